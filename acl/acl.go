@@ -0,0 +1,220 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package acl
+
+import (
+    "errors"
+    "github.com/xfali/gache/internal/utils"
+    "sort"
+    "sync"
+)
+
+const (
+    Read      = "read"
+    Write     = "write"
+    ReadWrite = "readwrite"
+
+    // 未认证的请求使用该用户名进行授权
+    Anonymous = "anonymous"
+    // 匹配全部命令
+    AllCommands = "*"
+)
+
+// Rule 允许执行Commands中的命令访问匹配Keys的key，Access限制读写
+type Rule struct {
+    Commands []string `json:"commands"`
+    Keys     []string `json:"keys"`
+    Access   string   `json:"access"`
+}
+
+type User struct {
+    Name  string `json:"name"`
+    Admin bool   `json:"admin"`
+    Rules []Rule `json:"rules"`
+}
+
+// Store ACL规则，作为GacheDb的一部分通过raft复制并写入快照。
+// 没有任何用户时不做限制
+type Store struct {
+    mu    sync.RWMutex
+    Users map[string]*User
+}
+
+func NewStore() *Store {
+    return &Store{Users: map[string]*User{}}
+}
+
+func (s *Store) Enabled() bool {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    return len(s.Users) > 0
+}
+
+func (u *User) Validate() error {
+    if u.Name == "" {
+        return errors.New("user name is empty")
+    }
+    for _, r := range u.Rules {
+        switch r.Access {
+        case Read, Write, ReadWrite:
+        default:
+            return errors.New("rule access must be read, write or readwrite")
+        }
+        if len(r.Commands) == 0 || len(r.Keys) == 0 {
+            return errors.New("rule commands and keys must not be empty")
+        }
+    }
+    return nil
+}
+
+func (s *Store) SetUser(u *User) error {
+    if err := u.Validate(); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    // 避免开启ACL后没有管理员可以修改规则
+    if !u.Admin && s.adminCount(u.Name) == 0 {
+        return errors.New("at least one admin user is required")
+    }
+    s.Users[u.Name] = u
+    return nil
+}
+
+func (s *Store) DelUser(name string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if _, ok := s.Users[name]; !ok {
+        return errors.New("user not found")
+    }
+    if len(s.Users) > 1 && s.adminCount(name) == 0 {
+        return errors.New("can not delete the last admin user")
+    }
+    delete(s.Users, name)
+    return nil
+}
+
+// 除exclude之外的管理员数量
+func (s *Store) adminCount(exclude string) int {
+    n := 0
+    for name, u := range s.Users {
+        if u.Admin && name != exclude {
+            n++
+        }
+    }
+    return n
+}
+
+func (s *Store) GetUser(name string) (User, bool) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    u, ok := s.Users[name]
+    if !ok {
+        return User{}, false
+    }
+    return *u, true
+}
+
+func (s *Store) ListUsers() []User {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    ret := make([]User, 0, len(s.Users))
+    for _, u := range s.Users {
+        ret = append(ret, *u)
+    }
+    sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+    return ret
+}
+
+func (s *Store) IsAdmin(user string) bool {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    if len(s.Users) == 0 {
+        return true
+    }
+    u, ok := s.Users[user]
+    return ok && u.Admin
+}
+
+// Allowed 判断user是否可以执行cmd访问key，write表示cmd是否为写命令
+func (s *Store) Allowed(user, cmd, key string, write bool) bool {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    if len(s.Users) == 0 {
+        return true
+    }
+    u, ok := s.Users[user]
+    if !ok {
+        return false
+    }
+    if u.Admin {
+        return true
+    }
+    for _, r := range u.Rules {
+        if r.allow(cmd, key, write) {
+            return true
+        }
+    }
+    return false
+}
+
+func (r *Rule) allow(cmd, key string, write bool) bool {
+    if write && r.Access == Read || !write && r.Access == Write {
+        return false
+    }
+    if !contains(r.Commands, cmd) && !contains(r.Commands, AllCommands) {
+        return false
+    }
+    for _, p := range r.Keys {
+        if utils.MatchGlob(p, key) {
+            return true
+        }
+    }
+    return false
+}
+
+func contains(list []string, s string) bool {
+    for _, v := range list {
+        if v == s {
+            return true
+        }
+    }
+    return false
+}
+
+func (s *Store) Copy() *Store {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    ret := NewStore()
+    for k, v := range s.Users {
+        u := *v
+        ret.Users[k] = &u
+    }
+    return ret
+}
+
+func (s *Store) Restore(other *Store) {
+    users := map[string]*User{}
+    if other != nil {
+        for k, v := range other.Users {
+            users[k] = v
+        }
+    }
+
+    s.mu.Lock()
+    s.Users = users
+    s.mu.Unlock()
+}
@@ -0,0 +1,163 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package acl
+
+import (
+    "testing"
+)
+
+func newTestStore(t *testing.T) *Store {
+    s := NewStore()
+    users := []*User{
+        {Name: "root", Admin: true},
+        {Name: "reader", Rules: []Rule{
+            {Commands: []string{AllCommands}, Keys: []string{"user:*"}, Access: Read},
+        }},
+        {Name: "writer", Rules: []Rule{
+            {Commands: []string{"SET", "DEL"}, Keys: []string{"user:?", "tmp"}, Access: Write},
+            {Commands: []string{"GET"}, Keys: []string{"*"}, Access: ReadWrite},
+        }},
+        {Name: Anonymous, Rules: []Rule{
+            {Commands: []string{"GET"}, Keys: []string{"public/*"}, Access: Read},
+        }},
+    }
+    for _, u := range users {
+        if err := s.SetUser(u); err != nil {
+            t.Fatal(err)
+        }
+    }
+    return s
+}
+
+func TestAllowed(t *testing.T) {
+    s := newTestStore(t)
+    cases := []struct {
+        user  string
+        cmd   string
+        key   string
+        write bool
+        allow bool
+    }{
+        {"root", "SET", "any", true, true},
+        {"root", "ACL_SETUSER", "x", true, true},
+        {"nobody", "GET", "user:1", false, false},
+        {"", "GET", "public/a", false, false},
+
+        {"reader", "GET", "user:1", false, true},
+        {"reader", "SUBSCRIBE", "user:chan", false, true},
+        {"reader", "SET", "user:1", true, false},
+        {"reader", "GET", "admin:1", false, false},
+
+        {"writer", "SET", "user:1", true, true},
+        {"writer", "SET", "user:10", true, false},
+        {"writer", "DEL", "tmp", true, true},
+        {"writer", "DEL", "tmp2", true, false},
+        {"writer", "CAS", "user:1", true, false},
+        {"writer", "GET", "anything", false, true},
+        // 写权限的规则不允许读命令
+        {"writer", "SET", "user:1", false, false},
+
+        {Anonymous, "GET", "public/a/b", false, true},
+        {Anonymous, "GET", "private", false, false},
+        {Anonymous, "SET", "public/a", true, false},
+    }
+    for _, c := range cases {
+        if got := s.Allowed(c.user, c.cmd, c.key, c.write); got != c.allow {
+            t.Errorf("%s %s %s write=%v: %v, want %v", c.user, c.cmd, c.key, c.write, got, c.allow)
+        }
+    }
+}
+
+func TestDisabled(t *testing.T) {
+    s := NewStore()
+    if s.Enabled() || !s.Allowed("nobody", "SET", "k", true) || !s.IsAdmin("nobody") {
+        t.Fatal("empty store must not restrict requests")
+    }
+}
+
+func TestIsAdmin(t *testing.T) {
+    s := newTestStore(t)
+    for user, admin := range map[string]bool{"root": true, "reader": false, "nobody": false} {
+        if s.IsAdmin(user) != admin {
+            t.Errorf("%s: %v", user, !admin)
+        }
+    }
+}
+
+func TestValidate(t *testing.T) {
+    cases := []struct {
+        name string
+        user User
+        ok   bool
+    }{
+        {"admin", User{Name: "a", Admin: true}, true},
+        {"rule", User{Name: "a", Rules: []Rule{{Commands: []string{"GET"}, Keys: []string{"*"}, Access: Read}}}, true},
+        {"no name", User{Admin: true}, false},
+        {"bad access", User{Name: "a", Rules: []Rule{{Commands: []string{"GET"}, Keys: []string{"*"}, Access: "all"}}}, false},
+        {"no commands", User{Name: "a", Rules: []Rule{{Keys: []string{"*"}, Access: Read}}}, false},
+        {"no keys", User{Name: "a", Rules: []Rule{{Commands: []string{"GET"}, Access: Read}}}, false},
+    }
+    for _, c := range cases {
+        if err := c.user.Validate(); (err == nil) != c.ok {
+            t.Errorf("%s: %v", c.name, err)
+        }
+    }
+}
+
+func TestAdminRequired(t *testing.T) {
+    s := NewStore()
+    if err := s.SetUser(&User{Name: "reader", Rules: []Rule{{Commands: []string{"GET"}, Keys: []string{"*"}, Access: Read}}}); err == nil {
+        t.Fatal("first user must be admin")
+    }
+    if err := s.SetUser(&User{Name: "root", Admin: true}); err != nil {
+        t.Fatal(err)
+    }
+    if err := s.SetUser(&User{Name: "reader", Rules: []Rule{{Commands: []string{"GET"}, Keys: []string{"*"}, Access: Read}}}); err != nil {
+        t.Fatal(err)
+    }
+    // 不能把唯一的管理员降级或删除
+    if err := s.SetUser(&User{Name: "root"}); err == nil {
+        t.Fatal("demote last admin")
+    }
+    if err := s.DelUser("root"); err == nil {
+        t.Fatal("delete last admin")
+    }
+    if err := s.DelUser("nobody"); err == nil {
+        t.Fatal("delete unknown user")
+    }
+    if err := s.DelUser("reader"); err != nil {
+        t.Fatal(err)
+    }
+    // 只剩管理员时可以删除，删除后不再限制
+    if err := s.DelUser("root"); err != nil {
+        t.Fatal(err)
+    }
+    if s.Enabled() {
+        t.Fatal("store still enabled")
+    }
+}
+
+func TestCopyRestore(t *testing.T) {
+    s := newTestStore(t)
+    c := s.Copy()
+    if err := s.DelUser("reader"); err != nil {
+        t.Fatal(err)
+    }
+    if _, ok := c.GetUser("reader"); !ok {
+        t.Fatal("copy changed with the store")
+    }
+
+    r := NewStore()
+    r.Restore(c)
+    if len(r.ListUsers()) != 4 || !r.Allowed("reader", "GET", "user:1", false) {
+        t.Fatalf("restore: %+v", r.ListUsers())
+    }
+    r.Restore(nil)
+    if r.Enabled() {
+        t.Fatal("restore nil")
+    }
+}
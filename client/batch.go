@@ -0,0 +1,97 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package client
+
+import (
+    "context"
+    "sync"
+)
+
+// MGet 并发读取多个key，全部成功时返回key到value的映射
+func (c *Client) MGet(ctx context.Context, keys []string) (map[string]string, error) {
+    ret := make(map[string]string, len(keys))
+    var mu sync.Mutex
+    err := c.parallel(ctx, len(keys), func(ctx context.Context, i int) error {
+        v, err := c.Get(ctx, keys[i])
+        if err != nil {
+            return err
+        }
+        mu.Lock()
+        ret[keys[i]] = v
+        mu.Unlock()
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return ret, nil
+}
+
+// MSet 并发写入多个key，返回第一个失败的错误（其他key可能已经写入）
+func (c *Client) MSet(ctx context.Context, kvs map[string]string) error {
+    keys := make([]string, 0, len(kvs))
+    for k := range kvs {
+        keys = append(keys, k)
+    }
+    return c.parallel(ctx, len(keys), func(ctx context.Context, i int) error {
+        return c.Set(ctx, keys[i], kvs[keys[i]])
+    })
+}
+
+// MDelete 并发删除多个key，返回第一个失败的错误
+func (c *Client) MDelete(ctx context.Context, keys []string) error {
+    return c.parallel(ctx, len(keys), func(ctx context.Context, i int) error {
+        return c.Delete(ctx, keys[i])
+    })
+}
+
+// 最多batchConcurrency个请求同时进行，出错时取消其余的请求
+func (c *Client) parallel(ctx context.Context, n int, f func(ctx context.Context, i int) error) error {
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    concurrency := c.opts.batchConcurrency
+    if concurrency <= 0 || concurrency > n {
+        concurrency = n
+    }
+    var (
+        wg    sync.WaitGroup
+        once  sync.Once
+        first error
+    )
+    ch := make(chan int)
+    for w := 0; w < concurrency; w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for i := range ch {
+                if err := f(ctx, i); err != nil {
+                    once.Do(func() {
+                        first = err
+                        cancel()
+                    })
+                }
+            }
+        }()
+    }
+    for i := 0; i < n; i++ {
+        select {
+        case ch <- i:
+        case <-ctx.Done():
+        }
+        if ctx.Err() != nil {
+            break
+        }
+    }
+    close(ch)
+    wg.Wait()
+
+    if first != nil {
+        return first
+    }
+    return ctx.Err()
+}
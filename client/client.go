@@ -0,0 +1,418 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package client
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "github.com/xfali/gache/internal/auth"
+    "github.com/xfali/gache/internal/utils"
+    "io/ioutil"
+    "net"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+const (
+    maxRedirects = 5
+    maxBackoff   = time.Second
+)
+
+const (
+    headerCas         = "X-Gache-Cas"
+    headerConsistency = "X-Gache-Consistency"
+    headerTimestamp   = "X-Gache-Timestamp"
+    headerSession     = "X-Gache-Session"
+)
+
+var (
+    ErrNoAddr           = errors.New("no address")
+    ErrTooManyRedirects = errors.New("too many redirects")
+)
+
+// StatusError 服务端返回的错误
+type StatusError struct {
+    Code int
+    Msg  string
+}
+
+func (e *StatusError) Error() string {
+    return fmt.Sprintf("%d %s: %s", e.Code, http.StatusText(e.Code), e.Msg)
+}
+
+// 分片的leader节点，与/cluster返回的格式一致
+type Node struct {
+    ApiAddr   string `json:"apiAddr,omitempty"`
+    Addr      string `json:"addr,omitempty"`
+    SlotBegin uint32 `json:"slotBegin,omitempty"`
+    SlotEnd   uint32 `json:"slotEnd,omitempty"`
+}
+
+func (n *Node) CheckSlot(slot uint32) bool {
+    return n.SlotBegin <= slot && slot <= n.SlotEnd
+}
+
+// Client 根据/cluster返回的分片分布在本地计算slot，把请求直接发送到对应的节点；
+// 收到307时跟随跳转并在下次请求前重新加载分片分布。可以在多个goroutine中使用
+type Client struct {
+    opts   *options
+    seeds  []string
+    http   *http.Client
+    scheme string
+
+    mu      sync.RWMutex
+    nodes   []Node
+    stale   bool
+    primary string
+
+    refreshMu sync.Mutex
+}
+
+// New addrs为任意几个节点的api地址，用于加载分片分布以及未启用分片时访问
+func New(addrs []string, opts ...Option) (*Client, error) {
+    o := defaultOptions()
+    for _, opt := range opts {
+        opt(o)
+    }
+    var seeds []string
+    for _, v := range addrs {
+        if v = strings.TrimSpace(v); v != "" {
+            seeds = append(seeds, v)
+        }
+    }
+    if len(seeds) == 0 {
+        return nil, ErrNoAddr
+    }
+
+    var hc http.Client
+    if o.httpClient != nil {
+        hc = *o.httpClient
+    } else {
+        hc = http.Client{
+            Timeout: o.timeout,
+            Transport: &http.Transport{
+                Proxy: http.ProxyFromEnvironment,
+                DialContext: (&net.Dialer{
+                    Timeout:   o.timeout,
+                    KeepAlive: 30 * time.Second,
+                }).DialContext,
+                TLSClientConfig:     o.tlsConfig,
+                MaxIdleConnsPerHost: o.maxIdleConns,
+                IdleConnTimeout:     90 * time.Second,
+                TLSHandshakeTimeout: 10 * time.Second,
+            },
+        }
+    }
+    // 跳转到其他节点时http.Client会丢弃Authorization，自己处理跳转
+    hc.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+        return http.ErrUseLastResponse
+    }
+
+    c := &Client{
+        opts:   o,
+        seeds:  seeds,
+        http:   &hc,
+        scheme: "http",
+        stale:  true,
+    }
+    if o.tlsConfig != nil {
+        c.scheme = "https"
+    }
+    return c, nil
+}
+
+func (c *Client) Get(ctx context.Context, key string) (string, error) {
+    var hdr http.Header
+    if c.opts.linearizable {
+        hdr = http.Header{headerConsistency: {"linearizable"}}
+    }
+    b, err := c.doKey(ctx, http.MethodGet, key, nil, hdr)
+    return string(b), err
+}
+
+func (c *Client) Set(ctx context.Context, key, value string) error {
+    _, err := c.doKey(ctx, http.MethodPut, key, []byte(value), nil)
+    return err
+}
+
+func (c *Client) Delete(ctx context.Context, key string) error {
+    _, err := c.doKey(ctx, http.MethodDelete, key, nil, nil)
+    return err
+}
+
+// SetAt 按last-writer-wins写入：key不存在或者最后修改时间早于ts时才写入，返回是否写入。
+// 修改时间相同时不写入，因此重试是幂等的，但重试前已经写入时同样返回false
+func (c *Client) SetAt(ctx context.Context, key, value string, ts time.Time) (bool, error) {
+    return c.doAt(ctx, http.MethodPut, key, []byte(value), ts)
+}
+
+// DeleteAt 按last-writer-wins删除，key不存在时返回true
+func (c *Client) DeleteAt(ctx context.Context, key string, ts time.Time) (bool, error) {
+    return c.doAt(ctx, http.MethodDelete, key, nil, ts)
+}
+
+func (c *Client) doAt(ctx context.Context, method, key string, body []byte, ts time.Time) (bool, error) {
+    hdr := http.Header{headerTimestamp: {strconv.FormatInt(ts.UnixNano(), 10)}}
+    _, err := c.doKey(ctx, method, key, body, hdr)
+    if se, ok := err.(*StatusError); ok && se.Code == http.StatusPreconditionFailed {
+        return false, nil
+    }
+    return err == nil, err
+}
+
+// CompareAndSwap 当前值（不存在时为空字符串）等于old时设置为value，返回是否设置。
+// CAS不是幂等的，leader切换等错误时不重试，返回错误时可能已经设置成功
+func (c *Client) CompareAndSwap(ctx context.Context, key, old, value string) (bool, error) {
+    c.refreshIfStale(ctx)
+    hdr := http.Header{headerCas: {old}}
+    _, err := c.send(ctx, http.MethodPut, c.route(key), keyPath(key), []byte(value), hdr)
+    if se, ok := err.(*StatusError); ok && se.Code == http.StatusPreconditionFailed {
+        return false, nil
+    }
+    return err == nil, err
+}
+
+// Publish 向频道发布消息，只发送给当前的订阅者。结果未知（504、超时）时不重试，返回错误时消息可能已经发布
+func (c *Client) Publish(ctx context.Context, channel, message string) error {
+    c.refreshIfStale(ctx)
+    _, err := c.retry(ctx, http.MethodPost, "/pubsub/"+url.PathEscape(channel), channel, []byte(message), nil)
+    return err
+}
+
+// Do 发送任意请求（如/status、/admin/下的接口），同样会跟随跳转和重试（POST只在请求没有执行时重试）
+func (c *Client) Do(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+    return c.retry(ctx, method, path, "", body, nil)
+}
+
+// Nodes 当前缓存的分片分布，未启用分片时为空
+func (c *Client) Nodes() []Node {
+    c.mu.RLock()
+    defer c.mu.RUnlock()
+
+    ret := make([]Node, len(c.nodes))
+    copy(ret, c.nodes)
+    return ret
+}
+
+// Refresh 重新加载分片分布
+func (c *Client) Refresh(ctx context.Context) error {
+    c.refreshMu.Lock()
+    defer c.refreshMu.Unlock()
+
+    b, err := c.send(ctx, http.MethodGet, c.route(""), "/cluster", nil, nil)
+    if err != nil {
+        return err
+    }
+    var nodes []Node
+    if err := json.Unmarshal(b, &nodes); err != nil {
+        return err
+    }
+    c.mu.Lock()
+    c.nodes = nodes
+    c.stale = false
+    c.mu.Unlock()
+    return nil
+}
+
+// Close 关闭空闲的连接
+func (c *Client) Close() {
+    c.http.CloseIdleConnections()
+}
+
+func (c *Client) doKey(ctx context.Context, method, key string, body []byte, hdr http.Header) ([]byte, error) {
+    c.refreshIfStale(ctx)
+    return c.retry(ctx, method, keyPath(key), key, body, hdr)
+}
+
+// key中的"/"、"?"、"%"等字符转义后作为路径，服务端解码后计算slot
+func keyPath(key string) string {
+    return "/key/" + url.PathEscape(key)
+}
+
+func (c *Client) refreshIfStale(ctx context.Context) {
+    c.mu.RLock()
+    stale := c.stale
+    c.mu.RUnlock()
+    if stale {
+        // 加载失败时仍然可以通过跳转访问到正确的节点
+        c.Refresh(ctx)
+    }
+}
+
+// leader切换或节点不可用时按指数退避（最多1s）重试。结果未知（504、超时）时只重试幂等的请求（GET、PUT、DELETE），
+// POST（入队、限流、加锁等）重复执行时结果不同，只在确定没有执行（503、连接失败）时重试
+func (c *Client) retry(ctx context.Context, method, path, key string, body []byte, hdr http.Header) ([]byte, error) {
+    backoff := c.opts.retryBackoff
+    for attempt := 0; ; attempt++ {
+        b, err := c.send(ctx, method, c.route(key), path, body, hdr)
+        if err == nil || attempt >= c.opts.maxRetries || !retryable(ctx, method, err) {
+            return b, err
+        }
+        c.invalidate()
+
+        t := time.NewTimer(backoff)
+        select {
+        case <-ctx.Done():
+            t.Stop()
+            return nil, ctx.Err()
+        case <-t.C:
+        }
+        if backoff *= 2; backoff > maxBackoff {
+            backoff = maxBackoff
+        }
+    }
+}
+
+func retryable(ctx context.Context, method string, err error) bool {
+    if ctx.Err() != nil {
+        return false
+    }
+    if unavailable(err) {
+        return true
+    }
+    if !idempotent(method) {
+        return false
+    }
+    if se, ok := err.(*StatusError); ok {
+        switch se.Code {
+        case http.StatusBadGateway, http.StatusGatewayTimeout, http.StatusInternalServerError:
+            return true
+        }
+        return false
+    }
+    // 超时等网络错误
+    _, ok := err.(net.Error)
+    return ok
+}
+
+func idempotent(method string) bool {
+    switch method {
+    case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+        return true
+    }
+    return false
+}
+
+func (c *Client) invalidate() {
+    c.mu.Lock()
+    c.stale = true
+    c.primary = ""
+    c.mu.Unlock()
+}
+
+// 返回依次尝试的地址：key所在分片的leader、上次跳转到的节点、seeds
+func (c *Client) route(key string) []string {
+    c.mu.RLock()
+    defer c.mu.RUnlock()
+
+    ret := make([]string, 0, len(c.seeds)+2)
+    if key != "" && len(c.nodes) > 0 {
+        slot := utils.CalcSlot(key)
+        for i := range c.nodes {
+            if c.nodes[i].CheckSlot(slot) && c.nodes[i].ApiAddr != "" {
+                ret = append(ret, c.nodes[i].ApiAddr)
+                break
+            }
+        }
+    } else if c.primary != "" {
+        ret = append(ret, c.primary)
+    }
+    return append(ret, c.seeds...)
+}
+
+// 依次尝试addrs直到有节点响应
+func (c *Client) send(ctx context.Context, method string, addrs []string, path string, body []byte, hdr http.Header) ([]byte, error) {
+    var lastErr error
+    for _, addr := range addrs {
+        b, err := c.follow(ctx, method, addr, path, body, hdr)
+        if err == nil {
+            return b, nil
+        }
+        // 节点不可达或暂时不能提供服务（如被隔离、不知道leader）时尝试下一个节点
+        if !unavailable(err) || ctx.Err() != nil {
+            return nil, err
+        }
+        lastErr = err
+    }
+    return nil, lastErr
+}
+
+// 503表示请求没有被执行，连接失败时请求没有发出，这两种情况换一个节点发送是安全的
+func unavailable(err error) bool {
+    if se, ok := err.(*StatusError); ok {
+        return se.Code == http.StatusServiceUnavailable
+    }
+    if ue, ok := err.(*url.Error); ok {
+        err = ue.Err
+    }
+    oe, ok := err.(*net.OpError)
+    return ok && oe.Op == "dial"
+}
+
+func (c *Client) follow(ctx context.Context, method, addr, path string, body []byte, hdr http.Header) ([]byte, error) {
+    redirected := false
+    for hop := 0; hop <= maxRedirects; hop++ {
+        req, err := http.NewRequest(method, c.scheme+"://"+addr+path, bytes.NewReader(body))
+        if err != nil {
+            return nil, fmt.Errorf("invalid request: %v", err)
+        }
+        req = req.WithContext(ctx)
+        for k, v := range hdr {
+            req.Header[k] = v
+        }
+        c.setAuth(req, body)
+        resp, err := c.http.Do(req)
+        if err != nil {
+            return nil, err
+        }
+        b, err := ioutil.ReadAll(resp.Body)
+        resp.Body.Close()
+        if err != nil {
+            return nil, err
+        }
+
+        switch {
+        case resp.StatusCode == http.StatusTemporaryRedirect:
+            loc, err := resp.Location()
+            if err != nil {
+                return nil, err
+            }
+            // 分片分布或leader发生了变化
+            c.mu.Lock()
+            c.stale = true
+            c.mu.Unlock()
+            addr = loc.Host
+            redirected = true
+        case resp.StatusCode >= 200 && resp.StatusCode < 300:
+            if redirected {
+                c.mu.Lock()
+                c.primary = addr
+                c.mu.Unlock()
+            }
+            return b, nil
+        default:
+            return nil, &StatusError{Code: resp.StatusCode, Msg: strings.TrimSpace(string(b))}
+        }
+    }
+    return nil, ErrTooManyRedirects
+}
+
+func (c *Client) setAuth(req *http.Request, body []byte) {
+    switch {
+    case c.opts.token != "":
+        req.Header.Set("Authorization", "Bearer "+c.opts.token)
+    case c.opts.hmacUser != "":
+        auth.SignRequest(req, c.opts.hmacUser, c.opts.hmacKey, body)
+    }
+}
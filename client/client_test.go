@@ -0,0 +1,92 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package client
+
+import (
+    "context"
+    "errors"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "sync/atomic"
+    "testing"
+)
+
+func TestKeyPath(t *testing.T) {
+    for _, key := range []string{"foo", "a b", "x?y", "p%q", "svc/api/node1", "a#b", "键"} {
+        u, err := url.Parse("http://127.0.0.1" + keyPath(key))
+        if err != nil {
+            t.Fatalf("%q: %v", key, err)
+        }
+        if u.RawQuery != "" || u.Fragment != "" {
+            t.Fatalf("%q: query %q fragment %q", key, u.RawQuery, u.Fragment)
+        }
+        if got, _ := url.PathUnescape(u.EscapedPath()[len("/key/"):]); got != key {
+            t.Fatalf("%q: decoded %q", key, got)
+        }
+    }
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestRetryable(t *testing.T) {
+    dial := &url.Error{Op: "Post", Err: &net.OpError{Op: "dial", Err: errors.New("refused")}}
+    cases := []struct {
+        method string
+        err    error
+        want   bool
+    }{
+        {http.MethodPost, &StatusError{Code: http.StatusServiceUnavailable}, true},
+        {http.MethodPost, dial, true},
+        {http.MethodPost, &StatusError{Code: http.StatusGatewayTimeout}, false},
+        {http.MethodPost, timeoutError{}, false},
+        {http.MethodPut, &StatusError{Code: http.StatusGatewayTimeout}, true},
+        {http.MethodGet, timeoutError{}, true},
+        {http.MethodDelete, &StatusError{Code: http.StatusInternalServerError}, true},
+        {http.MethodGet, &StatusError{Code: http.StatusBadRequest}, false},
+        {http.MethodPut, &StatusError{Code: http.StatusConflict}, false},
+    }
+    for _, c := range cases {
+        if got := retryable(context.Background(), c.method, c.err); got != c.want {
+            t.Errorf("%s %v: %v, want %v", c.method, c.err, got, c.want)
+        }
+    }
+}
+
+// 结果未知时POST只发送一次，PUT重试
+func TestRetryIdempotent(t *testing.T) {
+    var posts, puts int32
+    srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+        if req.Method == http.MethodPost {
+            atomic.AddInt32(&posts, 1)
+        } else {
+            atomic.AddInt32(&puts, 1)
+        }
+        resp.WriteHeader(http.StatusGatewayTimeout)
+    }))
+    defer srv.Close()
+
+    c, err := New([]string{srv.Listener.Addr().String()}, WithRetry(3, 0))
+    if err != nil {
+        t.Fatal(err)
+    }
+    c.stale = false
+    if _, err := c.retry(context.Background(), http.MethodPost, "/queue/q", "q", nil, nil); err == nil {
+        t.Fatal("want error")
+    }
+    if _, err := c.retry(context.Background(), http.MethodPut, keyPath("k"), "k", nil, nil); err == nil {
+        t.Fatal("want error")
+    }
+    if p, u := atomic.LoadInt32(&posts), atomic.LoadInt32(&puts); p != 1 || u != 4 {
+        t.Fatalf("posts %d, puts %d", p, u)
+    }
+}
@@ -0,0 +1,91 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package client
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/url"
+    "strconv"
+    "time"
+)
+
+var (
+    // 等待超时时锁仍然被其他持有者持有
+    ErrLockHeld = errors.New("lock held by another owner")
+    // 锁已经过期或者被其他持有者获得
+    ErrLockLost = errors.New("lock not held")
+)
+
+// Lock 持有的分布式锁。Token单调递增，访问下游系统时带上Token，下游拒绝小于已见过的Token的请求，
+// 避免锁过期后的旧持有者继续写入
+type Lock struct {
+    Name   string    `json:"name"`
+    Owner  string    `json:"owner"`
+    Token  uint64    `json:"token"`
+    Expire time.Time `json:"expire"`
+}
+
+// Lock 获取锁，有效期为ttl，被其他持有者持有时最多等待wait，超时返回ErrLockHeld。
+// 同一个owner重复获取时延长有效期并返回相同的Token，因此可以安全地重试
+func (c *Client) Lock(ctx context.Context, name, owner string, ttl, wait time.Duration) (*Lock, error) {
+    deadline := time.Now().Add(wait)
+    for {
+        // 每次请求等待的时间不超过请求超时
+        w := time.Until(deadline)
+        if w < 0 {
+            w = 0
+        }
+        if c.opts.timeout > 0 && w > c.opts.timeout/2 {
+            w = c.opts.timeout / 2
+        }
+        query := url.Values{"owner": {owner}, "ttl": {ttl.String()}, "wait": {w.String()}}
+        l, err := c.lockRequest(ctx, http.MethodPost, name, query)
+        if err != ErrLockLost || !time.Now().Before(deadline) {
+            if err == ErrLockLost {
+                err = ErrLockHeld
+            }
+            return l, err
+        }
+    }
+}
+
+// RefreshLock 把锁的有效期延长为从现在开始的ttl，锁已经丢失时返回ErrLockLost
+func (c *Client) RefreshLock(ctx context.Context, l *Lock, ttl time.Duration) error {
+    query := url.Values{"owner": {l.Owner}, "token": {strconv.FormatUint(l.Token, 10)}, "ttl": {ttl.String()}}
+    ret, err := c.lockRequest(ctx, http.MethodPut, l.Name, query)
+    if err != nil {
+        return err
+    }
+    l.Expire = ret.Expire
+    return nil
+}
+
+// Unlock 释放锁，锁已经过期或者被其他持有者获得时返回ErrLockLost
+func (c *Client) Unlock(ctx context.Context, l *Lock) error {
+    query := url.Values{"owner": {l.Owner}, "token": {strconv.FormatUint(l.Token, 10)}}
+    _, err := c.lockRequest(ctx, http.MethodDelete, l.Name, query)
+    return err
+}
+
+func (c *Client) lockRequest(ctx context.Context, method, name string, query url.Values) (*Lock, error) {
+    c.refreshIfStale(ctx)
+    b, err := c.retry(ctx, method, "/lock/"+url.PathEscape(name)+"?"+query.Encode(), name, nil, nil)
+    if se, ok := err.(*StatusError); ok && se.Code == http.StatusConflict {
+        return nil, ErrLockLost
+    }
+    if err != nil || method == http.MethodDelete {
+        return nil, err
+    }
+    l := &Lock{}
+    if err := json.Unmarshal(b, l); err != nil {
+        return nil, err
+    }
+    return l, nil
+}
@@ -0,0 +1,114 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package client
+
+import (
+    "crypto/tls"
+    "net/http"
+    "time"
+)
+
+const (
+    DefaultTimeout          = 10 * time.Second
+    DefaultMaxRetries       = 8
+    DefaultRetryBackoff     = 100 * time.Millisecond
+    DefaultMaxIdleConns     = 64
+    DefaultBatchConcurrency = 16
+)
+
+type options struct {
+    timeout          time.Duration
+    maxRetries       int
+    retryBackoff     time.Duration
+    maxIdleConns     int
+    batchConcurrency int
+    linearizable     bool
+
+    token    string
+    hmacUser string
+    hmacKey  string
+
+    tlsConfig  *tls.Config
+    httpClient *http.Client
+}
+
+type Option func(o *options)
+
+func defaultOptions() *options {
+    return &options{
+        timeout:          DefaultTimeout,
+        maxRetries:       DefaultMaxRetries,
+        retryBackoff:     DefaultRetryBackoff,
+        maxIdleConns:     DefaultMaxIdleConns,
+        batchConcurrency: DefaultBatchConcurrency,
+    }
+}
+
+// 单个HTTP请求的超时时间
+func WithTimeout(d time.Duration) Option {
+    return func(o *options) {
+        o.timeout = d
+    }
+}
+
+// leader切换、节点不可用时的重试次数，重试间隔从backoff开始倍增，最多1s
+func WithRetry(maxRetries int, backoff time.Duration) Option {
+    return func(o *options) {
+        o.maxRetries = maxRetries
+        o.retryBackoff = backoff
+    }
+}
+
+// 每个节点保持的空闲连接数
+func WithMaxIdleConns(n int) Option {
+    return func(o *options) {
+        o.maxIdleConns = n
+    }
+}
+
+// 批量操作时的最大并发请求数
+func WithBatchConcurrency(n int) Option {
+    return func(o *options) {
+        o.batchConcurrency = n
+    }
+}
+
+// 在leader上读取并等待之前提交的写入生效，读到的总是最新的数据（默认可以从follower读到旧数据）
+func WithLinearizableReads() Option {
+    return func(o *options) {
+        o.linearizable = true
+    }
+}
+
+// 使用Bearer token认证
+func WithToken(token string) Option {
+    return func(o *options) {
+        o.token = token
+    }
+}
+
+// 使用HMAC签名认证
+func WithHmac(user, key string) Option {
+    return func(o *options) {
+        o.hmacUser = user
+        o.hmacKey = key
+    }
+}
+
+// 使用https访问，可以携带客户端证书
+func WithTLS(conf *tls.Config) Option {
+    return func(o *options) {
+        o.tlsConfig = conf
+    }
+}
+
+// 使用自定义的http.Client，连接池、超时和TLS由调用方设置（访问https时仍需要WithTLS）
+func WithHTTPClient(c *http.Client) Option {
+    return func(o *options) {
+        o.httpClient = c
+    }
+}
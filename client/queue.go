@@ -0,0 +1,102 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package client
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/url"
+    "strconv"
+    "time"
+)
+
+// 可见性超时后回执失效，消息可能已经投递给其他消费者
+var ErrReceiptExpired = errors.New("receipt expired")
+
+type QueueMessage struct {
+    Queue      string    `json:"-"`
+    ID         uint64    `json:"id"`
+    Body       string    `json:"body"`
+    Enqueued   time.Time `json:"enqueued"`
+    Deliveries int       `json:"deliveries"`
+    // ACK、NACK时使用
+    Receipt uint64 `json:"receipt"`
+}
+
+// Enqueue 入队，返回消息id。与Publish相同，结果未知时不重试，返回错误时消息可能已经入队
+func (c *Client) Enqueue(ctx context.Context, queue, body string) (uint64, error) {
+    c.refreshIfStale(ctx)
+    b, err := c.retry(ctx, http.MethodPost, "/queue/"+url.PathEscape(queue), queue, []byte(body), nil)
+    if err != nil {
+        return 0, err
+    }
+    ret := struct {
+        ID uint64 `json:"id"`
+    }{}
+    err = json.Unmarshal(b, &ret)
+    return ret.ID, err
+}
+
+// Dequeue 出队，消息在visibility内对其他消费者不可见，为0时使用服务端的queue-visibility-timeout。
+// 没有消息时最多等待wait，超时返回nil。visibility内没有Ack的消息会重新投递，消费者需要能够处理重复的消息
+func (c *Client) Dequeue(ctx context.Context, queue string, visibility, wait time.Duration) (*QueueMessage, error) {
+    c.refreshIfStale(ctx)
+    deadline := time.Now().Add(wait)
+    for {
+        // 每次请求等待的时间不超过请求超时
+        w := time.Until(deadline)
+        if w < 0 {
+            w = 0
+        }
+        if c.opts.timeout > 0 && w > c.opts.timeout/2 {
+            w = c.opts.timeout / 2
+        }
+        query := url.Values{"wait": {w.String()}}
+        if visibility > 0 {
+            query.Set("visibility", visibility.String())
+        }
+        b, err := c.retry(ctx, http.MethodGet, "/queue/"+url.PathEscape(queue)+"?"+query.Encode(), queue, nil, nil)
+        if err != nil {
+            return nil, err
+        }
+        if len(b) > 0 {
+            m := &QueueMessage{Queue: queue}
+            if err := json.Unmarshal(b, m); err != nil {
+                return nil, err
+            }
+            return m, nil
+        }
+        if !time.Now().Before(deadline) {
+            return nil, nil
+        }
+    }
+}
+
+// Ack 确认处理完成，删除消息
+func (c *Client) Ack(ctx context.Context, m *QueueMessage) error {
+    return c.settle(ctx, m, "ack", nil)
+}
+
+// Nack 处理失败，消息在delay之后重新投递，投递次数达到上限时移到死信
+func (c *Client) Nack(ctx context.Context, m *QueueMessage, delay time.Duration) error {
+    return c.settle(ctx, m, "nack", url.Values{"delay": {delay.String()}})
+}
+
+func (c *Client) settle(ctx context.Context, m *QueueMessage, action string, query url.Values) error {
+    if query == nil {
+        query = url.Values{}
+    }
+    query.Set("receipt", strconv.FormatUint(m.Receipt, 10))
+    c.refreshIfStale(ctx)
+    _, err := c.retry(ctx, http.MethodPost, "/queue/"+url.PathEscape(m.Queue)+"/"+action+"?"+query.Encode(), m.Queue, nil, nil)
+    if se, ok := err.(*StatusError); ok && se.Code == http.StatusConflict {
+        return ErrReceiptExpired
+    }
+    return err
+}
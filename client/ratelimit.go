@@ -0,0 +1,66 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package client
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/url"
+    "strconv"
+    "time"
+)
+
+const (
+    // 令牌桶，每period/limit恢复一个配额，最多limit个
+    TokenBucket = "token-bucket"
+    // 滑动窗口，任意period内最多limit个配额
+    SlidingWindow = "sliding-window"
+)
+
+type RateLimit struct {
+    Allowed   bool      `json:"allowed"`
+    Limit     int64     `json:"limit"`
+    Remaining int64     `json:"remaining"`
+    Reset     time.Time `json:"reset"`
+    // 拒绝时等待多久之后可以通过
+    RetryAfter time.Duration `json:"-"`
+}
+
+// RateLimit 消耗限流器name的cost个配额，每period最多limit个，拒绝时不消耗配额。
+// 与Publish相同，结果未知时不重试，返回错误时配额可能已经消耗
+func (c *Client) RateLimit(ctx context.Context, name, algorithm string, limit int64, period time.Duration, cost int64) (*RateLimit, error) {
+    query := url.Values{
+        "algorithm": {algorithm},
+        "limit":     {strconv.FormatInt(limit, 10)},
+        "period":    {period.String()},
+        "cost":      {strconv.FormatInt(cost, 10)},
+    }
+    c.refreshIfStale(ctx)
+    b, err := c.retry(ctx, http.MethodPost, "/ratelimit/"+url.PathEscape(name)+"?"+query.Encode(), name, nil, nil)
+    if err != nil {
+        return nil, err
+    }
+    ret := struct {
+        RateLimit
+        RetryAfter string `json:"retryAfter"`
+    }{}
+    if err := json.Unmarshal(b, &ret); err != nil {
+        return nil, err
+    }
+    if ret.RetryAfter != "" {
+        ret.RateLimit.RetryAfter, _ = time.ParseDuration(ret.RetryAfter)
+    }
+    return &ret.RateLimit, nil
+}
+
+// ResetRateLimit 重置限流器
+func (c *Client) ResetRateLimit(ctx context.Context, name string) error {
+    c.refreshIfStale(ctx)
+    _, err := c.retry(ctx, http.MethodDelete, "/ratelimit/"+url.PathEscape(name), name, nil, nil)
+    return err
+}
@@ -0,0 +1,120 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package client
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "sync"
+    "time"
+)
+
+// 会话已经过期被删除
+var ErrSessionExpired = errors.New("session expired")
+
+// Session 客户端会话，创建后在后台每ttl/3发送一次心跳，停止心跳超过ttl后服务端删除会话以及绑定的临时key
+type Session struct {
+    ID  string
+    TTL time.Duration
+
+    c      *Client
+    cancel context.CancelFunc
+    done   chan struct{}
+    mu     sync.Mutex
+    err    error
+}
+
+// NewSession 创建会话并开始发送心跳。分片集群中会话只在一个分片上，临时key需要属于同一个分片
+func (c *Client) NewSession(ctx context.Context, ttl time.Duration) (*Session, error) {
+    // 创建不是幂等的，不重试
+    b, err := c.send(ctx, http.MethodPost, c.route(""), "/session?ttl="+ttl.String(), nil, nil)
+    if err != nil {
+        return nil, err
+    }
+    info := struct {
+        ID string `json:"id"`
+    }{}
+    if err := json.Unmarshal(b, &info); err != nil {
+        return nil, err
+    }
+    hctx, cancel := context.WithCancel(context.Background())
+    s := &Session{
+        ID:     info.ID,
+        TTL:    ttl,
+        c:      c,
+        cancel: cancel,
+        done:   make(chan struct{}),
+    }
+    go s.heartbeat(hctx)
+    return s, nil
+}
+
+func (s *Session) heartbeat(ctx context.Context) {
+    ticker := time.NewTicker(s.TTL / 3)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ticker.C:
+            // 失败时等待下一次心跳，会话已经删除时停止
+            if err := s.KeepAlive(ctx); err == ErrSessionExpired {
+                s.finish(err)
+                return
+            }
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+func (s *Session) finish(err error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.err == nil {
+        s.err = err
+        close(s.done)
+    }
+}
+
+// KeepAlive 立即发送一次心跳
+func (s *Session) KeepAlive(ctx context.Context) error {
+    _, err := s.c.retry(ctx, http.MethodPut, "/session/"+s.ID, "", nil, nil)
+    if se, ok := err.(*StatusError); ok && se.Code == http.StatusNotFound {
+        return ErrSessionExpired
+    }
+    return err
+}
+
+// Done 会话过期或者关闭后关闭
+func (s *Session) Done() <-chan struct{} {
+    return s.done
+}
+
+// Err Done关闭后返回原因：ErrSessionExpired或者context.Canceled（调用了Close）
+func (s *Session) Err() error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.err
+}
+
+// Close 停止心跳并关闭会话，服务端删除绑定的临时key
+func (s *Session) Close(ctx context.Context) error {
+    s.cancel()
+    s.finish(context.Canceled)
+    _, err := s.c.retry(ctx, http.MethodDelete, "/session/"+s.ID, "", nil, nil)
+    if se, ok := err.(*StatusError); ok && se.Code == http.StatusNotFound {
+        return ErrSessionExpired
+    }
+    return err
+}
+
+// SetEphemeral 写入绑定到会话的临时key，会话删除后key同时删除。之后使用Set写入同一个key时解除绑定
+func (c *Client) SetEphemeral(ctx context.Context, s *Session, key, value string) error {
+    _, err := c.doKey(ctx, http.MethodPut, key, []byte(value), http.Header{headerSession: {s.ID}})
+    return err
+}
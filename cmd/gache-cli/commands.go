@@ -0,0 +1,231 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "github.com/xfali/gache/client"
+    "github.com/xfali/gache/internal/cluster"
+    "github.com/xfali/gache/internal/handler"
+    "io"
+    "net/http"
+    "strings"
+    "text/tabwriter"
+    "time"
+)
+
+const raftUsage = "raft peers | raft add ID ADDR [API_ADDR] | raft remove ID"
+
+type command struct {
+    name  string
+    usage string
+    desc  string
+    min   int
+    max   int
+    f     func(c *cli, out *output, args []string) error
+}
+
+type cli struct {
+    *client.Client
+    ctx        context.Context
+    joinSecret string
+}
+
+var commands = []*command{
+    {"get", "get KEY", "get the value of KEY", 1, 1, cmdGet},
+    {"set", "set KEY VALUE", "set KEY to VALUE", 2, 2, cmdSet},
+    {"del", "del KEY", "delete KEY", 1, 1, cmdDel},
+    {"cluster", "cluster", "show the slot map of the cluster", 0, 0, cmdCluster},
+    {"status", "status", "show the status of the node", 0, 0, cmdStatus},
+    {"raft", raftUsage, "manage raft membership", 1, 4, cmdRaft},
+}
+
+func findCommand(name string) *command {
+    for _, c := range commands {
+        if c.name == name {
+            return c
+        }
+    }
+    return nil
+}
+
+func execute(c *cli, out *output, args []string) error {
+    name := strings.ToLower(args[0])
+    if name == "help" {
+        printHelp(out.w)
+        return nil
+    }
+    cmd := findCommand(name)
+    if cmd == nil {
+        return fmt.Errorf("unknown command %q, try help", args[0])
+    }
+    args = args[1:]
+    if len(args) < cmd.min || len(args) > cmd.max {
+        return errors.New("usage: " + cmd.usage)
+    }
+    return cmd.f(c, out, args)
+}
+
+func printHelp(w io.Writer) {
+    tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+    for _, c := range commands {
+        fmt.Fprintf(tw, "  %s\t%s\n", c.usage, c.desc)
+    }
+    fmt.Fprintf(tw, "  %s\t%s\n", "help", "show this help")
+    tw.Flush()
+}
+
+// output 按raw或json格式输出结果
+type output struct {
+    w    io.Writer
+    json bool
+}
+
+func (o *output) print(v interface{}, raw func(w io.Writer)) {
+    if o.json {
+        b, _ := json.MarshalIndent(v, "", "  ")
+        fmt.Fprintln(o.w, string(b))
+        return
+    }
+    raw(o.w)
+}
+
+func (o *output) ok() {
+    o.print(map[string]string{"result": "OK"}, func(w io.Writer) {
+        fmt.Fprintln(w, "OK")
+    })
+}
+
+func cmdGet(c *cli, out *output, args []string) error {
+    v, err := c.Get(c.ctx, args[0])
+    if err != nil {
+        return err
+    }
+    out.print(map[string]string{"key": args[0], "value": v}, func(w io.Writer) {
+        fmt.Fprintln(w, v)
+    })
+    return nil
+}
+
+func cmdSet(c *cli, out *output, args []string) error {
+    if err := c.Set(c.ctx, args[0], args[1]); err != nil {
+        return err
+    }
+    out.ok()
+    return nil
+}
+
+func cmdDel(c *cli, out *output, args []string) error {
+    if err := c.Delete(c.ctx, args[0]); err != nil {
+        return err
+    }
+    out.ok()
+    return nil
+}
+
+func cmdCluster(c *cli, out *output, args []string) error {
+    if err := c.Refresh(c.ctx); err != nil {
+        return err
+    }
+    nodes := c.Nodes()
+    out.print(nodes, func(w io.Writer) {
+        if len(nodes) == 0 {
+            fmt.Fprintln(w, "cluster is not enabled")
+            return
+        }
+        tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+        fmt.Fprintln(tw, "SLOTS\tAPI\tGOSSIP")
+        for _, n := range nodes {
+            fmt.Fprintf(tw, "%d-%d\t%s\t%s\n", n.SlotBegin, n.SlotEnd, n.ApiAddr, n.Addr)
+        }
+        tw.Flush()
+    })
+    return nil
+}
+
+func cmdStatus(c *cli, out *output, args []string) error {
+    b, err := c.Do(c.ctx, http.MethodGet, "/status", nil)
+    if err != nil {
+        return err
+    }
+    s := handler.Status{}
+    if err := json.Unmarshal(b, &s); err != nil {
+        return err
+    }
+    out.print(&s, func(w io.Writer) {
+        tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+        fmt.Fprintf(tw, "leader:\t%v\n", s.Leader)
+        fmt.Fprintf(tw, "keys:\t%d\n", s.Keys)
+        if s.Raft != nil {
+            fmt.Fprintf(tw, "raft id:\t%s\n", s.Raft.ID)
+            fmt.Fprintf(tw, "raft state:\t%s\n", s.Raft.State)
+            fmt.Fprintf(tw, "raft leader:\t%s\n", s.Raft.Leader)
+            fmt.Fprintf(tw, "raft term:\t%d\n", s.Raft.Term)
+            fmt.Fprintf(tw, "raft commit/applied/last:\t%d/%d/%d\n", s.Raft.CommitIndex, s.Raft.AppliedIndex, s.Raft.LastIndex)
+        }
+        if s.ClusterEnabled {
+            fmt.Fprintf(tw, "slots:\t%s\n", s.Slots)
+            fmt.Fprintf(tw, "cluster state:\t%s\n", s.ClusterState)
+            fmt.Fprintf(tw, "cluster nodes:\t%d\n", len(s.Nodes))
+        }
+        tw.Flush()
+    })
+    return nil
+}
+
+func cmdRaft(c *cli, out *output, args []string) error {
+    switch strings.ToLower(args[0]) {
+    case "peers":
+        b, err := c.Do(c.ctx, http.MethodGet, "/admin/raft/peers", nil)
+        if err != nil {
+            return err
+        }
+        var peers []cluster.RaftPeer
+        if err := json.Unmarshal(b, &peers); err != nil {
+            return err
+        }
+        out.print(peers, func(w io.Writer) {
+            tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+            fmt.Fprintln(tw, "ID\tADDR\tAPI\tSUFFRAGE\tLEADER")
+            for _, p := range peers {
+                fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%v\n", p.ID, p.Addr, p.ApiAddr, p.Suffrage, p.Leader)
+            }
+            tw.Flush()
+        })
+        return nil
+    case "add":
+        if len(args) < 3 {
+            return errors.New("usage: raft add ID ADDR [API_ADDR]")
+        }
+        jr := cluster.JoinRequest{ID: args[1], Addr: args[2], Ts: time.Now().Unix()}
+        if len(args) > 3 {
+            jr.ApiAddr = args[3]
+        }
+        if c.joinSecret != "" {
+            jr.Sign(c.joinSecret)
+        }
+        b, _ := json.Marshal(&jr)
+        if _, err := c.Do(c.ctx, http.MethodPost, "/join", b); err != nil {
+            return err
+        }
+        out.ok()
+        return nil
+    case "remove":
+        if len(args) != 2 {
+            return errors.New("usage: raft remove ID")
+        }
+        if _, err := c.Do(c.ctx, http.MethodDelete, "/admin/raft/peers/"+args[1], nil); err != nil {
+            return err
+        }
+        out.ok()
+        return nil
+    }
+    return errors.New("usage: " + raftUsage)
+}
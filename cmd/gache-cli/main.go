@@ -0,0 +1,181 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package main
+
+import (
+    "bufio"
+    "context"
+    "crypto/tls"
+    "crypto/x509"
+    "errors"
+    "flag"
+    "fmt"
+    "github.com/xfali/gache/client"
+    "io"
+    "io/ioutil"
+    "os"
+    "strings"
+)
+
+func main() {
+    addrs := flag.String("addr", "127.0.0.1:8000", "api address of gache nodes: HOST1:PORT1,HOST2:PORT2")
+    format := flag.String("format", "raw", "output format: raw, json")
+    timeout := flag.Duration("timeout", client.DefaultTimeout, "request timeout")
+    retries := flag.Int("retries", client.DefaultMaxRetries, "retries on leader change or node failure")
+    token := flag.String("token", os.Getenv("GACHE_TOKEN"), "bearer token")
+    hmacUser := flag.String("hmac-user", "", "user name of HMAC signature")
+    hmacKey := flag.String("hmac-key", os.Getenv("GACHE_HMAC_KEY"), "key of HMAC signature")
+    tlsCA := flag.String("tls-ca", "", "CA certificate to verify the server")
+    tlsCert := flag.String("tls-cert", "", "client certificate")
+    tlsKey := flag.String("tls-key", "", "client private key")
+    joinSecret := flag.String("join-secret", os.Getenv("GACHE_RAFT_JOIN_SECRET"), "raft join secret, used by raft add")
+    flag.Usage = func() {
+        fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command [args...]]\n\nCommands:\n", os.Args[0])
+        printHelp(flag.CommandLine.Output())
+        fmt.Fprintln(flag.CommandLine.Output(), "\nFlags:")
+        flag.PrintDefaults()
+    }
+    flag.Parse()
+
+    if *format != "raw" && *format != "json" {
+        flag.Usage()
+        os.Exit(2)
+    }
+
+    opts := []client.Option{
+        client.WithTimeout(*timeout),
+        client.WithRetry(*retries, client.DefaultRetryBackoff),
+        client.WithToken(*token),
+    }
+    if *hmacUser != "" {
+        opts = append(opts, client.WithHmac(*hmacUser, *hmacKey))
+    }
+    if *tlsCA != "" || *tlsCert != "" {
+        tlsConf, err := loadTLS(*tlsCA, *tlsCert, *tlsKey)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(1)
+        }
+        opts = append(opts, client.WithTLS(tlsConf))
+    }
+    cc, err := client.New(strings.Split(*addrs, ","), opts...)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(1)
+    }
+    c := &cli{Client: cc, ctx: context.Background(), joinSecret: *joinSecret}
+    out := &output{w: os.Stdout, json: *format == "json"}
+
+    // 带命令参数时只执行一次
+    if flag.NArg() > 0 {
+        if err := execute(c, out, flag.Args()); err != nil {
+            fmt.Fprintln(os.Stderr, "(error)", err)
+            os.Exit(1)
+        }
+        return
+    }
+    repl(c, out, strings.Split(*addrs, ",")[0], os.Stdin)
+}
+
+func repl(c *cli, out *output, addr string, in io.Reader) {
+    interactive := false
+    if f, ok := in.(*os.File); ok {
+        if fi, err := f.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+            interactive = true
+        }
+    }
+    prompt := func() {
+        if interactive {
+            fmt.Fprintf(out.w, "%s> ", addr)
+        }
+    }
+
+    scanner := bufio.NewScanner(in)
+    for prompt(); scanner.Scan(); prompt() {
+        args, err := splitArgs(scanner.Text())
+        if err != nil {
+            fmt.Fprintln(out.w, "(error)", err)
+            continue
+        }
+        if len(args) == 0 {
+            continue
+        }
+        switch strings.ToLower(args[0]) {
+        case "quit", "exit":
+            return
+        }
+        if err := execute(c, out, args); err != nil {
+            fmt.Fprintln(out.w, "(error)", err)
+        }
+    }
+}
+
+func loadTLS(ca, cert, key string) (*tls.Config, error) {
+    ret := &tls.Config{MinVersion: tls.VersionTLS12}
+    if ca != "" {
+        b, err := ioutil.ReadFile(ca)
+        if err != nil {
+            return nil, err
+        }
+        pool := x509.NewCertPool()
+        if !pool.AppendCertsFromPEM(b) {
+            return nil, errors.New("no certificate found in " + ca)
+        }
+        ret.RootCAs = pool
+    }
+    if cert != "" {
+        c, err := tls.LoadX509KeyPair(cert, key)
+        if err != nil {
+            return nil, err
+        }
+        ret.Certificates = []tls.Certificate{c}
+    }
+    return ret, nil
+}
+
+// 按空白分割命令行，支持单引号、双引号及双引号内的\转义
+func splitArgs(line string) ([]string, error) {
+    var args []string
+    var cur strings.Builder
+    inArg := false
+    var quote rune
+    escaped := false
+    for _, r := range line {
+        switch {
+        case escaped:
+            cur.WriteRune(r)
+            escaped = false
+        case quote != 0:
+            if r == quote {
+                quote = 0
+            } else if r == '\\' && quote == '"' {
+                escaped = true
+            } else {
+                cur.WriteRune(r)
+            }
+        case r == '"' || r == '\'':
+            quote = r
+            inArg = true
+        case r == ' ' || r == '\t':
+            if inArg {
+                args = append(args, cur.String())
+                cur.Reset()
+                inArg = false
+            }
+        default:
+            cur.WriteRune(r)
+            inArg = true
+        }
+    }
+    if quote != 0 || escaped {
+        return nil, errors.New("unbalanced quotes")
+    }
+    if inArg {
+        args = append(args, cur.String())
+    }
+    return args, nil
+}
@@ -0,0 +1,184 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "github.com/xfali/gache/client"
+    "github.com/xfali/gache/internal/cluster"
+    "github.com/xfali/gache/internal/handler"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "reflect"
+    "strings"
+    "sync"
+    "testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+    cases := []struct {
+        line string
+        args []string
+        err  bool
+    }{
+        {"", nil, false},
+        {"  get   k  ", []string{"get", "k"}, false},
+        {"set k \"a b\"", []string{"set", "k", "a b"}, false},
+        {"set k 'a \"b\"'", []string{"set", "k", `a "b"`}, false},
+        {`set k "a \"b\" \\c"`, []string{"set", "k", `a "b" \c`}, false},
+        {`set k 'a\b'`, []string{"set", "k", `a\b`}, false},
+        {"set k \"\"", []string{"set", "k", ""}, false},
+        {"set\tk\tv", []string{"set", "k", "v"}, false},
+        {"set k \"v", nil, true},
+        {"set k 'v", nil, true},
+    }
+    for _, c := range cases {
+        args, err := splitArgs(c.line)
+        if (err != nil) != c.err || !reflect.DeepEqual(args, c.args) {
+            t.Errorf("%q: %q %v, want %q", c.line, args, err, c.args)
+        }
+    }
+}
+
+// 模拟单个节点的API
+type fakeNode struct {
+    mu   sync.Mutex
+    data map[string]string
+    join *cluster.JoinRequest
+}
+
+func (n *fakeNode) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+
+    switch {
+    case strings.HasPrefix(req.URL.Path, "/key/"):
+        key, _ := url.PathUnescape(strings.TrimPrefix(req.URL.EscapedPath(), "/key/"))
+        switch req.Method {
+        case http.MethodGet:
+            v, ok := n.data[key]
+            if !ok {
+                resp.WriteHeader(http.StatusNotFound)
+                return
+            }
+            resp.Write([]byte(v))
+        case http.MethodPut:
+            b, _ := ioutil.ReadAll(req.Body)
+            n.data[key] = string(b)
+        case http.MethodDelete:
+            delete(n.data, key)
+        }
+    case req.URL.Path == "/cluster":
+        resp.Write([]byte("[]"))
+    case req.URL.Path == "/status":
+        json.NewEncoder(resp).Encode(&handler.Status{
+            Leader: true,
+            Keys:   len(n.data),
+            Raft:   &cluster.RaftStatus{ID: "n1", State: "Leader", Leader: "127.0.0.1:7000", Term: 2},
+        })
+    case req.URL.Path == "/admin/raft/peers":
+        json.NewEncoder(resp).Encode([]cluster.RaftPeer{{ID: "n1", Addr: "127.0.0.1:7000", Suffrage: "Voter", Leader: true}})
+    case req.URL.Path == "/join":
+        jr := &cluster.JoinRequest{}
+        json.NewDecoder(req.Body).Decode(jr)
+        n.join = jr
+    default:
+        resp.WriteHeader(http.StatusNotFound)
+    }
+}
+
+func newTestCli(t *testing.T, n *fakeNode) (*cli, func()) {
+    srv := httptest.NewServer(n)
+    cc, err := client.New([]string{srv.Listener.Addr().String()}, client.WithRetry(0, 0))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return &cli{Client: cc, ctx: context.Background(), joinSecret: "secret"}, srv.Close
+}
+
+func TestExecute(t *testing.T) {
+    n := &fakeNode{data: map[string]string{"k": "v"}}
+    c, closeFn := newTestCli(t, n)
+    defer closeFn()
+
+    cases := []struct {
+        args []string
+        json bool
+        out  string
+        err  string
+    }{
+        {[]string{"GET", "k"}, false, "v\n", ""},
+        {[]string{"get", "k"}, true, "{\n  \"key\": \"k\",\n  \"value\": \"v\"\n}\n", ""},
+        {[]string{"set", "a b", "1"}, false, "OK\n", ""},
+        {[]string{"get", "a b"}, false, "1\n", ""},
+        {[]string{"del", "a b"}, true, "{\n  \"result\": \"OK\"\n}\n", ""},
+        {[]string{"get", "a b"}, false, "", "404"},
+        {[]string{"get"}, false, "", "usage: get KEY"},
+        {[]string{"set", "k"}, false, "", "usage: set KEY VALUE"},
+        {[]string{"status", "x"}, false, "", "usage: status"},
+        {[]string{"nope"}, false, "", `unknown command "nope"`},
+        {[]string{"raft", "list"}, false, "", "usage: " + raftUsage},
+        {[]string{"raft", "remove"}, false, "", "usage: raft remove ID"},
+        {[]string{"cluster"}, false, "cluster is not enabled\n", ""},
+        {[]string{"status"}, false, "leader:", ""},
+        {[]string{"raft", "peers"}, false, "ID  ADDR            API  SUFFRAGE  LEADER\nn1  127.0.0.1:7000       Voter     true\n", ""},
+        {[]string{"help"}, false, "  get KEY", ""},
+    }
+    for _, tc := range cases {
+        buf := &bytes.Buffer{}
+        err := execute(c, &output{w: buf, json: tc.json}, tc.args)
+        if tc.err != "" {
+            if err == nil || !strings.Contains(err.Error(), tc.err) {
+                t.Errorf("%q: %v, want %q", tc.args, err, tc.err)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("%q: %v", tc.args, err)
+            continue
+        }
+        if !strings.HasPrefix(buf.String(), tc.out) {
+            t.Errorf("%q: %q, want %q", tc.args, buf.String(), tc.out)
+        }
+    }
+}
+
+func TestRaftAdd(t *testing.T) {
+    n := &fakeNode{data: map[string]string{}}
+    c, closeFn := newTestCli(t, n)
+    defer closeFn()
+
+    if err := execute(c, &output{w: ioutil.Discard}, []string{"raft", "add", "n2", "127.0.0.1:7002", "127.0.0.1:8002"}); err != nil {
+        t.Fatal(err)
+    }
+    jr := n.join
+    if jr == nil || jr.ID != "n2" || jr.Addr != "127.0.0.1:7002" || jr.ApiAddr != "127.0.0.1:8002" {
+        t.Fatalf("join request: %+v", jr)
+    }
+    if err := jr.Verify("secret"); err != nil {
+        t.Fatalf("signature: %v", err)
+    }
+}
+
+func TestRepl(t *testing.T) {
+    n := &fakeNode{data: map[string]string{}}
+    c, closeFn := newTestCli(t, n)
+    defer closeFn()
+
+    in := strings.NewReader("set k \"hello world\"\n\nget k\nget\nset k 'v\nquit\nget k\n")
+    buf := &bytes.Buffer{}
+    repl(c, &output{w: buf}, "127.0.0.1:8000", in)
+
+    expect := "OK\nhello world\n(error) usage: get KEY\n(error) unbalanced quotes\n"
+    if buf.String() != expect {
+        t.Fatalf("output:\n%s", buf.String())
+    }
+}
@@ -0,0 +1,41 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package command
+
+import (
+    "encoding/json"
+    "errors"
+    "github.com/xfali/gache/acl"
+    "github.com/xfali/gache/db"
+)
+
+// ACL_SETUSER：K为用户名，V为acl.User的JSON
+func ProcessAclSetUser(db *db.GacheDb, req *Request) (interface{}, error) {
+    u := acl.User{}
+    if err := json.Unmarshal([]byte(req.V), &u); err != nil {
+        return nil, err
+    }
+    u.Name = req.K
+    return nil, db.Acl.SetUser(&u)
+}
+
+// ACL_DELUSER：K为用户名
+func ProcessAclDelUser(db *db.GacheDb, req *Request) (interface{}, error) {
+    return nil, db.Acl.DelUser(req.K)
+}
+
+// 校验规则中的命令是否存在
+func ValidateRules(rules []acl.Rule) error {
+    for _, r := range rules {
+        for _, c := range r.Commands {
+            if c != acl.AllCommands && !Exists(c) {
+                return errors.New("unknown command in rule: " + c)
+            }
+        }
+    }
+    return nil
+}
@@ -0,0 +1,22 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package command
+
+import (
+    "github.com/xfali/gache/db"
+    "strconv"
+)
+
+// CDC_COMMIT：K为消费者名称，V为已经处理的raft日志index
+func ProcessCdcCommit(db *db.GacheDb, req *Request) (interface{}, error) {
+    index, err := strconv.ParseUint(req.V, 10, 64)
+    if err != nil {
+        return nil, err
+    }
+    db.SetOffset(req.K, index)
+    return nil, nil
+}
@@ -9,19 +9,78 @@ package command
 import (
     "encoding/json"
     "errors"
-    "gache/db"
+    "github.com/xfali/gache/db"
+    "time"
 )
 
 const (
     SET = "SET"
     DEL = "DEL"
     GET = "GET"
+    CAS = "CAS"
+    // 按Ts判断，key的修改时间早于Ts时才写入（last-writer-wins），用于跨集群复制
+    LWW_SET = "LWW_SET"
+    LWW_DEL = "LWW_DEL"
+
+    // 发布消息：K为频道，V为消息。不修改数据，每个节点应用日志时发送给本节点的订阅者
+    PUBLISH = "PUBLISH"
+    // 只用于ACL，订阅通过HTTP长连接完成，不经过raft
+    SUBSCRIBE = "SUBSCRIBE"
+
+    // 分布式锁：K为锁名，V为持有者
+    LOCK    = "LOCK"
+    UNLOCK  = "UNLOCK"
+    REFRESH = "REFRESH"
+
+    // 客户端会话，K为会话id
+    SESSION_CREATE    = "SESSION_CREATE"
+    SESSION_KEEPALIVE = "SESSION_KEEPALIVE"
+    SESSION_CLOSE     = "SESSION_CLOSE"
+    // 由leader提交，删除过期的会话以及会话的临时key
+    SESSION_EXPIRE = "SESSION_EXPIRE"
+    EPHEMERAL_DEL  = "EPHEMERAL_DEL"
+
+    // 由leader在超过max-memory时提交，与DEL相同，watch中为expire事件
+    EVICT = "EVICT"
+
+    // 消息队列，K为队列名
+    ENQUEUE          = "ENQUEUE"
+    DEQUEUE          = "DEQUEUE"
+    ACK              = "ACK"
+    NACK             = "NACK"
+    QUEUE_PURGE_DEAD = "QUEUE_PURGE_DEAD"
+
+    // 限流，K为限流器名
+    RATELIMIT       = "RATELIMIT"
+    RATELIMIT_RESET = "RATELIMIT_RESET"
+
+    ACL_SETUSER = "ACL_SETUSER"
+    ACL_DELUSER = "ACL_DELUSER"
+
+    PEER_SET = "PEER_SET"
+
+    CDC_COMMIT = "CDC_COMMIT"
 )
 
 type Request struct {
     Cmd string
     K   string
     V   string
+    // CAS时期望的当前值
+    Old string `json:",omitempty"`
+    // 提交到raft时的时间（UnixNano），每个节点应用日志时使用相同的时间
+    Ts int64 `json:",omitempty"`
+    // LOCK、REFRESH时锁的有效期
+    Ttl time.Duration `json:",omitempty"`
+    // UNLOCK、REFRESH时加锁返回的fencing token
+    Token uint64 `json:",omitempty"`
+    // 不为空时SET的key为绑定到该会话的临时key
+    Session string `json:",omitempty"`
+    // DEQUEUE、NACK时的最大投递次数，达到后消息移到死信，为0时不限制
+    MaxDeliveries int `json:",omitempty"`
+    // RATELIMIT时每Ttl允许的配额以及本次消耗的配额
+    Limit int64 `json:",omitempty"`
+    Cost  int64 `json:",omitempty"`
 }
 
 type processFunc func(db *db.GacheDb, req *Request) (interface{}, error)
@@ -30,6 +89,83 @@ var gCmds = map[string]processFunc{
     SET:    ProcessSet,
     DEL:    ProcessDel,
     GET:    ProcessGet,
+    CAS:    ProcessCas,
+
+    LWW_SET: ProcessLwwSet,
+    LWW_DEL: ProcessLwwDel,
+
+    PUBLISH:   ProcessPublish,
+    SUBSCRIBE: ProcessSubscribe,
+
+    LOCK:    ProcessLock,
+    UNLOCK:  ProcessUnlock,
+    REFRESH: ProcessRefresh,
+
+    SESSION_CREATE:    ProcessSessionCreate,
+    SESSION_KEEPALIVE: ProcessSessionKeepAlive,
+    SESSION_CLOSE:     ProcessSessionClose,
+    SESSION_EXPIRE:    ProcessSessionExpire,
+    EPHEMERAL_DEL:     ProcessEphemeralDel,
+
+    EVICT: ProcessDel,
+
+    ENQUEUE:          ProcessEnqueue,
+    DEQUEUE:          ProcessDequeue,
+    ACK:              ProcessAck,
+    NACK:             ProcessNack,
+    QUEUE_PURGE_DEAD: ProcessQueuePurgeDead,
+
+    RATELIMIT:       ProcessRateLimit,
+    RATELIMIT_RESET: ProcessRateLimitReset,
+
+    ACL_SETUSER: ProcessAclSetUser,
+    ACL_DELUSER: ProcessAclDelUser,
+
+    PEER_SET: ProcessPeerSet,
+
+    CDC_COMMIT: ProcessCdcCommit,
+}
+
+// 修改数据的命令，ACL按写权限校验
+var writeCmds = map[string]bool{
+    SET: true,
+    DEL: true,
+    CAS: true,
+
+    LWW_SET: true,
+    LWW_DEL: true,
+
+    PUBLISH: true,
+
+    LOCK:    true,
+    UNLOCK:  true,
+    REFRESH: true,
+
+    SESSION_CREATE:    true,
+    SESSION_KEEPALIVE: true,
+    SESSION_CLOSE:     true,
+    SESSION_EXPIRE:    true,
+    EPHEMERAL_DEL:     true,
+
+    EVICT: true,
+
+    ENQUEUE:          true,
+    DEQUEUE:          true,
+    ACK:              true,
+    NACK:             true,
+    QUEUE_PURGE_DEAD: true,
+
+    RATELIMIT:       true,
+    RATELIMIT_RESET: true,
+}
+
+func Exists(cmd string) bool {
+    _, ok := gCmds[cmd]
+    return ok
+}
+
+func IsWrite(cmd string) bool {
+    return writeCmds[cmd]
 }
 
 type Command interface {
@@ -53,7 +189,10 @@ func (req *Request) Unmarshal(bytes []byte) error {
 }
 
 func ProcessSet(db *db.GacheDb, req *Request) (interface{}, error) {
-    return nil, db.Set(req.K, req.V)
+    if req.Session != "" {
+        return nil, db.SetEphemeral(req.K, req.V, req.Session, req.Ts)
+    }
+    return nil, db.SetAt(req.K, req.V, req.Ts)
 }
 
 func ProcessDel(db *db.GacheDb, req *Request) (interface{}, error) {
@@ -63,3 +202,18 @@ func ProcessDel(db *db.GacheDb, req *Request) (interface{}, error) {
 func ProcessGet(db *db.GacheDb, req *Request) (interface{}, error) {
     return db.Get(req.K), nil
 }
+
+// 返回是否设置成功
+func ProcessCas(db *db.GacheDb, req *Request) (interface{}, error) {
+    return db.CompareAndSetAt(req.K, req.Old, req.V, req.Ts), nil
+}
+
+// 返回是否写入
+func ProcessLwwSet(db *db.GacheDb, req *Request) (interface{}, error) {
+    return db.SetIfNewer(req.K, req.V, req.Ts), nil
+}
+
+// 返回是否删除
+func ProcessLwwDel(db *db.GacheDb, req *Request) (interface{}, error) {
+    return db.DeleteIfNewer(req.K, req.Ts), nil
+}
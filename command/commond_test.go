@@ -0,0 +1,60 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package command
+
+import (
+    "testing"
+)
+
+// 不修改数据的命令；ACL_*、PEER_SET、CDC_COMMIT只能由管理员或节点自身提交，不按key授权
+var readCmds = map[string]bool{
+    GET:       true,
+    SUBSCRIBE: true,
+
+    ACL_SETUSER: true,
+    ACL_DELUSER: true,
+    PEER_SET:    true,
+    CDC_COMMIT:  true,
+}
+
+// 新增命令时必须决定是否为写命令，否则ACL会按读权限放行
+func TestWriteCmds(t *testing.T) {
+    for cmd := range gCmds {
+        if writeCmds[cmd] == readCmds[cmd] {
+            t.Errorf("%s: must be in exactly one of writeCmds and readCmds", cmd)
+        }
+    }
+    for cmd := range writeCmds {
+        if !Exists(cmd) {
+            t.Errorf("%s: write command is not registered", cmd)
+        }
+    }
+    for cmd := range readCmds {
+        if !Exists(cmd) {
+            t.Errorf("%s: read command is not registered", cmd)
+        }
+    }
+}
+
+func TestIsWrite(t *testing.T) {
+    cases := map[string]bool{
+        SET:       true,
+        CAS:       true,
+        PUBLISH:   true,
+        DEQUEUE:   true,
+        RATELIMIT: true,
+        EVICT:     true,
+        GET:       false,
+        SUBSCRIBE: false,
+        "UNKNOWN": false,
+    }
+    for cmd, write := range cases {
+        if IsWrite(cmd) != write {
+            t.Errorf("%s: %v", cmd, !write)
+        }
+    }
+}
@@ -0,0 +1,34 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package command
+
+import (
+    "github.com/xfali/gache/db"
+)
+
+// LOCK、REFRESH的结果，Ok为false时Lock为当前持有的锁
+type LockResult struct {
+    db.Lock
+    Ok bool
+}
+
+// LOCK：K为锁名，V为持有者，有效期为Ttl
+func ProcessLock(db *db.GacheDb, req *Request) (interface{}, error) {
+    l, ok := db.Locks.Acquire(req.K, req.V, db.AppliedIndex(), req.Ts, int64(req.Ttl))
+    return &LockResult{Lock: l, Ok: ok}, nil
+}
+
+// REFRESH：V、Token为持有者以及加锁时返回的token，有效期延长为从现在开始的Ttl
+func ProcessRefresh(db *db.GacheDb, req *Request) (interface{}, error) {
+    l, ok := db.Locks.Refresh(req.K, req.V, req.Token, req.Ts, int64(req.Ttl))
+    return &LockResult{Lock: l, Ok: ok}, nil
+}
+
+// UNLOCK：返回是否释放
+func ProcessUnlock(db *db.GacheDb, req *Request) (interface{}, error) {
+    return db.Locks.Release(req.K, req.V, req.Token, req.Ts), nil
+}
@@ -0,0 +1,22 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package command
+
+import (
+    "encoding/json"
+    "github.com/xfali/gache/db"
+)
+
+// PEER_SET：K为raft节点ID，V为db.Peer的JSON
+func ProcessPeerSet(gacheDb *db.GacheDb, req *Request) (interface{}, error) {
+    p := db.Peer{}
+    if err := json.Unmarshal([]byte(req.V), &p); err != nil {
+        return nil, err
+    }
+    gacheDb.SetPeer(req.K, p)
+    return nil, nil
+}
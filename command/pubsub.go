@@ -0,0 +1,21 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package command
+
+import (
+    "errors"
+    "github.com/xfali/gache/db"
+)
+
+// PUBLISH不修改数据，消息由pubsub.Broker在应用日志时发送
+func ProcessPublish(db *db.GacheDb, req *Request) (interface{}, error) {
+    return nil, nil
+}
+
+func ProcessSubscribe(db *db.GacheDb, req *Request) (interface{}, error) {
+    return nil, errors.New("SUBSCRIBE is only supported over streaming connections")
+}
@@ -0,0 +1,40 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package command
+
+import (
+    "github.com/xfali/gache/db"
+)
+
+// ENQUEUE：K为队列名，V为消息，返回消息id
+func ProcessEnqueue(db *db.GacheDb, req *Request) (interface{}, error) {
+    return db.Queues.Enqueue(req.K, req.V, req.Ts), nil
+}
+
+// DEQUEUE：Ttl为可见性超时，返回*db.QueueMessage，没有可以投递的消息时为nil
+func ProcessDequeue(d *db.GacheDb, req *Request) (interface{}, error) {
+    m, ok := d.Queues.Dequeue(req.K, req.Ts, int64(req.Ttl), req.MaxDeliveries)
+    if !ok {
+        return (*db.QueueMessage)(nil), nil
+    }
+    return &m, nil
+}
+
+// ACK：Token为投递时的回执，返回是否删除
+func ProcessAck(db *db.GacheDb, req *Request) (interface{}, error) {
+    return db.Queues.Ack(req.K, req.Token, req.Ts), nil
+}
+
+// NACK：Token为投递时的回执，消息在Ttl之后重新可见
+func ProcessNack(db *db.GacheDb, req *Request) (interface{}, error) {
+    return db.Queues.Nack(req.K, req.Token, req.Ts, int64(req.Ttl), req.MaxDeliveries), nil
+}
+
+// QUEUE_PURGE_DEAD：清空死信，返回删除的消息数
+func ProcessQueuePurgeDead(db *db.GacheDb, req *Request) (interface{}, error) {
+    return db.Queues.PurgeDead(req.K), nil
+}
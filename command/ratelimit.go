@@ -0,0 +1,21 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package command
+
+import (
+    "github.com/xfali/gache/db"
+)
+
+// RATELIMIT：V为算法（db.TokenBucket、db.SlidingWindow），每Ttl最多Limit个配额，消耗Cost个，返回db.RateLimitResult
+func ProcessRateLimit(db *db.GacheDb, req *Request) (interface{}, error) {
+    return db.Limiters.Take(req.K, req.V, req.Ts, int64(req.Ttl), req.Limit, req.Cost), nil
+}
+
+// RATELIMIT_RESET：删除限流器，返回是否存在
+func ProcessRateLimitReset(db *db.GacheDb, req *Request) (interface{}, error) {
+    return db.Limiters.Reset(req.K), nil
+}
@@ -0,0 +1,50 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package command
+
+import (
+    "errors"
+    "github.com/xfali/gache/db"
+)
+
+// SESSION_CREATE：K为会话id（由leader生成），有效期为Ttl
+func ProcessSessionCreate(d *db.GacheDb, req *Request) (interface{}, error) {
+    if !d.Sessions.Create(req.K, req.Ts, int64(req.Ttl)) {
+        return nil, errors.New("session already exists")
+    }
+    s, _ := d.Sessions.Get(req.K)
+    return s, nil
+}
+
+// SESSION_KEEPALIVE：延长会话的有效期，返回db.Session
+func ProcessSessionKeepAlive(d *db.GacheDb, req *Request) (interface{}, error) {
+    s, ok := d.Sessions.KeepAlive(req.K, req.Ts)
+    if !ok {
+        return nil, db.ErrSessionNotFound
+    }
+    return s, nil
+}
+
+// SESSION_CLOSE：删除会话，返回需要删除的临时key
+func ProcessSessionClose(d *db.GacheDb, req *Request) (interface{}, error) {
+    keys, ok := d.Sessions.Remove(req.K, req.Ts, true)
+    if !ok {
+        return nil, db.ErrSessionNotFound
+    }
+    return keys, nil
+}
+
+// SESSION_EXPIRE：由leader在会话过期后提交，提交前收到心跳时不删除。返回需要删除的临时key
+func ProcessSessionExpire(d *db.GacheDb, req *Request) (interface{}, error) {
+    keys, _ := d.Sessions.Remove(req.K, req.Ts, false)
+    return keys, nil
+}
+
+// EPHEMERAL_DEL：K为临时key，V为已经删除的会话id，返回是否删除
+func ProcessEphemeralDel(d *db.GacheDb, req *Request) (interface{}, error) {
+    return d.DeleteEphemeral(req.K, req.V), nil
+}
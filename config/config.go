@@ -6,14 +6,503 @@
 
 package config
 
+import (
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "gopkg.in/yaml.v2"
+    "io"
+    "io/ioutil"
+    "net"
+    "os"
+    "reflect"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const (
+    EnvPrefix = "GACHE_"
+    MaxSlot   = 16383
+)
+
+// 配置项的key与命令行参数名一致，环境变量为 GACHE_ + 大写key（"-" 替换为 "_"），
+// 如 raft-addr 对应 GACHE_RAFT_ADDR。带有 reload:"true" 的配置项可以在运行时重新加载
 type Config struct {
-    RaftTcpAddr  string
-    RaftDir      string
-    RaftJoinAddr string
+    LogLevel  string `yaml:"log-level" reload:"true"`
+    LogFormat string `yaml:"log-format"`
+
+    RaftTcpAddr     string        `yaml:"raft-addr"`
+    RaftNodeId      string        `yaml:"raft-id"`
+    RaftDir         string        `yaml:"raft-dir"`
+    RaftJoinAddr    string        `yaml:"raft-join"`
+    RaftJoinSecret  string        `yaml:"raft-join-secret" secret:"true"`
+    RaftJoinTimeout time.Duration `yaml:"raft-join-timeout"`
+    // 加入时替换已经使用相同ID或地址的成员（如节点更换了地址），默认拒绝
+    RaftJoinReplace bool `yaml:"raft-join-replace"`
+
+    RaftMaxBatch           int           `yaml:"raft-batch"`
+    RaftMaxInflight        int           `yaml:"raft-inflight"`
+    RaftApplyTimeout       time.Duration `yaml:"raft-apply-timeout"`
+    RaftHeartbeatTimeout   time.Duration `yaml:"raft-heartbeat-timeout"`
+    RaftElectionTimeout    time.Duration `yaml:"raft-election-timeout"`
+    RaftCommitTimeout      time.Duration `yaml:"raft-commit-timeout"`
+    RaftLeaderLeaseTimeout time.Duration `yaml:"raft-leader-lease-timeout"`
+    RaftSnapshotInterval   time.Duration `yaml:"raft-snapshot-interval"`
+    RaftSnapshotThreshold  uint64        `yaml:"raft-snapshot-threshold"`
+    RaftSnapshotRetain     int           `yaml:"raft-snapshot-retain"`
+    RaftMaxPool            int           `yaml:"raft-max-pool"`
+    RaftTransportTimeout   time.Duration `yaml:"raft-transport-timeout"`
+
+    ClusterPort             int           `yaml:"cluster-port"`
+    ClusterMemebers         string        `yaml:"cluster-members"`
+    ClusterSlot             string        `yaml:"cluster-slot"`
+    ClusterGossipInterval   time.Duration `yaml:"cluster-gossip-interval"`
+    ClusterGossipNodes      int           `yaml:"cluster-gossip-nodes"`
+    ClusterProbeInterval    time.Duration `yaml:"cluster-probe-interval"`
+    ClusterProbeTimeout     time.Duration `yaml:"cluster-probe-timeout"`
+    ClusterPushPullInterval time.Duration `yaml:"cluster-push-pull-interval"`
+    ClusterSuspicionMult    int           `yaml:"cluster-suspicion-mult"`
+    ClusterKeys             string        `yaml:"cluster-keys" reload:"true" secret:"true"`
+
+    ApiPort            int           `yaml:"port"`
+    ApiAdvertise       string        `yaml:"api-advertise"`
+    HttpReadTimeout    time.Duration `yaml:"http-read-timeout" reload:"true"`
+    HttpWriteTimeout   time.Duration `yaml:"http-write-timeout" reload:"true"`
+    HttpIdleTimeout    time.Duration `yaml:"http-idle-timeout" reload:"true"`
+    HttpMaxHeaderBytes int           `yaml:"http-max-header-bytes" reload:"true"`
+    // redis协议（RESP）端口，只支持发布订阅相关的命令，为0时不启用
+    RespPort int `yaml:"resp-port"`
+
+    TlsCert     string `yaml:"tls-cert"`
+    TlsKey      string `yaml:"tls-key"`
+    TlsCA       string `yaml:"tls-ca"`
+    TlsClientCA string `yaml:"tls-client-ca"`
+    RaftTls     bool   `yaml:"raft-tls"`
+
+    // 估算的key、value内存占用上限（字节），0为不限制。超过时按eviction-policy处理：
+    // noeviction拒绝增加数据的写命令，allkeys-random在leader上随机删除key
+    MaxMemory      int    `yaml:"max-memory" reload:"true"`
+    EvictionPolicy string `yaml:"eviction-policy" reload:"true"`
+
+    AuthTokens      string        `yaml:"auth-tokens" reload:"true" secret:"true"`
+    AuthHmacKeys    string        `yaml:"auth-hmac-keys" reload:"true" secret:"true"`
+    AuthHmacSkew    time.Duration `yaml:"auth-hmac-skew" reload:"true"`
+    AuthHmacMaxBody int           `yaml:"auth-hmac-max-body" reload:"true"`
+    AuthClientToken string        `yaml:"auth-client-token" secret:"true"`
+
+    // 保留的最近修改事件数，watch重新连接时可以从其中的版本号继续
+    WatchBuffer int `yaml:"watch-buffer"`
+
+    // 保留的最近CDC记录数，为0时不启用CDC，需要配置raft-addr
+    CdcBuffer int `yaml:"cdc-buffer"`
+    // 不为空时把CDC记录导出到该目录下的NDJSON文件
+    CdcDir string `yaml:"cdc-dir"`
+    // 单个NDJSON文件的最大字节数，超过后写入新的文件
+    CdcSegmentBytes int `yaml:"cdc-segment-bytes"`
+
+    // 不为空时把CDC记录异步复制到该集群，多个API地址用逗号分隔，需要配置cdc-buffer
+    ReplicateTo string `yaml:"replicate-to"`
+    // 冲突处理：lww按修改时间，source-wins总是覆盖目标集群
+    ReplicatePolicy string `yaml:"replicate-policy"`
+    // 访问目标集群使用的token
+    ReplicateToken string `yaml:"replicate-token" secret:"true"`
+    // 保存复制进度的CDC消费者名
+    ReplicateName string `yaml:"replicate-name"`
+
+    // leader检查会话是否过期的间隔
+    SessionCheckInterval time.Duration `yaml:"session-check-interval"`
+
+    // 消息队列默认的可见性超时，DEQUEUE时可以指定
+    QueueVisibilityTimeout time.Duration `yaml:"queue-visibility-timeout"`
+    // 消息投递的最大次数，超过后移到死信，为0时不限制
+    QueueMaxDeliveries int `yaml:"queue-max-deliveries"`
+
+    // 开启 /admin/debug/faults，在raft和gossip的网络上注入故障，只用于测试
+    DebugFaults bool `yaml:"debug-faults"`
+}
+
+// 默认值与raft.DefaultConfig、memberlist.DefaultLocalConfig保持一致
+func Default() *Config {
+    return &Config{
+        LogLevel:  "info",
+        LogFormat: "text",
+
+        RaftDir: "/tmp",
+
+        RaftMaxBatch:           128,
+        RaftMaxInflight:        4,
+        RaftApplyTimeout:       10 * time.Second,
+        RaftHeartbeatTimeout:   1000 * time.Millisecond,
+        RaftElectionTimeout:    1000 * time.Millisecond,
+        RaftCommitTimeout:      50 * time.Millisecond,
+        RaftLeaderLeaseTimeout: 500 * time.Millisecond,
+        RaftSnapshotInterval:   120 * time.Second,
+        RaftSnapshotThreshold:  8192,
+        RaftSnapshotRetain:     1,
+        RaftMaxPool:            3,
+        RaftTransportTimeout:   10 * time.Second,
+
+        ClusterPort:             9000,
+        ClusterGossipInterval:   100 * time.Millisecond,
+        ClusterGossipNodes:      3,
+        ClusterProbeInterval:    1 * time.Second,
+        ClusterProbeTimeout:     200 * time.Millisecond,
+        ClusterPushPullInterval: 15 * time.Second,
+        ClusterSuspicionMult:    3,
+
+        ApiPort:            8000,
+        HttpReadTimeout:    15 * time.Second,
+        HttpWriteTimeout:   15 * time.Second,
+        HttpIdleTimeout:    15 * time.Second,
+        HttpMaxHeaderBytes: 1 << 20,
+
+        EvictionPolicy: "noeviction",
+
+        AuthHmacSkew:    time.Minute,
+        AuthHmacMaxBody: 4 << 20,
+
+        WatchBuffer: 1024,
+
+        CdcSegmentBytes: 64 << 20,
+
+        ReplicatePolicy: "lww",
+        ReplicateName:   "replicator",
+
+        SessionCheckInterval: 500 * time.Millisecond,
+
+        QueueVisibilityTimeout: 30 * time.Second,
+        QueueMaxDeliveries:     5,
+    }
+}
+
+func (c *Config) LoadFile(path string) error {
+    b, err := ioutil.ReadFile(path)
+    if err != nil {
+        return err
+    }
+    if err := yaml.UnmarshalStrict(b, c); err != nil {
+        return fmt.Errorf("config file %s: %v", path, err)
+    }
+    return nil
+}
+
+func (c *Config) LoadEnv() error {
+    for _, key := range Keys() {
+        if v, ok := os.LookupEnv(EnvName(key)); ok {
+            if err := c.Set(key, v); err != nil {
+                return fmt.Errorf("env %s: %v", EnvName(key), err)
+            }
+        }
+    }
+    return nil
+}
+
+// Load 按优先级 默认值 < 配置文件 < 环境变量 < flags 读取配置并校验，
+// path为空时不读取配置文件，flags的key为配置项的key
+func Load(path string, flags map[string]string) (*Config, error) {
+    conf := Default()
+    if path != "" {
+        if err := conf.LoadFile(path); err != nil {
+            return nil, err
+        }
+    }
+    if err := conf.LoadEnv(); err != nil {
+        return nil, err
+    }
+
+    keys := make([]string, 0, len(flags))
+    for k := range flags {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    for _, k := range keys {
+        if err := conf.Set(k, flags[k]); err != nil {
+            return nil, fmt.Errorf("flag -%s: %v", k, err)
+        }
+    }
+
+    return conf, conf.Validate()
+}
 
-    ClusterPort     int
-    ClusterMemebers string
-    ClusterSlot     string
+func EnvName(key string) string {
+    return EnvPrefix + strings.ToUpper(strings.Replace(key, "-", "_", -1))
+}
+
+// 返回所有配置项的key
+func Keys() []string {
+    t := reflect.TypeOf(Config{})
+    ret := make([]string, 0, t.NumField())
+    for i := 0; i < t.NumField(); i++ {
+        if key := t.Field(i).Tag.Get("yaml"); key != "" {
+            ret = append(ret, key)
+        }
+    }
+    return ret
+}
+
+// 根据key设置配置项，value按字段类型解析
+func (c *Config) Set(key, value string) error {
+    v := reflect.ValueOf(c).Elem()
+    t := v.Type()
+    for i := 0; i < t.NumField(); i++ {
+        if t.Field(i).Tag.Get("yaml") != key {
+            continue
+        }
+        return setValue(v.Field(i), value)
+    }
+    return fmt.Errorf("unknown config key: %s", key)
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setValue(f reflect.Value, value string) error {
+    if f.Type() == durationType {
+        d, err := time.ParseDuration(value)
+        if err != nil {
+            return err
+        }
+        f.SetInt(int64(d))
+        return nil
+    }
+
+    switch f.Kind() {
+    case reflect.String:
+        f.SetString(value)
+    case reflect.Int:
+        i, err := strconv.Atoi(value)
+        if err != nil {
+            return err
+        }
+        f.SetInt(int64(i))
+    case reflect.Uint64:
+        i, err := strconv.ParseUint(value, 10, 64)
+        if err != nil {
+            return err
+        }
+        f.SetUint(i)
+    case reflect.Bool:
+        b, err := strconv.ParseBool(value)
+        if err != nil {
+            return err
+        }
+        f.SetBool(b)
+    default:
+        return fmt.Errorf("unsupported type %s", f.Type())
+    }
+    return nil
+}
+
+func (c *Config) Validate() error {
+    var errs []string
+    check := func(ok bool, format string, args ...interface{}) {
+        if !ok {
+            errs = append(errs, fmt.Sprintf(format, args...))
+        }
+    }
+
+    check(validLogLevel(c.LogLevel), "log-level: %q must be one of trace, debug, info, warn, error", c.LogLevel)
+    check(c.LogFormat == "text" || c.LogFormat == "json", "log-format: %q must be text or json", c.LogFormat)
+    check(validPort(c.ApiPort), "port: %d is not a valid port", c.ApiPort)
+    check(c.RespPort == 0 || validPort(c.RespPort), "resp-port: %d is not a valid port", c.RespPort)
+
+    if c.RaftTcpAddr != "" {
+        _, _, err := net.SplitHostPort(c.RaftTcpAddr)
+        check(err == nil, "raft-addr: %q is not HOST:PORT", c.RaftTcpAddr)
+        check(c.RaftDir != "", "raft-dir: required when raft-addr is set")
+        check(c.RaftMaxBatch > 0, "raft-batch: must be greater than 0")
+        check(c.RaftMaxInflight > 0, "raft-inflight: must be greater than 0")
+        check(c.RaftApplyTimeout > 0, "raft-apply-timeout: must be greater than 0")
+        check(c.RaftHeartbeatTimeout >= 5*time.Millisecond, "raft-heartbeat-timeout: must be at least 5ms")
+        check(c.RaftElectionTimeout >= c.RaftHeartbeatTimeout, "raft-election-timeout: must be at least raft-heartbeat-timeout")
+        check(c.RaftCommitTimeout >= time.Millisecond, "raft-commit-timeout: must be at least 1ms")
+        check(c.RaftLeaderLeaseTimeout >= 5*time.Millisecond && c.RaftLeaderLeaseTimeout <= c.RaftHeartbeatTimeout,
+            "raft-leader-lease-timeout: must be between 5ms and raft-heartbeat-timeout")
+        check(c.RaftSnapshotInterval >= 5*time.Millisecond, "raft-snapshot-interval: must be at least 5ms")
+        check(c.RaftSnapshotRetain > 0, "raft-snapshot-retain: must be greater than 0")
+        check(c.RaftMaxPool > 0, "raft-max-pool: must be greater than 0")
+        check(c.RaftTransportTimeout > 0, "raft-transport-timeout: must be greater than 0")
+        check(c.RaftJoinTimeout >= 0, "raft-join-timeout: must not be negative")
+        for _, v := range c.JoinAddrs() {
+            _, _, err := net.SplitHostPort(v)
+            check(err == nil, "raft-join: %q is not a valid HOST:PORT", v)
+        }
+    } else {
+        check(c.RaftJoinAddr == "", "raft-join: requires raft-addr")
+    }
+    if c.ApiAdvertise != "" {
+        _, _, err := net.SplitHostPort(c.ApiAdvertise)
+        check(err == nil, "api-advertise: %q is not a valid HOST:PORT", c.ApiAdvertise)
+    }
+
+    if c.ClusterSlot != "" {
+        if err := validSlot(c.ClusterSlot); err != nil {
+            errs = append(errs, fmt.Sprintf("cluster-slot: %q %v", c.ClusterSlot, err))
+        }
+        check(validPort(c.ClusterPort), "cluster-port: %d is not a valid port", c.ClusterPort)
+        check(c.ClusterGossipInterval > 0, "cluster-gossip-interval: must be greater than 0")
+        check(c.ClusterGossipNodes > 0, "cluster-gossip-nodes: must be greater than 0")
+        check(c.ClusterProbeInterval > 0, "cluster-probe-interval: must be greater than 0")
+        check(c.ClusterProbeTimeout > 0 && c.ClusterProbeTimeout < c.ClusterProbeInterval,
+            "cluster-probe-timeout: must be between 0 and cluster-probe-interval")
+        check(c.ClusterPushPullInterval >= 0, "cluster-push-pull-interval: must not be negative")
+        check(c.ClusterSuspicionMult > 0, "cluster-suspicion-mult: must be greater than 0")
+        if _, err := c.ClusterKeyList(); err != nil {
+            errs = append(errs, "cluster-keys: "+err.Error())
+        }
+    } else {
+        check(c.ClusterMemebers == "", "cluster-members: requires cluster-slot")
+    }
+
+    check(c.HttpReadTimeout >= 0, "http-read-timeout: must not be negative")
+    check(c.HttpWriteTimeout >= 0, "http-write-timeout: must not be negative")
+    check(c.HttpIdleTimeout >= 0, "http-idle-timeout: must not be negative")
+    check(c.HttpMaxHeaderBytes > 0, "http-max-header-bytes: must be greater than 0")
+
+    check((c.TlsCert == "") == (c.TlsKey == ""), "tls-cert, tls-key: must be set together")
+    check(c.TlsClientCA == "" || c.TlsCert != "", "tls-client-ca: requires tls-cert")
+    check(!c.RaftTls || c.TlsCert != "" && c.TlsCA != "", "raft-tls: requires tls-cert, tls-key and tls-ca")
+    check(c.MaxMemory >= 0, "max-memory: must not be negative")
+    check(c.EvictionPolicy == "noeviction" || c.EvictionPolicy == "allkeys-random", "eviction-policy: %q must be noeviction or allkeys-random", c.EvictionPolicy)
+    check(validPairs(c.AuthTokens), "auth-tokens: must be NAME=TOKEN[,NAME=TOKEN]")
+    check(validPairs(c.AuthHmacKeys), "auth-hmac-keys: must be NAME=KEY[,NAME=KEY]")
+    check(c.AuthHmacSkew > 0, "auth-hmac-skew: must be greater than 0")
+    check(c.AuthHmacMaxBody > 0, "auth-hmac-max-body: must be greater than 0")
+
+    check(c.WatchBuffer >= 0, "watch-buffer: must not be negative")
+    check(c.CdcBuffer >= 0, "cdc-buffer: must not be negative")
+    check(c.CdcBuffer == 0 || c.RaftTcpAddr != "", "cdc-buffer: requires raft-addr")
+    check(c.CdcDir == "" || c.CdcBuffer > 0, "cdc-dir: requires cdc-buffer")
+    check(c.CdcSegmentBytes > 0, "cdc-segment-bytes: must be greater than 0")
+    check(c.ReplicateTo == "" || c.CdcBuffer > 0, "replicate-to: requires cdc-buffer")
+    check(c.ReplicatePolicy == "lww" || c.ReplicatePolicy == "source-wins", "replicate-policy: must be lww or source-wins")
+    check(c.ReplicateName != "", "replicate-name: must not be empty")
+    check(c.SessionCheckInterval > 0, "session-check-interval: must be greater than 0")
+    check(c.QueueVisibilityTimeout > 0, "queue-visibility-timeout: must be greater than 0")
+    check(c.QueueMaxDeliveries >= 0, "queue-max-deliveries: must not be negative")
+
+    if len(errs) > 0 {
+        return errors.New("invalid config:\n  " + strings.Join(errs, "\n  "))
+    }
+    return nil
+}
+
+// raft节点ID，未设置时使用raft-addr
+func (c *Config) NodeID() string {
+    if c.RaftNodeId != "" {
+        return c.RaftNodeId
+    }
+    return c.RaftTcpAddr
+}
+
+// 其他节点访问本节点api的地址，未设置时使用raft-addr的host与port
+func (c *Config) AdvertiseAddr() string {
+    if c.ApiAdvertise != "" {
+        return c.ApiAdvertise
+    }
+    host, _, _ := net.SplitHostPort(c.RaftTcpAddr)
+    return net.JoinHostPort(host, strconv.Itoa(c.ApiPort))
+}
+
+// 其他节点与客户端访问本节点RESP端口的地址，使用api地址的host，未启用时为空
+func (c *Config) RespAdvertiseAddr() string {
+    if c.RespPort == 0 {
+        return ""
+    }
+    host, _, _ := net.SplitHostPort(c.AdvertiseAddr())
+    return net.JoinHostPort(host, strconv.Itoa(c.RespPort))
+}
+
+// 解析raft-join：逗号分隔的已有节点api地址
+func (c *Config) JoinAddrs() []string {
+    var ret []string
+    for _, v := range strings.Split(c.RaftJoinAddr, ",") {
+        if v = strings.TrimSpace(v); v != "" {
+            ret = append(ret, v)
+        }
+    }
+    return ret
+}
+
+// 解析cluster-keys：逗号分隔的base64编码的key（16、24或32字节），第一个用于加密
+func (c *Config) ClusterKeyList() ([][]byte, error) {
+    var ret [][]byte
+    for _, v := range strings.Split(c.ClusterKeys, ",") {
+        v = strings.TrimSpace(v)
+        if v == "" {
+            continue
+        }
+        k, err := base64.StdEncoding.DecodeString(v)
+        if err != nil {
+            return nil, errors.New("key is not valid base64")
+        }
+        if l := len(k); l != 16 && l != 24 && l != 32 {
+            return nil, errors.New("key must be 16, 24 or 32 bytes")
+        }
+        ret = append(ret, k)
+    }
+    return ret, nil
+}
+
+func validLogLevel(level string) bool {
+    switch strings.ToLower(level) {
+    case "trace", "debug", "info", "warn", "error":
+        return true
+    }
+    return false
+}
+
+func validPairs(s string) bool {
+    for _, v := range strings.Split(s, ",") {
+        v = strings.TrimSpace(v)
+        if v == "" {
+            continue
+        }
+        kv := strings.SplitN(v, "=", 2)
+        if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+            return false
+        }
+    }
+    return true
+}
+
+func validPort(port int) bool {
+    return port > 0 && port <= 65535
+}
+
+func validSlot(slot string) error {
+    s := strings.Split(slot, "-")
+    if len(s) != 2 {
+        return errors.New("must be BEGIN-END, e.g. 0-5000")
+    }
+    begin, err := strconv.Atoi(strings.TrimSpace(s[0]))
+    if err != nil {
+        return errors.New("begin is not a number")
+    }
+    end, err := strconv.Atoi(strings.TrimSpace(s[1]))
+    if err != nil {
+        return errors.New("end is not a number")
+    }
+    if begin < 0 || end > MaxSlot || begin > end {
+        return fmt.Errorf("must satisfy 0 <= BEGIN <= END <= %d", MaxSlot)
+    }
+    return nil
+}
 
-    ApiPort int
+// 输出配置，带有 secret:"true" 的配置项不输出明文
+func (c *Config) Dump(w io.Writer) error {
+    masked := *c
+    v := reflect.ValueOf(&masked).Elem()
+    for i := 0; i < v.NumField(); i++ {
+        if v.Type().Field(i).Tag.Get("secret") == "true" && v.Field(i).String() != "" {
+            v.Field(i).SetString("******")
+        }
+    }
+    b, err := yaml.Marshal(&masked)
+    if err != nil {
+        return err
+    }
+    _, err = w.Write(b)
+    return err
 }
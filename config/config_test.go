@@ -0,0 +1,206 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package config
+
+import (
+    "bytes"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestValidate(t *testing.T) {
+    cases := []struct {
+        name   string
+        modify func(c *Config)
+        errs   []string
+    }{
+        {"default", func(c *Config) {}, nil},
+        {"raft", func(c *Config) {
+            c.RaftTcpAddr = "127.0.0.1:7000"
+            c.RaftJoinAddr = "127.0.0.1:8001,127.0.0.1:8002"
+        }, nil},
+        {"cluster", func(c *Config) {
+            c.ClusterSlot = "0-16383"
+            c.ClusterMemebers = "127.0.0.1:9001"
+        }, nil},
+        {"log level", func(c *Config) { c.LogLevel = "verbose" }, []string{`log-level: "verbose"`}},
+        {"raft addr", func(c *Config) { c.RaftTcpAddr = "7000" }, []string{`raft-addr: "7000" is not HOST:PORT`}},
+        {"join without raft", func(c *Config) { c.RaftJoinAddr = "127.0.0.1:8001" }, []string{"raft-join: requires raft-addr"}},
+        {"bad join addr", func(c *Config) {
+            c.RaftTcpAddr = "127.0.0.1:7000"
+            c.RaftJoinAddr = "127.0.0.1:8001,8002"
+        }, []string{`raft-join: "8002"`}},
+        {"raft timeouts", func(c *Config) {
+            c.RaftTcpAddr = "127.0.0.1:7000"
+            c.RaftElectionTimeout = c.RaftHeartbeatTimeout / 2
+            c.RaftLeaderLeaseTimeout = 2 * c.RaftHeartbeatTimeout
+        }, []string{"raft-election-timeout", "raft-leader-lease-timeout"}},
+        {"resp port", func(c *Config) { c.RespPort = -1 }, []string{"resp-port: -1"}},
+        {"slot", func(c *Config) { c.ClusterSlot = "10-5" }, []string{`cluster-slot: "10-5" must satisfy`}},
+        {"members without slot", func(c *Config) { c.ClusterMemebers = "127.0.0.1:9001" }, []string{"cluster-members: requires cluster-slot"}},
+        {"tls", func(c *Config) { c.TlsCert = "cert.pem" }, []string{"tls-cert, tls-key"}},
+        {"eviction policy", func(c *Config) { c.EvictionPolicy = "lru" }, []string{`eviction-policy: "lru"`}},
+        {"auth tokens", func(c *Config) { c.AuthTokens = "token" }, []string{"auth-tokens"}},
+        {"cdc without raft", func(c *Config) { c.CdcBuffer = 10 }, []string{"cdc-buffer: requires raft-addr"}},
+        // 所有错误一起返回
+        {"multiple", func(c *Config) {
+            c.LogFormat = "xml"
+            c.ApiPort = 70000
+            c.MaxMemory = -1
+            c.QueueVisibilityTimeout = 0
+        }, []string{"log-format", "port: 70000", "max-memory", "queue-visibility-timeout"}},
+    }
+    for _, c := range cases {
+        conf := Default()
+        c.modify(conf)
+        err := conf.Validate()
+        if len(c.errs) == 0 {
+            if err != nil {
+                t.Errorf("%s: %v", c.name, err)
+            }
+            continue
+        }
+        if err == nil {
+            t.Errorf("%s: no error", c.name)
+            continue
+        }
+        lines := strings.Split(err.Error(), "\n")
+        if len(lines) != len(c.errs)+1 {
+            t.Errorf("%s: got %d errors, want %d:\n%v", c.name, len(lines)-1, len(c.errs), err)
+            continue
+        }
+        for i, e := range c.errs {
+            if !strings.Contains(lines[i+1], e) {
+                t.Errorf("%s: error %d %q does not contain %q", c.name, i, lines[i+1], e)
+            }
+        }
+    }
+}
+
+func setEnv(t *testing.T, env map[string]string) func() {
+    for k, v := range env {
+        if err := os.Setenv(k, v); err != nil {
+            t.Fatal(err)
+        }
+    }
+    return func() {
+        for k := range env {
+            os.Unsetenv(k)
+        }
+    }
+}
+
+func writeFile(t *testing.T, content string) (string, func()) {
+    dir, err := ioutil.TempDir("", "gache-config")
+    if err != nil {
+        t.Fatal(err)
+    }
+    path := filepath.Join(dir, "gache.yaml")
+    if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+        t.Fatal(err)
+    }
+    return path, func() { os.RemoveAll(dir) }
+}
+
+func TestLoadPrecedence(t *testing.T) {
+    path, clean := writeFile(t, "log-level: debug\nport: 8001\nraft-dir: /data\nwatch-buffer: 10\n")
+    defer clean()
+
+    cases := []struct {
+        name   string
+        path   string
+        env    map[string]string
+        flags  map[string]string
+        expect func(c *Config) bool
+    }{
+        {"default", "", nil, nil, func(c *Config) bool {
+            return c.LogLevel == "info" && c.ApiPort == 8000 && c.RaftDir == "/tmp"
+        }},
+        {"file over default", path, nil, nil, func(c *Config) bool {
+            return c.LogLevel == "debug" && c.ApiPort == 8001 && c.RaftDir == "/data" && c.LogFormat == "text"
+        }},
+        {"env over file", path, map[string]string{"GACHE_PORT": "8002", "GACHE_RAFT_APPLY_TIMEOUT": "3s"}, nil, func(c *Config) bool {
+            return c.ApiPort == 8002 && c.LogLevel == "debug" && c.RaftApplyTimeout == 3*time.Second
+        }},
+        {"flag over env", path, map[string]string{"GACHE_PORT": "8002", "GACHE_LOG_LEVEL": "warn"}, map[string]string{"port": "8003"}, func(c *Config) bool {
+            return c.ApiPort == 8003 && c.LogLevel == "warn" && c.RaftDir == "/data" && c.WatchBuffer == 10
+        }},
+    }
+    for _, c := range cases {
+        reset := setEnv(t, c.env)
+        conf, err := Load(c.path, c.flags)
+        reset()
+        if err != nil {
+            t.Errorf("%s: %v", c.name, err)
+            continue
+        }
+        if !c.expect(conf) {
+            t.Errorf("%s: %+v", c.name, conf)
+        }
+    }
+}
+
+func TestLoadError(t *testing.T) {
+    unknown, clean := writeFile(t, "no-such-key: 1\n")
+    defer clean()
+
+    cases := []struct {
+        name  string
+        path  string
+        env   map[string]string
+        flags map[string]string
+        err   string
+    }{
+        {"missing file", "/no/such/gache.yaml", nil, nil, "no such file"},
+        {"unknown file key", unknown, nil, nil, "no-such-key"},
+        {"bad env", "", map[string]string{"GACHE_PORT": "abc"}, nil, "env GACHE_PORT"},
+        {"unknown flag", "", nil, map[string]string{"no-such-key": "1"}, "unknown config key"},
+        {"bad flag", "", nil, map[string]string{"raft-apply-timeout": "10"}, "flag -raft-apply-timeout"},
+        {"invalid", "", nil, map[string]string{"log-format": "xml"}, "log-format"},
+    }
+    for _, c := range cases {
+        reset := setEnv(t, c.env)
+        _, err := Load(c.path, c.flags)
+        reset()
+        if err == nil || !strings.Contains(err.Error(), c.err) {
+            t.Errorf("%s: %v, want %q", c.name, err, c.err)
+        }
+    }
+}
+
+func TestDumpMasksSecrets(t *testing.T) {
+    conf := Default()
+    conf.RaftJoinSecret = "s3cr3t-join"
+    conf.AuthTokens = "admin=token-value"
+    conf.ClusterKeys = "a2V5"
+    conf.LogLevel = "debug"
+
+    buf := &bytes.Buffer{}
+    if err := conf.Dump(buf); err != nil {
+        t.Fatal(err)
+    }
+    out := buf.String()
+    for _, s := range []string{"s3cr3t-join", "token-value", "a2V5"} {
+        if strings.Contains(out, s) {
+            t.Errorf("secret %q in output:\n%s", s, out)
+        }
+    }
+    for _, s := range []string{"raft-join-secret: '******'", "auth-tokens: '******'", "cluster-keys: '******'",
+        "auth-hmac-keys: \"\"", "log-level: debug"} {
+        if !strings.Contains(out, s) {
+            t.Errorf("%q not in output:\n%s", s, out)
+        }
+    }
+    // 不修改原来的配置
+    if conf.RaftJoinSecret != "s3cr3t-join" {
+        t.Errorf("config modified: %q", conf.RaftJoinSecret)
+    }
+}
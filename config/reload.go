@@ -0,0 +1,76 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package config
+
+import (
+    "reflect"
+    "sync"
+)
+
+type ReloadResult struct {
+    Applied         []string `json:"applied"`
+    RestartRequired []string `json:"restartRequired"`
+}
+
+type Reloader struct {
+    mu        sync.Mutex
+    conf      *Config
+    load      func() (*Config, error)
+    listeners []func(conf *Config)
+}
+
+// load负责重新读取配置（配置文件、环境变量、命令行参数）并校验
+func NewReloader(conf *Config, load func() (*Config, error)) *Reloader {
+    c := *conf
+    return &Reloader{
+        conf: &c,
+        load: load,
+    }
+}
+
+// 注册重新加载的回调，仅当可重新加载的配置项发生变化时调用
+func (r *Reloader) OnReload(listener func(conf *Config)) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    r.listeners = append(r.listeners, listener)
+}
+
+func (r *Reloader) Reload() (*ReloadResult, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    newConf, err := r.load()
+    if err != nil {
+        return nil, err
+    }
+
+    ret := &ReloadResult{Applied: []string{}, RestartRequired: []string{}}
+    cur := reflect.ValueOf(r.conf).Elem()
+    next := reflect.ValueOf(newConf).Elem()
+    t := cur.Type()
+    for i := 0; i < t.NumField(); i++ {
+        if reflect.DeepEqual(cur.Field(i).Interface(), next.Field(i).Interface()) {
+            continue
+        }
+        key := t.Field(i).Tag.Get("yaml")
+        if t.Field(i).Tag.Get("reload") == "true" {
+            cur.Field(i).Set(next.Field(i))
+            ret.Applied = append(ret.Applied, key)
+        } else {
+            ret.RestartRequired = append(ret.RestartRequired, key)
+        }
+    }
+
+    if len(ret.Applied) > 0 {
+        c := *r.conf
+        for _, l := range r.listeners {
+            l(&c)
+        }
+    }
+    return ret, nil
+}
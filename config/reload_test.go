@@ -0,0 +1,102 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package config
+
+import (
+    "errors"
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestReload(t *testing.T) {
+    cases := []struct {
+        name    string
+        modify  func(c *Config)
+        applied []string
+        restart []string
+    }{
+        {"unchanged", func(c *Config) {}, []string{}, []string{}},
+        {"reloadable", func(c *Config) {
+            c.LogLevel = "debug"
+            c.MaxMemory = 1 << 20
+            c.EvictionPolicy = "allkeys-random"
+            c.AuthTokens = "admin=t"
+        }, []string{"log-level", "max-memory", "eviction-policy", "auth-tokens"}, []string{}},
+        {"restart required", func(c *Config) {
+            c.ApiPort = 8001
+            c.RaftDir = "/data"
+        }, []string{}, []string{"raft-dir", "port"}},
+        {"mixed", func(c *Config) {
+            c.HttpReadTimeout = time.Second
+            c.CdcBuffer = 10
+        }, []string{"http-read-timeout"}, []string{"cdc-buffer"}},
+    }
+    for _, c := range cases {
+        conf := Default()
+        next := Default()
+        c.modify(next)
+
+        var notified []*Config
+        r := NewReloader(conf, func() (*Config, error) { return next, nil })
+        r.OnReload(func(conf *Config) { notified = append(notified, conf) })
+
+        ret, err := r.Reload()
+        if err != nil {
+            t.Fatalf("%s: %v", c.name, err)
+        }
+        if !reflect.DeepEqual(ret.Applied, c.applied) || !reflect.DeepEqual(ret.RestartRequired, c.restart) {
+            t.Errorf("%s: %+v", c.name, ret)
+        }
+        // 只在有可重新加载的配置项变化时通知，且只带上可以重新加载的修改
+        if len(c.applied) == 0 {
+            if len(notified) != 0 {
+                t.Errorf("%s: notified without applied keys", c.name)
+            }
+            continue
+        }
+        if len(notified) != 1 {
+            t.Fatalf("%s: notified %d times", c.name, len(notified))
+        }
+        got := notified[0]
+        if got.LogLevel != next.LogLevel || got.MaxMemory != next.MaxMemory || got.HttpReadTimeout != next.HttpReadTimeout {
+            t.Errorf("%s: reloadable keys not applied: %+v", c.name, got)
+        }
+        if got.ApiPort != conf.ApiPort || got.CdcBuffer != conf.CdcBuffer || got.RaftDir != conf.RaftDir {
+            t.Errorf("%s: restart required keys applied: %+v", c.name, got)
+        }
+    }
+}
+
+func TestReloadRepeated(t *testing.T) {
+    next := Default()
+    r := NewReloader(Default(), func() (*Config, error) { return next, nil })
+
+    next.LogLevel = "debug"
+    next.ApiPort = 8001
+    if _, err := r.Reload(); err != nil {
+        t.Fatal(err)
+    }
+    // 已经应用的修改不再出现，未应用的修改每次都会提示
+    ret, err := r.Reload()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(ret.Applied) != 0 || !reflect.DeepEqual(ret.RestartRequired, []string{"port"}) {
+        t.Fatalf("second reload: %+v", ret)
+    }
+}
+
+func TestReloadError(t *testing.T) {
+    loadErr := errors.New("invalid config")
+    notified := false
+    r := NewReloader(Default(), func() (*Config, error) { return nil, loadErr })
+    r.OnReload(func(conf *Config) { notified = true })
+    if _, err := r.Reload(); err != loadErr || notified {
+        t.Fatalf("%v %v", err, notified)
+    }
+}
@@ -6,25 +6,86 @@
 
 package db
 
-import "sync"
+import (
+    "github.com/xfali/gache/acl"
+    "sync"
+    "sync/atomic"
+)
+
+// 估算内存时每个key额外的开销（map bucket、string header）
+const entryOverhead = 48
+
+// 集群中raft节点的地址，follower据此把请求指向leader的api地址
+type Peer struct {
+    RaftAddr string
+    ApiAddr  string
+    // 未启用RESP时为空
+    RespAddr string
+}
 
 type GacheDb struct {
     Table map[string]string
-    mutex sync.RWMutex
+    // key最后修改的时间（UnixNano），用于跨集群复制时的last-writer-wins
+    Stamps map[string]int64
+    Acl    *acl.Store
+    Peers  map[string]Peer
+    // 每次修改Table加1，作为修改的版本号
+    Rev uint64
+    // 最后应用的raft日志index
+    Applied uint64
+    // CDC消费者提交的offset（raft日志index）
+    Offsets map[string]uint64
+    // 分布式锁
+    Locks *LockStore
+    // 客户端会话以及临时key所属的会话
+    Sessions *SessionStore
+    // 消息队列
+    Queues *QueueStore
+    // 限流器
+    Limiters *RateLimitStore
+    mutex    sync.RWMutex
+    size     int64
 }
 
 func New() *GacheDb {
-    return &GacheDb{Table: map[string]string{}}
+    return &GacheDb{
+        Table:    map[string]string{},
+        Stamps:   map[string]int64{},
+        Acl:      acl.NewStore(),
+        Peers:    map[string]Peer{},
+        Offsets:  map[string]uint64{},
+        Locks:    newLockStore(),
+        Sessions: newSessionStore(),
+        Queues:   newQueueStore(),
+        Limiters: newRateLimitStore(),
+    }
 }
 
 func (db *GacheDb) Set(k, v string) error {
+    return db.SetAt(k, v, 0)
+}
+
+// SetAt 设置key并记录修改时间ts（UnixNano），为0时表示未知
+func (db *GacheDb) SetAt(k, v string, ts int64) error {
     db.mutex.Lock()
     defer db.mutex.Unlock()
 
-    db.Table[k] = v
+    db.set(k, v, ts)
     return nil
 }
 
+// SetIfNewer key不存在或者修改时间早于ts时设置，返回是否设置（last-writer-wins）
+func (db *GacheDb) SetIfNewer(k, v string, ts int64) bool {
+    db.mutex.Lock()
+    defer db.mutex.Unlock()
+
+    if _, ok := db.Table[k]; ok && db.Stamps[k] >= ts {
+        return false
+    }
+    db.set(k, v, ts)
+    return true
+}
+
 func (db *GacheDb) Get(k string) string {
     db.mutex.RLock()
     defer db.mutex.RUnlock()
@@ -32,10 +93,250 @@ func (db *GacheDb) Get(k string) string {
     return db.Table[k]
 }
 
+// Lookup 返回key的值以及是否存在
+func (db *GacheDb) Lookup(k string) (string, bool) {
+    db.mutex.RLock()
+    defer db.mutex.RUnlock()
+
+    v, ok := db.Table[k]
+    return v, ok
+}
+
 func (db *GacheDb) Delete(k string) error {
     db.mutex.Lock()
     defer db.mutex.Unlock()
 
-    delete(db.Table, k)
+    db.delete(k)
     return nil
 }
+
+// DeleteIfNewer key的修改时间早于ts时删除，返回是否删除（不存在时也返回true）
+func (db *GacheDb) DeleteIfNewer(k string, ts int64) bool {
+    db.mutex.Lock()
+    defer db.mutex.Unlock()
+
+    if _, ok := db.Table[k]; ok && db.Stamps[k] >= ts {
+        return false
+    }
+    db.delete(k)
+    return true
+}
+
+// CompareAndSet 当前值（不存在时为空字符串）等于old时设置为v，返回是否设置
+func (db *GacheDb) CompareAndSet(k, old, v string) bool {
+    return db.CompareAndSetAt(k, old, v, 0)
+}
+
+// CompareAndSetAt 同CompareAndSet，设置时记录修改时间ts
+func (db *GacheDb) CompareAndSetAt(k, old, v string, ts int64) bool {
+    db.mutex.Lock()
+    defer db.mutex.Unlock()
+
+    if db.Table[k] != old {
+        return false
+    }
+    db.set(k, v, ts)
+    return true
+}
+
+// 需要持有写锁
+func (db *GacheDb) set(k, v string, ts int64) {
+    db.put(k, v, ts)
+    db.Sessions.unbind(k)
+}
+
+// 需要持有写锁，不修改临时key的绑定
+func (db *GacheDb) put(k, v string, ts int64) {
+    if old, ok := db.Table[k]; ok {
+        atomic.AddInt64(&db.size, -int64(len(k)+len(old)+entryOverhead))
+    }
+    db.Table[k] = v
+    if ts != 0 {
+        db.Stamps[k] = ts
+    } else {
+        delete(db.Stamps, k)
+    }
+    atomic.AddInt64(&db.size, int64(len(k)+len(v)+entryOverhead))
+    atomic.AddUint64(&db.Rev, 1)
+}
+
+// 需要持有写锁
+func (db *GacheDb) delete(k string) {
+    if db.remove(k) {
+        db.Sessions.unbind(k)
+    }
+}
+
+// 需要持有写锁，不修改临时key的绑定。返回key是否存在
+func (db *GacheDb) remove(k string) bool {
+    old, ok := db.Table[k]
+    if !ok {
+        return false
+    }
+    atomic.AddInt64(&db.size, -int64(len(k)+len(old)+entryOverhead))
+    delete(db.Table, k)
+    delete(db.Stamps, k)
+    atomic.AddUint64(&db.Rev, 1)
+    return true
+}
+
+func (db *GacheDb) Len() int {
+    db.mutex.RLock()
+    defer db.mutex.RUnlock()
+
+    return len(db.Table)
+}
+
+func (db *GacheDb) SetPeer(id string, p Peer) {
+    db.mutex.Lock()
+    defer db.mutex.Unlock()
+
+    db.Peers[id] = p
+}
+
+func (db *GacheDb) GetPeer(id string) (Peer, bool) {
+    db.mutex.RLock()
+    defer db.mutex.RUnlock()
+
+    p, ok := db.Peers[id]
+    return p, ok
+}
+
+// 根据raft地址查找节点
+func (db *GacheDb) PeerByRaftAddr(addr string) (Peer, bool) {
+    db.mutex.RLock()
+    defer db.mutex.RUnlock()
+
+    for _, p := range db.Peers {
+        if p.RaftAddr == addr {
+            return p, true
+        }
+    }
+    return Peer{}, false
+}
+
+// 最后一次修改的版本号
+func (db *GacheDb) Version() uint64 {
+    return atomic.LoadUint64(&db.Rev)
+}
+
+func (db *GacheDb) SetApplied(index uint64) {
+    atomic.StoreUint64(&db.Applied, index)
+}
+
+// 最后应用的raft日志index，未使用raft时为0
+func (db *GacheDb) AppliedIndex() uint64 {
+    return atomic.LoadUint64(&db.Applied)
+}
+
+func (db *GacheDb) SetOffset(consumer string, index uint64) {
+    db.mutex.Lock()
+    defer db.mutex.Unlock()
+
+    db.Offsets[consumer] = index
+}
+
+func (db *GacheDb) GetOffset(consumer string) (uint64, bool) {
+    db.mutex.RLock()
+    defer db.mutex.RUnlock()
+
+    v, ok := db.Offsets[consumer]
+    return v, ok
+}
+
+// 估算的key、value内存占用（字节），不包括锁、会话、队列以及限流器
+func (db *GacheDb) MemSize() int64 {
+    return atomic.LoadInt64(&db.size)
+}
+
+// SampleKeys 随机返回最多n个key，用于淘汰
+func (db *GacheDb) SampleKeys(n int) []string {
+    db.mutex.RLock()
+    defer db.mutex.RUnlock()
+
+    ret := make([]string, 0, n)
+    for k := range db.Table {
+        if len(ret) >= n {
+            break
+        }
+        ret = append(ret, k)
+    }
+    return ret
+}
+
+// 复制全部数据，用于生成快照
+func (db *GacheDb) Copy() *GacheDb {
+    db.mutex.RLock()
+    table := make(map[string]string, len(db.Table))
+    for k, v := range db.Table {
+        table[k] = v
+    }
+    stamps := make(map[string]int64, len(db.Stamps))
+    for k, v := range db.Stamps {
+        stamps[k] = v
+    }
+    peers := make(map[string]Peer, len(db.Peers))
+    for k, v := range db.Peers {
+        peers[k] = v
+    }
+    offsets := make(map[string]uint64, len(db.Offsets))
+    for k, v := range db.Offsets {
+        offsets[k] = v
+    }
+    rev := db.Version()
+    db.mutex.RUnlock()
+
+    return &GacheDb{
+        Table:    table,
+        Stamps:   stamps,
+        Acl:      db.Acl.Copy(),
+        Peers:    peers,
+        Rev:      rev,
+        Applied:  db.AppliedIndex(),
+        Offsets:  offsets,
+        Locks:    db.Locks.copy(),
+        Sessions: db.Sessions.copy(),
+        Queues:   db.Queues.copy(),
+        Limiters: db.Limiters.copy(),
+    }
+}
+
+// 使用other替换全部数据，用于从快照恢复
+func (db *GacheDb) Restore(other *GacheDb) {
+    table := other.Table
+    if table == nil {
+        table = map[string]string{}
+    }
+    stamps := other.Stamps
+    if stamps == nil {
+        stamps = map[string]int64{}
+    }
+    peers := other.Peers
+    if peers == nil {
+        peers = map[string]Peer{}
+    }
+    offsets := other.Offsets
+    if offsets == nil {
+        offsets = map[string]uint64{}
+    }
+    var size int64
+    for k, v := range table {
+        size += int64(len(k) + len(v) + entryOverhead)
+    }
+
+    db.mutex.Lock()
+    db.Table = table
+    db.Stamps = stamps
+    db.Peers = peers
+    db.Offsets = offsets
+    atomic.StoreInt64(&db.size, size)
+    atomic.StoreUint64(&db.Rev, other.Rev)
+    atomic.StoreUint64(&db.Applied, other.Applied)
+    db.mutex.Unlock()
+
+    db.Acl.Restore(other.Acl)
+    db.Locks.restore(other.Locks)
+    db.Sessions.restore(other.Sessions)
+    db.Queues.restore(other.Queues)
+    db.Limiters.restore(other.Limiters)
+}
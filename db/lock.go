@@ -0,0 +1,129 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package db
+
+import (
+    "sync"
+)
+
+// 分布式锁，时间均为leader提交命令时的时间（UnixNano），每个副本上的结果相同
+type Lock struct {
+    Owner string
+    // 加锁时分配，单调递增，下游系统据此拒绝过期的持有者
+    Token uint64
+    // 过期时间
+    Expire int64
+}
+
+// LockStore 分布式锁以及最后分配的fencing token，与key使用不同的锁
+type LockStore struct {
+    mu    sync.RWMutex
+    Locks map[string]Lock
+    Fence uint64
+}
+
+func newLockStore() *LockStore {
+    return &LockStore{Locks: map[string]Lock{}}
+}
+
+// Acquire 锁空闲、已经过期或者已经由owner持有时加锁，有效期为ttl（已经持有时只延长有效期，token不变）。
+// index为当前应用的raft日志index，作为新的token。返回是否加锁成功，失败时返回当前持有的锁
+func (s *LockStore) Acquire(name, owner string, index uint64, now, ttl int64) (Lock, bool) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    l, ok := s.Locks[name]
+    if ok && l.Expire > now {
+        if l.Owner != owner {
+            return l, false
+        }
+    } else {
+        // 使用raft日志的index作为token，批量提交的同一条日志中多次加锁以及未使用raft时递增
+        s.Fence++
+        if index > s.Fence {
+            s.Fence = index
+        }
+        l = Lock{Owner: owner, Token: s.Fence}
+    }
+    l.Expire = now + ttl
+    s.Locks[name] = l
+    return l, true
+}
+
+// Refresh 延长仍然持有的锁的有效期，返回是否成功
+func (s *LockStore) Refresh(name, owner string, token uint64, now, ttl int64) (Lock, bool) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    l, ok := s.Locks[name]
+    if !ok || l.Expire <= now || l.Owner != owner || l.Token != token {
+        return l, false
+    }
+    l.Expire = now + ttl
+    s.Locks[name] = l
+    return l, true
+}
+
+// Release 释放仍然持有的锁，返回是否成功。锁已经过期时同样删除，但返回false
+func (s *LockStore) Release(name, owner string, token uint64, now int64) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    l, ok := s.Locks[name]
+    if !ok {
+        return false
+    }
+    if l.Expire <= now {
+        delete(s.Locks, name)
+        return false
+    }
+    if l.Owner != owner || l.Token != token {
+        return false
+    }
+    delete(s.Locks, name)
+    return true
+}
+
+// Get 返回now时仍然有效的锁
+func (s *LockStore) Get(name string, now int64) (Lock, bool) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    l, ok := s.Locks[name]
+    if !ok || l.Expire <= now {
+        return Lock{}, false
+    }
+    return l, true
+}
+
+func (s *LockStore) copy() *LockStore {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    ret := &LockStore{Locks: make(map[string]Lock, len(s.Locks)), Fence: s.Fence}
+    for k, v := range s.Locks {
+        ret.Locks[k] = v
+    }
+    return ret
+}
+
+// other为nil时（快照中没有锁）清空
+func (s *LockStore) restore(other *LockStore) {
+    locks := map[string]Lock{}
+    var fence uint64
+    if other != nil {
+        for k, v := range other.Locks {
+            locks[k] = v
+        }
+        fence = other.Fence
+    }
+
+    s.mu.Lock()
+    s.Locks = locks
+    s.Fence = fence
+    s.mu.Unlock()
+}
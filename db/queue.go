@@ -0,0 +1,245 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package db
+
+import (
+    "sync"
+)
+
+// 队列中的消息，时间为leader提交命令时的时间（UnixNano）
+type QueueMessage struct {
+    ID       uint64
+    Body     string
+    Enqueued int64
+    // 已经投递的次数
+    Deliveries int
+    // 最后一次投递的回执，ACK、NACK时使用，每次投递都不同
+    Receipt uint64
+    // 投递后在该时间之前对其他消费者不可见
+    Invisible int64
+}
+
+// Queue 按入队顺序保存消息，投递次数达到上限的消息移到Dead（死信）
+type Queue struct {
+    Messages []QueueMessage
+    Dead     []QueueMessage
+}
+
+type QueueStats struct {
+    Ready    int `json:"ready"`
+    InFlight int `json:"inFlight"`
+    Dead     int `json:"dead"`
+}
+
+// QueueStore 全部消息队列，Seq用于分配全部队列的消息id以及回执
+type QueueStore struct {
+    mu     sync.RWMutex
+    Queues map[string]*Queue
+    Seq    uint64
+}
+
+func newQueueStore() *QueueStore {
+    return &QueueStore{Queues: map[string]*Queue{}}
+}
+
+func (q *Queue) copy() *Queue {
+    return &Queue{
+        Messages: append([]QueueMessage(nil), q.Messages...),
+        Dead:     append([]QueueMessage(nil), q.Dead...),
+    }
+}
+
+// Enqueue 添加消息到队列末尾，返回消息id
+func (s *QueueStore) Enqueue(name, body string, now int64) uint64 {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    q, ok := s.Queues[name]
+    if !ok {
+        q = &Queue{}
+        s.Queues[name] = q
+    }
+    s.Seq++
+    q.Messages = append(q.Messages, QueueMessage{ID: s.Seq, Body: body, Enqueued: now})
+    return s.Seq
+}
+
+// Dequeue 投递第一条可见的消息，之后visibility时间内不可见。maxDeliveries大于0时，
+// 已经投递maxDeliveries次仍然没有ACK的消息移到死信
+func (s *QueueStore) Dequeue(name string, now, visibility int64, maxDeliveries int) (QueueMessage, bool) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    q, ok := s.Queues[name]
+    if !ok {
+        return QueueMessage{}, false
+    }
+    for i := 0; i < len(q.Messages); i++ {
+        m := &q.Messages[i]
+        if m.Invisible > now {
+            continue
+        }
+        if maxDeliveries > 0 && m.Deliveries >= maxDeliveries {
+            q.dead(i)
+            i--
+            continue
+        }
+        s.Seq++
+        m.Deliveries++
+        m.Receipt = s.Seq
+        m.Invisible = now + visibility
+        return *m, true
+    }
+    return QueueMessage{}, false
+}
+
+// Ack 删除回执为receipt并且仍然不可见的消息，返回是否删除。可见性超时后回执失效
+func (s *QueueStore) Ack(name string, receipt uint64, now int64) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    q, i := s.inFlight(name, receipt, now)
+    if i < 0 {
+        return false
+    }
+    q.Messages = append(q.Messages[:i], q.Messages[i+1:]...)
+    s.removeEmptyQueue(name, q)
+    return true
+}
+
+// Nack 消息在delay之后重新可见，投递次数达到maxDeliveries时移到死信
+func (s *QueueStore) Nack(name string, receipt uint64, now, delay int64, maxDeliveries int) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    q, i := s.inFlight(name, receipt, now)
+    if i < 0 {
+        return false
+    }
+    if maxDeliveries > 0 && q.Messages[i].Deliveries >= maxDeliveries {
+        q.dead(i)
+    } else {
+        q.Messages[i].Invisible = now + delay
+    }
+    return true
+}
+
+// Ready 是否有可以投递的消息
+func (s *QueueStore) Ready(name string, now int64) bool {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    if q, ok := s.Queues[name]; ok {
+        for i := range q.Messages {
+            if q.Messages[i].Invisible <= now {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+func (s *QueueStore) Stats(name string, now int64) QueueStats {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    stats := QueueStats{}
+    if q, ok := s.Queues[name]; ok {
+        for i := range q.Messages {
+            if q.Messages[i].Invisible > now {
+                stats.InFlight++
+            } else {
+                stats.Ready++
+            }
+        }
+        stats.Dead = len(q.Dead)
+    }
+    return stats
+}
+
+// DeadLetters 死信，按移入的顺序
+func (s *QueueStore) DeadLetters(name string) []QueueMessage {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    if q, ok := s.Queues[name]; ok {
+        return append([]QueueMessage(nil), q.Dead...)
+    }
+    return nil
+}
+
+// PurgeDead 清空死信，返回删除的消息数
+func (s *QueueStore) PurgeDead(name string) int {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    q, ok := s.Queues[name]
+    if !ok {
+        return 0
+    }
+    n := len(q.Dead)
+    q.Dead = nil
+    s.removeEmptyQueue(name, q)
+    return n
+}
+
+// 需要持有mu
+func (s *QueueStore) inFlight(name string, receipt uint64, now int64) (*Queue, int) {
+    q, ok := s.Queues[name]
+    if !ok {
+        return nil, -1
+    }
+    for i := range q.Messages {
+        if q.Messages[i].Receipt == receipt {
+            if q.Messages[i].Invisible <= now {
+                break
+            }
+            return q, i
+        }
+    }
+    return q, -1
+}
+
+// 需要持有mu
+func (s *QueueStore) removeEmptyQueue(name string, q *Queue) {
+    if len(q.Messages) == 0 && len(q.Dead) == 0 {
+        delete(s.Queues, name)
+    }
+}
+
+func (q *Queue) dead(i int) {
+    q.Dead = append(q.Dead, q.Messages[i])
+    q.Messages = append(q.Messages[:i], q.Messages[i+1:]...)
+}
+
+func (s *QueueStore) copy() *QueueStore {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    ret := &QueueStore{Queues: make(map[string]*Queue, len(s.Queues)), Seq: s.Seq}
+    for k, v := range s.Queues {
+        ret.Queues[k] = v.copy()
+    }
+    return ret
+}
+
+// other为nil时（快照中没有队列）清空
+func (s *QueueStore) restore(other *QueueStore) {
+    queues := map[string]*Queue{}
+    var seq uint64
+    if other != nil {
+        for k, v := range other.Queues {
+            queues[k] = v.copy()
+        }
+        seq = other.Seq
+    }
+
+    s.mu.Lock()
+    s.Queues = queues
+    s.Seq = seq
+    s.mu.Unlock()
+}
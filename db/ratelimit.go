@@ -0,0 +1,202 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package db
+
+import (
+    "sync"
+)
+
+const (
+    TokenBucket   = "token-bucket"
+    SlidingWindow = "sliding-window"
+
+    // 每次限流时最多检查的空闲限流器数
+    rateLimitSweep = 8
+)
+
+// 限流器，时间均为leader提交命令时的时间（UnixNano），每个副本上的结果相同
+type RateLimiter struct {
+    Algorithm string
+    // 令牌桶（GCRA）：令牌恢复满的时间
+    Tat int64
+    // 滑动窗口：窗口内通过的请求，按时间排序
+    Hits []RateLimitHit
+    // 之后状态与新建的限流器相同
+    Expire int64
+}
+
+type RateLimitHit struct {
+    Ts int64
+    N  int64
+}
+
+type RateLimitResult struct {
+    Allowed   bool
+    Limit     int64
+    Remaining int64
+    // 恢复到limit的时间
+    Reset int64
+    // 拒绝时可以通过的最早时间
+    RetryAt int64
+}
+
+// RateLimitStore 全部限流器
+type RateLimitStore struct {
+    mu       sync.Mutex
+    Limiters map[string]*RateLimiter
+}
+
+func newRateLimitStore() *RateLimitStore {
+    return &RateLimitStore{Limiters: map[string]*RateLimiter{}}
+}
+
+func (l *RateLimiter) copy() *RateLimiter {
+    c := *l
+    c.Hits = append([]RateLimitHit(nil), l.Hits...)
+    return &c
+}
+
+// Take 消耗name的cost个配额，每period最多limit个，返回是否通过以及剩余的配额。
+// 拒绝时不消耗配额；algorithm与之前不同时重新开始计数
+func (s *RateLimitStore) Take(name, algorithm string, now, period, limit, cost int64) RateLimitResult {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    l, ok := s.Limiters[name]
+    if !ok || l.Algorithm != algorithm || l.Expire <= now {
+        l = &RateLimiter{Algorithm: algorithm}
+    }
+    var ret RateLimitResult
+    if algorithm == SlidingWindow {
+        ret = l.slidingWindow(now, period, limit, cost)
+    } else {
+        ret = l.tokenBucket(now, period, limit, cost)
+    }
+    if l.Expire > now {
+        s.Limiters[name] = l
+    } else {
+        delete(s.Limiters, name)
+    }
+
+    // 删除部分空闲的限流器。空闲的限流器与不存在时的结果相同，各副本删除的不同不影响结果
+    n := 0
+    for k, v := range s.Limiters {
+        if n >= rateLimitSweep {
+            break
+        }
+        if v.Expire <= now {
+            delete(s.Limiters, k)
+        }
+        n++
+    }
+    return ret
+}
+
+// Reset 删除限流器，返回是否存在
+func (s *RateLimitStore) Reset(name string) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    _, ok := s.Limiters[name]
+    delete(s.Limiters, name)
+    return ok
+}
+
+func (s *RateLimitStore) copy() *RateLimitStore {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    ret := &RateLimitStore{Limiters: make(map[string]*RateLimiter, len(s.Limiters))}
+    for k, v := range s.Limiters {
+        ret.Limiters[k] = v.copy()
+    }
+    return ret
+}
+
+// other为nil时（快照中没有限流器）清空
+func (s *RateLimitStore) restore(other *RateLimitStore) {
+    limiters := map[string]*RateLimiter{}
+    if other != nil {
+        for k, v := range other.Limiters {
+            limiters[k] = v.copy()
+        }
+    }
+
+    s.mu.Lock()
+    s.Limiters = limiters
+    s.mu.Unlock()
+}
+
+// 每period/limit恢复一个令牌，最多limit个
+func (l *RateLimiter) tokenBucket(now, period, limit, cost int64) RateLimitResult {
+    interval := period / limit
+    if interval <= 0 {
+        interval = 1
+    }
+    tat := l.Tat
+    if tat < now {
+        tat = now
+    }
+    ret := RateLimitResult{Limit: limit}
+    if next := tat + interval*cost; next-now <= period {
+        tat = next
+        ret.Allowed = true
+    } else if cost <= limit {
+        ret.RetryAt = next - period
+    }
+    l.Tat, l.Expire = tat, tat
+    if tat-now < period {
+        ret.Remaining = (period - (tat - now)) / interval
+    }
+    ret.Reset = tat
+    return ret
+}
+
+// 任意period时间内通过的请求不超过limit
+func (l *RateLimiter) slidingWindow(now, period, limit, cost int64) RateLimitResult {
+    i := 0
+    for i < len(l.Hits) && l.Hits[i].Ts+period <= now {
+        i++
+    }
+    l.Hits = l.Hits[i:]
+    var used int64
+    for _, h := range l.Hits {
+        used += h.N
+    }
+
+    ret := RateLimitResult{Limit: limit}
+    if used+cost <= limit {
+        ret.Allowed = true
+        if cost > 0 {
+            if n := len(l.Hits); n > 0 && l.Hits[n-1].Ts == now {
+                l.Hits[n-1].N += cost
+            } else {
+                l.Hits = append(l.Hits, RateLimitHit{Ts: now, N: cost})
+            }
+            used += cost
+        }
+    } else if cost <= limit {
+        // 最早的请求移出窗口后空出足够的配额的时间
+        free := used + cost - limit
+        for _, h := range l.Hits {
+            free -= h.N
+            if free <= 0 {
+                ret.RetryAt = h.Ts + period
+                break
+            }
+        }
+    }
+    if used < limit {
+        ret.Remaining = limit - used
+    }
+    ret.Reset = now
+    if n := len(l.Hits); n > 0 {
+        ret.Reset = l.Hits[n-1].Ts + period
+    }
+    l.Expire = ret.Reset
+    return ret
+}
@@ -0,0 +1,224 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package db
+
+import (
+    "errors"
+    "sync"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// 客户端会话，时间为leader提交命令时的时间（UnixNano）。会话只由leader提交的命令删除，
+// 超过Expire但是还没有删除时仍然有效。会话删除后再删除绑定的临时key
+type Session struct {
+    Ttl    int64
+    Expire int64
+    // 绑定到会话的临时key
+    Keys map[string]bool
+}
+
+func (s Session) copy() Session {
+    keys := make(map[string]bool, len(s.Keys))
+    for k := range s.Keys {
+        keys[k] = true
+    }
+    s.Keys = keys
+    return s
+}
+
+// SessionStore 客户端会话以及临时key所属的会话。写入、删除key时需要先持有GacheDb的写锁再持有mu
+type SessionStore struct {
+    mu        sync.RWMutex
+    Sessions  map[string]Session
+    Ephemeral map[string]string
+}
+
+func newSessionStore() *SessionStore {
+    return &SessionStore{
+        Sessions:  map[string]Session{},
+        Ephemeral: map[string]string{},
+    }
+}
+
+// Create 创建会话，id已经存在时返回false
+func (s *SessionStore) Create(id string, now, ttl int64) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if _, ok := s.Sessions[id]; ok {
+        return false
+    }
+    s.Sessions[id] = Session{Ttl: ttl, Expire: now + ttl, Keys: map[string]bool{}}
+    return true
+}
+
+// KeepAlive 把会话的过期时间延长为now+ttl，会话不存在时返回false
+func (s *SessionStore) KeepAlive(id string, now int64) (Session, bool) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    sess, ok := s.Sessions[id]
+    if !ok {
+        return Session{}, false
+    }
+    sess.Expire = now + sess.Ttl
+    s.Sessions[id] = sess
+    return sess.copy(), true
+}
+
+// Remove 删除会话，force为false时只删除已经过期的会话。返回绑定的临时key，
+// 这些key随后通过GacheDb.DeleteEphemeral逐个删除
+func (s *SessionStore) Remove(id string, now int64, force bool) ([]string, bool) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    sess, ok := s.Sessions[id]
+    if !ok || !force && sess.Expire > now {
+        return nil, false
+    }
+    delete(s.Sessions, id)
+    keys := make([]string, 0, len(sess.Keys))
+    for k := range sess.Keys {
+        keys = append(keys, k)
+    }
+    return keys, true
+}
+
+func (s *SessionStore) Get(id string) (Session, bool) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    sess, ok := s.Sessions[id]
+    if !ok {
+        return Session{}, false
+    }
+    return sess.copy(), true
+}
+
+// Expired now时已经过期的会话及其ttl
+func (s *SessionStore) Expired(now int64) map[string]int64 {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    ret := map[string]int64{}
+    for id, sess := range s.Sessions {
+        if sess.Expire <= now {
+            ret[id] = sess.Ttl
+        }
+    }
+    return ret
+}
+
+// OrphanKeys 绑定的会话已经删除但是还没有删除的临时key（如leader删除过程中切换），返回key到会话id的映射
+func (s *SessionStore) OrphanKeys() map[string]string {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    ret := map[string]string{}
+    for k, id := range s.Ephemeral {
+        if _, ok := s.Sessions[id]; !ok {
+            ret[k] = id
+        }
+    }
+    return ret
+}
+
+// 再次写入或者删除key时解除与会话的绑定
+func (s *SessionStore) unbind(k string) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    s.unbindLocked(k)
+}
+
+// 需要持有mu
+func (s *SessionStore) unbindLocked(k string) {
+    id, ok := s.Ephemeral[k]
+    if !ok {
+        return
+    }
+    delete(s.Ephemeral, k)
+    if sess, ok := s.Sessions[id]; ok {
+        delete(sess.Keys, k)
+    }
+}
+
+func (s *SessionStore) copy() *SessionStore {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    ret := &SessionStore{
+        Sessions:  make(map[string]Session, len(s.Sessions)),
+        Ephemeral: make(map[string]string, len(s.Ephemeral)),
+    }
+    for k, v := range s.Sessions {
+        ret.Sessions[k] = v.copy()
+    }
+    for k, v := range s.Ephemeral {
+        ret.Ephemeral[k] = v
+    }
+    return ret
+}
+
+// other为nil时（快照中没有会话）清空
+func (s *SessionStore) restore(other *SessionStore) {
+    sessions := map[string]Session{}
+    ephemeral := map[string]string{}
+    if other != nil {
+        for k, v := range other.Sessions {
+            sessions[k] = v.copy()
+        }
+        for k, v := range other.Ephemeral {
+            ephemeral[k] = v
+        }
+    }
+
+    s.mu.Lock()
+    s.Sessions = sessions
+    s.Ephemeral = ephemeral
+    s.mu.Unlock()
+}
+
+// SetEphemeral 设置绑定到会话id的临时key，会话不存在时返回ErrSessionNotFound
+func (db *GacheDb) SetEphemeral(k, v, id string, ts int64) error {
+    db.mutex.Lock()
+    defer db.mutex.Unlock()
+    s := db.Sessions
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    sess, ok := s.Sessions[id]
+    if !ok {
+        return ErrSessionNotFound
+    }
+    db.put(k, v, ts)
+    s.unbindLocked(k)
+    s.Ephemeral[k] = id
+    sess.Keys[k] = true
+    return nil
+}
+
+// DeleteEphemeral key仍然绑定在已经删除的会话id上时删除，返回是否删除
+func (db *GacheDb) DeleteEphemeral(k, id string) bool {
+    db.mutex.Lock()
+    defer db.mutex.Unlock()
+    s := db.Sessions
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if s.Ephemeral[k] != id {
+        return false
+    }
+    if _, ok := s.Sessions[id]; ok {
+        return false
+    }
+    if db.remove(k) {
+        s.unbindLocked(k)
+    }
+    return true
+}
@@ -0,0 +1,166 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package auth
+
+import (
+    "context"
+    "crypto/tls"
+    "errors"
+    "github.com/xfali/gache/config"
+    "net/http"
+    "strings"
+    "sync"
+)
+
+const (
+    MethodToken = "token"
+    MethodHmac  = "hmac"
+    MethodMTLS  = "mtls"
+)
+
+var (
+    ErrNoCredentials      = errors.New("no credentials")
+    ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Principal 通过认证的调用方，后续的授权根据Name判断
+type Principal struct {
+    Name   string `json:"name"`
+    Method string `json:"method"`
+}
+
+type Authenticator interface {
+    // 请求中没有该认证方式的凭证时返回ErrNoCredentials
+    Authenticate(req *http.Request) (*Principal, error)
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+    return context.WithValue(ctx, principalKey{}, p)
+}
+
+// 未开启认证时返回nil
+func FromContext(ctx context.Context) *Principal {
+    p, _ := ctx.Value(principalKey{}).(*Principal)
+    return p
+}
+
+// Auth 依次尝试各认证方式，未配置任何认证方式时不做认证
+type Auth struct {
+    mu    sync.RWMutex
+    chain []Authenticator
+    // 重新加载配置后继续使用，避免重放之前的请求
+    nonces *nonceCache
+}
+
+func New(conf *config.Config) (*Auth, error) {
+    a := &Auth{nonces: newNonceCache()}
+    return a, a.Update(conf)
+}
+
+// 根据配置重建认证方式，用于运行时重新加载token和hmac key
+func (a *Auth) Update(conf *config.Config) error {
+    var chain []Authenticator
+    if conf.TlsClientCA != "" {
+        chain = append(chain, &certAuthenticator{})
+    }
+    if conf.AuthTokens != "" {
+        tokens, err := ParsePairs(conf.AuthTokens)
+        if err != nil {
+            return err
+        }
+        chain = append(chain, NewTokenAuthenticator(tokens))
+    }
+    if conf.AuthHmacKeys != "" {
+        keys, err := ParsePairs(conf.AuthHmacKeys)
+        if err != nil {
+            return err
+        }
+        h := NewHmacAuthenticator(keys, conf.AuthHmacSkew, int64(conf.AuthHmacMaxBody))
+        h.nonces = a.nonces
+        chain = append(chain, h)
+    }
+
+    a.mu.Lock()
+    a.chain = chain
+    a.mu.Unlock()
+    return nil
+}
+
+func (a *Auth) Enabled() bool {
+    a.mu.RLock()
+    defer a.mu.RUnlock()
+
+    return len(a.chain) > 0
+}
+
+func (a *Auth) Authenticate(req *http.Request) (*Principal, error) {
+    a.mu.RLock()
+    chain := a.chain
+    a.mu.RUnlock()
+
+    for _, v := range chain {
+        p, err := v.Authenticate(req)
+        if err == ErrNoCredentials {
+            continue
+        }
+        return p, err
+    }
+    return nil, ErrNoCredentials
+}
+
+// AuthenticateConn 认证HTTP以外的连接（如RESP）：token为客户端提供的Bearer token，
+// state为TLS连接的状态，可以为nil。使用与HTTP请求相同的token和客户端证书认证
+func (a *Auth) AuthenticateConn(state *tls.ConnectionState, token string) (*Principal, error) {
+    req := &http.Request{Header: http.Header{}, TLS: state}
+    if token != "" {
+        req.Header.Set("Authorization", bearerPrefix+token)
+    }
+    return a.Authenticate(req)
+}
+
+// Wrap 认证通过后将Principal放入请求的context
+func (a *Auth) Wrap(next http.HandlerFunc) http.HandlerFunc {
+    return func(resp http.ResponseWriter, req *http.Request) {
+        if !a.Enabled() {
+            next(resp, req)
+            return
+        }
+
+        p, err := a.Authenticate(req)
+        if err == ErrBodyTooLarge {
+            resp.WriteHeader(http.StatusRequestEntityTooLarge)
+            resp.Write([]byte(err.Error()))
+            return
+        }
+        if err != nil {
+            resp.Header().Set("WWW-Authenticate", `Bearer realm="gache"`)
+            resp.WriteHeader(http.StatusUnauthorized)
+            resp.Write([]byte(err.Error()))
+            return
+        }
+        next(resp, req.WithContext(WithPrincipal(req.Context(), p)))
+    }
+}
+
+// 解析 NAME=SECRET,NAME2=SECRET2 格式的配置，返回 NAME -> SECRET
+func ParsePairs(s string) (map[string]string, error) {
+    ret := map[string]string{}
+    for _, v := range strings.Split(s, ",") {
+        v = strings.TrimSpace(v)
+        if v == "" {
+            continue
+        }
+        kv := strings.SplitN(v, "=", 2)
+        if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+            return nil, errors.New("credentials must be NAME=SECRET[,NAME=SECRET]")
+        }
+        ret[kv[0]] = kv[1]
+    }
+    return ret, nil
+}
@@ -0,0 +1,256 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package auth
+
+import (
+    "bytes"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/hex"
+    "fmt"
+    "github.com/xfali/gache/config"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestToken(t *testing.T) {
+    a := NewTokenAuthenticator(map[string]string{"alice": "t1", "bob": "t2"})
+    cases := []struct {
+        header string
+        user   string
+        err    error
+    }{
+        {"Bearer t1", "alice", nil},
+        {"Bearer  t2 ", "bob", nil},
+        {"Bearer t3", "", ErrInvalidCredentials},
+        {"Bearer ", "", ErrInvalidCredentials},
+        {"", "", ErrNoCredentials},
+        {"Basic dDE=", "", ErrNoCredentials},
+    }
+    for _, c := range cases {
+        req := httptest.NewRequest(http.MethodGet, "/key/a", nil)
+        if c.header != "" {
+            req.Header.Set("Authorization", c.header)
+        }
+        p, err := a.Authenticate(req)
+        if err != c.err {
+            t.Fatalf("%q: %v, want %v", c.header, err, c.err)
+        }
+        if err == nil && (p.Name != c.user || p.Method != MethodToken) {
+            t.Fatalf("%q: %+v", c.header, p)
+        }
+    }
+}
+
+func hmacHeader(key, method, uri string, ts int64, nonce string, body []byte) string {
+    tss := strconv.FormatInt(ts, 10)
+    sig := Sign(key, method, uri, tss, nonce, body)
+    return fmt.Sprintf("%s user=alice,ts=%s,nonce=%s,sig=%s", HmacScheme, tss, nonce, hex.EncodeToString(sig))
+}
+
+func TestHmac(t *testing.T) {
+    now := time.Now().Unix()
+    body := []byte("value")
+    cases := []struct {
+        name   string
+        header string
+        body   []byte
+        err    string
+    }{
+        {"valid", hmacHeader("k1", http.MethodPut, "/key/a", now, "n1", body), body, ""},
+        {"wrong key", hmacHeader("k2", http.MethodPut, "/key/a", now, "n2", body), body, ErrInvalidCredentials.Error()},
+        {"body changed", hmacHeader("k1", http.MethodPut, "/key/a", now, "n3", body), []byte("other"), ErrInvalidCredentials.Error()},
+        {"uri changed", hmacHeader("k1", http.MethodPut, "/key/b", now, "n4", body), body, ErrInvalidCredentials.Error()},
+        {"expired", hmacHeader("k1", http.MethodPut, "/key/a", now-120, "n5", body), body, "signature expired"},
+        {"future", hmacHeader("k1", http.MethodPut, "/key/a", now+120, "n6", body), body, "signature expired"},
+        {"no nonce", hmacHeader("k1", http.MethodPut, "/key/a", now, "", body), body, ErrInvalidCredentials.Error()},
+        {"long nonce", hmacHeader("k1", http.MethodPut, "/key/a", now, strings.Repeat("n", 65), body), body, ErrInvalidCredentials.Error()},
+        {"too large", hmacHeader("k1", http.MethodPut, "/key/a", now, "n7", bytes.Repeat([]byte("x"), 17)), bytes.Repeat([]byte("x"), 17), ErrBodyTooLarge.Error()},
+        {"bad sig", HmacScheme + " user=alice,ts=1,nonce=n,sig=zz", body, ErrInvalidCredentials.Error()},
+        {"other scheme", "Bearer k1", body, ErrNoCredentials.Error()},
+    }
+    a := NewHmacAuthenticator(map[string]string{"alice": "k1"}, time.Minute, 16)
+    for _, c := range cases {
+        t.Run(c.name, func(t *testing.T) {
+            req := httptest.NewRequest(http.MethodPut, "/key/a", bytes.NewReader(c.body))
+            req.Header.Set("Authorization", c.header)
+            p, err := a.Authenticate(req)
+            got := ""
+            if err != nil {
+                got = err.Error()
+            }
+            if got != c.err {
+                t.Fatalf("%q, want %q", got, c.err)
+            }
+            if err != nil {
+                return
+            }
+            if p.Name != "alice" || p.Method != MethodHmac {
+                t.Fatalf("principal: %+v", p)
+            }
+            // 后续处理仍然可以读取body
+            if b, _ := ioutil.ReadAll(req.Body); !bytes.Equal(b, c.body) {
+                t.Fatalf("body: %q", b)
+            }
+        })
+    }
+}
+
+func TestHmacReplay(t *testing.T) {
+    a := NewHmacAuthenticator(map[string]string{"alice": "k1"}, time.Minute, 0)
+    header := hmacHeader("k1", http.MethodDelete, "/key/a", time.Now().Unix(), "n1", nil)
+    for i, want := range []error{nil, ErrReplayed} {
+        req := httptest.NewRequest(http.MethodDelete, "/key/a", nil)
+        req.Header.Set("Authorization", header)
+        if _, err := a.Authenticate(req); err != want {
+            t.Fatalf("request %d: %v, want %v", i, err, want)
+        }
+    }
+
+    // 过期的nonce被清理
+    c := newNonceCache()
+    now := time.Now()
+    if !c.add("n", now, now.Add(time.Second)) || c.add("n", now, now.Add(time.Second)) {
+        t.Fatal("nonce not recorded")
+    }
+    if !c.add("n", now.Add(2*time.Second), now.Add(3*time.Second)) || len(c.seen) != 1 {
+        t.Fatalf("expired nonce: %v", c.seen)
+    }
+}
+
+func TestSignRequest(t *testing.T) {
+    a := NewHmacAuthenticator(map[string]string{"alice": "k1"}, time.Minute, 0)
+    body := []byte("v")
+    for i := 0; i < 2; i++ {
+        req := httptest.NewRequest(http.MethodPut, "/key/a%20b?ttl=1s", bytes.NewReader(body))
+        SignRequest(req, "alice", "k1", body)
+        if _, err := a.Authenticate(req); err != nil {
+            t.Fatalf("request %d: %v", i, err)
+        }
+    }
+}
+
+func TestCert(t *testing.T) {
+    chain := func(cn string) [][]*x509.Certificate {
+        return [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: cn}}}}
+    }
+    cases := []struct {
+        name  string
+        state *tls.ConnectionState
+        user  string
+        err   error
+    }{
+        {"verified", &tls.ConnectionState{VerifiedChains: chain("alice")}, "alice", nil},
+        {"no cn", &tls.ConnectionState{VerifiedChains: chain("")}, "", ErrInvalidCredentials},
+        {"not verified", &tls.ConnectionState{}, "", ErrNoCredentials},
+        {"plain http", nil, "", ErrNoCredentials},
+    }
+    a := &certAuthenticator{}
+    for _, c := range cases {
+        req := httptest.NewRequest(http.MethodGet, "/key/a", nil)
+        req.TLS = c.state
+        p, err := a.Authenticate(req)
+        if err != c.err {
+            t.Fatalf("%s: %v, want %v", c.name, err, c.err)
+        }
+        if err == nil && (p.Name != c.user || p.Method != MethodMTLS) {
+            t.Fatalf("%s: %+v", c.name, p)
+        }
+    }
+}
+
+func TestWrap(t *testing.T) {
+    conf := config.Default()
+    conf.AuthTokens = "alice=t1"
+    conf.AuthHmacKeys = "bob=k1"
+    conf.AuthHmacMaxBody = 16
+    a, err := New(conf)
+    if err != nil {
+        t.Fatal(err)
+    }
+    h := a.Wrap(func(resp http.ResponseWriter, req *http.Request) {
+        resp.Write([]byte(FromContext(req.Context()).Name))
+    })
+
+    large := bytes.Repeat([]byte("x"), 17)
+    cases := []struct {
+        name   string
+        header string
+        body   []byte
+        code   int
+        user   string
+    }{
+        {"token", "Bearer t1", nil, http.StatusOK, "alice"},
+        {"hmac", "", []byte("v"), http.StatusOK, "bob"},
+        {"invalid token", "Bearer t2", nil, http.StatusUnauthorized, ""},
+        {"no credentials", "", nil, http.StatusUnauthorized, ""},
+        {"too large", "", large, http.StatusRequestEntityTooLarge, ""},
+    }
+    for _, c := range cases {
+        req := httptest.NewRequest(http.MethodPut, "/key/a", bytes.NewReader(c.body))
+        if c.header != "" {
+            req.Header.Set("Authorization", c.header)
+        } else if c.body != nil {
+            SignRequest(req, "bob", "k1", c.body)
+        }
+        resp := httptest.NewRecorder()
+        h(resp, req)
+        if resp.Code != c.code || c.code == http.StatusOK && resp.Body.String() != c.user {
+            t.Fatalf("%s: %d %q", c.name, resp.Code, resp.Body.String())
+        }
+    }
+
+    // 重新加载后之前的nonce仍然不能重放
+    req := httptest.NewRequest(http.MethodDelete, "/key/a", nil)
+    SignRequest(req, "bob", "k1", nil)
+    replay := req.Clone(req.Context())
+    h(httptest.NewRecorder(), req)
+    if err := a.Update(conf); err != nil {
+        t.Fatal(err)
+    }
+    resp := httptest.NewRecorder()
+    h(resp, replay)
+    if resp.Code != http.StatusUnauthorized {
+        t.Fatalf("replay after reload: %d", resp.Code)
+    }
+}
+
+func TestAuthenticateConn(t *testing.T) {
+    conf := config.Default()
+    conf.AuthTokens = "alice=t1"
+    conf.AuthHmacKeys = "bob=k1"
+    conf.TlsClientCA = "ca.pem"
+    a, err := New(conf)
+    if err != nil {
+        t.Fatal(err)
+    }
+    verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "carol"}}}}}
+    cases := []struct {
+        name  string
+        state *tls.ConnectionState
+        token string
+        user  string
+        err   error
+    }{
+        {"token", nil, "t1", "alice", nil},
+        {"cert", verified, "", "carol", nil},
+        {"invalid token", nil, "t2", "", ErrInvalidCredentials},
+        {"no credentials", &tls.ConnectionState{}, "", "", ErrNoCredentials},
+    }
+    for _, c := range cases {
+        p, err := a.AuthenticateConn(c.state, c.token)
+        if err != c.err || err == nil && p.Name != c.user {
+            t.Fatalf("%s: %+v %v", c.name, p, err)
+        }
+    }
+}
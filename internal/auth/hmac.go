@@ -0,0 +1,174 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package auth
+
+import (
+    "bytes"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+const (
+    HmacScheme = "GACHE-HMAC-SHA256"
+    // 默认允许签名的body大小
+    DefaultHmacMaxBody = 4 << 20
+    maxNonceLen        = 64
+)
+
+var (
+    ErrBodyTooLarge = errors.New("request body too large")
+    ErrReplayed     = errors.New("nonce already used")
+)
+
+// HmacAuthenticator HMAC签名认证：
+//   Authorization: GACHE-HMAC-SHA256 user=NAME,ts=UNIX_SECONDS,nonce=RANDOM,sig=HEX
+// sig = HMAC-SHA256(KEY, METHOD + "\n" + REQUEST_URI + "\n" + ts + "\n" + nonce + "\n" + HEX(SHA256(BODY)))
+// 时间偏差内每个nonce只能使用一次，body超过maxBody时在校验签名之前拒绝
+type HmacAuthenticator struct {
+    keys    map[string]string
+    skew    time.Duration
+    maxBody int64
+    nonces  *nonceCache
+}
+
+// keys: NAME -> KEY，skew为允许的时间偏差，maxBody为允许签名的body大小
+func NewHmacAuthenticator(keys map[string]string, skew time.Duration, maxBody int64) *HmacAuthenticator {
+    if skew <= 0 {
+        skew = time.Minute
+    }
+    if maxBody <= 0 {
+        maxBody = DefaultHmacMaxBody
+    }
+    return &HmacAuthenticator{keys: keys, skew: skew, maxBody: maxBody, nonces: newNonceCache()}
+}
+
+func (a *HmacAuthenticator) Authenticate(req *http.Request) (*Principal, error) {
+    h := req.Header.Get("Authorization")
+    if !strings.HasPrefix(h, HmacScheme+" ") {
+        return nil, ErrNoCredentials
+    }
+
+    params := map[string]string{}
+    for _, v := range strings.Split(h[len(HmacScheme)+1:], ",") {
+        kv := strings.SplitN(strings.TrimSpace(v), "=", 2)
+        if len(kv) == 2 {
+            params[kv[0]] = kv[1]
+        }
+    }
+    user, ts, nonce := params["user"], params["ts"], params["nonce"]
+    sig, err := hex.DecodeString(params["sig"])
+    if user == "" || ts == "" || nonce == "" || len(nonce) > maxNonceLen || err != nil {
+        return nil, ErrInvalidCredentials
+    }
+
+    key, ok := a.keys[user]
+    if !ok {
+        return nil, ErrInvalidCredentials
+    }
+    sec, err := strconv.ParseInt(ts, 10, 64)
+    if err != nil {
+        return nil, ErrInvalidCredentials
+    }
+    now := time.Now()
+    signed := time.Unix(sec, 0)
+    if d := now.Sub(signed); d > a.skew || d < -a.skew {
+        return nil, errors.New("signature expired")
+    }
+
+    body, err := readBody(req, a.maxBody)
+    if err != nil {
+        return nil, err
+    }
+    if !hmac.Equal(sig, Sign(key, req.Method, req.RequestURI, ts, nonce, body)) {
+        return nil, ErrInvalidCredentials
+    }
+    // 签名正确后才记录nonce，超过时间偏差的请求已经被拒绝，nonce不需要保留更久
+    if !a.nonces.add(user+"\n"+nonce, now, signed.Add(a.skew)) {
+        return nil, ErrReplayed
+    }
+    return &Principal{Name: user, Method: MethodHmac}, nil
+}
+
+// Sign 计算请求签名，客户端使用同样的方法生成sig
+func Sign(key, method, requestURI, ts, nonce string, body []byte) []byte {
+    sum := sha256.Sum256(body)
+    mac := hmac.New(sha256.New, []byte(key))
+    fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s", method, requestURI, ts, nonce, hex.EncodeToString(sum[:]))
+    return mac.Sum(nil)
+}
+
+// SignRequest 为请求添加HMAC签名头，每次使用新的随机nonce
+func SignRequest(req *http.Request, user, key string, body []byte) {
+    ts := strconv.FormatInt(time.Now().Unix(), 10)
+    b := make([]byte, 16)
+    rand.Read(b)
+    nonce := hex.EncodeToString(b)
+    sig := Sign(key, req.Method, req.URL.RequestURI(), ts, nonce, body)
+    req.Header.Set("Authorization", fmt.Sprintf("%s user=%s,ts=%s,nonce=%s,sig=%s", HmacScheme, user, ts, nonce, hex.EncodeToString(sig)))
+}
+
+// 读取body用于签名校验，并重新设置req.Body供后续处理。超过max时不再读取
+func readBody(req *http.Request, max int64) ([]byte, error) {
+    if req.Body == nil {
+        return nil, nil
+    }
+    if req.ContentLength > max {
+        return nil, ErrBodyTooLarge
+    }
+    b, err := ioutil.ReadAll(http.MaxBytesReader(nil, req.Body, max))
+    req.Body.Close()
+    if err != nil {
+        if len(b) >= int(max) {
+            return nil, ErrBodyTooLarge
+        }
+        return nil, err
+    }
+    req.Body = ioutil.NopCloser(bytes.NewReader(b))
+    return b, nil
+}
+
+// nonceCache 记录时间偏差内已经使用的nonce
+type nonceCache struct {
+    mu   sync.Mutex
+    seen map[string]time.Time
+    // 下次清理过期nonce的时间
+    sweep time.Time
+}
+
+func newNonceCache() *nonceCache {
+    return &nonceCache{seen: map[string]time.Time{}}
+}
+
+// add 记录nonce直到expire，nonce仍未过期时返回false
+func (c *nonceCache) add(nonce string, now, expire time.Time) bool {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if now.After(c.sweep) {
+        for k, v := range c.seen {
+            if !v.After(now) {
+                delete(c.seen, k)
+            }
+        }
+        c.sweep = now.Add(time.Second)
+    }
+    if v, ok := c.seen[nonce]; ok && v.After(now) {
+        return false
+    }
+    c.seen[nonce] = expire
+    return true
+}
@@ -0,0 +1,136 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package auth
+
+import (
+    "crypto/tls"
+    "crypto/x509"
+    "errors"
+    "github.com/xfali/gache/config"
+    "io/ioutil"
+    "net/http"
+    "time"
+)
+
+// certAuthenticator 使用经过校验的客户端证书的CommonName作为Principal
+type certAuthenticator struct{}
+
+func (a *certAuthenticator) Authenticate(req *http.Request) (*Principal, error) {
+    if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+        return nil, ErrNoCredentials
+    }
+    cn := req.TLS.VerifiedChains[0][0].Subject.CommonName
+    if cn == "" {
+        return nil, ErrInvalidCredentials
+    }
+    return &Principal{Name: cn, Method: MethodMTLS}, nil
+}
+
+func TLSEnabled(conf *config.Config) bool {
+    return conf.TlsCert != ""
+}
+
+// ServerTLSConfig 配置了tls-client-ca时校验客户端证书（未提供证书的客户端仍可以使用其他认证方式）
+func ServerTLSConfig(conf *config.Config) (*tls.Config, error) {
+    cert, err := tls.LoadX509KeyPair(conf.TlsCert, conf.TlsKey)
+    if err != nil {
+        return nil, err
+    }
+    ret := &tls.Config{
+        Certificates: []tls.Certificate{cert},
+        MinVersion:   tls.VersionTLS12,
+    }
+    if conf.TlsClientCA != "" {
+        pool, err := loadPool(conf.TlsClientCA)
+        if err != nil {
+            return nil, err
+        }
+        ret.ClientCAs = pool
+        ret.ClientAuth = tls.VerifyClientCertIfGiven
+    }
+    return ret, nil
+}
+
+// ClientTLSConfig 节点之间调用HTTP接口时使用，tls-ca用于校验服务端证书，并携带本节点证书
+func ClientTLSConfig(conf *config.Config) (*tls.Config, error) {
+    ret := &tls.Config{
+        MinVersion: tls.VersionTLS12,
+    }
+    if conf.TlsCA != "" {
+        pool, err := loadPool(conf.TlsCA)
+        if err != nil {
+            return nil, err
+        }
+        ret.RootCAs = pool
+    }
+    if conf.TlsCert != "" {
+        cert, err := tls.LoadX509KeyPair(conf.TlsCert, conf.TlsKey)
+        if err != nil {
+            return nil, err
+        }
+        ret.Certificates = []tls.Certificate{cert}
+    }
+    return ret, nil
+}
+
+// PeerTLSConfig raft节点之间双向认证：使用本节点证书，并用tls-ca校验对端证书
+func PeerTLSConfig(conf *config.Config) (server *tls.Config, client *tls.Config, err error) {
+    cert, err := tls.LoadX509KeyPair(conf.TlsCert, conf.TlsKey)
+    if err != nil {
+        return nil, nil, err
+    }
+    pool, err := loadPool(conf.TlsCA)
+    if err != nil {
+        return nil, nil, err
+    }
+    server = &tls.Config{
+        Certificates: []tls.Certificate{cert},
+        ClientCAs:    pool,
+        ClientAuth:   tls.RequireAndVerifyClientCert,
+        MinVersion:   tls.VersionTLS12,
+    }
+    client = &tls.Config{
+        Certificates: []tls.Certificate{cert},
+        RootCAs:      pool,
+        MinVersion:   tls.VersionTLS12,
+    }
+    return server, client, nil
+}
+
+func loadPool(path string) (*x509.CertPool, error) {
+    b, err := ioutil.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    pool := x509.NewCertPool()
+    if !pool.AppendCertsFromPEM(b) {
+        return nil, errors.New("no certificate found in " + path)
+    }
+    return pool, nil
+}
+
+// NewClient 返回节点之间调用HTTP接口的client，以及对应的scheme
+func NewClient(conf *config.Config) (*http.Client, string, error) {
+    if !TLSEnabled(conf) {
+        return &http.Client{Timeout: 10 * time.Second}, "http", nil
+    }
+    tlsConf, err := ClientTLSConfig(conf)
+    if err != nil {
+        return nil, "", err
+    }
+    return &http.Client{
+        Transport: &http.Transport{TLSClientConfig: tlsConf},
+        Timeout:   10 * time.Second,
+    }, "https", nil
+}
+
+// SetClientAuth 节点之间调用HTTP接口时携带auth-client-token
+func SetClientAuth(conf *config.Config, req *http.Request) {
+    if conf.AuthClientToken != "" {
+        req.Header.Set("Authorization", bearerPrefix+conf.AuthClientToken)
+    }
+}
@@ -0,0 +1,40 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package auth
+
+import (
+    "crypto/subtle"
+    "net/http"
+    "strings"
+)
+
+const bearerPrefix = "Bearer "
+
+// TokenAuthenticator 静态Bearer token认证：Authorization: Bearer TOKEN
+type TokenAuthenticator struct {
+    users map[string]string
+}
+
+// users: NAME -> TOKEN
+func NewTokenAuthenticator(users map[string]string) *TokenAuthenticator {
+    return &TokenAuthenticator{users: users}
+}
+
+func (a *TokenAuthenticator) Authenticate(req *http.Request) (*Principal, error) {
+    h := req.Header.Get("Authorization")
+    if !strings.HasPrefix(h, bearerPrefix) {
+        return nil, ErrNoCredentials
+    }
+    token := []byte(strings.TrimSpace(h[len(bearerPrefix):]))
+
+    for name, v := range a.users {
+        if subtle.ConstantTimeCompare(token, []byte(v)) == 1 {
+            return &Principal{Name: name, Method: MethodToken}, nil
+        }
+    }
+    return nil, ErrInvalidCredentials
+}
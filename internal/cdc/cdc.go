@@ -0,0 +1,180 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+// Package cdc 把应用的raft日志中key的修改作为变更数据流（change data capture）。
+// offset为raft日志的index，每个副本上的index相同，消费者处理完记录后提交offset，
+// 重新连接（或切换到其他副本）时从offset之后继续读取，保证每条记录至少处理一次
+package cdc
+
+import (
+    "context"
+    "fmt"
+    "github.com/xfali/gache/command"
+    "github.com/xfali/gache/db"
+    "sync"
+    "time"
+)
+
+const (
+    Set    = "set"
+    Delete = "delete"
+)
+
+type Record struct {
+    // 所在raft日志的index，批量提交时多条记录的index相同
+    Index uint64    `json:"index"`
+    Time  time.Time `json:"time"`
+    Op    string    `json:"op"`
+    Key   string    `json:"key"`
+    Value string    `json:"value,omitempty"`
+}
+
+// CompactedError from之后的记录已经不在缓冲区中，Oldest之后的记录是完整的
+type CompactedError struct {
+    Oldest uint64
+}
+
+func (e *CompactedError) Error() string {
+    return fmt.Sprintf("offset compacted, records after %d are available", e.Oldest)
+}
+
+// Log 保存最近的记录
+type Log struct {
+    mu    sync.Mutex
+    buf   []Record
+    start int
+    size  int
+    // index不大于floor的记录可能已经丢弃
+    floor uint64
+    // 最后应用的日志index
+    last   uint64
+    notify chan struct{}
+}
+
+// NewLog 最多保留size条记录
+func NewLog(size int) *Log {
+    return &Log{
+        buf:    make([]Record, size),
+        notify: make(chan struct{}),
+    }
+}
+
+// Append 应用第index条日志后调用，version为执行命令前db的版本号，修改了key时记录。l为nil时忽略
+func (l *Log) Append(index, version uint64, d *db.GacheDb, req *command.Request) {
+    if l == nil {
+        return
+    }
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    l.last = index
+    if d.Version() == version {
+        return
+    }
+    rec := Record{Index: index, Op: Delete, Key: req.K}
+    if req.Ts != 0 {
+        rec.Time = time.Unix(0, req.Ts).UTC()
+    } else {
+        rec.Time = time.Now().UTC()
+    }
+    if v, ok := d.Lookup(req.K); ok {
+        rec.Op, rec.Value = Set, v
+    }
+
+    if l.size < len(l.buf) {
+        l.buf[(l.start+l.size)%len(l.buf)] = rec
+        l.size++
+    } else {
+        if old := l.buf[l.start].Index; old > l.floor {
+            l.floor = old
+        }
+        l.buf[l.start] = rec
+        l.start = (l.start + 1) % len(l.buf)
+    }
+    close(l.notify)
+    l.notify = make(chan struct{})
+}
+
+// Reset 从快照恢复后调用，index为快照的日志index，之前的记录不再可用
+func (l *Log) Reset(index uint64) {
+    if l == nil {
+        return
+    }
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    l.start, l.size = 0, 0
+    l.floor, l.last = index, index
+}
+
+// Read 返回index大于from的记录，最多limit条，同一条日志的记录不会拆分。
+// limit不大于0时不限制条数。没有新的记录时最多等待wait。next为下一次读取的from：有记录时为最后一条记录的index，否则为最后应用的日志index
+func (l *Log) Read(ctx context.Context, from uint64, limit int, wait time.Duration) (records []Record, next uint64, err error) {
+    var timeout <-chan time.Time
+    if wait > 0 {
+        t := time.NewTimer(wait)
+        defer t.Stop()
+        timeout = t.C
+    }
+    for {
+        l.mu.Lock()
+        if from < l.floor {
+            l.mu.Unlock()
+            return nil, 0, &CompactedError{Oldest: l.floor}
+        }
+        for i := 0; i < l.size; i++ {
+            rec := l.buf[(l.start+i)%len(l.buf)]
+            if rec.Index <= from {
+                continue
+            }
+            if limit > 0 && len(records) >= limit && rec.Index != records[len(records)-1].Index {
+                break
+            }
+            records = append(records, rec)
+        }
+        next = l.last
+        if len(records) > 0 {
+            next = records[len(records)-1].Index
+        }
+        if next < from {
+            next = from
+        }
+        notify := l.notify
+        l.mu.Unlock()
+
+        if len(records) > 0 || timeout == nil {
+            return records, next, nil
+        }
+        select {
+        case <-notify:
+        case <-timeout:
+            return nil, next, nil
+        case <-ctx.Done():
+            return nil, next, ctx.Err()
+        }
+    }
+}
+
+// Pending index大于from的记录数以及其中第一条记录的时间
+func (l *Log) Pending(from uint64) (int, time.Time) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    for i := 0; i < l.size; i++ {
+        rec := l.buf[(l.start+i)%len(l.buf)]
+        if rec.Index > from {
+            return l.size - i, rec.Time
+        }
+    }
+    return 0, time.Time{}
+}
+
+// Index 最后应用的日志index
+func (l *Log) Index() uint64 {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    return l.last
+}
@@ -0,0 +1,180 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package cdc
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "github.com/hashicorp/go-hclog"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync/atomic"
+    "time"
+)
+
+const (
+    offsetFile    = "offset"
+    segmentSuffix = ".ndjson"
+    // 每次从Log读取的最大记录数
+    sinkBatch = 1000
+    sinkWait  = time.Second
+    // 写入失败后重试的间隔
+    sinkRetry = time.Second
+)
+
+// FileSink 把记录导出到dir下的NDJSON文件，每行一条记录，文件名为第一条记录的index，
+// 超过maxBytes后写入新的文件。已经写入的offset保存在dir/offset中，重启后从之后的记录继续，
+// 写入记录与保存offset之间崩溃时重启后会重复写入这些记录（至少一次）
+type FileSink struct {
+    log      *Log
+    dir      string
+    maxBytes int64
+    logger   hclog.Logger
+
+    offset uint64
+    f      *os.File
+    size   int64
+
+    cancel context.CancelFunc
+    done   chan struct{}
+}
+
+func NewFileSink(l *Log, dir string, maxBytes int, logger hclog.Logger) (*FileSink, error) {
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return nil, err
+    }
+    s := &FileSink{
+        log:      l,
+        dir:      dir,
+        maxBytes: int64(maxBytes),
+        logger:   logger.Named("cdc"),
+        done:     make(chan struct{}),
+    }
+    b, err := ioutil.ReadFile(filepath.Join(dir, offsetFile))
+    if err == nil {
+        if s.offset, err = strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64); err != nil {
+            return nil, fmt.Errorf("invalid cdc offset file: %v", err)
+        }
+    } else if !os.IsNotExist(err) {
+        return nil, err
+    }
+    return s, nil
+}
+
+func (s *FileSink) Start() {
+    ctx, cancel := context.WithCancel(context.Background())
+    s.cancel = cancel
+    s.logger.Info("cdc file sink started", "dir", s.dir, "offset", s.Offset())
+    go s.run(ctx)
+}
+
+func (s *FileSink) run(ctx context.Context) {
+    defer close(s.done)
+    for {
+        offset := s.Offset()
+        records, _, err := s.log.Read(ctx, offset, sinkBatch, sinkWait)
+        if ctx.Err() != nil {
+            return
+        }
+        if ce, ok := err.(*CompactedError); ok {
+            // 节点从快照恢复或者导出太慢，中间的记录已经丢失
+            s.logger.Error("cdc records lost", "offset", offset, "available", ce.Oldest)
+            atomic.StoreUint64(&s.offset, ce.Oldest)
+            continue
+        }
+        if len(records) == 0 {
+            continue
+        }
+        if err := s.write(records); err != nil {
+            s.logger.Error("write cdc records failed", "error", err)
+            select {
+            case <-time.After(sinkRetry):
+                continue
+            case <-ctx.Done():
+                return
+            }
+        }
+    }
+}
+
+func (s *FileSink) write(records []Record) error {
+    if s.f == nil || s.size >= s.maxBytes {
+        if err := s.rotate(records[0].Index); err != nil {
+            return err
+        }
+    }
+    buf := bytes.Buffer{}
+    enc := json.NewEncoder(&buf)
+    for i := range records {
+        if err := enc.Encode(&records[i]); err != nil {
+            return err
+        }
+    }
+    n, err := s.f.Write(buf.Bytes())
+    s.size += int64(n)
+    if err != nil {
+        return err
+    }
+    if err := s.f.Sync(); err != nil {
+        return err
+    }
+    return s.saveOffset(records[len(records)-1].Index)
+}
+
+func (s *FileSink) rotate(index uint64) error {
+    if s.f != nil {
+        s.f.Close()
+        s.f = nil
+    }
+    name := filepath.Join(s.dir, fmt.Sprintf("%020d%s", index, segmentSuffix))
+    f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+    if err != nil {
+        return err
+    }
+    info, err := f.Stat()
+    if err != nil {
+        f.Close()
+        return err
+    }
+    s.f, s.size = f, info.Size()
+    return nil
+}
+
+// 先写临时文件再改名，避免崩溃时offset文件不完整
+func (s *FileSink) saveOffset(offset uint64) error {
+    tmp := filepath.Join(s.dir, offsetFile+".tmp")
+    if err := ioutil.WriteFile(tmp, []byte(strconv.FormatUint(offset, 10)), 0644); err != nil {
+        return err
+    }
+    if err := os.Rename(tmp, filepath.Join(s.dir, offsetFile)); err != nil {
+        return err
+    }
+    atomic.StoreUint64(&s.offset, offset)
+    return nil
+}
+
+// Offset 已经写入文件的最后一条记录的index
+func (s *FileSink) Offset() uint64 {
+    return atomic.LoadUint64(&s.offset)
+}
+
+func (s *FileSink) Close() error {
+    if s.cancel == nil {
+        return nil
+    }
+    s.cancel()
+    <-s.done
+    if s.f != nil {
+        return s.f.Close()
+    }
+    return nil
+}
@@ -0,0 +1,209 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package cluster
+
+import (
+    "bytes"
+    "errors"
+    "github.com/hashicorp/raft"
+    "github.com/xfali/gache/internal/metrics"
+    "time"
+)
+
+const (
+    DefaultMaxBatch    = 128
+    DefaultMaxInflight = 4
+)
+
+var (
+    // FSM没有返回每条命令的结果（如日志无法解码），命令可能没有执行
+    ErrBadBatch = errors.New("invalid raft apply response")
+    // 已经提交但是在超时之前没有应用，命令可能已经执行
+    ErrApplyTimeout = errors.New("timed out waiting for raft apply")
+)
+
+// raft.Raft中batcher使用的方法，测试时可以替换
+type applier interface {
+    Apply(cmd []byte, timeout time.Duration) raft.ApplyFuture
+}
+
+type applyReq struct {
+    cmd  []byte
+    resp interface{}
+    err  error
+    done chan struct{}
+}
+
+// batcher 将并发的写请求合并为一条raft日志，并允许多个batch同时提交（pipeline）
+type batcher struct {
+    r          applier
+    applyCh    chan *applyReq
+    inflight   chan struct{}
+    shutdownCh chan struct{}
+    maxBatch   int
+    timeout    time.Duration
+
+    applyDuration *metrics.HistogramVec
+    batchSize     *metrics.HistogramVec
+}
+
+// 指标注册在reg中，为nil时不输出
+func newBatcher(r applier, maxBatch, maxInflight int, timeout time.Duration, reg *metrics.Registry) *batcher {
+    if maxBatch <= 0 {
+        maxBatch = DefaultMaxBatch
+    }
+    if maxInflight <= 0 {
+        maxInflight = DefaultMaxInflight
+    }
+    if reg == nil {
+        reg = metrics.NewRegistry()
+    }
+    b := &batcher{
+        r:          r,
+        applyCh:    make(chan *applyReq, maxBatch*maxInflight),
+        inflight:   make(chan struct{}, maxInflight),
+        shutdownCh: make(chan struct{}),
+        maxBatch:   maxBatch,
+        timeout:    timeout,
+
+        applyDuration: reg.NewHistogramVec("gache_raft_apply_duration_seconds",
+            "Time from submitting a raft batch to receiving its result.", metrics.DefBuckets),
+        batchSize: reg.NewHistogramVec("gache_raft_apply_batch_size",
+            "Number of commands coalesced into one raft log entry.", []float64{1, 2, 4, 8, 16, 32, 64, 128, 256, 512}),
+    }
+    go b.run()
+    return b
+}
+
+func (b *batcher) apply(cmd []byte, timeout time.Duration) (interface{}, error) {
+    req := &applyReq{
+        cmd:  cmd,
+        done: make(chan struct{}),
+    }
+
+    // 超时包括等待进入队列以及等待应用的时间
+    var timer <-chan time.Time
+    if timeout > 0 {
+        t := time.NewTimer(timeout)
+        defer t.Stop()
+        timer = t.C
+    }
+
+    select {
+    case b.applyCh <- req:
+    case <-timer:
+        return nil, raft.ErrEnqueueTimeout
+    case <-b.shutdownCh:
+        return nil, raft.ErrRaftShutdown
+    }
+
+    select {
+    case <-req.done:
+        return req.resp, req.err
+    case <-timer:
+        return nil, ErrApplyTimeout
+    case <-b.shutdownCh:
+        return nil, raft.ErrRaftShutdown
+    }
+}
+
+func (b *batcher) run() {
+    for {
+        select {
+        case b.inflight <- struct{}{}:
+        case <-b.shutdownCh:
+            return
+        }
+
+        var first *applyReq
+        select {
+        case first = <-b.applyCh:
+        case <-b.shutdownCh:
+            return
+        }
+
+        batch := []*applyReq{first}
+    DRAIN:
+        for len(batch) < b.maxBatch {
+            select {
+            case req := <-b.applyCh:
+                batch = append(batch, req)
+            default:
+                break DRAIN
+            }
+        }
+
+        b.batchSize.With().Observe(float64(len(batch)))
+        future := b.r.Apply(encodeBatch(batch), b.timeout)
+        go b.wait(future, batch, time.Now())
+    }
+}
+
+func (b *batcher) wait(future raft.ApplyFuture, batch []*applyReq, start time.Time) {
+    defer func() { <-b.inflight }()
+    defer func() { b.applyDuration.With().Observe(time.Since(start).Seconds()) }()
+
+    if err := future.Error(); err != nil {
+        for _, req := range batch {
+            req.err = err
+            close(req.done)
+        }
+        return
+    }
+
+    switch ret := future.Response().(type) {
+    case *applyResult:
+        if len(batch) == 1 {
+            batch[0].resp, batch[0].err = ret.resp, ret.err
+            break
+        }
+        for _, req := range batch {
+            req.err = ErrBadBatch
+        }
+    case []*applyResult:
+        for i, req := range batch {
+            if i < len(ret) && ret[i] != nil {
+                req.resp, req.err = ret[i].resp, ret[i].err
+            } else {
+                req.err = ErrBadBatch
+            }
+        }
+    default:
+        for _, req := range batch {
+            req.err = ErrBadBatch
+        }
+    }
+    for _, req := range batch {
+        close(req.done)
+    }
+}
+
+func (b *batcher) shutdown() {
+    close(b.shutdownCh)
+}
+
+// 单条命令直接提交；多条命令编码为JSON数组，由GacheFSM按顺序执行
+func encodeBatch(batch []*applyReq) []byte {
+    if len(batch) == 1 {
+        return batch[0].cmd
+    }
+    buf := bytes.Buffer{}
+    buf.WriteByte('[')
+    for i, req := range batch {
+        if i > 0 {
+            buf.WriteByte(',')
+        }
+        buf.Write(req.cmd)
+    }
+    buf.WriteByte(']')
+    return buf.Bytes()
+}
+
+func isBatch(data []byte) bool {
+    data = bytes.TrimSpace(data)
+    return len(data) > 0 && data[0] == '['
+}
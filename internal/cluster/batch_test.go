@@ -0,0 +1,270 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package cluster
+
+import (
+    "fmt"
+    "github.com/hashicorp/raft"
+    "github.com/xfali/gache/command"
+    "github.com/xfali/gache/db"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+type testFuture struct {
+    done chan struct{}
+    resp interface{}
+    err  error
+}
+
+func (f *testFuture) Error() error {
+    <-f.done
+    return f.err
+}
+
+func (f *testFuture) Response() interface{} {
+    <-f.done
+    return f.resp
+}
+
+func (f *testFuture) Index() uint64 {
+    return 0
+}
+
+// testApplier 在后台把日志交给GacheFSM，gate不为nil时等待gate关闭后才应用
+type testApplier struct {
+    fsm     *GacheFSM
+    gate    chan struct{}
+    index   uint64
+    entries int32
+    // 应用每条日志的耗时
+    delay time.Duration
+    // 替换FSM的返回值
+    response func(data []byte) interface{}
+}
+
+func newTestApplier() *testApplier {
+    return &testApplier{fsm: &GacheFSM{db: db.New()}}
+}
+
+func (a *testApplier) Apply(cmd []byte, timeout time.Duration) raft.ApplyFuture {
+    atomic.AddInt32(&a.entries, 1)
+    f := &testFuture{done: make(chan struct{})}
+    index := atomic.AddUint64(&a.index, 1)
+    go func() {
+        if a.gate != nil {
+            <-a.gate
+        }
+        time.Sleep(a.delay)
+        if a.response != nil {
+            f.resp = a.response(cmd)
+        } else {
+            f.resp = a.fsm.Apply(&raft.Log{Index: index, Data: cmd})
+        }
+        close(f.done)
+    }()
+    return f
+}
+
+func marshal(t testing.TB, req command.Request) []byte {
+    b, err := req.Marshal()
+    if err != nil {
+        t.Fatal(err)
+    }
+    return b
+}
+
+func TestBatcherCoalesce(t *testing.T) {
+    a := newTestApplier()
+    a.gate = make(chan struct{})
+    b := newBatcher(a, 64, 1, time.Second, nil)
+    defer b.shutdown()
+
+    // 第一条日志应用之前的请求合并提交
+    const n = 50
+    var wg sync.WaitGroup
+    var swapped int32
+    errs := make(chan error, n)
+    for i := 0; i < n; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            ret, err := b.apply(marshal(t, command.Request{Cmd: command.CAS, K: "k", V: "v"}), time.Second)
+            if err != nil {
+                errs <- err
+                return
+            }
+            if ret.(bool) {
+                atomic.AddInt32(&swapped, 1)
+            }
+        }()
+    }
+    time.Sleep(100 * time.Millisecond)
+    close(a.gate)
+    wg.Wait()
+    close(errs)
+    for err := range errs {
+        t.Fatal(err)
+    }
+    if swapped != 1 {
+        t.Fatalf("cas succeeded %d times", swapped)
+    }
+    if entries := atomic.LoadInt32(&a.entries); entries >= n || entries < 2 {
+        t.Fatalf("%d requests in %d entries", n, entries)
+    }
+    if v := a.fsm.db.Get("k"); v != "v" {
+        t.Fatalf("k = %q", v)
+    }
+}
+
+func TestBatcherResults(t *testing.T) {
+    cases := []struct {
+        name     string
+        response func(data []byte) interface{}
+        cmds     []command.Request
+        // 每条命令的错误，空字符串表示成功
+        wantErr []string
+    }{
+        {
+            name:    "per entry error",
+            cmds:    []command.Request{{Cmd: command.SET, K: "a", V: "1"}, {Cmd: "NOPE"}, {Cmd: command.SET, K: "b", V: "2"}},
+            wantErr: []string{"", "Command not found", ""},
+        },
+        {
+            name:     "undecodable",
+            response: func(data []byte) interface{} { return nil },
+            cmds:     []command.Request{{Cmd: command.SET, K: "a"}, {Cmd: command.SET, K: "b"}},
+            wantErr:  []string{ErrBadBatch.Error(), ErrBadBatch.Error()},
+        },
+        {
+            name:     "short response",
+            response: func(data []byte) interface{} { return []*applyResult{{resp: "x"}} },
+            cmds:     []command.Request{{Cmd: command.SET, K: "a"}, {Cmd: command.SET, K: "b"}},
+            wantErr:  []string{"", ErrBadBatch.Error()},
+        },
+        {
+            name:     "single result for batch",
+            response: func(data []byte) interface{} { return &applyResult{resp: "x"} },
+            cmds:     []command.Request{{Cmd: command.SET, K: "a"}, {Cmd: command.SET, K: "b"}},
+            wantErr:  []string{ErrBadBatch.Error(), ErrBadBatch.Error()},
+        },
+    }
+    for _, c := range cases {
+        t.Run(c.name, func(t *testing.T) {
+            a := newTestApplier()
+            a.response = c.response
+            a.gate = make(chan struct{})
+            b := newBatcher(a, 64, 1, time.Second, nil)
+            defer b.shutdown()
+
+            // 占用唯一的inflight，使后面的请求合并为一条日志
+            first := make(chan error, 1)
+            go func() {
+                _, err := b.apply(marshal(t, command.Request{Cmd: command.GET, K: "a"}), time.Second)
+                first <- err
+            }()
+            time.Sleep(50 * time.Millisecond)
+
+            errs := make([]chan error, len(c.cmds))
+            for i := range c.cmds {
+                errs[i] = make(chan error, 1)
+                go func(i int) {
+                    _, err := b.apply(marshal(t, c.cmds[i]), time.Second)
+                    errs[i] <- err
+                }(i)
+                // 保持提交的顺序
+                time.Sleep(10 * time.Millisecond)
+            }
+            close(a.gate)
+            <-first
+            for i := range c.cmds {
+                got := ""
+                if err := <-errs[i]; err != nil {
+                    got = err.Error()
+                }
+                if got != c.wantErr[i] {
+                    t.Fatalf("cmd %d: %q, want %q", i, got, c.wantErr[i])
+                }
+            }
+        })
+    }
+}
+
+func TestBatcherTimeout(t *testing.T) {
+    a := newTestApplier()
+    // 日志一直没有应用
+    a.gate = make(chan struct{})
+    defer close(a.gate)
+    b := newBatcher(a, 64, 1, time.Second, nil)
+    defer b.shutdown()
+
+    start := time.Now()
+    _, err := b.apply(marshal(t, command.Request{Cmd: command.SET, K: "a"}), 100*time.Millisecond)
+    if err != ErrApplyTimeout {
+        t.Fatalf("apply: %v", err)
+    }
+    if d := time.Since(start); d > time.Second {
+        t.Fatalf("timeout after %v", d)
+    }
+    // inflight已满，无法进入队列的请求同样超时
+    _, err = b.apply(marshal(t, command.Request{Cmd: command.SET, K: "b"}), 100*time.Millisecond)
+    if err != ErrApplyTimeout && err != raft.ErrEnqueueTimeout {
+        t.Fatalf("apply: %v", err)
+    }
+}
+
+func TestBatcherShutdown(t *testing.T) {
+    a := newTestApplier()
+    a.gate = make(chan struct{})
+    defer close(a.gate)
+    b := newBatcher(a, 64, 1, time.Second, nil)
+
+    ret := make(chan error, 1)
+    go func() {
+        _, err := b.apply(marshal(t, command.Request{Cmd: command.SET, K: "a"}), 0)
+        ret <- err
+    }()
+    time.Sleep(50 * time.Millisecond)
+    b.shutdown()
+    select {
+    case err := <-ret:
+        if err != raft.ErrRaftShutdown {
+            t.Fatalf("apply: %v", err)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("apply blocked after shutdown")
+    }
+    if _, err := b.apply(marshal(t, command.Request{Cmd: command.SET, K: "b"}), 0); err != raft.ErrRaftShutdown {
+        t.Fatalf("apply after shutdown: %v", err)
+    }
+}
+
+func BenchmarkBatcher(b *testing.B) {
+    for _, maxBatch := range []int{1, 128} {
+        b.Run(fmt.Sprintf("batch-%d", maxBatch), func(b *testing.B) {
+            a := newTestApplier()
+            // 模拟raft写日志以及复制的耗时
+            a.delay = 200 * time.Microsecond
+            bt := newBatcher(a, maxBatch, DefaultMaxInflight, time.Second, nil)
+            defer bt.shutdown()
+            cmd := marshal(b, command.Request{Cmd: command.SET, K: "k", V: "v"})
+            // 并发的写请求
+            b.SetParallelism(32)
+            b.ResetTimer()
+            b.RunParallel(func(pb *testing.PB) {
+                for pb.Next() {
+                    if _, err := bt.apply(cmd, time.Second); err != nil {
+                        b.Fatal(err)
+                    }
+                }
+            })
+            b.ReportMetric(float64(b.N)/float64(atomic.LoadInt32(&a.entries)), "cmds/entry")
+        })
+    }
+}
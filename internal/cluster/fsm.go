@@ -0,0 +1,126 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package cluster
+
+import (
+    "encoding/json"
+    "github.com/hashicorp/go-msgpack/codec"
+    "github.com/hashicorp/raft"
+    "github.com/xfali/gache/command"
+    "github.com/xfali/gache/db"
+    "github.com/xfali/gache/internal/cdc"
+    "github.com/xfali/gache/internal/pubsub"
+    "github.com/xfali/gache/internal/watch"
+    "io"
+    "sync"
+)
+
+type GacheFSM struct {
+    sync.Mutex
+    db *db.GacheDb
+    // 每个节点应用日志时通知本节点的订阅者，可以为nil
+    hub *watch.Hub
+    // PUBLISH发送给本节点的订阅者，可以为nil
+    pubsub *pubsub.Broker
+    // 记录key的修改，可以为nil
+    cdc *cdc.Log
+    // 启动时本地日志的最后一个index或恢复快照时已应用的index，不超过该index的日志是重放的，
+    // 其中的PUBLISH在重启之前已经发送过，不再发送给订阅者
+    replayed uint64
+}
+
+type applyResult struct {
+    resp interface{}
+    err  error
+}
+
+type GacheSnapshot struct {
+    db *db.GacheDb
+}
+
+func (m *GacheFSM) Apply(log *raft.Log) interface{} {
+    m.Lock()
+    defer m.Unlock()
+
+    m.db.SetApplied(log.Index)
+    if isBatch(log.Data) {
+        var cmds []command.Request
+        if err := json.Unmarshal(log.Data, &cmds); err != nil {
+            return nil
+        }
+        ret := make([]*applyResult, len(cmds))
+        for i := range cmds {
+            ret[i] = m.process(log.Index, &cmds[i])
+        }
+        return ret
+    }
+
+    var cmd command.Request
+    err := cmd.Unmarshal(log.Data)
+    if err != nil {
+        return nil
+    }
+    return m.process(log.Index, &cmd)
+}
+
+// 执行命令，并通知watch、pubsub的订阅者以及CDC
+func (m *GacheFSM) process(index uint64, cmd *command.Request) *applyResult {
+    version := m.db.Version()
+    resp, err := m.hub.Process(m.db, cmd)
+    if index > m.replayed {
+        n := m.pubsub.Process(cmd)
+        // PUBLISH的结果为本节点收到消息的订阅者数
+        if cmd.Cmd == command.PUBLISH && err == nil {
+            resp = n
+        }
+    }
+    m.cdc.Append(index, version, m.db, cmd)
+    return &applyResult{resp: resp, err: err}
+}
+
+func (m *GacheFSM) Snapshot() (raft.FSMSnapshot, error) {
+    m.Lock()
+    defer m.Unlock()
+
+    return &GacheSnapshot{m.db.Copy()}, nil
+}
+
+func (m *GacheFSM) Restore(inp io.ReadCloser) error {
+    m.Lock()
+    defer m.Unlock()
+    defer inp.Close()
+    hd := codec.MsgpackHandle{}
+    dec := codec.NewDecoder(inp, &hd)
+
+    restore := db.New()
+    if err := dec.Decode(restore); err != nil {
+        return err
+    }
+    m.db.Restore(restore)
+    if m.hub != nil {
+        m.hub.Reset(m.db.Version())
+    }
+    m.cdc.Reset(m.db.AppliedIndex())
+    if m.db.AppliedIndex() > m.replayed {
+        m.replayed = m.db.AppliedIndex()
+    }
+    return nil
+}
+
+func (m *GacheSnapshot) Persist(sink raft.SnapshotSink) error {
+    hd := codec.MsgpackHandle{}
+    enc := codec.NewEncoder(sink, &hd)
+    if err := enc.Encode(m.db); err != nil {
+        sink.Cancel()
+        return err
+    }
+    sink.Close()
+    return nil
+}
+
+func (m *GacheSnapshot) Release() {
+}
@@ -0,0 +1,246 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package cluster
+
+import (
+    "bytes"
+    "github.com/hashicorp/go-hclog"
+    "github.com/hashicorp/raft"
+    "github.com/xfali/gache/acl"
+    "github.com/xfali/gache/command"
+    "github.com/xfali/gache/config"
+    "github.com/xfali/gache/db"
+    "github.com/xfali/gache/internal/pubsub"
+    "io/ioutil"
+    "reflect"
+    "testing"
+    "time"
+)
+
+// 单节点raft使用的存储，重启时保留
+type testStores struct {
+    store *raft.InmemStore
+    snaps *raft.InmemSnapshotStore
+}
+
+func startRaft(t *testing.T, stores *testStores, broker *pubsub.Broker) Replication {
+    conf := config.Default()
+    conf.RaftNodeId = "n1"
+    conf.RaftHeartbeatTimeout = 50 * time.Millisecond
+    conf.RaftElectionTimeout = 50 * time.Millisecond
+    conf.RaftLeaderLeaseTimeout = 50 * time.Millisecond
+    conf.RaftCommitTimeout = 5 * time.Millisecond
+    _, trans := raft.NewInmemTransport("")
+
+    notify := make(chan bool, 1)
+    r, err := NewWithOptions(conf, db.New(), notify, hclog.NewNullLogger(), Options{
+        Transport:     trans,
+        LogStore:      stores.store,
+        StableStore:   stores.store,
+        SnapshotStore: stores.snaps,
+        PubSub:        broker,
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    select {
+    case <-notify:
+    case <-time.After(5 * time.Second):
+        t.Fatal("no leader")
+    }
+    return r
+}
+
+func publish(t *testing.T, r Replication, channel, data string) {
+    if _, err := r.Apply(marshal(t, command.Request{Cmd: command.PUBLISH, K: channel, V: data}), time.Second); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func expectMessages(t *testing.T, s *pubsub.Subscriber, data ...string) {
+    for _, d := range data {
+        select {
+        case m := <-s.Messages():
+            if m.Data != d {
+                t.Fatalf("message %q, want %q", m.Data, d)
+            }
+        case <-time.After(5 * time.Second):
+            t.Fatalf("message %q not received", d)
+        }
+    }
+    select {
+    case m := <-s.Messages():
+        t.Fatalf("unexpected message %q", m.Data)
+    default:
+    }
+}
+
+// 重启后重新应用的本地日志中的PUBLISH不再发送
+func TestPublishNotReplayed(t *testing.T) {
+    stores := &testStores{store: raft.NewInmemStore(), snaps: raft.NewInmemSnapshotStore()}
+
+    broker := pubsub.NewBroker()
+    sub, err := broker.Subscribe([]string{"ch"}, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    r := startRaft(t, stores, broker)
+    publish(t, r, "ch", "m1")
+    publish(t, r, "ch", "m2")
+    expectMessages(t, sub, "m1", "m2")
+    if err := r.Shutdown(); err != nil {
+        t.Fatal(err)
+    }
+
+    broker = pubsub.NewBroker()
+    sub, err = broker.Subscribe([]string{"ch"}, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    r = startRaft(t, stores, broker)
+    defer r.Shutdown()
+    // 新的leader提交一条日志后，之前的日志都已经重新应用
+    if err := r.Barrier(time.Second); err != nil {
+        t.Fatal(err)
+    }
+    publish(t, r, "ch", "m3")
+    expectMessages(t, sub, "m3")
+}
+
+func TestPublishAfterRestore(t *testing.T) {
+    broker := pubsub.NewBroker()
+    sub, err := broker.Subscribe([]string{"ch"}, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    fsm := &GacheFSM{db: db.New(), pubsub: broker}
+    apply := func(index uint64, data string) {
+        fsm.Apply(&raft.Log{Index: index, Data: marshal(t, command.Request{Cmd: command.PUBLISH, K: "ch", V: data})})
+    }
+    apply(1, "m1")
+    expectMessages(t, sub, "m1")
+
+    // 快照之后的日志正常发送
+    snap := db.New()
+    snap.SetApplied(10)
+    restoreFrom(t, fsm, snap)
+    apply(10, "old")
+    apply(11, "m2")
+    expectMessages(t, sub, "m2")
+}
+
+type memorySink struct {
+    bytes.Buffer
+    closed bool
+}
+
+func (s *memorySink) ID() string {
+    return "test"
+}
+
+func (s *memorySink) Cancel() error {
+    return nil
+}
+
+func (s *memorySink) Close() error {
+    s.closed = true
+    return nil
+}
+
+// 通过GacheSnapshot.Persist写入快照后由GacheFSM.Restore恢复
+func restoreFrom(t *testing.T, fsm *GacheFSM, d *db.GacheDb) {
+    sink := &memorySink{}
+    if err := (&GacheSnapshot{db: d}).Persist(sink); err != nil {
+        t.Fatal(err)
+    }
+    if !sink.closed {
+        t.Fatal("sink not closed")
+    }
+    if err := fsm.Restore(ioutil.NopCloser(&sink.Buffer)); err != nil {
+        t.Fatal(err)
+    }
+}
+
+// 每个导出的字段都有数据的数据库
+func snapshotFixture(t *testing.T) *db.GacheDb {
+    d := db.New()
+    d.SetAt("k1", "v1", 100)
+    d.Set("k2", "v2")
+    d.SetApplied(42)
+    if err := d.Acl.SetUser(&acl.User{Name: "root", Admin: true}); err != nil {
+        t.Fatal(err)
+    }
+    d.SetPeer("n1", db.Peer{RaftAddr: "127.0.0.1:7000", ApiAddr: "127.0.0.1:8000", RespAddr: "127.0.0.1:6379"})
+    d.SetOffset("consumer", 7)
+    d.Locks.Acquire("lock", "owner", d.AppliedIndex(), 0, 1000)
+    d.Sessions.Create("s1", 0, 1000)
+    if err := d.SetEphemeral("k3", "v3", "s1", 100); err != nil {
+        t.Fatal(err)
+    }
+    d.Queues.Enqueue("q", "m1", 0)
+    d.Queues.Enqueue("q", "m2", 0)
+    d.Queues.Dequeue("q", 0, 1000, 1)
+    // 可见性超时后m1移到死信，投递m2
+    d.Queues.Dequeue("q", 2000, 1000, 1)
+    d.Limiters.Take("r1", db.TokenBucket, 0, 1000, 10, 1)
+    d.Limiters.Take("r2", db.SlidingWindow, 0, 1000, 10, 1)
+    return d
+}
+
+// 没有数据的导出字段（包括子存储中的字段），用于检查snapshotFixture是否覆盖了全部字段
+func uncovered(v reflect.Value, path string) []string {
+    switch v.Kind() {
+    case reflect.Ptr:
+        if v.IsNil() {
+            return []string{path}
+        }
+        return uncovered(v.Elem(), path)
+    case reflect.Struct:
+        var ret []string
+        for i := 0; i < v.NumField(); i++ {
+            if f := v.Type().Field(i); f.PkgPath == "" {
+                ret = append(ret, uncovered(v.Field(i), path+"."+f.Name)...)
+            }
+        }
+        return ret
+    case reflect.Map, reflect.Slice:
+        if v.Len() == 0 {
+            return []string{path}
+        }
+        return nil
+    }
+    if reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface()) {
+        return []string{path}
+    }
+    return nil
+}
+
+// 快照经过GacheSnapshot.Persist、GacheFSM.Restore后与原来相同
+func TestSnapshotRoundTrip(t *testing.T) {
+    src := snapshotFixture(t)
+    // 新增的字段需要加入snapshotFixture
+    for _, f := range uncovered(reflect.ValueOf(src), "GacheDb") {
+        t.Errorf("%s: not covered by snapshotFixture", f)
+    }
+
+    dst := db.New()
+    dst.Set("stale", "x")
+    fsm := &GacheFSM{db: dst}
+    restoreFrom(t, fsm, src.Copy())
+    if !reflect.DeepEqual(dst.Copy(), src.Copy()) {
+        t.Fatalf("restored:\n%+v\nwant:\n%+v", dst.Copy(), src.Copy())
+    }
+    if dst.MemSize() != src.MemSize() {
+        t.Fatalf("mem size %d, want %d", dst.MemSize(), src.MemSize())
+    }
+
+    // 快照中没有的数据清空
+    restoreFrom(t, fsm, db.New())
+    if !reflect.DeepEqual(dst.Copy(), db.New().Copy()) {
+        t.Fatalf("restored empty:\n%+v", dst.Copy())
+    }
+}
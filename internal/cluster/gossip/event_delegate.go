@@ -7,8 +7,8 @@
 package gossip
 
 import (
+    "github.com/hashicorp/go-hclog"
     "github.com/hashicorp/memberlist"
-    "log"
     "sync"
 )
 
@@ -22,24 +22,19 @@ type NodeDelegate struct {
     UpdateFunc handle
 }
 
-func defaultJoin(meta []byte) {
-    log.Printf("defaultJoin meta: %s\n", string(meta))
-}
-
-func defaultLeave(meta []byte) {
-    log.Printf("defaultLeave meta: %s\n", string(meta))
-}
-
-func defaultUpdate(meta []byte) {
-    log.Printf("defaultUpdate meta: %s\n", string(meta))
+func logEvent(logger hclog.Logger, event string) handle {
+    return func(meta []byte) {
+        logger.Info("node "+event, "meta", string(meta))
+    }
 }
 
-func DefaultNodeDelegate() *NodeDelegate {
+func DefaultNodeDelegate(logger hclog.Logger) *NodeDelegate {
+    logger = logger.Named("gossip")
     return &NodeDelegate{
         Enabled:    true,
-        JoinFunc:   defaultJoin,
-        LeaveFunc:  defaultLeave,
-        UpdateFunc: defaultUpdate,
+        JoinFunc:   logEvent(logger, "join"),
+        LeaveFunc:  logEvent(logger, "leave"),
+        UpdateFunc: logEvent(logger, "update"),
     }
 }
 
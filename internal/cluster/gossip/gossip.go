@@ -0,0 +1,239 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package gossip
+
+import (
+    "bytes"
+    "errors"
+    "github.com/hashicorp/go-hclog"
+    "github.com/hashicorp/memberlist"
+    "github.com/xfali/gache/config"
+    "github.com/xfali/gache/internal/cluster"
+    "github.com/xfali/gache/internal/faultnet"
+    gachelog "github.com/xfali/gache/internal/logger"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// 广播meta时等待的最长时间
+const updateTimeout = time.Second
+
+type members struct {
+    list    *memberlist.Memberlist
+    keyring *memberlist.Keyring
+    meta    *metaDelegate
+    logger  hclog.Logger
+}
+
+type Cluster interface {
+    LocalAddr() string
+    UpdateLocal(meta []byte) error
+    UpdateAndWait(meta []byte, timeout time.Duration) error
+    NumMembers() int
+    UpdateKeys(keys [][]byte) error
+    Close() error
+    Enabled() bool
+}
+
+// Options 替换memberlist默认的网络，为nil时使用UDP/TCP
+type Options struct {
+    Transport memberlist.Transport
+    // 不为nil时在transport上注入故障
+    Faults *faultnet.Network
+}
+
+func Startup(conf *config.Config, delegate *NodeDelegate, logger hclog.Logger) (Cluster, error) {
+    return StartupWithOptions(conf, delegate, logger, Options{})
+}
+
+func StartupWithOptions(conf *config.Config, delegate *NodeDelegate, logger hclog.Logger, opts Options) (Cluster, error) {
+    hostname, _ := os.Hostname()
+    config := memberlist.DefaultLocalConfig()
+    config.Name = hostname + "-" + strconv.Itoa(conf.ClusterPort)
+    // config := memberlist.DefaultLocalConfig()
+    config.BindPort = conf.ClusterPort
+    config.AdvertisePort = conf.ClusterPort
+    config.Events = delegate
+    meta := &metaDelegate{}
+    config.Delegate = meta
+    config.Logger = gachelog.Std(logger.Named("memberlist"))
+    config.GossipInterval = conf.ClusterGossipInterval
+    config.GossipNodes = conf.ClusterGossipNodes
+    config.ProbeInterval = conf.ClusterProbeInterval
+    config.ProbeTimeout = conf.ClusterProbeTimeout
+    config.PushPullInterval = conf.ClusterPushPullInterval
+    config.SuspicionMult = conf.ClusterSuspicionMult
+    if opts.Transport != nil {
+        config.Transport = opts.Transport
+    }
+
+    // 第一个key用于加密，其余的key仅用于解密，便于滚动更新
+    keys, err := conf.ClusterKeyList()
+    if err != nil {
+        return nil, err
+    }
+    if len(keys) > 0 {
+        keyring, err := memberlist.NewKeyring(keys, keys[0])
+        if err != nil {
+            return nil, err
+        }
+        config.Keyring = keyring
+    }
+
+    // 节点名称与raft一致，便于按节点设置规则
+    faultName := conf.NodeID()
+    if faultName == "" {
+        faultName = config.Name
+    }
+    if opts.Faults != nil {
+        if config.Transport == nil {
+            t, err := memberlist.NewNetTransport(&memberlist.NetTransportConfig{
+                BindAddrs: []string{config.BindAddr},
+                BindPort:  config.BindPort,
+                Logger:    config.Logger,
+            })
+            if err != nil {
+                return nil, err
+            }
+            config.Transport = t
+        }
+        config.Transport = opts.Faults.GossipTransport(faultName, config.Transport)
+    }
+
+    list, err := memberlist.Create(config)
+    if err != nil {
+        return nil, err
+    }
+    if opts.Faults != nil {
+        opts.Faults.Register(faultName, list.LocalNode().Address())
+    }
+
+    _, _, sloterr := cluster.GetSlots(conf.ClusterSlot)
+    if sloterr != nil {
+        list.Shutdown()
+        return nil, sloterr
+    }
+
+    memList := strings.Split(conf.ClusterMemebers, ",")
+    var validMembers []string
+    for _, v := range memList {
+        mem := strings.TrimSpace(v)
+        if mem != "" {
+            validMembers = append(validMembers, mem)
+        }
+    }
+    if len(validMembers) > 0 {
+        if _, err := list.Join(validMembers); err != nil {
+            logger.Named("gossip").Warn("join cluster members failed", "members", validMembers, "error", err)
+        }
+    }
+
+    return &members{list: list, keyring: config.Keyring, meta: meta, logger: logger.Named("gossip")}, nil
+}
+
+func (c *members)LocalAddr() string {
+    return c.list.LocalNode().Address()
+}
+
+func (c *members)Enabled() bool {
+    return true
+}
+
+func (c *members) NumMembers() int {
+    return c.list.NumMembers()
+}
+
+// 直接修改LocalNode().Meta不会通知其他节点，需要通过Delegate提供meta并广播
+func (c *members) UpdateLocal(meta []byte) error {
+    return c.UpdateAndWait(meta, updateTimeout)
+}
+
+func (c *members) UpdateAndWait(meta []byte, timeout time.Duration) error {
+    c.meta.setMeta(meta)
+    return c.list.UpdateNode(timeout)
+}
+
+// UpdateKeys 滚动更新加密key：安装全部key，keys[0]作为加密使用的key，移除不在keys中的旧key。
+// 需要先在所有节点上安装新key，再切换主key，最后移除旧key
+func (c *members) UpdateKeys(keys [][]byte) error {
+    if c.keyring == nil {
+        if len(keys) == 0 {
+            return nil
+        }
+        return errors.New("gossip encryption is not enabled, restart required")
+    }
+    if len(keys) == 0 {
+        return errors.New("can not disable gossip encryption at runtime, restart required")
+    }
+
+    for _, k := range keys {
+        if err := c.keyring.AddKey(k); err != nil {
+            return err
+        }
+    }
+    if err := c.keyring.UseKey(keys[0]); err != nil {
+        return err
+    }
+    for _, old := range c.keyring.GetKeys() {
+        if !containsKey(keys, old) {
+            if err := c.keyring.RemoveKey(old); err != nil {
+                return err
+            }
+        }
+    }
+    c.logger.Info("gossip keys updated", "keys", len(keys))
+    return nil
+}
+
+func containsKey(keys [][]byte, key []byte) bool {
+    for _, k := range keys {
+        if bytes.Equal(k, key) {
+            return true
+        }
+    }
+    return false
+}
+
+// 通知其他节点离开后关闭
+func (c *members) Close() error {
+    if err := c.list.Leave(updateTimeout); err != nil {
+        c.logger.Warn("leave cluster failed", "error", err)
+    }
+    return c.list.Shutdown()
+}
+
+type DummyCluster int
+
+func (c *DummyCluster) LocalAddr() string {
+    return ""
+}
+
+func (c *DummyCluster) UpdateLocal(meta []byte) error {
+    return nil
+}
+
+func (c *DummyCluster) UpdateAndWait(meta []byte, timeout time.Duration) error {
+    return nil
+}
+
+func (c *DummyCluster) UpdateKeys(keys [][]byte) error {
+    return nil
+}
+
+func (c *DummyCluster) NumMembers() int {
+    return 0
+}
+
+func (c *DummyCluster)Enabled() bool {
+    return false
+}
+
+func (c *DummyCluster) Close() error {
+    return nil
+}
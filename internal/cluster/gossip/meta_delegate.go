@@ -0,0 +1,43 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package gossip
+
+import "sync"
+
+// metaDelegate 提供本节点的meta，memberlist在广播alive消息和push/pull时读取
+type metaDelegate struct {
+    mu   sync.Mutex
+    meta []byte
+}
+
+func (d *metaDelegate) NodeMeta(limit int) []byte {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+
+    if len(d.meta) > limit {
+        return nil
+    }
+    return d.meta
+}
+
+func (d *metaDelegate) setMeta(meta []byte) {
+    d.mu.Lock()
+    d.meta = meta
+    d.mu.Unlock()
+}
+
+func (d *metaDelegate) NotifyMsg([]byte) {}
+
+func (d *metaDelegate) GetBroadcasts(overhead, limit int) [][]byte {
+    return nil
+}
+
+func (d *metaDelegate) LocalState(join bool) []byte {
+    return nil
+}
+
+func (d *metaDelegate) MergeRemoteState(buf []byte, join bool) {}
@@ -0,0 +1,191 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package cluster
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "github.com/hashicorp/go-hclog"
+    "github.com/xfali/gache/config"
+    "github.com/xfali/gache/internal/auth"
+    "io"
+    "io/ioutil"
+    "net"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const (
+    // 加入请求签名允许的时间偏差
+    JoinSkew = 5 * time.Minute
+
+    joinMinBackoff   = 500 * time.Millisecond
+    joinMaxBackoff   = 30 * time.Second
+    joinMaxRedirects = 3
+)
+
+var (
+    ErrJoinSignature = errors.New("invalid join signature")
+    ErrJoinExpired   = errors.New("join request expired")
+    ErrJoinConflict  = errors.New("raft id or address is used by another member")
+)
+
+// JoinRequest 新节点申请加入raft集群，设置了raft-join-secret时需要签名：
+//   Sig = HEX(HMAC-SHA256(SECRET, ID + "\n" + Addr + "\n" + ApiAddr + "\n" + Ts + "\n" + Replace))
+type JoinRequest struct {
+    ID      string `json:"id"`
+    Addr    string `json:"addr"`
+    ApiAddr string `json:"apiAddr"`
+    Ts      int64  `json:"ts"`
+    // ID或地址已被其他成员使用时替换该成员，否则拒绝加入
+    Replace bool   `json:"replace,omitempty"`
+    Sig     string `json:"sig,omitempty"`
+}
+
+func (jr *JoinRequest) Sign(secret string) {
+    jr.Sig = hex.EncodeToString(jr.mac(secret))
+}
+
+func (jr *JoinRequest) Verify(secret string) error {
+    sig, err := hex.DecodeString(jr.Sig)
+    if err != nil || !hmac.Equal(sig, jr.mac(secret)) {
+        return ErrJoinSignature
+    }
+    if d := time.Since(time.Unix(jr.Ts, 0)); d > JoinSkew || d < -JoinSkew {
+        return ErrJoinExpired
+    }
+    return nil
+}
+
+func (jr *JoinRequest) mac(secret string) []byte {
+    m := hmac.New(sha256.New, []byte(secret))
+    io.WriteString(m, jr.ID+"\n"+jr.Addr+"\n"+jr.ApiAddr+"\n"+strconv.FormatInt(jr.Ts, 10)+"\n"+strconv.FormatBool(jr.Replace))
+    return m.Sum(nil)
+}
+
+// 被拒绝的加入请求，重试没有意义
+type joinRejected struct {
+    status string
+    msg    string
+}
+
+func (e *joinRejected) Error() string {
+    return "join rejected: " + e.status + ": " + e.msg
+}
+
+// Join 向raft-join中的节点申请加入集群。目标为follower时跟随307跳转到leader，
+// 失败时按指数退避轮流重试各个地址直到leader接受或ctx结束；raft-join-timeout为0时不限制重试时间
+func Join(ctx context.Context, conf *config.Config, logger hclog.Logger) error {
+    logger = logger.Named("join")
+    client, scheme, err := auth.NewClient(conf)
+    if err != nil {
+        return err
+    }
+    // 跳转到其他host时http.Client会丢弃Authorization，自己处理跳转
+    client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+        return http.ErrUseLastResponse
+    }
+    // 与raft transport保持一致，使用解析后的地址
+    addr, err := net.ResolveTCPAddr("tcp", conf.RaftTcpAddr)
+    if err != nil {
+        return err
+    }
+    addrs := conf.JoinAddrs()
+    if len(addrs) == 0 {
+        return errors.New("raft-join is empty")
+    }
+
+    if conf.RaftJoinTimeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, conf.RaftJoinTimeout)
+        defer cancel()
+    }
+    backoff := joinMinBackoff
+    for i := 0; ; i++ {
+        target := addrs[i%len(addrs)]
+        jr := JoinRequest{
+            ID:      conf.NodeID(),
+            Addr:    addr.String(),
+            ApiAddr: conf.AdvertiseAddr(),
+            Replace: conf.RaftJoinReplace,
+        }
+        err := joinOnce(ctx, client, scheme, target, &jr, conf, logger)
+        if err == nil {
+            logger.Info("joined raft cluster", "id", jr.ID, "addr", jr.Addr)
+            return nil
+        }
+        if _, ok := err.(*joinRejected); ok {
+            return err
+        }
+        if ctx.Err() != nil {
+            return fmt.Errorf("join raft cluster: %v: %v", ctx.Err(), err)
+        }
+        logger.Warn("join raft cluster failed, retrying", "target", target, "backoff", backoff, "error", err)
+        t := time.NewTimer(backoff)
+        select {
+        case <-ctx.Done():
+            t.Stop()
+            return fmt.Errorf("join raft cluster: %v: %v", ctx.Err(), err)
+        case <-t.C:
+        }
+        if backoff *= 2; backoff > joinMaxBackoff {
+            backoff = joinMaxBackoff
+        }
+    }
+}
+
+func joinOnce(ctx context.Context, client *http.Client, scheme, target string, jr *JoinRequest, conf *config.Config, logger hclog.Logger) error {
+    for hop := 0; hop <= joinMaxRedirects; hop++ {
+        jr.Ts = time.Now().Unix()
+        if conf.RaftJoinSecret != "" {
+            jr.Sign(conf.RaftJoinSecret)
+        }
+        b, err := json.Marshal(jr)
+        if err != nil {
+            return err
+        }
+        req, err := http.NewRequest(http.MethodPost, scheme+"://"+target+"/join", bytes.NewReader(b))
+        if err != nil {
+            return err
+        }
+        req = req.WithContext(ctx)
+        req.Header.Set("Content-Type", "application/json")
+        auth.SetClientAuth(conf, req)
+
+        resp, err := client.Do(req)
+        if err != nil {
+            return err
+        }
+        msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+        resp.Body.Close()
+
+        switch resp.StatusCode {
+        case http.StatusOK:
+            return nil
+        case http.StatusTemporaryRedirect:
+            loc, err := resp.Location()
+            if err != nil {
+                return err
+            }
+            logger.Debug("redirected to leader", "from", target, "leader", loc.Host)
+            target = loc.Host
+        case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict:
+            return &joinRejected{status: resp.Status, msg: strings.TrimSpace(string(msg))}
+        default:
+            return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+        }
+    }
+    return errors.New("too many redirects")
+}
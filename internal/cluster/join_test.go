@@ -0,0 +1,160 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package cluster
+
+import (
+    "github.com/hashicorp/raft"
+    "github.com/xfali/gache/db"
+    "io/ioutil"
+    "testing"
+    "time"
+)
+
+func TestJoinRequestVerify(t *testing.T) {
+    signed := func(f func(jr *JoinRequest)) *JoinRequest {
+        jr := &JoinRequest{ID: "n2", Addr: "127.0.0.1:7002", ApiAddr: "127.0.0.1:8002", Ts: time.Now().Unix()}
+        jr.Sign("secret")
+        if f != nil {
+            f(jr)
+        }
+        return jr
+    }
+    cases := []struct {
+        name   string
+        jr     *JoinRequest
+        secret string
+        err    error
+    }{
+        {"valid", signed(nil), "secret", nil},
+        {"wrong secret", signed(nil), "other", ErrJoinSignature},
+        {"id changed", signed(func(jr *JoinRequest) { jr.ID = "n1" }), "secret", ErrJoinSignature},
+        {"addr changed", signed(func(jr *JoinRequest) { jr.Addr = "127.0.0.1:7001" }), "secret", ErrJoinSignature},
+        {"api addr changed", signed(func(jr *JoinRequest) { jr.ApiAddr = "127.0.0.1:8001" }), "secret", ErrJoinSignature},
+        {"replace added", signed(func(jr *JoinRequest) { jr.Replace = true }), "secret", ErrJoinSignature},
+        {"ts changed", signed(func(jr *JoinRequest) { jr.Ts++ }), "secret", ErrJoinSignature},
+        {"not hex", signed(func(jr *JoinRequest) { jr.Sig = "zz" }), "secret", ErrJoinSignature},
+        {"unsigned", signed(func(jr *JoinRequest) { jr.Sig = "" }), "secret", ErrJoinSignature},
+        {"expired", signed(func(jr *JoinRequest) {
+            jr.Ts -= int64(2 * JoinSkew / time.Second)
+            jr.Sign("secret")
+        }), "secret", ErrJoinExpired},
+        {"future", signed(func(jr *JoinRequest) {
+            jr.Ts += int64(2 * JoinSkew / time.Second)
+            jr.Sign("secret")
+        }), "secret", ErrJoinExpired},
+    }
+    for _, c := range cases {
+        if err := c.jr.Verify(c.secret); err != c.err {
+            t.Errorf("%s: %v, want %v", c.name, err, c.err)
+        }
+    }
+}
+
+type testNode struct {
+    r     *raft.Raft
+    trans *raft.InmemTransport
+}
+
+// 使用内存transport启动raft节点，与nodes中的节点互相连通
+func newTestNode(t *testing.T, id string, bootstrap bool, nodes ...*testNode) *testNode {
+    addr, trans := raft.NewInmemTransport("")
+    for _, n := range nodes {
+        trans.Connect(n.trans.LocalAddr(), n.trans)
+        n.trans.Connect(addr, trans)
+    }
+    conf := raft.DefaultConfig()
+    conf.LocalID = raft.ServerID(id)
+    conf.HeartbeatTimeout = 50 * time.Millisecond
+    conf.ElectionTimeout = 50 * time.Millisecond
+    conf.LeaderLeaseTimeout = 50 * time.Millisecond
+    conf.CommitTimeout = 5 * time.Millisecond
+    conf.LogOutput = ioutil.Discard
+    store := raft.NewInmemStore()
+    snaps := raft.NewInmemSnapshotStore()
+    if bootstrap {
+        err := raft.BootstrapCluster(conf, store, store, snaps, trans, raft.Configuration{
+            Servers: []raft.Server{{ID: conf.LocalID, Address: addr}},
+        })
+        if err != nil {
+            t.Fatal(err)
+        }
+    }
+    r, err := raft.NewRaft(conf, &GacheFSM{db: db.New()}, store, store, snaps, trans)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return &testNode{r: r, trans: trans}
+}
+
+func (n *testNode) addr() string {
+    return string(n.trans.LocalAddr())
+}
+
+func members(t *testing.T, r *raft.Raft) map[string]string {
+    future := r.GetConfiguration()
+    if err := future.Error(); err != nil {
+        t.Fatal(err)
+    }
+    ret := map[string]string{}
+    for _, s := range future.Configuration().Servers {
+        ret[string(s.ID)] = string(s.Address)
+    }
+    return ret
+}
+
+func TestDoJoin(t *testing.T) {
+    n1 := newTestNode(t, "n1", true)
+    defer n1.r.Shutdown()
+    select {
+    case <-n1.r.LeaderCh():
+    case <-time.After(5 * time.Second):
+        t.Fatal("no leader")
+    }
+    n2 := newTestNode(t, "n2", false, n1)
+    defer n2.r.Shutdown()
+    n3 := newTestNode(t, "n3", false, n1, n2)
+    defer n3.r.Shutdown()
+
+    if err := DoJoin("n2", n2.addr(), false, n1.r); err != nil {
+        t.Fatal(err)
+    }
+    // 重复加入
+    if err := DoJoin("n2", n2.addr(), false, n1.r); err != nil {
+        t.Fatalf("rejoin: %v", err)
+    }
+
+    cases := []struct {
+        name    string
+        id      string
+        addr    string
+        replace bool
+    }{
+        {"id in use", "n2", n3.addr(), false},
+        {"addr in use", "n3", n2.addr(), false},
+        {"replace leader id", "n1", n3.addr(), true},
+        {"replace leader addr", "n3", n1.addr(), true},
+    }
+    for _, c := range cases {
+        if err := DoJoin(c.id, c.addr, c.replace, n1.r); err != ErrJoinConflict {
+            t.Fatalf("%s: %v", c.name, err)
+        }
+    }
+    if m := members(t, n1.r); len(m) != 2 || m["n2"] != n2.addr() {
+        t.Fatalf("members after conflicts: %v", m)
+    }
+
+    // n2更换地址后替换旧的成员
+    n2.r.Shutdown()
+    moved := newTestNode(t, "n2", false, n1, n3)
+    defer moved.r.Shutdown()
+    if err := DoJoin("n2", moved.addr(), true, n1.r); err != nil {
+        t.Fatal(err)
+    }
+    if m := members(t, n1.r); len(m) != 2 || m["n2"] != moved.addr() {
+        t.Fatalf("members after replace: %v", m)
+    }
+}
@@ -0,0 +1,330 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package cluster
+
+import (
+    "errors"
+    "github.com/hashicorp/go-hclog"
+    "github.com/hashicorp/raft"
+    "github.com/hashicorp/raft-boltdb"
+    "github.com/xfali/gache/config"
+    "github.com/xfali/gache/db"
+    "github.com/xfali/gache/internal/auth"
+    "github.com/xfali/gache/internal/cdc"
+    "github.com/xfali/gache/internal/faultnet"
+    "github.com/xfali/gache/internal/metrics"
+    "github.com/xfali/gache/internal/pubsub"
+    "github.com/xfali/gache/internal/watch"
+    gachelog "github.com/xfali/gache/internal/logger"
+    "io"
+    "net"
+    "path/filepath"
+    "strconv"
+    "time"
+)
+
+type Replication interface {
+    Apply(cmd []byte, timeout time.Duration) (interface{}, error)
+    Barrier(timeout time.Duration) error
+    Join(id, addr string, replace bool) error
+    Leader() string
+    LocalAddr() string
+    Peers() ([]RaftPeer, error)
+    Remove(id string) error
+    Listen(listener func(bool))
+    Stats() map[string]string
+    Status() RaftStatus
+    Shutdown() error
+}
+
+type RaftStatus struct {
+    ID           string `json:"id"`
+    State        string `json:"state"`
+    Leader       string `json:"leader"`
+    Term         uint64 `json:"term"`
+    CommitIndex  uint64 `json:"commitIndex"`
+    AppliedIndex uint64 `json:"appliedIndex"`
+    LastIndex    uint64 `json:"lastIndex"`
+    LastContact  string `json:"lastContact,omitempty"`
+}
+
+type RaftPeer struct {
+    ID       string `json:"id"`
+    Addr     string `json:"addr"`
+    ApiAddr  string `json:"apiAddr,omitempty"`
+    Suffrage string `json:"suffrage"`
+    Leader   bool   `json:"leader"`
+}
+
+type RaftReplication struct {
+    id      string
+    addr    string
+    r       *raft.Raft
+    c       chan bool
+    b       *batcher
+    closers []io.Closer
+}
+
+// Options 替换raft默认的网络和存储，为nil的字段使用默认实现（TCP/TLS、raft-dir下的boltdb和快照文件）
+type Options struct {
+    Transport     raft.Transport
+    LogStore      raft.LogStore
+    StableStore   raft.StableStore
+    SnapshotStore raft.SnapshotStore
+    // 不为nil时在transport上注入故障
+    Faults *faultnet.Network
+    // 应用日志时通知订阅者
+    Watch *watch.Hub
+    // 应用PUBLISH时发送给订阅者
+    PubSub *pubsub.Broker
+    // 应用日志时记录key的修改
+    Cdc *cdc.Log
+    // 注册raft提交相关的指标
+    Metrics *metrics.Registry
+}
+
+func (r *RaftReplication) Apply(cmd []byte, timeout time.Duration) (interface{}, error) {
+    return r.b.apply(cmd, timeout)
+}
+
+// Barrier 等待之前的日志都已经应用到FSM，只能在leader上执行
+func (r *RaftReplication) Barrier(timeout time.Duration) error {
+    return r.r.Barrier(timeout).Error()
+}
+
+func (r *RaftReplication) Join(id, addr string, replace bool) error {
+    return DoJoin(id, addr, replace, r.r)
+}
+
+// leader的raft地址，未知时为空
+func (r *RaftReplication) Leader() string {
+    return string(r.r.Leader())
+}
+
+func (r *RaftReplication) LocalAddr() string {
+    return r.addr
+}
+
+// raft集群当前的成员
+func (r *RaftReplication) Peers() ([]RaftPeer, error) {
+    future := r.r.GetConfiguration()
+    if err := future.Error(); err != nil {
+        return nil, err
+    }
+    leader := r.r.Leader()
+    servers := future.Configuration().Servers
+    ret := make([]RaftPeer, len(servers))
+    for i, s := range servers {
+        ret[i] = RaftPeer{
+            ID:       string(s.ID),
+            Addr:     string(s.Address),
+            Suffrage: s.Suffrage.String(),
+            Leader:   s.Address == leader,
+        }
+    }
+    return ret, nil
+}
+
+// 将节点移出raft集群，只能在leader上执行
+func (r *RaftReplication) Remove(id string) error {
+    return r.r.RemoveServer(raft.ServerID(id), 0, 0).Error()
+}
+
+func (r *RaftReplication) Shutdown() error {
+    r.b.shutdown()
+    err := r.r.Shutdown().Error()
+    for _, c := range r.closers {
+        if e := c.Close(); e != nil && err == nil {
+            err = e
+        }
+    }
+    return err
+}
+
+func (r *RaftReplication) Stats() map[string]string {
+    return r.r.Stats()
+}
+
+func (r *RaftReplication) Status() RaftStatus {
+    stats := r.r.Stats()
+    parse := func(key string) uint64 {
+        v, _ := strconv.ParseUint(stats[key], 10, 64)
+        return v
+    }
+    return RaftStatus{
+        ID:           r.id,
+        State:        stats["state"],
+        Leader:       r.Leader(),
+        Term:         parse("term"),
+        CommitIndex:  parse("commit_index"),
+        AppliedIndex: parse("applied_index"),
+        LastIndex:    parse("last_log_index"),
+        LastContact:  stats["last_contact"],
+    }
+}
+
+func (r *RaftReplication) Listen(listener func(bool)) {
+    go func() {
+        for v := range r.c {
+            listener(v)
+        }
+    }()
+}
+
+func New(conf *config.Config, db *db.GacheDb, notifyChan chan bool, logger hclog.Logger) (Replication, error) {
+    return NewWithOptions(conf, db, notifyChan, logger, Options{})
+}
+
+func NewWithOptions(conf *config.Config, db *db.GacheDb, notifyChan chan bool, logger hclog.Logger, opts Options) (Replication, error) {
+    logger = logger.Named("raft")
+    raftConfig := raft.DefaultConfig()
+    raftConfig.Logger = logger
+    raftConfig.LocalID = raft.ServerID(conf.NodeID())
+    raftConfig.HeartbeatTimeout = conf.RaftHeartbeatTimeout
+    raftConfig.ElectionTimeout = conf.RaftElectionTimeout
+    raftConfig.CommitTimeout = conf.RaftCommitTimeout
+    raftConfig.LeaderLeaseTimeout = conf.RaftLeaderLeaseTimeout
+    raftConfig.SnapshotInterval = conf.RaftSnapshotInterval
+    raftConfig.SnapshotThreshold = conf.RaftSnapshotThreshold
+    if notifyChan != nil {
+        raftConfig.NotifyCh = notifyChan
+    }
+
+    var closers []io.Closer
+    fail := func(err error) (Replication, error) {
+        for _, c := range closers {
+            c.Close()
+        }
+        return nil, err
+    }
+
+    if opts.LogStore == nil || opts.StableStore == nil || opts.SnapshotStore == nil {
+        if !IsPathExists(conf.RaftDir) {
+            Mkdir(conf.RaftDir)
+        }
+    }
+    logStore := opts.LogStore
+    if logStore == nil {
+        store, err := raftboltdb.NewBoltStore(filepath.Join(conf.RaftDir, "raft-log.bolt"))
+        if err != nil {
+            return fail(err)
+        }
+        closers = append(closers, store)
+        logStore = store
+    }
+    stableStore := opts.StableStore
+    if stableStore == nil {
+        store, err := raftboltdb.NewBoltStore(filepath.Join(conf.RaftDir, "raft-stable.bolt"))
+        if err != nil {
+            return fail(err)
+        }
+        closers = append(closers, store)
+        stableStore = store
+    }
+    snapshotStore := opts.SnapshotStore
+    if snapshotStore == nil {
+        store, err := raft.NewFileSnapshotStoreWithLogger(conf.RaftDir, conf.RaftSnapshotRetain, gachelog.Std(logger))
+        if err != nil {
+            return fail(err)
+        }
+        snapshotStore = store
+    }
+    transport := opts.Transport
+    if transport == nil {
+        t, err := newRaftTransport(conf, logger)
+        if err != nil {
+            return fail(err)
+        }
+        transport = t
+    }
+    if opts.Faults != nil {
+        transport = opts.Faults.RaftTransport(conf.NodeID(), transport)
+    }
+
+    if conf.RaftJoinAddr == "" {
+        configuration := raft.Configuration{
+            Servers: []raft.Server{
+                {
+                    ID:      raftConfig.LocalID,
+                    Address: transport.LocalAddr(),
+                },
+            },
+        }
+        raft.BootstrapCluster(raftConfig, logStore, stableStore, snapshotStore, transport, configuration)
+    }
+    // 本地已有的日志在启动后会重新应用
+    replayed, err := logStore.LastIndex()
+    if err != nil {
+        return fail(err)
+    }
+    fsm := &GacheFSM{db: db, hub: opts.Watch, pubsub: opts.PubSub, cdc: opts.Cdc, replayed: replayed}
+    r, err := raft.NewRaft(raftConfig, fsm, logStore, stableStore, snapshotStore, transport)
+    if err != nil {
+        return fail(err)
+    }
+    b := newBatcher(r, conf.RaftMaxBatch, conf.RaftMaxInflight, conf.RaftApplyTimeout, opts.Metrics)
+    return &RaftReplication{
+        id:      string(raftConfig.LocalID),
+        addr:    string(transport.LocalAddr()),
+        r:       r,
+        c:       notifyChan,
+        b:       b,
+        closers: closers,
+    }, nil
+}
+
+// DoJoin 将节点加入集群，可以重复调用：ID与地址都未变化时直接返回。
+// 同一ID换了地址（或地址被其他ID占用）时返回ErrJoinConflict，replace为true时先移除旧的成员再加入，
+// 但不会移除leader
+func DoJoin(id, addr string, replace bool, cluster *raft.Raft) error {
+    if cluster == nil {
+        return errors.New("raft is nil")
+    }
+    future := cluster.GetConfiguration()
+    if err := future.Error(); err != nil {
+        return err
+    }
+    serverID, serverAddr := raft.ServerID(id), raft.ServerAddress(addr)
+    for _, s := range future.Configuration().Servers {
+        if s.ID == serverID && s.Address == serverAddr {
+            return nil
+        }
+        if s.ID != serverID && s.Address != serverAddr {
+            continue
+        }
+        if !replace || s.Address == cluster.Leader() {
+            return ErrJoinConflict
+        }
+        if err := cluster.RemoveServer(s.ID, 0, 0).Error(); err != nil {
+            return err
+        }
+    }
+    return cluster.AddVoter(serverID, serverAddr, 0, 0).Error()
+}
+
+func newRaftTransport(conf *config.Config, logger hclog.Logger) (*raft.NetworkTransport, error) {
+    address, err := net.ResolveTCPAddr("tcp", conf.RaftTcpAddr)
+    if err != nil {
+        return nil, err
+    }
+    if conf.RaftTls {
+        server, client, err := auth.PeerTLSConfig(conf)
+        if err != nil {
+            return nil, err
+        }
+        stream, err := newTLSStreamLayer(address.String(), address, server, client)
+        if err != nil {
+            return nil, err
+        }
+        return raft.NewNetworkTransportWithLogger(stream, conf.RaftMaxPool, conf.RaftTransportTimeout, gachelog.Std(logger)), nil
+    }
+    transport, err := raft.NewTCPTransportWithLogger(address.String(), address, conf.RaftMaxPool, conf.RaftTransportTimeout, gachelog.Std(logger))
+    if err != nil {
+        return nil, err
+    }
+    return transport, nil
+}
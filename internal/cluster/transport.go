@@ -0,0 +1,61 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package cluster
+
+import (
+    "crypto/tls"
+    "errors"
+    "github.com/hashicorp/raft"
+    "net"
+    "time"
+)
+
+var (
+    errNotAdvertisable = errors.New("local bind address is not advertisable")
+)
+
+// tlsStreamLayer 实现raft.StreamLayer，raft节点之间使用双向认证的TLS连接
+type tlsStreamLayer struct {
+    net.Listener
+    advertise net.Addr
+    config    *tls.Config
+}
+
+func newTLSStreamLayer(bindAddr string, advertise net.Addr, server, client *tls.Config) (*tlsStreamLayer, error) {
+    l, err := tls.Listen("tcp", bindAddr, server)
+    if err != nil {
+        return nil, err
+    }
+
+    if advertise == nil {
+        advertise = l.Addr()
+    }
+    addr, ok := advertise.(*net.TCPAddr)
+    if !ok {
+        l.Close()
+        return nil, errNotAdvertisable
+    }
+    if addr.IP.IsUnspecified() {
+        l.Close()
+        return nil, errNotAdvertisable
+    }
+
+    return &tlsStreamLayer{
+        Listener:  l,
+        advertise: advertise,
+        config:    client,
+    }, nil
+}
+
+func (t *tlsStreamLayer) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+    dialer := &net.Dialer{Timeout: timeout}
+    return tls.DialWithDialer(dialer, "tcp", string(address), t.config)
+}
+
+func (t *tlsStreamLayer) Addr() net.Addr {
+    return t.advertise
+}
@@ -8,31 +8,11 @@ package cluster
 
 import (
     "errors"
-    "fmt"
-    "gache/config"
-    "io"
-    "io/ioutil"
-    "net/http"
     "os"
     "strconv"
     "strings"
 )
 
-func Join(conf *config.Config) error {
-    url := fmt.Sprintf("http://%s/join?addr=%s",
-        conf.RaftJoinAddr,
-        conf.RaftTcpAddr)
-    resp, err := http.Get(url)
-    if err != nil {
-        return err
-    }
-    defer resp.Body.Close()
-
-    io.Copy(ioutil.Discard, resp.Body)
-
-    return nil
-}
-
 // 判断文件夹是否存在
 func IsPathExists(path string) bool {
     _, err := os.Stat(path)
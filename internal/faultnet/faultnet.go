@@ -0,0 +1,277 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+// Package faultnet 包装raft和memberlist的transport，按规则丢弃、延迟、重复或者隔离节点之间的流量，
+// 用于复现脑裂、网络缓慢等问题
+package faultnet
+
+import (
+    "errors"
+    "math/rand"
+    "sort"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// Any 匹配任意节点
+const Any = "*"
+
+var errDropped = errors.New("faultnet: message dropped")
+
+// Rule 作用于从一个节点发往另一个节点的流量
+type Rule struct {
+    // 隔离，丢弃全部流量
+    Partition bool
+    // 丢弃的概率，0-1
+    Drop float64
+    // 重复发送的概率，0-1
+    Duplicate float64
+    // 延迟在[Delay, Delay+Jitter)之间随机
+    Delay  time.Duration
+    Jitter time.Duration
+}
+
+type LinkRule struct {
+    From string
+    To   string
+    Rule
+}
+
+type Stats struct {
+    Dropped    uint64 `json:"dropped"`
+    Delayed    uint64 `json:"delayed"`
+    Duplicated uint64 `json:"duplicated"`
+}
+
+type link struct {
+    from, to string
+}
+
+// 对一条消息的处理
+type fault struct {
+    drop  bool
+    dup   bool
+    delay time.Duration
+}
+
+// Network 保存节点之间的规则，同一个Network可以被多个节点共用（进程内的测试集群），
+// 此时只在发送方执行规则
+type Network struct {
+    mu    sync.RWMutex
+    names map[string]string
+    local map[string]bool
+    rules map[link]Rule
+
+    rndMu sync.Mutex
+    rnd   *rand.Rand
+
+    dropped    uint64
+    delayed    uint64
+    duplicated uint64
+}
+
+func New() *Network {
+    return &Network{
+        names: map[string]string{},
+        local: map[string]bool{},
+        rules: map[link]Rule{},
+        rnd:   rand.New(rand.NewSource(time.Now().UnixNano())),
+    }
+}
+
+// Register 设置节点的名称，规则中可以使用名称代替raft、gossip地址
+func (n *Network) Register(name string, addrs ...string) {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    for _, addr := range addrs {
+        n.names[addr] = name
+    }
+}
+
+// 未注册的地址使用地址本身作为名称
+func (n *Network) name(addr string) string {
+    n.mu.RLock()
+    defer n.mu.RUnlock()
+    if name, ok := n.names[addr]; ok {
+        return name
+    }
+    return addr
+}
+
+func (n *Network) addLocal(name string) {
+    n.mu.Lock()
+    n.local[name] = true
+    n.mu.Unlock()
+}
+
+// Local 通过本Network发送数据的节点
+func (n *Network) Local() []string {
+    n.mu.RLock()
+    defer n.mu.RUnlock()
+    ret := make([]string, 0, len(n.local))
+    for name := range n.local {
+        ret = append(ret, name)
+    }
+    sort.Strings(ret)
+    return ret
+}
+
+// Set 设置从from到to的规则，from、to可以是Any
+func (n *Network) Set(from, to string, r Rule) {
+    n.mu.Lock()
+    n.rules[link{from, to}] = r
+    n.mu.Unlock()
+}
+
+func (n *Network) Clear(from, to string) {
+    n.mu.Lock()
+    delete(n.rules, link{from, to})
+    n.mu.Unlock()
+}
+
+// Partition 隔离不同分组的节点，同一分组内的节点之间不受影响
+func (n *Network) Partition(groups ...[]string) {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    for i, a := range groups {
+        for j, b := range groups {
+            if i == j {
+                continue
+            }
+            for _, from := range a {
+                for _, to := range b {
+                    n.partition(link{from, to})
+                }
+            }
+        }
+    }
+}
+
+// Isolate 隔离节点与其他所有节点
+func (n *Network) Isolate(name string) {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    n.partition(link{name, Any})
+    n.partition(link{Any, name})
+}
+
+func (n *Network) partition(l link) {
+    r := n.rules[l]
+    r.Partition = true
+    n.rules[l] = r
+}
+
+// Heal 清除所有规则
+func (n *Network) Heal() {
+    n.mu.Lock()
+    n.rules = map[link]Rule{}
+    n.mu.Unlock()
+}
+
+func (n *Network) Rules() []LinkRule {
+    n.mu.RLock()
+    ret := make([]LinkRule, 0, len(n.rules))
+    for l, r := range n.rules {
+        ret = append(ret, LinkRule{From: l.from, To: l.to, Rule: r})
+    }
+    n.mu.RUnlock()
+
+    sort.Slice(ret, func(i, j int) bool {
+        if ret[i].From != ret[j].From {
+            return ret[i].From < ret[j].From
+        }
+        return ret[i].To < ret[j].To
+    })
+    return ret
+}
+
+func (n *Network) Stats() Stats {
+    return Stats{
+        Dropped:    atomic.LoadUint64(&n.dropped),
+        Delayed:    atomic.LoadUint64(&n.delayed),
+        Duplicated: atomic.LoadUint64(&n.duplicated),
+    }
+}
+
+// Partitioned 从from到to的流量是否被隔离
+func (n *Network) Partitioned(from, to string) bool {
+    r, ok := n.rule(from, to)
+    return ok && r.Partition
+}
+
+// 精确匹配的规则优先，其次是from或to为Any的规则
+func (n *Network) rule(from, to string) (Rule, bool) {
+    n.mu.RLock()
+    defer n.mu.RUnlock()
+    for _, l := range []link{{from, to}, {from, Any}, {Any, to}, {Any, Any}} {
+        if r, ok := n.rules[l]; ok {
+            return r, true
+        }
+    }
+    return Rule{}, false
+}
+
+func (n *Network) decide(from, to string) fault {
+    r, ok := n.rule(from, to)
+    if !ok {
+        return fault{}
+    }
+    n.rndMu.Lock()
+    f := fault{
+        drop:  r.Partition || (r.Drop > 0 && n.rnd.Float64() < r.Drop),
+        dup:   r.Duplicate > 0 && n.rnd.Float64() < r.Duplicate,
+        delay: r.Delay,
+    }
+    if r.Jitter > 0 {
+        f.delay += time.Duration(n.rnd.Int63n(int64(r.Jitter)))
+    }
+    n.rndMu.Unlock()
+
+    switch {
+    case f.drop:
+        atomic.AddUint64(&n.dropped, 1)
+        return fault{drop: true}
+    case f.dup:
+        atomic.AddUint64(&n.duplicated, 1)
+    }
+    if f.delay > 0 {
+        atomic.AddUint64(&n.delayed, 1)
+    }
+    return f
+}
+
+// 本节点发出的消息
+func (n *Network) outgoing(local, addr string) fault {
+    return n.decide(local, n.name(addr))
+}
+
+// 收到的消息，发送方也使用本Network时已经在发送时处理过
+func (n *Network) incoming(addr, local string) fault {
+    from := n.name(addr)
+    n.mu.RLock()
+    sent := n.local[from]
+    n.mu.RUnlock()
+    if sent {
+        return fault{}
+    }
+    return n.decide(from, local)
+}
+
+// 等待d，shutdown关闭时返回false
+func sleep(d time.Duration, shutdown <-chan struct{}) bool {
+    if d <= 0 {
+        return true
+    }
+    t := time.NewTimer(d)
+    defer t.Stop()
+    select {
+    case <-t.C:
+        return true
+    case <-shutdown:
+        return false
+    }
+}
@@ -0,0 +1,122 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package faultnet
+
+import (
+    "github.com/hashicorp/memberlist"
+    "net"
+    "sync"
+    "time"
+)
+
+type gossipTransport struct {
+    memberlist.Transport
+    net  *Network
+    name string
+
+    packetCh chan *memberlist.Packet
+    once     sync.Once
+    shutdown chan struct{}
+}
+
+// GossipTransport 包装节点name的memberlist transport，需要用Register设置节点的gossip地址。
+// 收到的TCP连接无法确定发送方，只在发送方执行规则
+func (n *Network) GossipTransport(name string, t memberlist.Transport) memberlist.Transport {
+    n.addLocal(name)
+    ret := &gossipTransport{
+        Transport: t,
+        net:       n,
+        name:      name,
+        packetCh:  make(chan *memberlist.Packet, 1024),
+        shutdown:  make(chan struct{}),
+    }
+    go ret.receive()
+    return ret
+}
+
+func (t *gossipTransport) receive() {
+    ch := t.Transport.PacketCh()
+    for {
+        select {
+        case p := <-ch:
+            f := t.net.incoming(p.From.String(), t.name)
+            if f.drop {
+                continue
+            }
+            if f.delay > 0 {
+                time.AfterFunc(f.delay, func() { t.deliver(p) })
+                continue
+            }
+            t.deliver(p)
+        case <-t.shutdown:
+            return
+        }
+    }
+}
+
+// 与UDP一样，来不及处理时丢弃
+func (t *gossipTransport) deliver(p *memberlist.Packet) {
+    select {
+    case t.packetCh <- p:
+    default:
+    }
+}
+
+func (t *gossipTransport) PacketCh() <-chan *memberlist.Packet {
+    return t.packetCh
+}
+
+// 丢弃时与UDP一样不返回错误，延迟时在后台发送
+func (t *gossipTransport) WriteTo(b []byte, addr string) (time.Time, error) {
+    now := time.Now()
+    f := t.net.outgoing(t.name, addr)
+    if f.drop {
+        return now, nil
+    }
+    times := 1
+    if f.dup {
+        times = 2
+    }
+    if f.delay > 0 {
+        buf := make([]byte, len(b))
+        copy(buf, b)
+        time.AfterFunc(f.delay, func() {
+            for i := 0; i < times; i++ {
+                t.Transport.WriteTo(buf, addr)
+            }
+        })
+        return now, nil
+    }
+    for i := 0; i < times; i++ {
+        if _, err := t.Transport.WriteTo(b, addr); err != nil {
+            return now, err
+        }
+    }
+    return now, nil
+}
+
+func (t *gossipTransport) DialTimeout(addr string, timeout time.Duration) (net.Conn, error) {
+    f := t.net.outgoing(t.name, addr)
+    if f.drop {
+        return nil, errDropped
+    }
+    if f.delay > timeout {
+        sleep(timeout, t.shutdown)
+        return nil, errDropped
+    }
+    if !sleep(f.delay, t.shutdown) {
+        return nil, errDropped
+    }
+    return t.Transport.DialTimeout(addr, timeout-f.delay)
+}
+
+func (t *gossipTransport) Shutdown() error {
+    t.once.Do(func() {
+        close(t.shutdown)
+    })
+    return t.Transport.Shutdown()
+}
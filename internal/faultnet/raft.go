@@ -0,0 +1,169 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package faultnet
+
+import (
+    "github.com/hashicorp/raft"
+    "io"
+    "sync"
+)
+
+type raftTransport struct {
+    raft.Transport
+    net  *Network
+    name string
+
+    consumer chan raft.RPC
+    once     sync.Once
+    shutdown chan struct{}
+}
+
+// RaftTransport 包装节点name的raft transport。
+// 不支持流水线复制（AppendEntriesPipeline），raft会逐个发送AppendEntries
+func (n *Network) RaftTransport(name string, t raft.Transport) raft.Transport {
+    n.Register(name, string(t.LocalAddr()))
+    n.addLocal(name)
+    ret := &raftTransport{
+        Transport: t,
+        net:       n,
+        name:      name,
+        consumer:  make(chan raft.RPC),
+        shutdown:  make(chan struct{}),
+    }
+    go ret.receive()
+    return ret
+}
+
+func (t *raftTransport) receive() {
+    ch := t.Transport.Consumer()
+    for {
+        select {
+        case rpc := <-ch:
+            if !t.accept(rpc) {
+                continue
+            }
+            select {
+            case t.consumer <- rpc:
+            case <-t.shutdown:
+                return
+            }
+        case <-t.shutdown:
+            return
+        }
+    }
+}
+
+// 根据发送方处理收到的请求，丢弃时返回错误
+func (t *raftTransport) accept(rpc raft.RPC) bool {
+    var from []byte
+    switch req := rpc.Command.(type) {
+    case *raft.AppendEntriesRequest:
+        from = req.Leader
+    case *raft.RequestVoteRequest:
+        from = req.Candidate
+    case *raft.InstallSnapshotRequest:
+        from = req.Leader
+    default:
+        return true
+    }
+    f := t.net.incoming(string(t.Transport.DecodePeer(from)), t.name)
+    if f.drop {
+        rpc.Respond(nil, errDropped)
+        return false
+    }
+    if !sleep(f.delay, t.shutdown) {
+        rpc.Respond(nil, raft.ErrTransportShutdown)
+        return false
+    }
+    return true
+}
+
+func (t *raftTransport) Consumer() <-chan raft.RPC {
+    return t.consumer
+}
+
+func (t *raftTransport) SetHeartbeatHandler(cb func(rpc raft.RPC)) {
+    if cb == nil {
+        t.Transport.SetHeartbeatHandler(nil)
+        return
+    }
+    t.Transport.SetHeartbeatHandler(func(rpc raft.RPC) {
+        if t.accept(rpc) {
+            cb(rpc)
+        }
+    })
+}
+
+// 发送前执行规则，返回是否重复发送
+func (t *raftTransport) send(target raft.ServerAddress) (bool, error) {
+    f := t.net.outgoing(t.name, string(target))
+    if f.drop {
+        return false, errDropped
+    }
+    if !sleep(f.delay, t.shutdown) {
+        return false, raft.ErrTransportShutdown
+    }
+    return f.dup, nil
+}
+
+func (t *raftTransport) AppendEntriesPipeline(id raft.ServerID, target raft.ServerAddress) (raft.AppendPipeline, error) {
+    return nil, raft.ErrPipelineReplicationNotSupported
+}
+
+func (t *raftTransport) AppendEntries(id raft.ServerID, target raft.ServerAddress, args *raft.AppendEntriesRequest, resp *raft.AppendEntriesResponse) error {
+    dup, err := t.send(target)
+    if err != nil {
+        return err
+    }
+    if err := t.Transport.AppendEntries(id, target, args, resp); err != nil {
+        return err
+    }
+    if dup {
+        t.Transport.AppendEntries(id, target, args, &raft.AppendEntriesResponse{})
+    }
+    return nil
+}
+
+func (t *raftTransport) RequestVote(id raft.ServerID, target raft.ServerAddress, args *raft.RequestVoteRequest, resp *raft.RequestVoteResponse) error {
+    dup, err := t.send(target)
+    if err != nil {
+        return err
+    }
+    if err := t.Transport.RequestVote(id, target, args, resp); err != nil {
+        return err
+    }
+    if dup {
+        t.Transport.RequestVote(id, target, args, &raft.RequestVoteResponse{})
+    }
+    return nil
+}
+
+// 快照数据只能读取一次，不重复发送
+func (t *raftTransport) InstallSnapshot(id raft.ServerID, target raft.ServerAddress, args *raft.InstallSnapshotRequest, resp *raft.InstallSnapshotResponse, data io.Reader) error {
+    if _, err := t.send(target); err != nil {
+        return err
+    }
+    return t.Transport.InstallSnapshot(id, target, args, resp, data)
+}
+
+func (t *raftTransport) TimeoutNow(id raft.ServerID, target raft.ServerAddress, args *raft.TimeoutNowRequest, resp *raft.TimeoutNowResponse) error {
+    if _, err := t.send(target); err != nil {
+        return err
+    }
+    return t.Transport.TimeoutNow(id, target, args, resp)
+}
+
+// Close raft.Shutdown时调用
+func (t *raftTransport) Close() error {
+    t.once.Do(func() {
+        close(t.shutdown)
+    })
+    if c, ok := t.Transport.(raft.WithClose); ok {
+        return c.Close()
+    }
+    return nil
+}
@@ -0,0 +1,116 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package handler
+
+import (
+    "encoding/json"
+    "github.com/xfali/gache/acl"
+    "github.com/xfali/gache/command"
+    "github.com/xfali/gache/internal/auth"
+    "net/http"
+    "strings"
+)
+
+const aclUsersPath = "/admin/acl/users"
+
+func (handler *Handler) authorize(resp http.ResponseWriter, req *http.Request, cmdReq *command.Request) bool {
+    if handler.ctx.Authorized(auth.FromContext(req.Context()), cmdReq.Cmd, cmdReq.K) {
+        return true
+    }
+    resp.WriteHeader(http.StatusForbidden)
+    resp.Write([]byte("permission denied"))
+    return false
+}
+
+func (handler *Handler) requireAdmin(resp http.ResponseWriter, req *http.Request) bool {
+    if handler.ctx.IsAdmin(auth.FromContext(req.Context())) {
+        return true
+    }
+    resp.WriteHeader(http.StatusForbidden)
+    resp.Write([]byte("permission denied"))
+    return false
+}
+
+// AclUsers 管理ACL用户：
+//   GET    /admin/acl/users        全部用户
+//   GET    /admin/acl/users/NAME   单个用户
+//   PUT    /admin/acl/users/NAME   创建或替换用户，body为acl.User的JSON
+//   DELETE /admin/acl/users/NAME   删除用户
+func (handler *Handler) AclUsers(resp http.ResponseWriter, req *http.Request) {
+    if !handler.requireAdmin(resp, req) {
+        return
+    }
+
+    name := strings.Trim(strings.TrimPrefix(req.URL.Path, aclUsersPath), "/")
+    switch req.Method {
+    case http.MethodGet:
+        if name == "" {
+            writeJson(resp, handler.ctx.db.Acl.ListUsers())
+            return
+        }
+        u, ok := handler.ctx.db.Acl.GetUser(name)
+        if !ok {
+            resp.WriteHeader(http.StatusNotFound)
+            resp.Write([]byte("user not found"))
+            return
+        }
+        writeJson(resp, u)
+    case http.MethodPut, http.MethodPost:
+        value, err := getValue(req)
+        if err != nil {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte(err.Error()))
+            return
+        }
+        u := acl.User{}
+        if err := json.Unmarshal([]byte(value), &u); err != nil {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte(err.Error()))
+            return
+        }
+        u.Name = name
+        if err := validateUser(&u); err != nil {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte(err.Error()))
+            return
+        }
+        b, _ := json.Marshal(u)
+        handler.processAdmin(resp, req, &command.Request{Cmd: command.ACL_SETUSER, K: name, V: string(b)})
+    case http.MethodDelete:
+        handler.processAdmin(resp, req, &command.Request{Cmd: command.ACL_DELUSER, K: name})
+    default:
+        resp.WriteHeader(http.StatusMethodNotAllowed)
+        resp.Write([]byte("method not support"))
+    }
+}
+
+func validateUser(u *acl.User) error {
+    if err := u.Validate(); err != nil {
+        return err
+    }
+    return command.ValidateRules(u.Rules)
+}
+
+func (handler *Handler) processAdmin(resp http.ResponseWriter, req *http.Request, cmdReq *command.Request) {
+    if !handler.leader(resp, req) {
+        return
+    }
+    if _, err := handler.ctx.ProcessCmd(cmdReq, false); err != nil {
+        writeCmdError(resp, err)
+    }
+}
+
+func writeJson(resp http.ResponseWriter, v interface{}) {
+    b, err := json.Marshal(v)
+    if err != nil {
+        resp.WriteHeader(http.StatusInternalServerError)
+        resp.Write([]byte(err.Error()))
+        return
+    }
+    resp.Header().Set("Content-Type", "application/json")
+    resp.Write(b)
+}
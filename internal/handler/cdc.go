@@ -0,0 +1,151 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package handler
+
+import (
+    "bufio"
+    "encoding/json"
+    "github.com/xfali/gache/internal/cdc"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const (
+    // 下一次读取CDC记录时使用的from
+    HeaderCdcNext = "X-Gache-Cdc-Next"
+
+    defaultCdcLimit = 1000
+    maxCdcWait      = time.Minute
+)
+
+// Cdc 读取key的修改记录（需要管理员权限）：
+//   GET /cdc?from=INDEX|consumer=NAME[&limit=N][&wait=DURATION]
+// 返回index大于from的记录，每行一条cdc.Record的JSON（NDJSON），没有记录时最多等待wait。
+// 只指定consumer时从该消费者提交的offset开始，处理完成后通过 /cdc/offsets/NAME 提交X-Gache-Cdc-Next。
+// 记录已经不在缓冲区中时返回410
+func (handler *Handler) Cdc(resp http.ResponseWriter, req *http.Request) {
+    if !handler.requireAdmin(resp, req) {
+        return
+    }
+    if req.Method != http.MethodGet {
+        resp.WriteHeader(http.StatusMethodNotAllowed)
+        resp.Write([]byte("method not support"))
+        return
+    }
+    l := handler.ctx.cdc
+    if l == nil {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte("cdc is not enabled"))
+        return
+    }
+
+    query := req.URL.Query()
+    var from uint64
+    if v := query.Get("from"); v != "" {
+        i, err := strconv.ParseUint(v, 10, 64)
+        if err != nil {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte("invalid from: " + v))
+            return
+        }
+        from = i
+    } else if consumer := query.Get("consumer"); consumer != "" {
+        from = handler.ctx.Offset(consumer)
+    }
+    limit := defaultCdcLimit
+    if v := query.Get("limit"); v != "" {
+        i, err := strconv.Atoi(v)
+        if err != nil || i <= 0 {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte("invalid limit: " + v))
+            return
+        }
+        limit = i
+    }
+    var wait time.Duration
+    if v := query.Get("wait"); v != "" {
+        d, err := time.ParseDuration(v)
+        if err != nil || d < 0 {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte("invalid wait: " + v))
+            return
+        }
+        if d > maxCdcWait {
+            d = maxCdcWait
+        }
+        wait = d
+    }
+    if wait > 0 {
+        // 等待时间可能超过http-write-timeout
+        handler.clearWriteDeadline(resp)
+    }
+
+    records, next, err := l.Read(req.Context(), from, limit, wait)
+    if err != nil {
+        if _, ok := err.(*cdc.CompactedError); ok {
+            resp.WriteHeader(http.StatusGone)
+        } else {
+            resp.WriteHeader(http.StatusServiceUnavailable)
+        }
+        resp.Write([]byte(err.Error()))
+        return
+    }
+
+    resp.Header().Set("Content-Type", "application/x-ndjson")
+    resp.Header().Set(HeaderCdcNext, strconv.FormatUint(next, 10))
+    w := bufio.NewWriter(resp)
+    enc := json.NewEncoder(w)
+    for i := range records {
+        enc.Encode(&records[i])
+    }
+    w.Flush()
+}
+
+// CdcOffsets 消费者提交的offset（需要管理员权限）：
+//   GET /cdc/offsets/NAME    未提交时为0
+//   PUT /cdc/offsets/NAME    提交offset，body为已经处理的最后一条记录的index
+func (handler *Handler) CdcOffsets(resp http.ResponseWriter, req *http.Request) {
+    if !handler.requireAdmin(resp, req) {
+        return
+    }
+    consumer := strings.TrimPrefix(req.URL.Path, "/cdc/offsets/")
+    if consumer == "" {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte("consumer is required"))
+        return
+    }
+
+    switch req.Method {
+    case http.MethodGet:
+        resp.Write([]byte(strconv.FormatUint(handler.ctx.Offset(consumer), 10)))
+    case http.MethodPut, http.MethodPost:
+        if !handler.leader(resp, req) {
+            return
+        }
+        value, err := getValue(req)
+        if err != nil {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte(err.Error()))
+            return
+        }
+        value = strings.TrimSpace(value)
+        offset, err := strconv.ParseUint(value, 10, 64)
+        if err != nil {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte("invalid offset: " + value))
+            return
+        }
+        if procErr := handler.ctx.CommitOffset(consumer, offset); procErr != nil {
+            writeCmdError(resp, procErr)
+        }
+    default:
+        resp.WriteHeader(http.StatusMethodNotAllowed)
+        resp.Write([]byte("method not support"))
+    }
+}
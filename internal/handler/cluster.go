@@ -8,8 +8,9 @@ package handler
 
 import (
     "encoding/json"
-    "hash/crc32"
-    "log"
+    "fmt"
+    "github.com/hashicorp/go-hclog"
+    "github.com/xfali/gache/internal/utils"
     "sort"
     "sync"
     "sync/atomic"
@@ -24,6 +25,7 @@ const (
 
 type NodeInfo struct {
     ApiAddr   string `json:"apiAddr,omitempty"`
+    RespAddr  string `json:"respAddr,omitempty"`
     Addr      string `json:"addr,omitempty"`
     SlotBegin uint32 `json:"slotBegin,omitempty"`
     SlotEnd   uint32 `json:"slotEnd,omitempty"`
@@ -36,15 +38,13 @@ type ClusterManager struct {
     mu          sync.Mutex
     Nodes       NodeList
     LeaderNodes NodeList
+    logger      hclog.Logger
 
-    state int32
+    state  int32
+    reason string
 }
 
-var CRC32Q *crc32.Table
-
-func init() {
-    CRC32Q = crc32.MakeTable(0xD5828281)
-}
+var CRC32Q = utils.CRC32Q
 
 func (n *NodeList) Len() int {
     return len(*n)
@@ -105,7 +105,7 @@ func (cm *ClusterManager) Join(node NodeInfo) {
 
     for i := range cm.Nodes {
         if cm.Nodes[i].Addr == node.Addr {
-            log.Printf("Join same node: %s\n", node.Addr)
+            cm.logger.Debug("join same node", "addr", node.Addr)
             return
         }
     }
@@ -115,6 +115,17 @@ func (cm *ClusterManager) Join(node NodeInfo) {
     cm.checkNode()
 }
 
+func (cm *ClusterManager) State() int32 {
+    return atomic.LoadInt32(&cm.state)
+}
+
+func (cm *ClusterManager) NumNodes() (int, int) {
+    cm.mu.Lock()
+    defer cm.mu.Unlock()
+
+    return len(cm.Nodes), len(cm.LeaderNodes)
+}
+
 func (cm *ClusterManager) Enable() bool {
     return atomic.LoadInt32(&cm.state) == OK
 }
@@ -130,6 +141,15 @@ func (cm *ClusterManager) Leaders() ([]NodeInfo, error) {
     return ret, nil
 }
 
+func (cm *ClusterManager) AllNodes() []NodeInfo {
+    cm.mu.Lock()
+    defer cm.mu.Unlock()
+
+    ret := make([]NodeInfo, len(cm.Nodes))
+    copy(ret, cm.Nodes)
+    return ret
+}
+
 func (cm *ClusterManager) refreshLeaders() {
     cm.LeaderNodes = NodeList{}
     for i := range cm.Nodes {
@@ -143,41 +163,50 @@ func (cm *ClusterManager) checkNode() bool {
     cm.refreshLeaders()
     sort.Sort(&cm.LeaderNodes)
 
-    log.Printf("leader node %v\n", cm.LeaderNodes)
-    log.Printf("all node %v\n", cm.Nodes)
+    cm.logger.Debug("check nodes", "leaders", cm.LeaderNodes, "nodes", cm.Nodes)
+    state, reason := cm.checkSlots()
+    old := atomic.SwapInt32(&cm.state, state)
+    if old != state || cm.reason != reason {
+        if state == OK {
+            cm.logger.Info("cluster state changed", "state", "OK")
+        } else {
+            cm.logger.Warn("cluster state changed", "state", clusterStates[state], "reason", reason)
+        }
+    }
+    cm.reason = reason
+    return state == OK
+}
+
+func (cm *ClusterManager) checkSlots() (int32, string) {
     length := len(cm.LeaderNodes)
     if length == 0 {
-        atomic.StoreInt32(&cm.state, ERROR)
-        log.Printf("checkNode status: ERROR\n")
-        return false
+        return ERROR, "no leader node"
     }
     if cm.LeaderNodes[0].SlotBegin != 0 {
-        atomic.StoreInt32(&cm.state, NOT_READY)
-        log.Printf("checkNode status: NOT_READY, reason: SlotBegin is not 0\n")
-        return false
+        return NOT_READY, "SlotBegin is not 0"
     }
     if cm.LeaderNodes[length-1].SlotEnd != 16383 {
-        atomic.StoreInt32(&cm.state, NOT_READY)
-        log.Printf("checkNode status: NOT_READY, reason: SlotEnd is not 16383\n")
-        return false
+        return NOT_READY, "SlotEnd is not 16383"
     }
 
     for i := 0; i < length-1; i++ {
         if cm.LeaderNodes[i].SlotEnd+1 != cm.LeaderNodes[i+1].SlotBegin {
-            atomic.StoreInt32(&cm.state, NOT_READY)
-            log.Printf("checkNode status: NOT_READY, reason: cm.Nodes[i].SlotEnd is %d cm.Nodes[i+1].SlotBegin is %d\n",
+            return NOT_READY, fmt.Sprintf("slot gap between %d and %d",
                 cm.LeaderNodes[i].SlotEnd, cm.LeaderNodes[i+1].SlotBegin)
-            return false
         }
     }
-    atomic.StoreInt32(&cm.state, OK)
-    log.Printf("checkNode status: OK\n")
-    return true
+    return OK, ""
 }
 
 func (cm *ClusterManager) FindNode(key string, master bool) (string, int32) {
+    node, status := cm.FindNodeInfo(key, master)
+    return node.ApiAddr, status
+}
+
+// FindNodeInfo key所在的节点，master为true时只查找leader
+func (cm *ClusterManager) FindNodeInfo(key string, master bool) (NodeInfo, int32) {
     if !cm.Enable() {
-        return "", cm.state
+        return NodeInfo{}, cm.state
     }
 
     slot := CalcSlot(key)
@@ -188,15 +217,14 @@ func (cm *ClusterManager) FindNode(key string, master bool) (string, int32) {
     }
     for _, v := range list {
         if v.CheckSlot(slot) {
-            return v.ApiAddr, OK
+            return v, OK
         }
     }
-    return "", ERROR
+    return NodeInfo{}, ERROR
 }
 
 func CalcSlot(key string) uint32 {
-    sum := crc32.Checksum([]byte(key), CRC32Q)
-    return sum % 16384
+    return utils.CalcSlot(key)
 }
 
 func (n *NodeInfo)CheckSlot(slot uint32) bool {
@@ -207,15 +235,12 @@ func (n *NodeInfo)CheckSlot(slot uint32) bool {
     }
 }
 
-func marshalMeta(node NodeInfo) []byte {
-    b, err := json.Marshal(node)
-    log.Printf("%v\n", err)
-    return b
+func marshalMeta(node NodeInfo) ([]byte, error) {
+    return json.Marshal(node)
 }
 
-func unmarshalMeta(meta []byte) NodeInfo {
+func unmarshalMeta(meta []byte) (NodeInfo, error) {
     ret := NodeInfo{}
     err := json.Unmarshal(meta, &ret)
-    log.Printf("%v\n", err)
-    return ret
+    return ret, err
 }
@@ -0,0 +1,362 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package handler
+
+import (
+    "encoding/json"
+    "errors"
+    "github.com/hashicorp/go-hclog"
+    "github.com/xfali/gache/acl"
+    "github.com/xfali/gache/command"
+    "github.com/xfali/gache/config"
+    "github.com/xfali/gache/db"
+    "github.com/xfali/gache/internal/auth"
+    "github.com/xfali/gache/internal/cdc"
+    "github.com/xfali/gache/internal/cluster"
+    "github.com/xfali/gache/internal/cluster/gossip"
+    "github.com/xfali/gache/internal/faultnet"
+    "github.com/xfali/gache/internal/metrics"
+    "github.com/xfali/gache/internal/pubsub"
+    "github.com/xfali/gache/internal/watch"
+    "net"
+    "strconv"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+type Context struct {
+    conf       *config.Config
+    raft       cluster.Replication
+    db         *db.GacheDb
+    cluster    gossip.Cluster
+    clusterMgr ClusterManager
+    self       NodeInfo
+    reloader   *config.Reloader
+    faults     *faultnet.Network
+    watch      *watch.Hub
+    pubsub     *pubsub.Broker
+    cdc        *cdc.Log
+    logger     hclog.Logger
+    mu         sync.Mutex
+    // max-memory与eviction-policy，重新加载配置时修改
+    memLimit atomic.Value
+    metrics  *handlerMetrics
+}
+
+// 请求、命令相关的指标注册在reg中
+func NewContext(conf *config.Config, raft cluster.Replication, db *db.GacheDb, reg *metrics.Registry, logger hclog.Logger) *Context {
+    var dummyCluster gossip.DummyCluster = 1
+    ret := &Context{
+        conf:    conf,
+        raft:    raft,
+        db:      db,
+        cluster: &dummyCluster,
+        logger:  logger.Named("handler"),
+        metrics: newHandlerMetrics(reg),
+    }
+    ret.clusterMgr.logger = logger.Named("cluster")
+
+    if raft == nil {
+        ret.self.Master = true
+    } else {
+        raft.Listen(ret.Listen)
+    }
+
+    return ret
+}
+
+func (ctx *Context) Listen(v bool) {
+    ctx.logger.Info("leadership changed", "leader", v)
+    ctx.mu.Lock()
+    ctx.self.Master = v
+    ctx.mu.Unlock()
+
+    ctx.NotifySelf()
+    if v {
+        // 新leader登记自己的api地址，follower据此把请求指向leader
+        go func() {
+            err := ctx.registerPeer(ctx.conf.NodeID(), db.Peer{
+                RaftAddr: ctx.raft.LocalAddr(),
+                ApiAddr:  ctx.conf.AdvertiseAddr(),
+                RespAddr: ctx.conf.RespAdvertiseAddr(),
+            })
+            if err != nil {
+                ctx.logger.Warn("register leader failed", "error", err)
+            }
+        }()
+    }
+}
+
+func (ctx *Context) IsLeader() bool {
+    ctx.mu.Lock()
+    defer ctx.mu.Unlock()
+    return ctx.self.Master
+}
+
+func (ctx *Context) SetCluster(conf *config.Config, c gossip.Cluster) {
+    ctx.cluster = c
+    ctx.self.Addr = c.LocalAddr()
+    //ctx.self.Master = ctx.leader.IsSet()
+    host, _, _ := net.SplitHostPort(c.LocalAddr())
+    ctx.self.ApiAddr = net.JoinHostPort(host, strconv.Itoa(conf.ApiPort))
+    if conf.RespPort != 0 {
+        ctx.self.RespAddr = net.JoinHostPort(host, strconv.Itoa(conf.RespPort))
+    }
+
+    b, e, _ := cluster.GetSlots(conf.ClusterSlot)
+    ctx.self.SlotBegin = b
+    ctx.self.SlotEnd = e
+
+    ctx.NotifySelf()
+}
+
+func (ctx *Context) SetReloader(r *config.Reloader) {
+    ctx.reloader = r
+}
+
+func (ctx *Context) SetWatch(hub *watch.Hub) {
+    ctx.watch = hub
+}
+
+func (ctx *Context) SetPubSub(b *pubsub.Broker) {
+    ctx.pubsub = b
+}
+
+func (ctx *Context) SetCdc(l *cdc.Log) {
+    ctx.cdc = l
+}
+
+func (ctx *Context) SetFaults(faults *faultnet.Network) {
+    ctx.faults = faults
+}
+
+func (ctx *Context) Reload() (*config.ReloadResult, error) {
+    if ctx.reloader == nil {
+        return nil, errors.New("Reload is not supported ")
+    }
+    return ctx.reloader.Reload()
+}
+
+func (ctx *Context) NotifySelf() {
+    if ctx.cluster.Enabled() {
+        meta, err := marshalMeta(ctx.self)
+        if err != nil {
+            ctx.logger.Error("marshal node meta failed", "error", err)
+            return
+        }
+        if err := ctx.cluster.UpdateLocal(meta); err != nil {
+            ctx.logger.Warn("broadcast node meta failed", "error", err)
+        }
+        ctx.clusterMgr.Update(ctx.self)
+    }
+}
+
+func (ctx *Context) ProcessCmd(cmdReq *command.Request, direct bool) (ret interface{}, err error) {
+    start := time.Now()
+    defer func() {
+        result := "ok"
+        if err != nil {
+            result = "error"
+        }
+        ctx.metrics.cmdTotal.With(cmdReq.Cmd, result).Inc()
+        ctx.metrics.cmdDuration.With(cmdReq.Cmd).Observe(time.Since(start).Seconds())
+    }()
+
+    if !direct && ctx.rejectWrite(cmdReq.Cmd) {
+        return nil, ErrOutOfMemory
+    }
+    // 写命令记录修改时间，在leader上确定以保证各个副本相同
+    if cmdReq.Ts == 0 && command.IsWrite(cmdReq.Cmd) {
+        cmdReq.Ts = time.Now().UnixNano()
+    }
+    if ctx.raft == nil || direct {
+        ret, err = ctx.watch.Process(ctx.db, cmdReq)
+        if n := ctx.pubsub.Process(cmdReq); cmdReq.Cmd == command.PUBLISH && err == nil {
+            ret = n
+        }
+        return ret, err
+    } else {
+        b, err := cmdReq.Marshal()
+        if err != nil {
+            return nil, err
+        }
+        return ctx.raft.Apply(b, ctx.conf.RaftApplyTimeout)
+    }
+}
+
+// Offset CDC消费者提交的offset，未提交时为0
+func (ctx *Context) Offset(consumer string) uint64 {
+    offset, _ := ctx.db.GetOffset(consumer)
+    return offset
+}
+
+// CommitOffset 提交CDC消费者的offset，需要在leader上调用
+func (ctx *Context) CommitOffset(consumer string, offset uint64) error {
+    cmdReq := command.Request{
+        Cmd: command.CDC_COMMIT,
+        K:   consumer,
+        V:   strconv.FormatUint(offset, 10),
+    }
+    _, err := ctx.ProcessCmd(&cmdReq, false)
+    return err
+}
+
+// Barrier 确认本节点仍然是leader并且已经应用了之前提交的全部日志，之后读取本地数据是线性一致的
+func (ctx *Context) Barrier() error {
+    if ctx.raft == nil {
+        return nil
+    }
+    return ctx.raft.Barrier(ctx.conf.RaftApplyTimeout)
+}
+
+// 根据ACL判断principal是否可以执行命令，未认证的请求按acl.Anonymous判断
+func (ctx *Context) Authorized(p *auth.Principal, cmd, key string) bool {
+    return ctx.db.Acl.Allowed(principalName(p), cmd, key, command.IsWrite(cmd))
+}
+
+func (ctx *Context) IsAdmin(p *auth.Principal) bool {
+    return ctx.db.Acl.IsAdmin(principalName(p))
+}
+
+func principalName(p *auth.Principal) string {
+    if p == nil {
+        return acl.Anonymous
+    }
+    return p.Name
+}
+
+func (ctx *Context) ReplicaJoin(jr *cluster.JoinRequest) error {
+    if err := ctx.raft.Join(jr.ID, jr.Addr, jr.Replace); err != nil {
+        return err
+    }
+    ctx.logger.Info("raft node joined", "id", jr.ID, "addr", jr.Addr, "apiAddr", jr.ApiAddr)
+    return ctx.registerPeer(jr.ID, db.Peer{RaftAddr: jr.Addr, ApiAddr: jr.ApiAddr})
+}
+
+// leader的api地址，未知时为空
+func (ctx *Context) LeaderApiAddr() string {
+    if ctx.raft == nil {
+        return ""
+    }
+    leader := ctx.raft.Leader()
+    if leader == "" {
+        return ""
+    }
+    p, ok := ctx.db.PeerByRaftAddr(leader)
+    if !ok {
+        return ""
+    }
+    return p.ApiAddr
+}
+
+// leader的RESP地址，未知或leader未启用RESP时为空
+func (ctx *Context) LeaderRespAddr() string {
+    if ctx.raft == nil {
+        return ""
+    }
+    leader := ctx.raft.Leader()
+    if leader == "" {
+        return ""
+    }
+    p, ok := ctx.db.PeerByRaftAddr(leader)
+    if !ok {
+        return ""
+    }
+    return p.RespAddr
+}
+
+func (ctx *Context) registerPeer(id string, p db.Peer) error {
+    if old, ok := ctx.db.GetPeer(id); ok && old == p {
+        return nil
+    }
+    b, err := json.Marshal(p)
+    if err != nil {
+        return err
+    }
+    _, err = ctx.ProcessCmd(&command.Request{Cmd: command.PEER_SET, K: id, V: string(b)}, false)
+    return err
+}
+
+func (ctx *Context) LeaderNodes() ([]NodeInfo, error) {
+    return ctx.clusterMgr.Leaders()
+}
+
+func (ctx *Context) SelectClusterNode(key string, master bool) (string, error) {
+    addr, status := ctx.clusterMgr.FindNode(key, master)
+    if status == OK && addr != ctx.self.ApiAddr {
+        return addr, nil
+    }
+    if status == NOT_READY {
+        return "", errors.New("Cluster is not ready ")
+    }
+    return "", nil
+}
+
+// SelectRespNode 与SelectClusterNode相同，返回key所在节点的RESP地址
+func (ctx *Context) SelectRespNode(key string, master bool) (string, error) {
+    node, status := ctx.clusterMgr.FindNodeInfo(key, master)
+    if status == OK && node.ApiAddr != ctx.self.ApiAddr {
+        if node.RespAddr == "" {
+            return "", errors.New("RESP is not enabled on " + node.ApiAddr)
+        }
+        return node.RespAddr, nil
+    }
+    if status == NOT_READY {
+        return "", errors.New("Cluster is not ready ")
+    }
+    return "", nil
+}
+
+func (ctx *Context) CheckSelf(key string, leader bool) bool {
+    if !ctx.cluster.Enabled() {
+        return true
+    }
+
+    ctx.mu.Lock()
+    defer ctx.mu.Unlock()
+
+    if leader && !ctx.self.Master {
+        return false
+    }
+    slot := CalcSlot(key)
+    return ctx.self.CheckSlot(slot)
+}
+
+func (ctx *Context) NodeJoin(meta []byte) {
+    ctx.logger.Debug("node join", "meta", string(meta))
+    if node, ok := ctx.parseMeta(meta); ok {
+        ctx.clusterMgr.Join(node)
+    }
+}
+
+func (ctx *Context) NodeLeave(meta []byte) {
+    ctx.logger.Debug("node leave", "meta", string(meta))
+    if node, ok := ctx.parseMeta(meta); ok {
+        ctx.clusterMgr.Leave(node)
+    }
+}
+
+func (ctx *Context) NodeUpdate(meta []byte) {
+    ctx.logger.Debug("node update", "meta", string(meta))
+    if node, ok := ctx.parseMeta(meta); ok {
+        ctx.clusterMgr.Update(node)
+    }
+}
+
+func (ctx *Context) parseMeta(meta []byte) (NodeInfo, bool) {
+    // 节点刚启动时尚未设置meta
+    if len(meta) == 0 {
+        return NodeInfo{}, false
+    }
+    node, err := unmarshalMeta(meta)
+    if err != nil {
+        ctx.logger.Warn("invalid node meta", "meta", string(meta), "error", err)
+        return node, false
+    }
+    return node, true
+}
@@ -0,0 +1,154 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package handler
+
+import (
+    "context"
+    "errors"
+    "github.com/xfali/gache/command"
+    "time"
+)
+
+const (
+    // 超过max-memory时拒绝增加数据的写命令
+    NoEviction = "noeviction"
+    // 超过max-memory时随机删除key
+    AllKeysRandom = "allkeys-random"
+
+    // 每次检查最多删除的key数，避免长时间占用raft
+    evictBatch  = 1024
+    evictSample = 16
+)
+
+var ErrOutOfMemory = errors.New("memory usage exceeds max-memory")
+
+// 超过内存上限时仍然允许的写命令：删除数据、只修改已有的数据或者不保存数据。
+// 其他写命令（包括新增的命令）都会被拒绝
+var releaseCmds = map[string]bool{
+    command.DEL:     true,
+    command.LWW_DEL: true,
+    command.EVICT:   true,
+
+    command.PUBLISH: true,
+
+    command.UNLOCK:  true,
+    command.REFRESH: true,
+
+    command.SESSION_KEEPALIVE: true,
+    command.SESSION_CLOSE:     true,
+    command.SESSION_EXPIRE:    true,
+    command.EPHEMERAL_DEL:     true,
+
+    // 拒绝消费会导致队列无法减少
+    command.DEQUEUE:          true,
+    command.ACK:              true,
+    command.NACK:             true,
+    command.QUEUE_PURGE_DEAD: true,
+
+    command.RATELIMIT_RESET: true,
+}
+
+type memoryLimit struct {
+    max    int64
+    policy string
+}
+
+// SetMemoryLimit 设置内存上限（字节，0为不限制）以及超过时的处理方式，可以在运行时修改
+func (ctx *Context) SetMemoryLimit(max int64, policy string) {
+    ctx.memLimit.Store(memoryLimit{max: max, policy: policy})
+}
+
+func (ctx *Context) memoryLimit() memoryLimit {
+    l, _ := ctx.memLimit.Load().(memoryLimit)
+    return l
+}
+
+// 超过内存上限并且不淘汰时拒绝增加数据的命令
+func (ctx *Context) rejectWrite(cmd string) bool {
+    if !command.IsWrite(cmd) || releaseCmds[cmd] {
+        return false
+    }
+    l := ctx.memoryLimit()
+    return l.max > 0 && l.policy == NoEviction && ctx.db.MemSize() >= l.max
+}
+
+// Evictor 在leader上定期检查内存占用，超过max-memory时按eviction-policy通过raft删除key，
+// 各个副本删除相同的key
+type Evictor struct {
+    ctx      *Context
+    interval time.Duration
+
+    cancel context.CancelFunc
+    done   chan struct{}
+}
+
+func NewEvictor(ctx *Context, interval time.Duration) *Evictor {
+    return &Evictor{
+        ctx:      ctx,
+        interval: interval,
+        done:     make(chan struct{}),
+    }
+}
+
+func (e *Evictor) Start() {
+    c, cancel := context.WithCancel(context.Background())
+    e.cancel = cancel
+    go e.run(c)
+}
+
+func (e *Evictor) run(c context.Context) {
+    defer close(e.done)
+    ticker := time.NewTicker(e.interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ticker.C:
+            e.evict(c)
+        case <-c.Done():
+            return
+        }
+    }
+}
+
+func (e *Evictor) evict(c context.Context) {
+    l := e.ctx.memoryLimit()
+    if l.max <= 0 || l.policy != AllKeysRandom || !e.ctx.IsLeader() {
+        return
+    }
+    d := e.ctx.db
+    n := 0
+    for n < evictBatch && d.MemSize() > l.max && c.Err() == nil {
+        keys := d.SampleKeys(evictSample)
+        if len(keys) == 0 {
+            return
+        }
+        for _, k := range keys {
+            cmdReq := command.Request{Cmd: command.EVICT, K: k}
+            if _, err := e.ctx.ProcessCmd(&cmdReq, false); err != nil {
+                e.ctx.logger.Warn("evict key failed", "key", k, "error", err)
+                return
+            }
+            e.ctx.metrics.evicted.With(l.policy).Inc()
+            n++
+            if d.MemSize() <= l.max {
+                break
+            }
+        }
+    }
+    if n > 0 {
+        e.ctx.logger.Info("evicted keys", "policy", l.policy, "keys", n, "memory", d.MemSize(), "max-memory", l.max)
+    }
+}
+
+func (e *Evictor) Close() error {
+    if e.cancel == nil {
+        return nil
+    }
+    e.cancel()
+    <-e.done
+    return nil
+}
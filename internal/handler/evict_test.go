@@ -0,0 +1,78 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package handler
+
+import (
+    "github.com/hashicorp/go-hclog"
+    "github.com/xfali/gache/command"
+    "github.com/xfali/gache/config"
+    "github.com/xfali/gache/db"
+    "github.com/xfali/gache/internal/metrics"
+    "testing"
+)
+
+func TestRejectWrite(t *testing.T) {
+    for cmd := range releaseCmds {
+        if !command.IsWrite(cmd) {
+            t.Errorf("%s: not a write command", cmd)
+        }
+    }
+
+    d := db.New()
+    ctx := NewContext(config.Default(), nil, d, metrics.NewRegistry(), hclog.NewNullLogger())
+    d.Set("k", "v")
+    ctx.SetMemoryLimit(1, NoEviction)
+
+    cases := map[string]bool{
+        command.SET:            true,
+        command.CAS:            true,
+        command.LWW_SET:        true,
+        command.LOCK:           true,
+        command.SESSION_CREATE: true,
+        command.ENQUEUE:        true,
+        command.RATELIMIT:      true,
+
+        command.GET:               false,
+        command.DEL:               false,
+        command.LWW_DEL:           false,
+        command.PUBLISH:           false,
+        command.UNLOCK:            false,
+        command.SESSION_KEEPALIVE: false,
+        command.DEQUEUE:           false,
+        command.ACK:               false,
+        command.RATELIMIT_RESET:   false,
+    }
+    for cmd, reject := range cases {
+        if ctx.rejectWrite(cmd) != reject {
+            t.Errorf("%s: reject %v", cmd, !reject)
+        }
+    }
+
+    cmdReq := command.Request{Cmd: command.ENQUEUE, K: "q", V: "m"}
+    if _, err := ctx.ProcessCmd(&cmdReq, false); err != ErrOutOfMemory {
+        t.Fatalf("enqueue: %v", err)
+    }
+    cmdReq = command.Request{Cmd: command.DEL, K: "k"}
+    if _, err := ctx.ProcessCmd(&cmdReq, false); err != nil {
+        t.Fatalf("del: %v", err)
+    }
+    // 低于上限后不再拒绝
+    cmdReq = command.Request{Cmd: command.ENQUEUE, K: "q", V: "m"}
+    if _, err := ctx.ProcessCmd(&cmdReq, false); err != nil {
+        t.Fatalf("enqueue: %v", err)
+    }
+
+    d.Set("k", "v")
+    ctx.SetMemoryLimit(1, AllKeysRandom)
+    if ctx.rejectWrite(command.SET) {
+        t.Fatal("allkeys-random rejects SET")
+    }
+    ctx.SetMemoryLimit(0, NoEviction)
+    if ctx.rejectWrite(command.SET) {
+        t.Fatal("no limit rejects SET")
+    }
+}
@@ -0,0 +1,163 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package handler
+
+import (
+    "encoding/json"
+    "errors"
+    "github.com/xfali/gache/internal/faultnet"
+    "net/http"
+    "time"
+)
+
+var errInvalidFault = errors.New("drop and duplicate must be between 0 and 1, delay and jitter must not be negative")
+
+// 节点名称为raft-id或者raft、gossip地址，*表示任意节点
+type faultRule struct {
+    From      string  `json:"from"`
+    To        string  `json:"to"`
+    Partition bool    `json:"partition,omitempty"`
+    Drop      float64 `json:"drop,omitempty"`
+    Duplicate float64 `json:"duplicate,omitempty"`
+    Delay     string  `json:"delay,omitempty"`
+    Jitter    string  `json:"jitter,omitempty"`
+}
+
+type faultStatus struct {
+    Node  string         `json:"node"`
+    Rules []faultRule    `json:"rules"`
+    Stats faultnet.Stats `json:"stats"`
+}
+
+// Faults 在本节点的raft、gossip网络上注入故障（需要配置debug-faults）：
+//   GET    /admin/debug/faults                全部规则以及丢弃、延迟、重复的消息数
+//   PUT    /admin/debug/faults                设置规则，body为faultRule的JSON，from默认为本节点，to默认为*
+//   DELETE /admin/debug/faults?from=A&to=B    删除规则，不带参数时删除全部规则
+func (handler *Handler) Faults(resp http.ResponseWriter, req *http.Request) {
+    if !handler.requireAdmin(resp, req) {
+        return
+    }
+    faults := handler.ctx.faults
+    if faults == nil {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte("fault injection is not enabled"))
+        return
+    }
+    handler.registerFaultPeers()
+
+    local := handler.ctx.conf.NodeID()
+    if names := faults.Local(); local == "" && len(names) > 0 {
+        local = names[0]
+    }
+    switch req.Method {
+    case http.MethodGet:
+        ret := faultStatus{Node: local, Rules: []faultRule{}, Stats: faults.Stats()}
+        for _, r := range faults.Rules() {
+            ret.Rules = append(ret.Rules, toFaultRule(r))
+        }
+        writeJson(resp, ret)
+    case http.MethodPut, http.MethodPost:
+        value, err := getValue(req)
+        if err != nil {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte(err.Error()))
+            return
+        }
+        r := faultRule{}
+        if err := json.Unmarshal([]byte(value), &r); err != nil {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte(err.Error()))
+            return
+        }
+        if r.From == "" {
+            r.From = local
+        }
+        if r.To == "" {
+            r.To = faultnet.Any
+        }
+        rule, err := fromFaultRule(&r)
+        if err != nil {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte(err.Error()))
+            return
+        }
+        faults.Set(r.From, r.To, rule)
+        handler.ctx.logger.Warn("fault injected", "from", r.From, "to", r.To, "rule", value)
+    case http.MethodDelete:
+        from, to := req.URL.Query().Get("from"), req.URL.Query().Get("to")
+        if from == "" && to == "" {
+            faults.Heal()
+            handler.ctx.logger.Info("faults cleared")
+            return
+        }
+        if from == "" {
+            from = local
+        }
+        if to == "" {
+            to = faultnet.Any
+        }
+        faults.Clear(from, to)
+        handler.ctx.logger.Info("fault cleared", "from", from, "to", to)
+    default:
+        resp.WriteHeader(http.StatusMethodNotAllowed)
+        resp.Write([]byte("method not support"))
+    }
+}
+
+// raft成员可以使用raft-id作为名称
+func (handler *Handler) registerFaultPeers() {
+    if handler.ctx.raft == nil {
+        return
+    }
+    peers, err := handler.ctx.raft.Peers()
+    if err != nil {
+        return
+    }
+    for _, p := range peers {
+        handler.ctx.faults.Register(p.ID, p.Addr)
+    }
+}
+
+func fromFaultRule(r *faultRule) (faultnet.Rule, error) {
+    ret := faultnet.Rule{
+        Partition: r.Partition,
+        Drop:      r.Drop,
+        Duplicate: r.Duplicate,
+    }
+    var err error
+    if r.Delay != "" {
+        if ret.Delay, err = time.ParseDuration(r.Delay); err != nil {
+            return ret, err
+        }
+    }
+    if r.Jitter != "" {
+        if ret.Jitter, err = time.ParseDuration(r.Jitter); err != nil {
+            return ret, err
+        }
+    }
+    if ret.Drop < 0 || ret.Drop > 1 || ret.Duplicate < 0 || ret.Duplicate > 1 || ret.Delay < 0 || ret.Jitter < 0 {
+        return ret, errInvalidFault
+    }
+    return ret, nil
+}
+
+func toFaultRule(r faultnet.LinkRule) faultRule {
+    ret := faultRule{
+        From:      r.From,
+        To:        r.To,
+        Partition: r.Partition,
+        Drop:      r.Drop,
+        Duplicate: r.Duplicate,
+    }
+    if r.Delay > 0 {
+        ret.Delay = r.Delay.String()
+    }
+    if r.Jitter > 0 {
+        ret.Jitter = r.Jitter.String()
+    }
+    return ret
+}
@@ -0,0 +1,404 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package handler
+
+import (
+    "encoding/json"
+    "github.com/hashicorp/raft"
+    "github.com/xfali/gache/command"
+    "github.com/xfali/gache/internal/cluster"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const (
+    // 带有该header的写请求为CAS：当前值（不存在时为空）等于header的值时才写入，否则返回412
+    HeaderCas = "X-Gache-Cas"
+    // 带有该header（UnixNano）的写请求按last-writer-wins处理：key的修改时间早于header时才写入或删除，否则返回412
+    HeaderTimestamp = "X-Gache-Timestamp"
+    // 带有该header（会话id）的SET写入绑定到会话的临时key，会话过期或关闭后删除
+    HeaderSession = "X-Gache-Session"
+    // 值为linearizable时在leader上读取，保证读到最新提交的数据
+    HeaderConsistency = "X-Gache-Consistency"
+    Linearizable      = "linearizable"
+)
+
+type Handler struct {
+    methodMap map[string]http.HandlerFunc
+    ctx       *Context
+}
+
+func New(ctx *Context) *Handler {
+    ret := &Handler{
+        methodMap: map[string]http.HandlerFunc{},
+        ctx:       ctx,
+    }
+    ret.methodMap[http.MethodPost] = ret.create
+    ret.methodMap[http.MethodPut] = ret.create
+    ret.methodMap[http.MethodDelete] = ret.delete
+    ret.methodMap[ http.MethodGet] = ret.get
+    return ret
+}
+
+func (ctx *Handler) Handle(resp http.ResponseWriter, req *http.Request) {
+    start := time.Now()
+    sw := &statusWriter{ResponseWriter: resp, code: http.StatusOK}
+    resp = sw
+    defer func() {
+        ctx.ctx.metrics.httpRequests.With(req.Method, strconv.Itoa(sw.code)).Inc()
+        ctx.ctx.metrics.httpDuration.With(req.Method).Observe(time.Since(start).Seconds())
+    }()
+
+    handleFunc := ctx.methodMap[req.Method]
+    if handleFunc != nil {
+        handleFunc(resp, req)
+    } else {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte("method not support"))
+    }
+}
+
+func (handler *Handler) create(resp http.ResponseWriter, req *http.Request) {
+    key, err := getKey(req)
+    if err != nil {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte(err.Error()))
+        return
+    }
+    if !handler.ctx.CheckSelf(key, true) {
+        addr, err := handler.ctx.SelectClusterNode(key, true)
+        if err != nil {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte(err.Error()))
+            return
+        }
+        if addr != "" {
+            handler.redirect(addr, resp, req)
+            return
+        }
+    }
+
+    if !handler.leader(resp, req) {
+        return
+    }
+    value, err := getValue(req)
+    if err != nil {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte(err.Error()))
+        return
+    }
+
+    cmdReq := command.Request{
+        Cmd: command.SET,
+        K:   key,
+        V:   value,
+    }
+    if old, ok := req.Header[HeaderCas]; ok {
+        cmdReq.Cmd = command.CAS
+        if len(old) > 0 {
+            cmdReq.Old = old[0]
+        }
+    } else if !lwwRequest(resp, req, &cmdReq, command.LWW_SET) {
+        return
+    }
+    if session := req.Header.Get(HeaderSession); session != "" {
+        if cmdReq.Cmd != command.SET {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte(HeaderSession + " can only be used with plain SET"))
+            return
+        }
+        cmdReq.Session = session
+    }
+
+    if !handler.authorize(resp, req, &cmdReq) {
+        return
+    }
+    ret, procErr := handler.ctx.ProcessCmd(&cmdReq, false)
+    if procErr != nil {
+        writeCmdError(resp, procErr)
+        return
+    }
+    if applied, ok := ret.(bool); ok && !applied {
+        resp.WriteHeader(http.StatusPreconditionFailed)
+        if cmdReq.Cmd == command.CAS {
+            resp.Write([]byte("value mismatch"))
+        } else {
+            resp.Write([]byte("newer value exists"))
+        }
+    }
+}
+
+func (handler *Handler) delete(resp http.ResponseWriter, req *http.Request) {
+    key, err := getKey(req)
+    if err != nil {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte(err.Error()))
+        return
+    }
+    if !handler.ctx.CheckSelf(key, true) {
+        addr, err := handler.ctx.SelectClusterNode(key, true)
+        if err != nil {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte(err.Error()))
+            return
+        }
+        if addr != "" {
+            handler.redirect(addr, resp, req)
+            return
+        }
+    }
+
+    if !handler.leader(resp, req) {
+        return
+    }
+
+    cmdReq := command.Request{
+        Cmd: command.DEL,
+        K:   key,
+    }
+    if !lwwRequest(resp, req, &cmdReq, command.LWW_DEL) {
+        return
+    }
+
+    if !handler.authorize(resp, req, &cmdReq) {
+        return
+    }
+    ret, procErr := handler.ctx.ProcessCmd(&cmdReq, false)
+    if procErr != nil {
+        writeCmdError(resp, procErr)
+        return
+    }
+    if deleted, ok := ret.(bool); ok && !deleted {
+        resp.WriteHeader(http.StatusPreconditionFailed)
+        resp.Write([]byte("newer value exists"))
+    }
+}
+
+// 请求带有HeaderTimestamp时改为cmd，header无效时返回400
+func lwwRequest(resp http.ResponseWriter, req *http.Request, cmdReq *command.Request, cmd string) bool {
+    v := req.Header.Get(HeaderTimestamp)
+    if v == "" {
+        return true
+    }
+    ts, err := strconv.ParseInt(v, 10, 64)
+    if err != nil || ts <= 0 {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte("invalid timestamp: " + v))
+        return false
+    }
+    cmdReq.Cmd, cmdReq.Ts = cmd, ts
+    return true
+}
+
+func (handler *Handler) get(resp http.ResponseWriter, req *http.Request) {
+    key, err := getKey(req)
+    if err != nil {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte(err.Error()))
+        return
+    }
+    if !handler.ctx.CheckSelf(key, false) {
+        addr, err := handler.ctx.SelectClusterNode(key, false)
+        if err != nil {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte(err.Error()))
+            return
+        }
+        if addr != "" {
+            handler.redirect(addr, resp, req)
+            return
+        }
+    }
+
+    linearizable := req.Header.Get(HeaderConsistency) == Linearizable
+    if linearizable && !handler.leader(resp, req) {
+        return
+    }
+
+    cmdReq := command.Request{
+        Cmd: command.GET,
+        K:   key,
+    }
+    if !handler.authorize(resp, req, &cmdReq) {
+        return
+    }
+    if linearizable {
+        if err := handler.ctx.Barrier(); err != nil {
+            writeCmdError(resp, err)
+            return
+        }
+    }
+    v, procErr := handler.ctx.ProcessCmd(&cmdReq, true)
+    if procErr != nil {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte(procErr.Error()))
+        return
+    }
+    io.WriteString(resp, v.(string))
+}
+
+// 解码后的key，与客户端计算slot使用的key相同；不包含query
+func getKey(req *http.Request) (string, error) {
+    return url.PathUnescape(strings.TrimPrefix(req.URL.EscapedPath(), "/key/"))
+}
+
+func getValue(req *http.Request) (string, error) {
+    b, err := ioutil.ReadAll(req.Body)
+    if err != nil {
+        return "", err
+    }
+    return string(b), nil
+}
+
+// Join 处理新节点加入raft集群的请求，body为cluster.JoinRequest的JSON。
+// 设置了raft-join-secret时校验签名，否则要求管理员权限；本节点不是leader时307跳转到leader
+func (handler *Handler) Join(resp http.ResponseWriter, req *http.Request) {
+    if req.Method != http.MethodPost {
+        resp.WriteHeader(http.StatusMethodNotAllowed)
+        resp.Write([]byte("method not support"))
+        return
+    }
+    if handler.ctx.raft == nil {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte("raft is not enabled"))
+        return
+    }
+
+    jr := cluster.JoinRequest{}
+    if err := json.NewDecoder(req.Body).Decode(&jr); err != nil {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte(err.Error()))
+        return
+    }
+    if jr.ID == "" || jr.Addr == "" {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte("id and addr are required"))
+        return
+    }
+    if secret := handler.ctx.conf.RaftJoinSecret; secret != "" {
+        if err := jr.Verify(secret); err != nil {
+            handler.ctx.logger.Warn("reject join request", "id", jr.ID, "addr", jr.Addr, "error", err)
+            resp.WriteHeader(http.StatusForbidden)
+            resp.Write([]byte(err.Error()))
+            return
+        }
+    } else if !handler.requireAdmin(resp, req) {
+        return
+    }
+
+    if !handler.ctx.IsLeader() {
+        leader := handler.ctx.LeaderApiAddr()
+        if leader == "" {
+            resp.WriteHeader(http.StatusServiceUnavailable)
+            resp.Write([]byte("leader unknown"))
+            return
+        }
+        handler.redirect(leader, resp, req)
+        return
+    }
+
+    if err := handler.ctx.ReplicaJoin(&jr); err != nil {
+        status := http.StatusServiceUnavailable
+        if err == cluster.ErrJoinConflict {
+            status = http.StatusConflict
+        }
+        resp.WriteHeader(status)
+        resp.Write([]byte("join raft cluster failed: " + err.Error()))
+    }
+}
+
+func (handler *Handler) Cluster(resp http.ResponseWriter, req *http.Request) {
+    ret, err := handler.ctx.LeaderNodes()
+    if err != nil {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte(err.Error()))
+        return
+    }
+
+    b, err := json.Marshal(ret)
+    if err != nil {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte(err.Error()))
+        return
+    }
+
+    resp.Write(b)
+}
+
+func (handler *Handler) redirect(addr string, resp http.ResponseWriter, req *http.Request) {
+    handler.ctx.metrics.redirects.With(req.Method).Inc()
+    //注意此处不使用StatusFound，由于302会出于安全考虑将POST重定向时修改为GET。使用307保持Method
+    scheme := "http://"
+    if req.TLS != nil {
+        scheme = "https://"
+    }
+    http.Redirect(resp, req, scheme+addr+req.RequestURI, http.StatusTemporaryRedirect)
+}
+
+// 本节点不是leader时跳转到leader，leader未知（如正在选举）时返回503
+func (handler *Handler) leader(resp http.ResponseWriter, req *http.Request) bool {
+    if handler.ctx.IsLeader() {
+        return true
+    }
+    if addr := handler.ctx.LeaderApiAddr(); addr != "" {
+        handler.redirect(addr, resp, req)
+        return false
+    }
+    resp.WriteHeader(http.StatusServiceUnavailable)
+    resp.Write([]byte("Not leader"))
+    return false
+}
+
+// leader切换过程中的错误：命令未提交到raft时返回503，客户端可以重试；
+// 已经提交但失去leader时结果未知，返回504
+func writeCmdError(resp http.ResponseWriter, err error) {
+    switch err {
+    case raft.ErrNotLeader, raft.ErrLeadershipTransferInProgress, raft.ErrEnqueueTimeout:
+        resp.WriteHeader(http.StatusServiceUnavailable)
+    case raft.ErrLeadershipLost, raft.ErrRaftShutdown, cluster.ErrApplyTimeout:
+        resp.WriteHeader(http.StatusGatewayTimeout)
+    case cluster.ErrBadBatch:
+        resp.WriteHeader(http.StatusInternalServerError)
+    case ErrOutOfMemory:
+        resp.WriteHeader(http.StatusInsufficientStorage)
+    default:
+        resp.WriteHeader(http.StatusBadRequest)
+    }
+    resp.Write([]byte(err.Error()))
+}
+
+func (handler *Handler) Reload(resp http.ResponseWriter, req *http.Request) {
+    if !handler.requireAdmin(resp, req) {
+        return
+    }
+    if req.Method != http.MethodPost {
+        resp.WriteHeader(http.StatusMethodNotAllowed)
+        resp.Write([]byte("method not support"))
+        return
+    }
+
+    ret, err := handler.ctx.Reload()
+    if err != nil {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte(err.Error()))
+        return
+    }
+
+    b, err := json.Marshal(ret)
+    if err != nil {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte(err.Error()))
+        return
+    }
+
+    resp.Write(b)
+}
@@ -0,0 +1,99 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package handler
+
+import (
+    "encoding/json"
+    "fmt"
+    "github.com/xfali/gache/internal/cluster"
+    "net/http"
+)
+
+// FSM落后commit index不超过该值时认为已追上
+const maxApplyLag = 128
+
+var clusterStates = map[int32]string{
+    OK:        "OK",
+    ERROR:     "ERROR",
+    NOT_READY: "NOT_READY",
+    MOVE:      "MOVE",
+}
+
+type Status struct {
+    Self           NodeInfo            `json:"self"`
+    Slots          string              `json:"slots,omitempty"`
+    Leader         bool                `json:"leader"`
+    Raft           *cluster.RaftStatus `json:"raft,omitempty"`
+    ClusterEnabled bool                `json:"clusterEnabled"`
+    ClusterState   string              `json:"clusterState,omitempty"`
+    Nodes          []NodeInfo          `json:"nodes"`
+    Keys           int                 `json:"keys"`
+}
+
+func (ctx *Context) Status() *Status {
+    ctx.mu.Lock()
+    ret := &Status{
+        Self:   ctx.self,
+        Leader: ctx.self.Master,
+    }
+    ctx.mu.Unlock()
+
+    if ctx.raft != nil {
+        s := ctx.raft.Status()
+        ret.Raft = &s
+    }
+    ret.ClusterEnabled = ctx.cluster.Enabled()
+    if ret.ClusterEnabled {
+        ret.Slots = fmt.Sprintf("%d-%d", ret.Self.SlotBegin, ret.Self.SlotEnd)
+        ret.ClusterState = clusterStates[ctx.clusterMgr.State()]
+    }
+    ret.Nodes = ctx.clusterMgr.AllNodes()
+    ret.Keys = ctx.db.Len()
+    return ret
+}
+
+// 返回nil表示可以对外提供服务，否则返回未就绪的原因
+func (ctx *Context) Ready() error {
+    if ctx.raft != nil {
+        s := ctx.raft.Status()
+        if s.Leader == "" {
+            return fmt.Errorf("raft has no leader, state: %s", s.State)
+        }
+        if s.CommitIndex > s.AppliedIndex+maxApplyLag {
+            return fmt.Errorf("fsm is catching up, applied: %d commit: %d", s.AppliedIndex, s.CommitIndex)
+        }
+    }
+    if ctx.cluster.Enabled() && !ctx.clusterMgr.Enable() {
+        return fmt.Errorf("cluster state: %s", clusterStates[ctx.clusterMgr.State()])
+    }
+    return nil
+}
+
+func (handler *Handler) Healthz(resp http.ResponseWriter, req *http.Request) {
+    resp.Write([]byte("ok"))
+}
+
+func (handler *Handler) Readyz(resp http.ResponseWriter, req *http.Request) {
+    if err := handler.ctx.Ready(); err != nil {
+        resp.WriteHeader(http.StatusServiceUnavailable)
+        resp.Write([]byte(err.Error()))
+        return
+    }
+    resp.Write([]byte("ok"))
+}
+
+func (handler *Handler) Status(resp http.ResponseWriter, req *http.Request) {
+    b, err := json.Marshal(handler.ctx.Status())
+    if err != nil {
+        resp.WriteHeader(http.StatusInternalServerError)
+        resp.Write([]byte(err.Error()))
+        return
+    }
+
+    resp.Header().Set("Content-Type", "application/json")
+    resp.Write(b)
+}
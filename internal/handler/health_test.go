@@ -0,0 +1,87 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package handler
+
+import (
+    "github.com/hashicorp/go-hclog"
+    "github.com/xfali/gache/config"
+    "github.com/xfali/gache/db"
+    "github.com/xfali/gache/internal/cluster"
+    "github.com/xfali/gache/internal/cluster/gossip"
+    "github.com/xfali/gache/internal/metrics"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync/atomic"
+    "testing"
+)
+
+// 只返回固定状态的raft
+type fakeReplication struct {
+    cluster.Replication
+    status cluster.RaftStatus
+}
+
+func (r *fakeReplication) Listen(listener func(bool)) {}
+
+func (r *fakeReplication) Status() cluster.RaftStatus {
+    return r.status
+}
+
+type fakeCluster struct {
+    gossip.Cluster
+}
+
+func (c *fakeCluster) Enabled() bool {
+    return true
+}
+
+func TestHealth(t *testing.T) {
+    cases := []struct {
+        name    string
+        raft    *cluster.RaftStatus
+        cluster bool
+        state   int32
+        code    int
+        body    string
+    }{
+        {"standalone", nil, false, OK, http.StatusOK, "ok"},
+        {"leader", &cluster.RaftStatus{State: "Leader", Leader: "n1", CommitIndex: 10, AppliedIndex: 10}, false, OK, http.StatusOK, "ok"},
+        {"follower within lag", &cluster.RaftStatus{State: "Follower", Leader: "n1", CommitIndex: 100 + maxApplyLag, AppliedIndex: 100}, false, OK, http.StatusOK, "ok"},
+        {"no leader", &cluster.RaftStatus{State: "Candidate"}, false, OK, http.StatusServiceUnavailable, "raft has no leader, state: Candidate"},
+        {"catching up", &cluster.RaftStatus{State: "Follower", Leader: "n1", CommitIndex: 101 + maxApplyLag, AppliedIndex: 100}, false, OK,
+            http.StatusServiceUnavailable, "fsm is catching up"},
+        {"cluster ok", nil, true, OK, http.StatusOK, "ok"},
+        {"cluster not ready", nil, true, NOT_READY, http.StatusServiceUnavailable, "cluster state: NOT_READY"},
+        {"cluster error", &cluster.RaftStatus{State: "Leader", Leader: "n1"}, true, ERROR, http.StatusServiceUnavailable, "cluster state: ERROR"},
+    }
+    for _, c := range cases {
+        var raft cluster.Replication
+        if c.raft != nil {
+            raft = &fakeReplication{status: *c.raft}
+        }
+        ctx := NewContext(config.Default(), raft, db.New(), metrics.NewRegistry(), hclog.NewNullLogger())
+        if c.cluster {
+            ctx.cluster = &fakeCluster{}
+        }
+        atomic.StoreInt32(&ctx.clusterMgr.state, c.state)
+        h := New(ctx)
+
+        // 存活检查不依赖节点状态
+        rec := httptest.NewRecorder()
+        h.Healthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+        if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+            t.Errorf("%s healthz: %d %s", c.name, rec.Code, rec.Body.String())
+        }
+
+        rec = httptest.NewRecorder()
+        h.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+        if rec.Code != c.code || !strings.HasPrefix(rec.Body.String(), c.body) {
+            t.Errorf("%s readyz: %d %s, want %d %s", c.name, rec.Code, rec.Body.String(), c.code, c.body)
+        }
+    }
+}
@@ -0,0 +1,216 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package handler
+
+import (
+    "encoding/json"
+    "github.com/xfali/gache/command"
+    "github.com/xfali/gache/db"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const (
+    maxLockWait = time.Minute
+    // 等待锁释放时检查本地状态的间隔
+    lockPoll = 50 * time.Millisecond
+)
+
+// 锁的JSON格式
+type LockInfo struct {
+    Name   string    `json:"name"`
+    Owner  string    `json:"owner"`
+    Token  uint64    `json:"token"`
+    Expire time.Time `json:"expire"`
+}
+
+func newLockInfo(name string, l db.Lock) *LockInfo {
+    return &LockInfo{
+        Name:   name,
+        Owner:  l.Owner,
+        Token:  l.Token,
+        Expire: time.Unix(0, l.Expire).UTC(),
+    }
+}
+
+// Lock 分布式锁，锁名与key相同按slot分布在分片上：
+//   POST   /lock/NAME?owner=O&ttl=10s[&wait=5s]   加锁，其他持有者持有时最多等待wait，超时返回409及当前持有的锁
+//   PUT    /lock/NAME?owner=O&token=T&ttl=10s     延长有效期
+//   DELETE /lock/NAME?owner=O&token=T             释放
+//   GET    /lock/NAME                             当前持有的锁，空闲时返回404
+// 成功时返回LockInfo，token单调递增（通常为加锁时的raft日志index）；锁已经过期或者不是持有者时返回409
+func (handler *Handler) Lock(resp http.ResponseWriter, req *http.Request) {
+    name := strings.TrimPrefix(req.URL.Path, "/lock/")
+    if name == "" || name == req.URL.Path {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte("lock name is required"))
+        return
+    }
+    write := req.Method != http.MethodGet
+    if !handler.ctx.CheckSelf(name, write) {
+        addr, err := handler.ctx.SelectClusterNode(name, write)
+        if err != nil {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte(err.Error()))
+            return
+        }
+        if addr != "" {
+            handler.redirect(addr, resp, req)
+            return
+        }
+    }
+
+    switch req.Method {
+    case http.MethodGet:
+        cmdReq := command.Request{Cmd: command.GET, K: name}
+        if !handler.authorize(resp, req, &cmdReq) {
+            return
+        }
+        l, ok := handler.ctx.db.Locks.Get(name, time.Now().UnixNano())
+        if !ok {
+            resp.WriteHeader(http.StatusNotFound)
+            resp.Write([]byte("lock not held"))
+            return
+        }
+        writeLock(resp, http.StatusOK, name, l)
+    case http.MethodPost, http.MethodPut, http.MethodDelete:
+        if !handler.leader(resp, req) {
+            return
+        }
+        cmdReq, wait, ok := parseLockRequest(resp, req, name)
+        if !ok || !handler.authorize(resp, req, cmdReq) {
+            return
+        }
+        if cmdReq.Cmd == command.UNLOCK {
+            ret, procErr := handler.ctx.ProcessCmd(cmdReq, false)
+            if procErr != nil {
+                writeCmdError(resp, procErr)
+                return
+            }
+            if released, _ := ret.(bool); !released {
+                resp.WriteHeader(http.StatusConflict)
+                resp.Write([]byte("lock not held"))
+            }
+            return
+        }
+        handler.acquire(resp, req, cmdReq, wait)
+    default:
+        resp.WriteHeader(http.StatusMethodNotAllowed)
+        resp.Write([]byte("method not support"))
+    }
+}
+
+func parseLockRequest(resp http.ResponseWriter, req *http.Request, name string) (*command.Request, time.Duration, bool) {
+    query := req.URL.Query()
+    cmdReq := &command.Request{K: name, V: query.Get("owner")}
+    if cmdReq.V == "" {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte("owner is required"))
+        return nil, 0, false
+    }
+    switch req.Method {
+    case http.MethodPost:
+        cmdReq.Cmd = command.LOCK
+    case http.MethodPut:
+        cmdReq.Cmd = command.REFRESH
+    default:
+        cmdReq.Cmd = command.UNLOCK
+    }
+    if cmdReq.Cmd != command.LOCK {
+        token, err := strconv.ParseUint(query.Get("token"), 10, 64)
+        if err != nil {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte("invalid token: " + query.Get("token")))
+            return nil, 0, false
+        }
+        cmdReq.Token = token
+    }
+    if cmdReq.Cmd != command.UNLOCK {
+        ttl, err := time.ParseDuration(query.Get("ttl"))
+        if err != nil || ttl <= 0 {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte("invalid ttl: " + query.Get("ttl")))
+            return nil, 0, false
+        }
+        cmdReq.Ttl = ttl
+    }
+    var wait time.Duration
+    if v := query.Get("wait"); v != "" && cmdReq.Cmd == command.LOCK {
+        d, err := time.ParseDuration(v)
+        if err != nil || d < 0 {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte("invalid wait: " + v))
+            return nil, 0, false
+        }
+        if d > maxLockWait {
+            d = maxLockWait
+        }
+        wait = d
+    }
+    return cmdReq, wait, true
+}
+
+// 执行LOCK或REFRESH，LOCK失败时等待锁释放或者过期后重试，直到超过wait
+func (handler *Handler) acquire(resp http.ResponseWriter, req *http.Request, cmdReq *command.Request, wait time.Duration) {
+    deadline := time.Now().Add(wait)
+    if wait > 0 {
+        // 等待时间可能超过http-write-timeout
+        handler.clearWriteDeadline(resp)
+    }
+    for {
+        // 每次提交使用新的时间
+        cmdReq.Ts = 0
+        ret, procErr := handler.ctx.ProcessCmd(cmdReq, false)
+        if procErr != nil {
+            writeCmdError(resp, procErr)
+            return
+        }
+        result := ret.(*command.LockResult)
+        if result.Ok {
+            writeLock(resp, http.StatusOK, cmdReq.K, result.Lock)
+            return
+        }
+        if cmdReq.Cmd != command.LOCK {
+            resp.WriteHeader(http.StatusConflict)
+            resp.Write([]byte("lock not held"))
+            return
+        }
+        if !handler.waitLock(req, cmdReq.K, deadline) {
+            writeLock(resp, http.StatusConflict, cmdReq.K, result.Lock)
+            return
+        }
+    }
+}
+
+// 等待本地的锁释放或者过期，超过deadline或者请求取消时返回false
+func (handler *Handler) waitLock(req *http.Request, name string, deadline time.Time) bool {
+    ticker := time.NewTicker(lockPoll)
+    defer ticker.Stop()
+    for {
+        now := time.Now()
+        if !now.Before(deadline) {
+            return false
+        }
+        if _, held := handler.ctx.db.Locks.Get(name, now.UnixNano()); !held {
+            return true
+        }
+        select {
+        case <-ticker.C:
+        case <-req.Context().Done():
+            return false
+        }
+    }
+}
+
+func writeLock(resp http.ResponseWriter, code int, name string, l db.Lock) {
+    b, _ := json.Marshal(newLockInfo(name, l))
+    resp.Header().Set("Content-Type", "application/json")
+    resp.WriteHeader(code)
+    resp.Write(b)
+}
@@ -0,0 +1,115 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package handler
+
+import (
+    "github.com/xfali/gache/internal/metrics"
+    "net/http"
+    "strconv"
+)
+
+// 请求、命令相关的计数器与直方图，每个节点使用自己的Registry
+type handlerMetrics struct {
+    httpRequests *metrics.CounterVec
+    httpDuration *metrics.HistogramVec
+    cmdTotal     *metrics.CounterVec
+    cmdDuration  *metrics.HistogramVec
+    redirects    *metrics.CounterVec
+    evicted      *metrics.CounterVec
+}
+
+func newHandlerMetrics(reg *metrics.Registry) *handlerMetrics {
+    return &handlerMetrics{
+        httpRequests: reg.NewCounterVec("gache_http_requests_total",
+            "Number of data API requests by HTTP method and status code.", "method", "code"),
+        httpDuration: reg.NewHistogramVec("gache_http_request_duration_seconds",
+            "Data API request latency by HTTP method.", metrics.DefBuckets, "method"),
+        cmdTotal: reg.NewCounterVec("gache_command_total",
+            "Number of processed commands by command and result.", "cmd", "result"),
+        cmdDuration: reg.NewHistogramVec("gache_command_duration_seconds",
+            "Command latency, including raft replication for writes.", metrics.DefBuckets, "cmd"),
+        redirects: reg.NewCounterVec("gache_redirects_total",
+            "Number of requests redirected to the node owning the key slot.", "method"),
+        evicted: reg.NewCounterVec("gache_evicted_keys_total",
+            "Number of keys deleted because memory usage exceeded max-memory.", "policy"),
+    }
+}
+
+var raftStates = map[string]float64{
+    "Follower":  0,
+    "Candidate": 1,
+    "Leader":    2,
+    "Shutdown":  3,
+}
+
+// 注册节点状态相关的指标，指标值在采集时读取
+func (ctx *Context) RegisterMetrics(reg *metrics.Registry) {
+    reg.NewGaugeFunc("gache_db_keys", "Number of keys in the local database.", func() float64 {
+        return float64(ctx.db.Len())
+    })
+    reg.NewGaugeFunc("gache_db_memory_bytes", "Estimated memory used by keys and values.", func() float64 {
+        return float64(ctx.db.MemSize())
+    })
+
+    if ctx.watch != nil {
+        reg.NewGaugeFunc("gache_watchers", "Number of active watch subscriptions.", func() float64 {
+            return float64(ctx.watch.Watchers())
+        })
+    }
+    if ctx.pubsub != nil {
+        reg.NewGaugeFunc("gache_pubsub_subscribers", "Number of active pub/sub subscribers.", func() float64 {
+            return float64(ctx.pubsub.Subscribers())
+        })
+    }
+
+    if ctx.raft != nil {
+        stat := func(key string) func() float64 {
+            return func() float64 {
+                v, _ := strconv.ParseFloat(ctx.raft.Stats()[key], 64)
+                return v
+            }
+        }
+        reg.NewGaugeFunc("gache_raft_state", "Raft state: 0 follower, 1 candidate, 2 leader, 3 shutdown.", func() float64 {
+            return raftStates[ctx.raft.Stats()["state"]]
+        })
+        reg.NewGaugeFunc("gache_raft_term", "Current raft term.", stat("term"))
+        reg.NewGaugeFunc("gache_raft_commit_index", "Raft commit index.", stat("commit_index"))
+        reg.NewGaugeFunc("gache_raft_applied_index", "Last raft index applied to the FSM.", stat("applied_index"))
+        reg.NewGaugeFunc("gache_raft_last_log_index", "Last raft log index.", stat("last_log_index"))
+        reg.NewGaugeFunc("gache_raft_peers", "Number of raft peers.", stat("num_peers"))
+    }
+
+    reg.NewGaugeFunc("gache_cluster_state", "Cluster state: 0 ok, 1 error, 2 not ready.", func() float64 {
+        return float64(ctx.clusterMgr.State())
+    })
+    reg.NewGaugeFunc("gache_cluster_nodes", "Number of known cluster nodes.", func() float64 {
+        n, _ := ctx.clusterMgr.NumNodes()
+        return float64(n)
+    })
+    reg.NewGaugeFunc("gache_cluster_leader_nodes", "Number of known cluster leader nodes.", func() float64 {
+        _, n := ctx.clusterMgr.NumNodes()
+        return float64(n)
+    })
+    reg.NewGaugeFunc("gache_gossip_members", "Number of alive gossip members.", func() float64 {
+        return float64(ctx.cluster.NumMembers())
+    })
+}
+
+type statusWriter struct {
+    http.ResponseWriter
+    code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+    w.code = code
+    w.ResponseWriter.WriteHeader(code)
+}
+
+// 用于http.ResponseController
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+    return w.ResponseWriter
+}
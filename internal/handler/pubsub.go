@@ -0,0 +1,170 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package handler
+
+import (
+    "encoding/json"
+    "fmt"
+    "github.com/xfali/gache/command"
+    "github.com/xfali/gache/internal/auth"
+    "github.com/xfali/gache/internal/pubsub"
+    "net/http"
+    "strings"
+    "time"
+)
+
+// PubSub 频道消息的发布与订阅：
+//   POST /pubsub/CHANNEL                            发布消息，body为消息
+//   GET  /pubsub?channel=A&channel=B&pattern=P      订阅频道以及匹配glob模式的频道，使用Server-Sent Events
+// 与key相同，频道按slot分布在分片上：发布跳转到所在分片的leader，订阅可以连接所在分片的任意节点。
+// 一次订阅的频道必须属于同一个分片，模式只能收到本分片的消息
+func (handler *Handler) PubSub(resp http.ResponseWriter, req *http.Request) {
+    if handler.ctx.pubsub == nil {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte("pubsub is not enabled"))
+        return
+    }
+    switch req.Method {
+    case http.MethodPost, http.MethodPut:
+        handler.publish(resp, req)
+    case http.MethodGet:
+        handler.subscribe(resp, req)
+    default:
+        resp.WriteHeader(http.StatusMethodNotAllowed)
+        resp.Write([]byte("method not support"))
+    }
+}
+
+func (handler *Handler) publish(resp http.ResponseWriter, req *http.Request) {
+    channel := strings.TrimPrefix(req.URL.Path, "/pubsub/")
+    if channel == "" || channel == req.URL.Path {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte("channel is required"))
+        return
+    }
+    if !handler.ctx.CheckSelf(channel, true) {
+        addr, err := handler.ctx.SelectClusterNode(channel, true)
+        if err != nil {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte(err.Error()))
+            return
+        }
+        if addr != "" {
+            handler.redirect(addr, resp, req)
+            return
+        }
+    }
+
+    if !handler.leader(resp, req) {
+        return
+    }
+    value, err := getValue(req)
+    if err != nil {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte(err.Error()))
+        return
+    }
+    cmdReq := command.Request{
+        Cmd: command.PUBLISH,
+        K:   channel,
+        V:   value,
+    }
+    if !handler.authorize(resp, req, &cmdReq) {
+        return
+    }
+    if _, procErr := handler.ctx.ProcessCmd(&cmdReq, false); procErr != nil {
+        writeCmdError(resp, procErr)
+    }
+}
+
+func (handler *Handler) subscribe(resp http.ResponseWriter, req *http.Request) {
+    query := req.URL.Query()
+    channels, patterns := query["channel"], query["pattern"]
+    if len(channels) == 0 && len(patterns) == 0 {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte(pubsub.ErrNoChannel.Error()))
+        return
+    }
+
+    // 频道都不在本节点时跳转到所在的节点
+    target := ""
+    for i, c := range channels {
+        addr := ""
+        if !handler.ctx.CheckSelf(c, false) {
+            var err error
+            if addr, err = handler.ctx.SelectClusterNode(c, false); err != nil {
+                resp.WriteHeader(http.StatusBadRequest)
+                resp.Write([]byte(err.Error()))
+                return
+            }
+        }
+        if i > 0 && addr != target {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte("channels belong to different shards"))
+            return
+        }
+        target = addr
+    }
+    if target != "" {
+        handler.redirect(target, resp, req)
+        return
+    }
+
+    principal := auth.FromContext(req.Context())
+    for _, c := range channels {
+        if !handler.ctx.Authorized(principal, command.SUBSCRIBE, c) {
+            resp.WriteHeader(http.StatusForbidden)
+            resp.Write([]byte("permission denied"))
+            return
+        }
+    }
+
+    sub, err := handler.ctx.pubsub.Subscribe(channels, patterns)
+    if err != nil {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte(err.Error()))
+        return
+    }
+    defer sub.Close()
+
+    flusher, ok := handler.startSSE(resp)
+    if !ok {
+        return
+    }
+    keepalive := time.NewTicker(sseKeepalive)
+    defer keepalive.Stop()
+    for {
+        select {
+        case msg := <-sub.Messages():
+            // 模式匹配的频道按每条消息校验
+            if msg.Pattern != "" && !handler.ctx.Authorized(principal, command.SUBSCRIBE, msg.Channel) {
+                continue
+            }
+            event := "message"
+            if msg.Pattern != "" {
+                event = "pmessage"
+            }
+            b, _ := json.Marshal(msg)
+            if _, err := fmt.Fprintf(resp, "event: %s\ndata: %s\n\n", event, b); err != nil {
+                return
+            }
+        case <-keepalive.C:
+            if !writeKeepalive(resp) {
+                return
+            }
+        case <-sub.Done():
+            if err := sub.Err(); err != nil {
+                fmt.Fprintf(resp, "event: error\ndata: %s\n\n", err.Error())
+                flusher.Flush()
+            }
+            return
+        case <-req.Context().Done():
+            return
+        }
+        flusher.Flush()
+    }
+}
@@ -0,0 +1,249 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package handler
+
+import (
+    "github.com/xfali/gache/command"
+    "github.com/xfali/gache/db"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const (
+    maxQueueWait = time.Minute
+    // 长轮询时检查本地是否有可以投递的消息的间隔
+    queuePoll = 50 * time.Millisecond
+)
+
+// 消息的JSON格式
+type QueueMessageInfo struct {
+    ID         uint64    `json:"id"`
+    Body       string    `json:"body"`
+    Enqueued   time.Time `json:"enqueued"`
+    Deliveries int       `json:"deliveries"`
+    Receipt    uint64    `json:"receipt,omitempty"`
+}
+
+func newQueueMessageInfo(m *db.QueueMessage) *QueueMessageInfo {
+    return &QueueMessageInfo{
+        ID:         m.ID,
+        Body:       m.Body,
+        Enqueued:   time.Unix(0, m.Enqueued).UTC(),
+        Deliveries: m.Deliveries,
+        Receipt:    m.Receipt,
+    }
+}
+
+// Queue 消息队列，队列名与key相同按slot分布在分片上，名称中不能包含"/"：
+//   POST   /queue/NAME                               入队，body为消息，返回 {"id":ID}
+//   GET    /queue/NAME[?visibility=30s][&wait=10s]   出队，返回消息，visibility内对其他消费者不可见；没有消息时最多等待wait，超时返回204
+//   POST   /queue/NAME/ack?receipt=R                 确认处理完成，删除消息
+//   POST   /queue/NAME/nack?receipt=R[&delay=5s]     处理失败，delay后重新投递
+//   GET    /queue/NAME/stats                         可投递、处理中以及死信的消息数
+//   GET    /queue/NAME/dead                          死信
+//   DELETE /queue/NAME/dead                          清空死信
+// 投递queue-max-deliveries次仍然没有确认的消息移到死信。可见性超时后回执失效，ACK、NACK返回409
+func (handler *Handler) Queue(resp http.ResponseWriter, req *http.Request) {
+    path := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/queue/"), "/", 2)
+    name, action := path[0], ""
+    if len(path) > 1 {
+        action = path[1]
+    }
+    if name == "" {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte("queue name is required"))
+        return
+    }
+    write := req.Method != http.MethodGet || action == ""
+    if !handler.ctx.CheckSelf(name, write) {
+        addr, err := handler.ctx.SelectClusterNode(name, write)
+        if err != nil {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte(err.Error()))
+            return
+        }
+        if addr != "" {
+            handler.redirect(addr, resp, req)
+            return
+        }
+    }
+
+    switch {
+    case action == "" && req.Method == http.MethodPost:
+        handler.enqueue(resp, req, name)
+    case action == "" && req.Method == http.MethodGet:
+        handler.dequeue(resp, req, name)
+    case (action == "ack" || action == "nack") && req.Method == http.MethodPost:
+        handler.settle(resp, req, name, action == "ack")
+    case action == "stats" && req.Method == http.MethodGet:
+        cmdReq := command.Request{Cmd: command.GET, K: name}
+        if !handler.authorize(resp, req, &cmdReq) {
+            return
+        }
+        writeJson(resp, handler.ctx.db.Queues.Stats(name, time.Now().UnixNano()))
+    case action == "dead" && req.Method == http.MethodGet:
+        cmdReq := command.Request{Cmd: command.GET, K: name}
+        if !handler.authorize(resp, req, &cmdReq) {
+            return
+        }
+        dead := handler.ctx.db.Queues.DeadLetters(name)
+        ret := make([]*QueueMessageInfo, 0, len(dead))
+        for i := range dead {
+            m := newQueueMessageInfo(&dead[i])
+            m.Receipt = 0
+            ret = append(ret, m)
+        }
+        writeJson(resp, ret)
+    case action == "dead" && req.Method == http.MethodDelete:
+        cmdReq := command.Request{Cmd: command.QUEUE_PURGE_DEAD, K: name}
+        if !handler.leader(resp, req) || !handler.authorize(resp, req, &cmdReq) {
+            return
+        }
+        ret, procErr := handler.ctx.ProcessCmd(&cmdReq, false)
+        if procErr != nil {
+            writeCmdError(resp, procErr)
+            return
+        }
+        writeJson(resp, map[string]int{"purged": ret.(int)})
+    default:
+        resp.WriteHeader(http.StatusMethodNotAllowed)
+        resp.Write([]byte("method not support"))
+    }
+}
+
+func (handler *Handler) enqueue(resp http.ResponseWriter, req *http.Request, name string) {
+    if !handler.leader(resp, req) {
+        return
+    }
+    value, err := getValue(req)
+    if err != nil {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte(err.Error()))
+        return
+    }
+    cmdReq := command.Request{Cmd: command.ENQUEUE, K: name, V: value}
+    if !handler.authorize(resp, req, &cmdReq) {
+        return
+    }
+    ret, procErr := handler.ctx.ProcessCmd(&cmdReq, false)
+    if procErr != nil {
+        writeCmdError(resp, procErr)
+        return
+    }
+    writeJson(resp, map[string]uint64{"id": ret.(uint64)})
+}
+
+func (handler *Handler) dequeue(resp http.ResponseWriter, req *http.Request, name string) {
+    if !handler.leader(resp, req) {
+        return
+    }
+    query := req.URL.Query()
+    cmdReq := command.Request{
+        Cmd:           command.DEQUEUE,
+        K:             name,
+        Ttl:           handler.ctx.conf.QueueVisibilityTimeout,
+        MaxDeliveries: handler.ctx.conf.QueueMaxDeliveries,
+    }
+    if v := query.Get("visibility"); v != "" {
+        d, err := time.ParseDuration(v)
+        if err != nil || d <= 0 {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte("invalid visibility: " + v))
+            return
+        }
+        cmdReq.Ttl = d
+    }
+    var wait time.Duration
+    if v := query.Get("wait"); v != "" {
+        d, err := time.ParseDuration(v)
+        if err != nil || d < 0 {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte("invalid wait: " + v))
+            return
+        }
+        if d > maxQueueWait {
+            d = maxQueueWait
+        }
+        wait = d
+    }
+    if !handler.authorize(resp, req, &cmdReq) {
+        return
+    }
+    if wait > 0 {
+        // 等待时间可能超过http-write-timeout
+        handler.clearWriteDeadline(resp)
+    }
+
+    deadline := time.Now().Add(wait)
+    ticker := time.NewTicker(queuePoll)
+    defer ticker.Stop()
+    for {
+        // 本地没有可以投递的消息时不提交命令
+        if handler.ctx.db.Queues.Ready(name, time.Now().UnixNano()) {
+            cmdReq.Ts = 0
+            ret, procErr := handler.ctx.ProcessCmd(&cmdReq, false)
+            if procErr != nil {
+                writeCmdError(resp, procErr)
+                return
+            }
+            if m := ret.(*db.QueueMessage); m != nil {
+                writeJson(resp, newQueueMessageInfo(m))
+                return
+            }
+        }
+        if !time.Now().Before(deadline) {
+            resp.WriteHeader(http.StatusNoContent)
+            return
+        }
+        select {
+        case <-ticker.C:
+        case <-req.Context().Done():
+            return
+        }
+    }
+}
+
+// ACK或NACK
+func (handler *Handler) settle(resp http.ResponseWriter, req *http.Request, name string, ack bool) {
+    if !handler.leader(resp, req) {
+        return
+    }
+    query := req.URL.Query()
+    receipt, err := strconv.ParseUint(query.Get("receipt"), 10, 64)
+    if err != nil {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte("invalid receipt: " + query.Get("receipt")))
+        return
+    }
+    cmdReq := command.Request{Cmd: command.ACK, K: name, Token: receipt}
+    if !ack {
+        cmdReq.Cmd, cmdReq.MaxDeliveries = command.NACK, handler.ctx.conf.QueueMaxDeliveries
+        if v := query.Get("delay"); v != "" {
+            d, err := time.ParseDuration(v)
+            if err != nil || d < 0 {
+                resp.WriteHeader(http.StatusBadRequest)
+                resp.Write([]byte("invalid delay: " + v))
+                return
+            }
+            cmdReq.Ttl = d
+        }
+    }
+    if !handler.authorize(resp, req, &cmdReq) {
+        return
+    }
+    ret, procErr := handler.ctx.ProcessCmd(&cmdReq, false)
+    if procErr != nil {
+        writeCmdError(resp, procErr)
+        return
+    }
+    if ok, _ := ret.(bool); !ok {
+        resp.WriteHeader(http.StatusConflict)
+        resp.Write([]byte("receipt expired"))
+    }
+}
@@ -0,0 +1,63 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package handler
+
+import (
+    "net/http"
+    "strings"
+)
+
+const raftPeersPath = "/admin/raft/peers"
+
+// RaftPeers 管理raft成员：
+//   GET    /admin/raft/peers      全部成员
+//   DELETE /admin/raft/peers/ID   将节点移出集群
+func (handler *Handler) RaftPeers(resp http.ResponseWriter, req *http.Request) {
+    if !handler.requireAdmin(resp, req) {
+        return
+    }
+    if handler.ctx.raft == nil {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte("raft is not enabled"))
+        return
+    }
+
+    id := strings.Trim(strings.TrimPrefix(req.URL.Path, raftPeersPath), "/")
+    switch req.Method {
+    case http.MethodGet:
+        peers, err := handler.ctx.raft.Peers()
+        if err != nil {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte(err.Error()))
+            return
+        }
+        for i := range peers {
+            if p, ok := handler.ctx.db.GetPeer(peers[i].ID); ok {
+                peers[i].ApiAddr = p.ApiAddr
+            }
+        }
+        writeJson(resp, peers)
+    case http.MethodDelete:
+        if id == "" {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte("id is required"))
+            return
+        }
+        if !handler.leader(resp, req) {
+            return
+        }
+        if err := handler.ctx.raft.Remove(id); err != nil {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte(err.Error()))
+            return
+        }
+        handler.ctx.logger.Info("raft node removed", "id", id)
+    default:
+        resp.WriteHeader(http.StatusMethodNotAllowed)
+        resp.Write([]byte("method not support"))
+    }
+}
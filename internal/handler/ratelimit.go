@@ -0,0 +1,132 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package handler
+
+import (
+    "errors"
+    "github.com/xfali/gache/command"
+    "github.com/xfali/gache/db"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// 限流结果的JSON格式
+type RateLimitInfo struct {
+    Allowed   bool      `json:"allowed"`
+    Limit     int64     `json:"limit"`
+    Remaining int64     `json:"remaining"`
+    Reset     time.Time `json:"reset"`
+    // 拒绝时等待多久之后可以通过
+    RetryAfter string `json:"retryAfter,omitempty"`
+}
+
+// RateLimit 限流，名称与key相同按slot分布在分片上：
+//   POST   /ratelimit/NAME?limit=100&period=1m[&algorithm=token-bucket][&cost=1]   消耗cost个配额，返回RateLimitInfo
+//   DELETE /ratelimit/NAME                                                         重置
+// algorithm为token-bucket（令牌桶，每period/limit恢复一个，最多limit个）或者sliding-window（任意period内最多limit个）。
+// 通过与否都返回200，并设置X-RateLimit-Limit、X-RateLimit-Remaining、X-RateLimit-Reset（Unix秒），拒绝时设置Retry-After
+func (handler *Handler) RateLimit(resp http.ResponseWriter, req *http.Request) {
+    name := strings.TrimPrefix(req.URL.Path, "/ratelimit/")
+    if name == "" || name == req.URL.Path {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte("rate limiter name is required"))
+        return
+    }
+    if !handler.ctx.CheckSelf(name, true) {
+        addr, err := handler.ctx.SelectClusterNode(name, true)
+        if err != nil {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte(err.Error()))
+            return
+        }
+        if addr != "" {
+            handler.redirect(addr, resp, req)
+            return
+        }
+    }
+
+    var cmdReq command.Request
+    switch req.Method {
+    case http.MethodPost:
+        r, err := parseRateLimitRequest(req)
+        if err != nil {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte(err.Error()))
+            return
+        }
+        cmdReq = *r
+        cmdReq.K = name
+    case http.MethodDelete:
+        cmdReq = command.Request{Cmd: command.RATELIMIT_RESET, K: name}
+    default:
+        resp.WriteHeader(http.StatusMethodNotAllowed)
+        resp.Write([]byte("method not support"))
+        return
+    }
+    if !handler.leader(resp, req) || !handler.authorize(resp, req, &cmdReq) {
+        return
+    }
+    ret, procErr := handler.ctx.ProcessCmd(&cmdReq, false)
+    if procErr != nil {
+        writeCmdError(resp, procErr)
+        return
+    }
+    if r, ok := ret.(db.RateLimitResult); ok {
+        writeRateLimit(resp, r, cmdReq.Ts)
+    }
+}
+
+func parseRateLimitRequest(req *http.Request) (*command.Request, error) {
+    query := req.URL.Query()
+    ret := &command.Request{Cmd: command.RATELIMIT, V: db.TokenBucket, Cost: 1}
+    if v := query.Get("algorithm"); v != "" {
+        if v != db.TokenBucket && v != db.SlidingWindow {
+            return nil, errors.New("invalid algorithm: " + v)
+        }
+        ret.V = v
+    }
+    limit, err := strconv.ParseInt(query.Get("limit"), 10, 64)
+    if err != nil || limit <= 0 {
+        return nil, errors.New("invalid limit: " + query.Get("limit"))
+    }
+    ret.Limit = limit
+    period, err := time.ParseDuration(query.Get("period"))
+    if err != nil || period <= 0 {
+        return nil, errors.New("invalid period: " + query.Get("period"))
+    }
+    ret.Ttl = period
+    if v := query.Get("cost"); v != "" {
+        cost, err := strconv.ParseInt(v, 10, 64)
+        if err != nil || cost < 0 || cost > limit {
+            return nil, errors.New("invalid cost: " + v)
+        }
+        ret.Cost = cost
+    }
+    return ret, nil
+}
+
+// now为提交命令时的时间
+func writeRateLimit(resp http.ResponseWriter, r db.RateLimitResult, now int64) {
+    info := &RateLimitInfo{
+        Allowed:   r.Allowed,
+        Limit:     r.Limit,
+        Remaining: r.Remaining,
+        Reset:     time.Unix(0, r.Reset).UTC(),
+    }
+    h := resp.Header()
+    h.Set("X-RateLimit-Limit", strconv.FormatInt(r.Limit, 10))
+    h.Set("X-RateLimit-Remaining", strconv.FormatInt(r.Remaining, 10))
+    h.Set("X-RateLimit-Reset", strconv.FormatInt(info.Reset.Unix(), 10))
+    if !r.Allowed && r.RetryAt > now {
+        d := time.Duration(r.RetryAt - now)
+        info.RetryAfter = d.String()
+        h.Set("Retry-After", strconv.FormatInt(int64((d+time.Second-1)/time.Second), 10))
+    }
+    writeJson(resp, info)
+}
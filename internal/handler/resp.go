@@ -0,0 +1,510 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package handler
+
+import (
+    "crypto/tls"
+    "fmt"
+    "github.com/hashicorp/go-hclog"
+    "github.com/hashicorp/raft"
+    "github.com/xfali/gache/command"
+    "github.com/xfali/gache/config"
+    "github.com/xfali/gache/internal/auth"
+    "github.com/xfali/gache/internal/cluster"
+    "github.com/xfali/gache/internal/pubsub"
+    "github.com/xfali/gache/internal/resp"
+    "net"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+// 发送回复以及消息的超时，超时后关闭连接
+const respWriteTimeout = 15 * time.Second
+
+// RespServer 使用redis协议（RESP2）提供发布订阅，支持PING、AUTH、QUIT、PUBLISH、
+// SUBSCRIBE、PSUBSCRIBE、UNSUBSCRIBE、PUNSUBSCRIBE，语义与redis相同。
+// 与HTTP接口相同，频道按slot分布在分片上：不在本节点的频道返回MOVED，
+// PUBLISH在follower上返回MOVED指向leader。PUBLISH返回leader上收到消息的订阅者数，
+// 不包括其他副本上的订阅者
+type RespServer struct {
+    ctx    *Context
+    auth   *auth.Auth
+    logger hclog.Logger
+
+    mu     sync.Mutex
+    l      net.Listener
+    conns  map[*respConn]bool
+    closed bool
+    wg     sync.WaitGroup
+}
+
+func NewRespServer(ctx *Context, authenticator *auth.Auth, logger hclog.Logger) *RespServer {
+    return &RespServer{
+        ctx:    ctx,
+        auth:   authenticator,
+        logger: logger.Named("resp"),
+        conns:  map[*respConn]bool{},
+    }
+}
+
+func (s *RespServer) Start(conf *config.Config) error {
+    l, err := net.Listen("tcp", fmt.Sprintf(":%d", conf.RespPort))
+    if err != nil {
+        return err
+    }
+    return s.Serve(l, conf)
+}
+
+// Serve 使用已经创建的listener提供服务，配置了tls-cert时启用TLS
+func (s *RespServer) Serve(l net.Listener, conf *config.Config) error {
+    if auth.TLSEnabled(conf) {
+        tlsConf, err := auth.ServerTLSConfig(conf)
+        if err != nil {
+            l.Close()
+            return err
+        }
+        l = tls.NewListener(l, tlsConf)
+    }
+    s.mu.Lock()
+    s.l = l
+    s.mu.Unlock()
+
+    s.wg.Add(1)
+    go s.accept(l)
+    return nil
+}
+
+func (s *RespServer) accept(l net.Listener) {
+    defer s.wg.Done()
+    for {
+        c, err := l.Accept()
+        if err != nil {
+            if ne, ok := err.(net.Error); ok && ne.Temporary() {
+                time.Sleep(10 * time.Millisecond)
+                continue
+            }
+            return
+        }
+        rc := &respConn{
+            s: s,
+            c: c,
+            r: resp.NewReader(c),
+            w: resp.NewWriter(c),
+        }
+        s.mu.Lock()
+        if s.closed {
+            s.mu.Unlock()
+            c.Close()
+            return
+        }
+        s.conns[rc] = true
+        s.wg.Add(1)
+        s.mu.Unlock()
+        go rc.serve()
+    }
+}
+
+func (s *RespServer) Addr() net.Addr {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if s.l == nil {
+        return nil
+    }
+    return s.l.Addr()
+}
+
+// Close 停止接受新的连接并关闭所有连接，订阅者收到连接断开
+func (s *RespServer) Close() error {
+    s.mu.Lock()
+    if s.closed || s.l == nil {
+        s.mu.Unlock()
+        return nil
+    }
+    s.closed = true
+    err := s.l.Close()
+    for c := range s.conns {
+        c.c.Close()
+    }
+    s.mu.Unlock()
+
+    s.wg.Wait()
+    return err
+}
+
+func (s *RespServer) remove(c *respConn) {
+    s.mu.Lock()
+    delete(s.conns, c)
+    s.mu.Unlock()
+    s.wg.Done()
+}
+
+type respConn struct {
+    s *RespServer
+    c net.Conn
+    r *resp.Reader
+
+    // 处理命令与发送订阅消息的goroutine共用
+    wmu sync.Mutex
+    w   *resp.Writer
+
+    authed    bool
+    principal *auth.Principal
+    channels  map[string]bool
+    patterns  map[string]bool
+    sub       *pubsub.Subscriber
+}
+
+func (c *respConn) serve() {
+    defer c.s.remove(c)
+    defer c.c.Close()
+    defer c.unsubscribeAll()
+
+    c.authed = !c.s.auth.Enabled()
+    // 客户端证书认证在握手之后完成，之后可以用AUTH切换为token对应的用户
+    if tc, ok := c.c.(*tls.Conn); ok {
+        if err := tc.Handshake(); err != nil {
+            return
+        }
+        state := tc.ConnectionState()
+        if p, err := c.s.auth.AuthenticateConn(&state, ""); err == nil {
+            c.authed, c.principal = true, p
+        }
+    }
+
+    for {
+        args, err := c.r.ReadCommand()
+        if err != nil {
+            if err == resp.ErrProtocol {
+                c.reply(func(w *resp.Writer) { w.WriteError("ERR Protocol error") })
+            }
+            return
+        }
+        if !c.execute(args) {
+            return
+        }
+    }
+}
+
+// 执行一条命令，返回false时关闭连接
+func (c *respConn) execute(args []string) bool {
+    name := strings.ToUpper(args[0])
+    args = args[1:]
+    if name == "QUIT" {
+        c.reply(func(w *resp.Writer) { w.WriteSimple("OK") })
+        return false
+    }
+    // 订阅期间不能切换用户
+    subscribed := c.sub != nil
+    if name == "AUTH" && !subscribed {
+        return c.authenticate(args)
+    }
+    if !c.authed {
+        return c.replyError("NOAUTH Authentication required.")
+    }
+    if c.s.ctx.pubsub == nil && name != "PING" {
+        return c.replyError("ERR pubsub is not enabled")
+    }
+
+    switch name {
+    case "PING":
+        if len(args) > 1 {
+            return c.arity(name)
+        }
+        msg := ""
+        if len(args) == 1 {
+            msg = args[0]
+        }
+        return c.reply(func(w *resp.Writer) {
+            switch {
+            case subscribed:
+                w.WriteArray(2)
+                w.WriteBulk("pong")
+                w.WriteBulk(msg)
+            case len(args) == 1:
+                w.WriteBulk(msg)
+            default:
+                w.WriteSimple("PONG")
+            }
+        })
+    case "SUBSCRIBE", "PSUBSCRIBE":
+        if len(args) == 0 {
+            return c.arity(name)
+        }
+        return c.subscribe(name == "PSUBSCRIBE", args)
+    case "UNSUBSCRIBE", "PUNSUBSCRIBE":
+        return c.unsubscribe(name == "PUNSUBSCRIBE", args)
+    }
+    if subscribed {
+        return c.replyError(fmt.Sprintf("ERR Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", strings.ToLower(name)))
+    }
+    if name == "PUBLISH" {
+        if len(args) != 2 {
+            return c.arity(name)
+        }
+        return c.publish(args[0], args[1])
+    }
+    return c.replyError(fmt.Sprintf("ERR unknown command '%s'", strings.ToLower(name)))
+}
+
+// AUTH TOKEN 或 AUTH USER TOKEN，使用auth-tokens中的token
+func (c *respConn) authenticate(args []string) bool {
+    if len(args) < 1 || len(args) > 2 {
+        return c.arity("AUTH")
+    }
+    if !c.s.auth.Enabled() {
+        return c.replyError("ERR AUTH called without any authentication configured")
+    }
+    p, err := c.s.auth.AuthenticateConn(nil, args[len(args)-1])
+    if err != nil || len(args) == 2 && p.Name != args[0] {
+        return c.replyError("WRONGPASS invalid username-password pair")
+    }
+    c.authed, c.principal = true, p
+    return c.reply(func(w *resp.Writer) { w.WriteSimple("OK") })
+}
+
+func (c *respConn) publish(channel, data string) bool {
+    ctx := c.s.ctx
+    if !ctx.CheckSelf(channel, true) {
+        addr, err := ctx.SelectRespNode(channel, true)
+        if err != nil {
+            return c.replyError("CLUSTERDOWN " + err.Error())
+        }
+        if addr != "" {
+            return c.moved(channel, addr)
+        }
+    }
+    if !ctx.IsLeader() {
+        addr := ctx.LeaderRespAddr()
+        if addr == "" {
+            return c.replyError("TRYAGAIN Not leader")
+        }
+        return c.moved(channel, addr)
+    }
+    cmdReq := command.Request{
+        Cmd: command.PUBLISH,
+        K:   channel,
+        V:   data,
+    }
+    if !ctx.Authorized(c.principal, command.PUBLISH, channel) {
+        return c.replyError("NOPERM permission denied")
+    }
+    ret, err := ctx.ProcessCmd(&cmdReq, false)
+    if err != nil {
+        return c.replyError(respCmdError(err))
+    }
+    n, _ := ret.(int)
+    return c.reply(func(w *resp.Writer) { w.WriteInt(int64(n)) })
+}
+
+// 与writeCmdError相同，leader切换时返回TRYAGAIN，客户端可以重试
+func respCmdError(err error) string {
+    switch err {
+    case raft.ErrNotLeader, raft.ErrLeadershipTransferInProgress, raft.ErrEnqueueTimeout:
+        return "TRYAGAIN " + err.Error()
+    case raft.ErrLeadershipLost, raft.ErrRaftShutdown, cluster.ErrApplyTimeout:
+        return "TIMEOUT " + err.Error()
+    case ErrOutOfMemory:
+        return "OOM " + err.Error()
+    }
+    return "ERR " + err.Error()
+}
+
+func (c *respConn) subscribe(pattern bool, args []string) bool {
+    ctx := c.s.ctx
+    if !pattern {
+        // 频道都需要在本节点，模式只能收到本分片的消息
+        for _, ch := range args {
+            if ctx.CheckSelf(ch, false) {
+                continue
+            }
+            addr, err := ctx.SelectRespNode(ch, false)
+            if err != nil {
+                return c.replyError("CLUSTERDOWN " + err.Error())
+            }
+            if addr != "" {
+                return c.moved(ch, addr)
+            }
+        }
+        for _, ch := range args {
+            if !ctx.Authorized(c.principal, command.SUBSCRIBE, ch) {
+                return c.replyError("NOPERM permission denied")
+            }
+        }
+    }
+
+    set := c.set(pattern)
+    for _, v := range args {
+        set[v] = true
+    }
+    if err := c.update(); err != nil {
+        return c.replyError("ERR " + err.Error())
+    }
+    kind := "subscribe"
+    if pattern {
+        kind = "psubscribe"
+    }
+    count := len(c.channels) + len(c.patterns)
+    return c.reply(func(w *resp.Writer) {
+        for _, v := range args {
+            w.WriteArray(3)
+            w.WriteBulk(kind)
+            w.WriteBulk(v)
+            w.WriteInt(int64(count))
+        }
+    })
+}
+
+// 没有参数时取消全部频道（或模式）
+func (c *respConn) unsubscribe(pattern bool, args []string) bool {
+    set := c.set(pattern)
+    if len(args) == 0 {
+        for v := range set {
+            args = append(args, v)
+        }
+        sort.Strings(args)
+    }
+    kind := "unsubscribe"
+    if pattern {
+        kind = "punsubscribe"
+    }
+    if len(args) == 0 {
+        count := len(c.channels) + len(c.patterns)
+        return c.reply(func(w *resp.Writer) {
+            w.WriteArray(3)
+            w.WriteBulk(kind)
+            w.WriteBulk("")
+            w.WriteInt(int64(count))
+        })
+    }
+
+    counts := make([]int, len(args))
+    for i, v := range args {
+        delete(set, v)
+        counts[i] = len(c.channels) + len(c.patterns)
+    }
+    if err := c.update(); err != nil {
+        return c.replyError("ERR " + err.Error())
+    }
+    return c.reply(func(w *resp.Writer) {
+        for i, v := range args {
+            w.WriteArray(3)
+            w.WriteBulk(kind)
+            w.WriteBulk(v)
+            w.WriteInt(int64(counts[i]))
+        }
+    })
+}
+
+func (c *respConn) set(pattern bool) map[string]bool {
+    if pattern {
+        if c.patterns == nil {
+            c.patterns = map[string]bool{}
+        }
+        return c.patterns
+    }
+    if c.channels == nil {
+        c.channels = map[string]bool{}
+    }
+    return c.channels
+}
+
+// 按当前的频道与模式修改订阅，全部取消后退出订阅模式
+func (c *respConn) update() error {
+    channels, patterns := keys(c.channels), keys(c.patterns)
+    if len(channels) == 0 && len(patterns) == 0 {
+        c.unsubscribeAll()
+        return nil
+    }
+    if c.sub != nil {
+        c.sub.Update(channels, patterns)
+        return nil
+    }
+    sub, err := c.s.ctx.pubsub.Subscribe(channels, patterns)
+    if err != nil {
+        return err
+    }
+    c.sub = sub
+    go c.forward(sub, c.principal)
+    return nil
+}
+
+func (c *respConn) unsubscribeAll() {
+    if c.sub != nil {
+        c.sub.Close()
+        c.sub = nil
+    }
+}
+
+func keys(m map[string]bool) []string {
+    ret := make([]string, 0, len(m))
+    for k := range m {
+        ret = append(ret, k)
+    }
+    return ret
+}
+
+// 把订阅者收到的消息发送给客户端，订阅者处理太慢被移除时关闭连接
+func (c *respConn) forward(sub *pubsub.Subscriber, principal *auth.Principal) {
+    ctx := c.s.ctx
+    for {
+        select {
+        case msg := <-sub.Messages():
+            // 模式匹配的频道按每条消息校验
+            if msg.Pattern != "" && !ctx.Authorized(principal, command.SUBSCRIBE, msg.Channel) {
+                continue
+            }
+            ok := c.reply(func(w *resp.Writer) {
+                if msg.Pattern != "" {
+                    w.WriteArray(4)
+                    w.WriteBulk("pmessage")
+                    w.WriteBulk(msg.Pattern)
+                } else {
+                    w.WriteArray(3)
+                    w.WriteBulk("message")
+                }
+                w.WriteBulk(msg.Channel)
+                w.WriteBulk(msg.Data)
+            })
+            if !ok {
+                c.c.Close()
+                return
+            }
+        case <-sub.Done():
+            if err := sub.Err(); err != nil {
+                c.s.logger.Warn("subscriber removed", "remote", c.c.RemoteAddr().String(), "error", err)
+                c.replyError("ERR " + err.Error())
+                c.c.Close()
+            }
+            return
+        }
+    }
+}
+
+func (c *respConn) moved(key, addr string) bool {
+    return c.replyError(fmt.Sprintf("MOVED %d %s", CalcSlot(key), addr))
+}
+
+func (c *respConn) arity(name string) bool {
+    return c.replyError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+}
+
+func (c *respConn) replyError(msg string) bool {
+    return c.reply(func(w *resp.Writer) { w.WriteError(msg) })
+}
+
+// 写入并发送回复，失败时返回false
+func (c *respConn) reply(f func(w *resp.Writer)) bool {
+    c.wmu.Lock()
+    defer c.wmu.Unlock()
+
+    f(c.w)
+    c.c.SetWriteDeadline(time.Now().Add(respWriteTimeout))
+    return c.w.Flush() == nil
+}
@@ -0,0 +1,179 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package handler
+
+import (
+    "context"
+    "crypto/tls"
+    "errors"
+    "fmt"
+    "github.com/hashicorp/go-hclog"
+    "github.com/xfali/gache/config"
+    "github.com/xfali/gache/internal/auth"
+    gachelog "github.com/xfali/gache/internal/logger"
+    "net"
+    "net/http"
+    "sync"
+    "time"
+)
+
+var errListenerClosed = errors.New("listener closed")
+
+// Server 在同一个端口上可以替换http.Server，用于运行时修改超时等配置
+type Server struct {
+    mu      sync.Mutex
+    handler http.Handler
+    l       net.Listener
+    connCh  chan net.Conn
+    s       *http.Server
+    sl      *serverListener
+    logger  hclog.Logger
+}
+
+func NewServer(handler http.Handler, logger hclog.Logger) *Server {
+    return &Server{
+        handler: handler,
+        connCh:  make(chan net.Conn),
+        logger:  logger.Named("http"),
+    }
+}
+
+func (s *Server) Start(conf *config.Config) error {
+    l, err := net.Listen("tcp", fmt.Sprintf(":%d", conf.ApiPort))
+    if err != nil {
+        return err
+    }
+    return s.Serve(l, conf)
+}
+
+// Serve 使用已经创建的listener提供服务，配置了tls-cert时启用TLS
+func (s *Server) Serve(l net.Listener, conf *config.Config) error {
+    if auth.TLSEnabled(conf) {
+        tlsConf, err := auth.ServerTLSConfig(conf)
+        if err != nil {
+            l.Close()
+            return err
+        }
+        l = tls.NewListener(l, tlsConf)
+    }
+    s.l = l
+    go s.accept()
+
+    s.Reload(conf)
+    return nil
+}
+
+func (s *Server) accept() {
+    for {
+        c, err := s.l.Accept()
+        if err != nil {
+            if ne, ok := err.(net.Error); ok && ne.Temporary() {
+                time.Sleep(10 * time.Millisecond)
+                continue
+            }
+            close(s.connCh)
+            return
+        }
+        s.connCh <- c
+    }
+}
+
+// 使用新的配置创建http.Server接管监听，旧的Server处理完正在进行的请求后关闭
+func (s *Server) Reload(conf *config.Config) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    old, oldListener := s.s, s.sl
+    s.sl = &serverListener{addr: s.l.Addr(), connCh: s.connCh, done: make(chan struct{})}
+    s.s = &http.Server{
+        Handler:        s.handler,
+        ReadTimeout:    conf.HttpReadTimeout,
+        WriteTimeout:   conf.HttpWriteTimeout,
+        IdleTimeout:    conf.HttpIdleTimeout,
+        MaxHeaderBytes: conf.HttpMaxHeaderBytes,
+        ErrorLog:       gachelog.Std(s.logger),
+    }
+    go s.s.Serve(s.sl)
+
+    if old != nil {
+        oldListener.Close()
+        go func() {
+            ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+            defer cancel()
+            if err := old.Shutdown(ctx); err != nil {
+                s.logger.Warn("shutdown old http server failed", "error", err)
+            }
+        }()
+    }
+}
+
+func (s *Server) Addr() net.Addr {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if s.l == nil {
+        return nil
+    }
+    return s.l.Addr()
+}
+
+// Shutdown 停止接受新的连接，等待正在处理的请求完成或ctx结束
+func (s *Server) Shutdown(ctx context.Context) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if s.l == nil {
+        return nil
+    }
+    s.l.Close()
+    return s.s.Shutdown(ctx)
+}
+
+func (s *Server) Close() error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if s.l == nil {
+        return nil
+    }
+    s.l.Close()
+    return s.s.Close()
+}
+
+type serverListener struct {
+    addr   net.Addr
+    connCh chan net.Conn
+    once   sync.Once
+    done   chan struct{}
+}
+
+func (l *serverListener) Accept() (net.Conn, error) {
+    select {
+    case <-l.done:
+        return nil, errListenerClosed
+    default:
+    }
+
+    select {
+    case c, ok := <-l.connCh:
+        if !ok {
+            return nil, errListenerClosed
+        }
+        return c, nil
+    case <-l.done:
+        return nil, errListenerClosed
+    }
+}
+
+func (l *serverListener) Close() error {
+    l.once.Do(func() { close(l.done) })
+    return nil
+}
+
+func (l *serverListener) Addr() net.Addr {
+    return l.addr
+}
@@ -0,0 +1,219 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package handler
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "github.com/xfali/gache/command"
+    "github.com/xfali/gache/db"
+    "net/http"
+    "sort"
+    "strings"
+    "time"
+)
+
+// 会话的JSON格式
+type SessionInfo struct {
+    ID     string    `json:"id"`
+    TTL    string    `json:"ttl"`
+    Expire time.Time `json:"expire"`
+    Keys   []string  `json:"keys,omitempty"`
+}
+
+func newSessionInfo(id string, s db.Session) *SessionInfo {
+    ret := &SessionInfo{
+        ID:     id,
+        TTL:    time.Duration(s.Ttl).String(),
+        Expire: time.Unix(0, s.Expire).UTC(),
+    }
+    for k := range s.Keys {
+        ret.Keys = append(ret.Keys, k)
+    }
+    sort.Strings(ret.Keys)
+    return ret
+}
+
+// Session 客户端会话：
+//   POST   /session?ttl=10s   创建会话
+//   PUT    /session/ID        心跳，延长有效期
+//   DELETE /session/ID        关闭会话并删除临时key
+//   GET    /session/ID        会话信息以及绑定的临时key
+// 写入key时带上 X-Gache-Session: ID 时key绑定到会话，超过ttl没有心跳时由leader删除会话以及这些key。
+// 会话保存在raft集群中，分片集群中需要在临时key所在的分片上创建会话
+func (handler *Handler) Session(resp http.ResponseWriter, req *http.Request) {
+    id := strings.TrimPrefix(strings.TrimPrefix(req.URL.Path, "/session"), "/")
+    if (id == "") != (req.Method == http.MethodPost) {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte("invalid session path"))
+        return
+    }
+    if req.Method == http.MethodGet {
+        cmdReq := command.Request{Cmd: command.GET, K: id}
+        if !handler.authorize(resp, req, &cmdReq) {
+            return
+        }
+        s, ok := handler.ctx.db.Sessions.Get(id)
+        if !ok {
+            resp.WriteHeader(http.StatusNotFound)
+            resp.Write([]byte(db.ErrSessionNotFound.Error()))
+            return
+        }
+        writeSession(resp, id, s)
+        return
+    }
+
+    cmdReq := command.Request{K: id}
+    switch req.Method {
+    case http.MethodPost:
+        ttl, err := time.ParseDuration(req.URL.Query().Get("ttl"))
+        if err != nil || ttl <= 0 {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte("invalid ttl: " + req.URL.Query().Get("ttl")))
+            return
+        }
+        cmdReq.Cmd, cmdReq.K, cmdReq.Ttl = command.SESSION_CREATE, newSessionID(), ttl
+    case http.MethodPut:
+        cmdReq.Cmd = command.SESSION_KEEPALIVE
+    case http.MethodDelete:
+        cmdReq.Cmd = command.SESSION_CLOSE
+    default:
+        resp.WriteHeader(http.StatusMethodNotAllowed)
+        resp.Write([]byte("method not support"))
+        return
+    }
+    if !handler.leader(resp, req) || !handler.authorize(resp, req, &cmdReq) {
+        return
+    }
+    ret, procErr := handler.ctx.ProcessCmd(&cmdReq, false)
+    if procErr == db.ErrSessionNotFound {
+        resp.WriteHeader(http.StatusNotFound)
+        resp.Write([]byte(procErr.Error()))
+        return
+    }
+    if procErr != nil {
+        writeCmdError(resp, procErr)
+        return
+    }
+    if keys, ok := ret.([]string); ok {
+        if err := handler.ctx.deleteEphemeral(id, keys); err != nil {
+            writeCmdError(resp, err)
+        }
+        return
+    }
+    writeSession(resp, cmdReq.K, ret.(db.Session))
+}
+
+func newSessionID() string {
+    b := make([]byte, 16)
+    rand.Read(b)
+    return hex.EncodeToString(b)
+}
+
+func writeSession(resp http.ResponseWriter, id string, s db.Session) {
+    b, _ := json.Marshal(newSessionInfo(id, s))
+    resp.Header().Set("Content-Type", "application/json")
+    resp.Write(b)
+}
+
+// 逐个删除已经删除的会话id的临时key，每个key一条日志，watch与CDC可以看到每个key的删除
+func (ctx *Context) deleteEphemeral(id string, keys []string) error {
+    for _, k := range keys {
+        cmdReq := command.Request{Cmd: command.EPHEMERAL_DEL, K: k, V: id}
+        if _, err := ctx.ProcessCmd(&cmdReq, false); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// SessionReaper 在leader上定期删除过期的会话以及会话的临时key。
+// 成为leader后至少等待会话的ttl才删除，避免选举期间客户端无法发送心跳导致会话过期
+type SessionReaper struct {
+    ctx      *Context
+    interval time.Duration
+
+    leaderSince time.Time
+    cancel      context.CancelFunc
+    done        chan struct{}
+}
+
+func NewSessionReaper(ctx *Context, interval time.Duration) *SessionReaper {
+    return &SessionReaper{
+        ctx:      ctx,
+        interval: interval,
+        done:     make(chan struct{}),
+    }
+}
+
+func (r *SessionReaper) Start() {
+    c, cancel := context.WithCancel(context.Background())
+    r.cancel = cancel
+    go r.run(c)
+}
+
+func (r *SessionReaper) run(c context.Context) {
+    defer close(r.done)
+    ticker := time.NewTicker(r.interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ticker.C:
+            r.reap(time.Now())
+        case <-c.Done():
+            return
+        }
+    }
+}
+
+func (r *SessionReaper) reap(now time.Time) {
+    if !r.ctx.IsLeader() {
+        r.leaderSince = time.Time{}
+        return
+    }
+    if r.leaderSince.IsZero() {
+        r.leaderSince = now
+    }
+    d := r.ctx.db
+    for id, ttl := range d.Sessions.Expired(now.UnixNano()) {
+        if now.Sub(r.leaderSince) < time.Duration(ttl) {
+            continue
+        }
+        cmdReq := command.Request{Cmd: command.SESSION_EXPIRE, K: id}
+        ret, err := r.ctx.ProcessCmd(&cmdReq, false)
+        if err != nil {
+            r.ctx.logger.Warn("expire session failed", "session", id, "error", err)
+            return
+        }
+        keys, _ := ret.([]string)
+        if len(keys) > 0 {
+            r.ctx.logger.Info("session expired", "session", id, "keys", len(keys))
+        }
+        if err := r.ctx.deleteEphemeral(id, keys); err != nil {
+            r.ctx.logger.Warn("delete ephemeral keys failed", "session", id, "error", err)
+            return
+        }
+    }
+    // 删除过程中leader切换时剩下的临时key
+    for k, id := range d.Sessions.OrphanKeys() {
+        if err := r.ctx.deleteEphemeral(id, []string{k}); err != nil {
+            r.ctx.logger.Warn("delete ephemeral keys failed", "session", id, "error", err)
+            return
+        }
+    }
+}
+
+func (r *SessionReaper) Close() error {
+    if r.cancel == nil {
+        return nil
+    }
+    r.cancel()
+    <-r.done
+    return nil
+}
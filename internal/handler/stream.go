@@ -0,0 +1,46 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package handler
+
+import (
+    "io"
+    "net/http"
+    "time"
+)
+
+// SSE没有消息时发送注释，及时发现断开的连接
+const sseKeepalive = 15 * time.Second
+
+// 长连接、长轮询不受http-write-timeout限制。包装的ResponseWriter需要实现Unwrap，
+// 否则不能清除，请求会在http-write-timeout后被断开
+func (handler *Handler) clearWriteDeadline(resp http.ResponseWriter) {
+    if err := http.NewResponseController(resp).SetWriteDeadline(time.Time{}); err != nil {
+        handler.ctx.logger.Warn("clear write deadline failed", "error", err)
+    }
+}
+
+// 开始Server-Sent Events响应，不支持时返回500
+func (handler *Handler) startSSE(resp http.ResponseWriter) (http.Flusher, bool) {
+    flusher, ok := resp.(http.Flusher)
+    if !ok {
+        resp.WriteHeader(http.StatusInternalServerError)
+        resp.Write([]byte("streaming is not supported"))
+        return nil, false
+    }
+    handler.clearWriteDeadline(resp)
+
+    resp.Header().Set("Content-Type", "text/event-stream")
+    resp.Header().Set("Cache-Control", "no-cache")
+    resp.WriteHeader(http.StatusOK)
+    flusher.Flush()
+    return flusher, true
+}
+
+func writeKeepalive(resp http.ResponseWriter) bool {
+    _, err := io.WriteString(resp, ": keepalive\n\n")
+    return err == nil
+}
@@ -0,0 +1,175 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package handler
+
+import (
+    "encoding/json"
+    "fmt"
+    "github.com/xfali/gache/command"
+    "github.com/xfali/gache/internal/auth"
+    "github.com/xfali/gache/internal/watch"
+    "golang.org/x/net/websocket"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// 订阅开始时最后一个事件的版本号
+const HeaderVersion = "X-Gache-Version"
+
+type watchError struct {
+    Type  string `json:"type"`
+    Error string `json:"error"`
+}
+
+// Watch 订阅key的修改：
+//   GET /watch?key=KEY|prefix=PREFIX|glob=PATTERN[&from=VERSION]
+// 默认使用Server-Sent Events，请求带有Upgrade: websocket时使用WebSocket，每条消息为watch.Event的JSON。
+// SSE的id为版本号，重新连接时通过Last-Event-ID或from从之后的版本继续接收，这些事件已经不在缓冲区中时返回410。
+// 每个节点都可以订阅，follower上的事件在日志应用到本节点后发送
+func (handler *Handler) Watch(resp http.ResponseWriter, req *http.Request) {
+    if req.Method != http.MethodGet {
+        resp.WriteHeader(http.StatusMethodNotAllowed)
+        resp.Write([]byte("method not support"))
+        return
+    }
+    if handler.ctx.watch == nil {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte("watch is not enabled"))
+        return
+    }
+
+    query := req.URL.Query()
+    pattern := watch.Pattern{
+        Key:    query.Get("key"),
+        Prefix: query.Get("prefix"),
+        Glob:   query.Get("glob"),
+    }
+    if err := pattern.Validate(); err != nil {
+        resp.WriteHeader(http.StatusBadRequest)
+        resp.Write([]byte(err.Error()))
+        return
+    }
+    from := query.Get("from")
+    if from == "" {
+        from = req.Header.Get("Last-Event-ID")
+    }
+    var version uint64
+    if from != "" {
+        v, err := strconv.ParseUint(from, 10, 64)
+        if err != nil {
+            resp.WriteHeader(http.StatusBadRequest)
+            resp.Write([]byte("invalid version: " + from))
+            return
+        }
+        version = v
+    }
+
+    // 订阅单个key时直接校验，prefix、glob按每个事件的key校验
+    principal := auth.FromContext(req.Context())
+    if pattern.Key != "" && !handler.ctx.Authorized(principal, command.GET, pattern.Key) {
+        resp.WriteHeader(http.StatusForbidden)
+        resp.Write([]byte("permission denied"))
+        return
+    }
+    allowed := func(ev *watch.Event) bool {
+        return handler.ctx.Authorized(principal, command.GET, ev.Key)
+    }
+
+    w, err := handler.ctx.watch.Watch(pattern, version)
+    if err != nil {
+        if _, ok := err.(*watch.CompactedError); ok {
+            resp.WriteHeader(http.StatusGone)
+        } else {
+            resp.WriteHeader(http.StatusBadRequest)
+        }
+        resp.Write([]byte(err.Error()))
+        return
+    }
+    defer w.Close()
+
+    resp.Header().Set(HeaderVersion, strconv.FormatUint(w.Start, 10))
+    if strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+        s := websocket.Server{
+            // 已经通过认证，不校验Origin
+            Handshake: func(*websocket.Config, *http.Request) error { return nil },
+            Handler: func(ws *websocket.Conn) {
+                handler.watchWebSocket(ws, w, allowed)
+            },
+        }
+        s.ServeHTTP(resp, req)
+        return
+    }
+    handler.watchSSE(resp, req, w, allowed)
+}
+
+func (handler *Handler) watchSSE(resp http.ResponseWriter, req *http.Request, w *watch.Watcher, allowed func(*watch.Event) bool) {
+    flusher, ok := handler.startSSE(resp)
+    if !ok {
+        return
+    }
+    keepalive := time.NewTicker(sseKeepalive)
+    defer keepalive.Stop()
+    for {
+        select {
+        case ev := <-w.Events():
+            if !allowed(&ev) {
+                continue
+            }
+            b, _ := json.Marshal(ev)
+            if _, err := fmt.Fprintf(resp, "id: %d\nevent: %s\ndata: %s\n\n", ev.Version, ev.Type, b); err != nil {
+                return
+            }
+        case <-keepalive.C:
+            if !writeKeepalive(resp) {
+                return
+            }
+        case <-w.Done():
+            if err := w.Err(); err != nil {
+                fmt.Fprintf(resp, "event: error\ndata: %s\n\n", err.Error())
+                flusher.Flush()
+            }
+            return
+        case <-req.Context().Done():
+            return
+        }
+        flusher.Flush()
+    }
+}
+
+func (handler *Handler) watchWebSocket(ws *websocket.Conn, w *watch.Watcher, allowed func(*watch.Event) bool) {
+    defer ws.Close()
+    ws.SetDeadline(time.Time{})
+
+    // 客户端不发送数据，读取只用于发现连接断开
+    closed := make(chan struct{})
+    go func() {
+        io.Copy(ioutil.Discard, ws)
+        close(closed)
+    }()
+    for {
+        select {
+        case ev := <-w.Events():
+            if !allowed(&ev) {
+                continue
+            }
+            if err := websocket.JSON.Send(ws, ev); err != nil {
+                return
+            }
+        case <-w.Done():
+            if err := w.Err(); err != nil {
+                websocket.JSON.Send(ws, watchError{Type: "error", Error: err.Error()})
+            }
+            return
+        case <-closed:
+            return
+        }
+    }
+}
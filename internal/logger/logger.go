@@ -0,0 +1,36 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package logger
+
+import (
+    "github.com/hashicorp/go-hclog"
+    "github.com/xfali/gache/config"
+    "io"
+    "log"
+    "os"
+)
+
+// 所有组件共用同一个根logger，通过Named区分组件；子logger共享日志级别，
+// 因此在根logger上SetLevel即可在运行时调整全部组件的级别
+func New(conf *config.Config) hclog.Logger {
+    return NewWithOutput(conf, os.Stderr)
+}
+
+func NewWithOutput(conf *config.Config, output io.Writer) hclog.Logger {
+    return hclog.New(&hclog.LoggerOptions{
+        Name:       "gache",
+        Level:      hclog.LevelFromString(conf.LogLevel),
+        Output:     output,
+        JSONFormat: conf.LogFormat == "json",
+    })
+}
+
+// 用于只接受标准库log.Logger的组件（memberlist、raft transport等），
+// 根据日志中的[DEBUG]、[WARN]等前缀推断级别
+func Std(l hclog.Logger) *log.Logger {
+    return l.StandardLogger(&hclog.StandardLoggerOptions{InferLevels: true})
+}
@@ -0,0 +1,268 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package metrics
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "math"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+var DefBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Collector 以Prometheus文本格式输出指标
+type Collector interface {
+    Collect(w io.Writer)
+}
+
+type Registry struct {
+    mu         sync.Mutex
+    collectors []Collector
+}
+
+func NewRegistry() *Registry {
+    return &Registry{}
+}
+
+func (r *Registry) Register(c Collector) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    r.collectors = append(r.collectors, c)
+}
+
+func (r *Registry) Collect(w io.Writer) {
+    r.mu.Lock()
+    collectors := make([]Collector, len(r.collectors))
+    copy(collectors, r.collectors)
+    r.mu.Unlock()
+
+    for _, c := range collectors {
+        c.Collect(w)
+    }
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+    c := &CounterVec{
+        desc:   desc{name: name, help: help, labels: labels},
+        values: map[string]*Counter{},
+    }
+    r.Register(c)
+    return c
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+    h := &HistogramVec{
+        desc:    desc{name: name, help: help, labels: labels},
+        buckets: buckets,
+        values:  map[string]*Histogram{},
+    }
+    r.Register(h)
+    return h
+}
+
+func (r *Registry) NewGaugeFunc(name, help string, f func() float64) {
+    r.Register(&gaugeFunc{desc: desc{name: name, help: help}, f: f})
+}
+
+func Handler(regs ...*Registry) http.Handler {
+    return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+        resp.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+        w := bufio.NewWriter(resp)
+        for _, r := range regs {
+            r.Collect(w)
+        }
+        w.Flush()
+    })
+}
+
+type desc struct {
+    name   string
+    help   string
+    labels []string
+}
+
+func (d *desc) header(w io.Writer, typ string) {
+    fmt.Fprintf(w, "# HELP %s %s\n", d.name, d.help)
+    fmt.Fprintf(w, "# TYPE %s %s\n", d.name, typ)
+}
+
+func (d *desc) labelPairs(values []string, extra ...string) string {
+    pairs := make([]string, 0, len(values)+1)
+    for i := range values {
+        pairs = append(pairs, d.labels[i]+`="`+labelEscaper.Replace(values[i])+`"`)
+    }
+    if len(extra) == 2 {
+        pairs = append(pairs, extra[0]+`="`+labelEscaper.Replace(extra[1])+`"`)
+    }
+    if len(pairs) == 0 {
+        return ""
+    }
+    return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labelKey(values []string) string {
+    return strings.Join(values, "\xff")
+}
+
+func formatFloat(v float64) string {
+    if math.IsInf(v, 1) {
+        return "+Inf"
+    }
+    return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type Counter struct {
+    mu     sync.Mutex
+    labels []string
+    v      float64
+}
+
+func (c *Counter) Inc() {
+    c.Add(1)
+}
+
+func (c *Counter) Add(v float64) {
+    c.mu.Lock()
+    c.v += v
+    c.mu.Unlock()
+}
+
+func (c *Counter) Value() float64 {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.v
+}
+
+type CounterVec struct {
+    desc
+    mu     sync.Mutex
+    values map[string]*Counter
+}
+
+func (c *CounterVec) With(labels ...string) *Counter {
+    key := labelKey(labels)
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    v, ok := c.values[key]
+    if !ok {
+        v = &Counter{labels: labels}
+        c.values[key] = v
+    }
+    return v
+}
+
+func (c *CounterVec) Collect(w io.Writer) {
+    c.header(w, "counter")
+    for _, v := range c.sorted() {
+        fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelPairs(v.labels), formatFloat(v.Value()))
+    }
+}
+
+func (c *CounterVec) sorted() []*Counter {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    keys := make([]string, 0, len(c.values))
+    for k := range c.values {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    ret := make([]*Counter, len(keys))
+    for i, k := range keys {
+        ret[i] = c.values[k]
+    }
+    return ret
+}
+
+type Histogram struct {
+    mu      sync.Mutex
+    labels  []string
+    buckets []float64
+    counts  []uint64
+    sum     float64
+    count   uint64
+}
+
+func (h *Histogram) Observe(v float64) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    for i, b := range h.buckets {
+        if v <= b {
+            h.counts[i]++
+        }
+    }
+    h.sum += v
+    h.count++
+}
+
+type HistogramVec struct {
+    desc
+    buckets []float64
+    mu      sync.Mutex
+    values  map[string]*Histogram
+}
+
+func (h *HistogramVec) With(labels ...string) *Histogram {
+    key := labelKey(labels)
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    v, ok := h.values[key]
+    if !ok {
+        v = &Histogram{labels: labels, buckets: h.buckets, counts: make([]uint64, len(h.buckets))}
+        h.values[key] = v
+    }
+    return v
+}
+
+func (h *HistogramVec) Collect(w io.Writer) {
+    h.header(w, "histogram")
+
+    h.mu.Lock()
+    keys := make([]string, 0, len(h.values))
+    for k := range h.values {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    values := make([]*Histogram, len(keys))
+    for i, k := range keys {
+        values[i] = h.values[k]
+    }
+    h.mu.Unlock()
+
+    for _, v := range values {
+        v.mu.Lock()
+        for i, b := range v.buckets {
+            fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(v.labels, "le", formatFloat(b)), v.counts[i])
+        }
+        fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(v.labels, "le", "+Inf"), v.count)
+        fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelPairs(v.labels), formatFloat(v.sum))
+        fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelPairs(v.labels), v.count)
+        v.mu.Unlock()
+    }
+}
+
+type gaugeFunc struct {
+    desc
+    f func() float64
+}
+
+func (g *gaugeFunc) Collect(w io.Writer) {
+    g.header(w, "gauge")
+    fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.f()))
+}
@@ -0,0 +1,138 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package metrics
+
+import (
+    "bytes"
+    "io/ioutil"
+    "net/http/httptest"
+    "testing"
+)
+
+func collect(r *Registry) string {
+    buf := &bytes.Buffer{}
+    r.Collect(buf)
+    return buf.String()
+}
+
+func TestExposition(t *testing.T) {
+    cases := []struct {
+        name   string
+        setup  func(r *Registry)
+        expect string
+    }{
+        {
+            name: "counter",
+            setup: func(r *Registry) {
+                c := r.NewCounterVec("req_total", "Requests.", "method", "code")
+                c.With("PUT", "200").Add(2)
+                c.With("GET", "200").Inc()
+            },
+            expect: "# HELP req_total Requests.\n" +
+                "# TYPE req_total counter\n" +
+                "req_total{method=\"GET\",code=\"200\"} 1\n" +
+                "req_total{method=\"PUT\",code=\"200\"} 2\n",
+        },
+        {
+            name: "counter without values",
+            setup: func(r *Registry) {
+                r.NewCounterVec("empty_total", "Empty.", "cmd")
+            },
+            expect: "# HELP empty_total Empty.\n" +
+                "# TYPE empty_total counter\n",
+        },
+        {
+            name: "label escaping",
+            setup: func(r *Registry) {
+                r.NewCounterVec("esc_total", "Escaped.", "key").With("a\"b\\c\nd").Inc()
+            },
+            expect: "# HELP esc_total Escaped.\n" +
+                "# TYPE esc_total counter\n" +
+                "esc_total{key=\"a\\\"b\\\\c\\nd\"} 1\n",
+        },
+        {
+            name: "histogram",
+            setup: func(r *Registry) {
+                h := r.NewHistogramVec("lat_seconds", "Latency.", []float64{0.1, 1}, "cmd")
+                h.With("get").Observe(0.05)
+                h.With("get").Observe(0.5)
+                h.With("get").Observe(2)
+            },
+            expect: "# HELP lat_seconds Latency.\n" +
+                "# TYPE lat_seconds histogram\n" +
+                "lat_seconds_bucket{cmd=\"get\",le=\"0.1\"} 1\n" +
+                "lat_seconds_bucket{cmd=\"get\",le=\"1\"} 2\n" +
+                "lat_seconds_bucket{cmd=\"get\",le=\"+Inf\"} 3\n" +
+                "lat_seconds_sum{cmd=\"get\"} 2.55\n" +
+                "lat_seconds_count{cmd=\"get\"} 3\n",
+        },
+        {
+            name: "histogram without labels",
+            setup: func(r *Registry) {
+                r.NewHistogramVec("size", "Size.", []float64{1}).With().Observe(1)
+            },
+            expect: "# HELP size Size.\n" +
+                "# TYPE size histogram\n" +
+                "size_bucket{le=\"1\"} 1\n" +
+                "size_bucket{le=\"+Inf\"} 1\n" +
+                "size_sum 1\n" +
+                "size_count 1\n",
+        },
+        {
+            name: "gauge",
+            setup: func(r *Registry) {
+                r.NewGaugeFunc("keys", "Keys.", func() float64 { return 42 })
+            },
+            expect: "# HELP keys Keys.\n" +
+                "# TYPE keys gauge\n" +
+                "keys 42\n",
+        },
+    }
+    for _, c := range cases {
+        r := NewRegistry()
+        c.setup(r)
+        if got := collect(r); got != c.expect {
+            t.Errorf("%s:\n%s\nwant:\n%s", c.name, got, c.expect)
+        }
+    }
+}
+
+// 不同的Registry互不影响，同一进程中的多个节点各自计数
+func TestRegistryIsolation(t *testing.T) {
+    r1, r2 := NewRegistry(), NewRegistry()
+    c1 := r1.NewCounterVec("cmd_total", "Commands.", "cmd")
+    c2 := r2.NewCounterVec("cmd_total", "Commands.", "cmd")
+    c1.With("set").Add(3)
+    c2.With("set").Inc()
+
+    if v := c1.With("set").Value(); v != 3 {
+        t.Fatalf("r1 %v", v)
+    }
+    if v := c2.With("set").Value(); v != 1 {
+        t.Fatalf("r2 %v", v)
+    }
+    if s := collect(r2); !bytes.Contains([]byte(s), []byte("cmd_total{cmd=\"set\"} 1\n")) {
+        t.Fatalf("r2 output:\n%s", s)
+    }
+}
+
+func TestHandler(t *testing.T) {
+    r1, r2 := NewRegistry(), NewRegistry()
+    r1.NewGaugeFunc("a", "A.", func() float64 { return 1 })
+    r2.NewGaugeFunc("b", "B.", func() float64 { return 2 })
+
+    rec := httptest.NewRecorder()
+    Handler(r1, r2).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+    if ct := rec.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+        t.Fatalf("content type %q", ct)
+    }
+    body, _ := ioutil.ReadAll(rec.Body)
+    expect := "# HELP a A.\n# TYPE a gauge\na 1\n# HELP b B.\n# TYPE b gauge\nb 2\n"
+    if string(body) != expect {
+        t.Fatalf("body:\n%s", body)
+    }
+}
@@ -0,0 +1,171 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+// Package pubsub 频道消息的发布与订阅。PUBLISH作为raft日志复制，每个节点应用日志时
+// 把消息发送给本节点的订阅者，所以订阅者可以连接任意副本。消息不保存，订阅之前以及
+// 通过快照追赶的节点上的消息不会收到，节点重启时重新应用的本地日志中的消息也不会再次发送
+package pubsub
+
+import (
+    "errors"
+    "github.com/xfali/gache/command"
+    "github.com/xfali/gache/internal/utils"
+    "sync"
+)
+
+// 每个订阅者最多缓存的消息数
+const subscriberBuffer = 1024
+
+var (
+    ErrNoChannel = errors.New("at least one channel or pattern is required")
+    // 订阅者处理太慢，缓冲区已满
+    ErrOverflow = errors.New("subscriber overflow")
+)
+
+type Message struct {
+    Channel string `json:"channel"`
+    // 通过PSUBSCRIBE收到时为匹配的模式
+    Pattern string `json:"pattern,omitempty"`
+    Data    string `json:"data"`
+}
+
+type Subscriber struct {
+    broker   *Broker
+    channels map[string]bool
+    patterns []string
+    ch       chan Message
+    done     chan struct{}
+    err      error
+}
+
+func (s *Subscriber) Messages() <-chan Message {
+    return s.ch
+}
+
+func (s *Subscriber) Done() <-chan struct{} {
+    return s.done
+}
+
+// Err Done关闭的原因，调用Close时为nil
+func (s *Subscriber) Err() error {
+    s.broker.mu.Lock()
+    defer s.broker.mu.Unlock()
+    return s.err
+}
+
+// Update 修改订阅的频道与模式，用于在同一个连接上继续SUBSCRIBE、UNSUBSCRIBE。
+// 已经收到的消息不变，之后按新的频道与模式发送
+func (s *Subscriber) Update(channels, patterns []string) {
+    s.broker.mu.Lock()
+    defer s.broker.mu.Unlock()
+
+    s.channels = map[string]bool{}
+    for _, c := range channels {
+        s.channels[c] = true
+    }
+    s.patterns = patterns
+}
+
+func (s *Subscriber) Close() {
+    s.broker.mu.Lock()
+    defer s.broker.mu.Unlock()
+    s.broker.remove(s, nil)
+}
+
+type Broker struct {
+    mu   sync.Mutex
+    subs map[*Subscriber]bool
+}
+
+func NewBroker() *Broker {
+    return &Broker{
+        subs: map[*Subscriber]bool{},
+    }
+}
+
+// Subscribe 订阅channels中的频道（SUBSCRIBE）以及匹配patterns（glob）的频道（PSUBSCRIBE）
+func (b *Broker) Subscribe(channels, patterns []string) (*Subscriber, error) {
+    if len(channels) == 0 && len(patterns) == 0 {
+        return nil, ErrNoChannel
+    }
+    s := &Subscriber{
+        broker:   b,
+        channels: map[string]bool{},
+        patterns: patterns,
+        ch:       make(chan Message, subscriberBuffer),
+        done:     make(chan struct{}),
+    }
+    for _, c := range channels {
+        s.channels[c] = true
+    }
+
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    b.subs[s] = true
+    return s, nil
+}
+
+// Process 应用日志时调用，PUBLISH命令发送给本节点的订阅者，返回收到消息的订阅者数。b为nil时忽略
+func (b *Broker) Process(req *command.Request) int {
+    if b == nil || req.Cmd != command.PUBLISH {
+        return 0
+    }
+    return b.Publish(req.K, req.V)
+}
+
+// Publish 发送给本节点的订阅者，返回收到消息的订阅者数。
+// 与redis相同，同时订阅了频道和匹配的模式时会收到多次
+func (b *Broker) Publish(channel, data string) int {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    n := 0
+    for s := range b.subs {
+        if s.channels[channel] {
+            if !b.send(s, Message{Channel: channel, Data: data}) {
+                continue
+            }
+            n++
+        }
+        for _, p := range s.patterns {
+            if utils.MatchGlob(p, channel) {
+                if !b.send(s, Message{Channel: channel, Pattern: p, Data: data}) {
+                    break
+                }
+                n++
+            }
+        }
+    }
+    return n
+}
+
+// 需要持有b.mu，订阅者已满时移除并返回false
+func (b *Broker) send(s *Subscriber, msg Message) bool {
+    select {
+    case s.ch <- msg:
+        return true
+    default:
+        b.remove(s, ErrOverflow)
+        return false
+    }
+}
+
+// 需要持有b.mu
+func (b *Broker) remove(s *Subscriber, err error) {
+    if !b.subs[s] {
+        return
+    }
+    delete(b.subs, s)
+    s.err = err
+    close(s.done)
+}
+
+// Subscribers 当前的订阅者数
+func (b *Broker) Subscribers() int {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    return len(b.subs)
+}
@@ -0,0 +1,193 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+// Package replicator 异步跨集群复制：在源集群的leader上读取CDC记录，通过API写入目标集群。
+// 已经写入目标集群的最后一条记录的index作为CDC消费者的offset提交到源集群（随raft持久化），
+// leader切换或者重启后从offset之后继续，记录至少写入一次
+package replicator
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "github.com/hashicorp/go-hclog"
+    "github.com/xfali/gache/client"
+    "github.com/xfali/gache/internal/cdc"
+    "github.com/xfali/gache/internal/metrics"
+    "time"
+)
+
+const (
+    // 按源集群的修改时间写入，目标集群中的修改时间更晚时保留目标集群的值
+    LastWriterWins = "lww"
+    // 总是使用源集群的值覆盖目标集群
+    SourceWins = "source-wins"
+
+    batchSize = 100
+    readWait  = time.Second
+    // 不是leader或者写入失败后重试的间隔
+    retryInterval = time.Second
+)
+
+var errNotLeader = errors.New("not leader")
+
+// Source 源集群中保存offset的节点
+type Source interface {
+    IsLeader() bool
+    Offset(consumer string) uint64
+    CommitOffset(consumer string, offset uint64) error
+}
+
+type Options struct {
+    // 提交offset时使用的消费者名
+    Name   string
+    Policy string
+    Log    *cdc.Log
+    Source Source
+    // 目标集群的客户端
+    Client *client.Client
+    Logger hclog.Logger
+    // 注册复制相关的指标
+    Metrics *metrics.Registry
+}
+
+type Replicator struct {
+    opts    Options
+    logger  hclog.Logger
+    records *metrics.CounterVec
+
+    cancel context.CancelFunc
+    done   chan struct{}
+}
+
+func New(opts Options) (*Replicator, error) {
+    if opts.Policy != LastWriterWins && opts.Policy != SourceWins {
+        return nil, fmt.Errorf("unknown replication policy: %s", opts.Policy)
+    }
+    reg := opts.Metrics
+    if reg == nil {
+        reg = metrics.NewRegistry()
+    }
+    r := &Replicator{
+        opts:   opts,
+        logger: opts.Logger.Named("replicator"),
+        records: reg.NewCounterVec("gache_replication_records_total",
+            "Number of CDC records replicated to the remote cluster by result.", "result"),
+        done: make(chan struct{}),
+    }
+    r.registerMetrics(reg)
+    return r, nil
+}
+
+func (r *Replicator) Start() {
+    ctx, cancel := context.WithCancel(context.Background())
+    r.cancel = cancel
+    r.logger.Info("replicator started", "name", r.opts.Name, "policy", r.opts.Policy)
+    go r.run(ctx)
+}
+
+func (r *Replicator) run(ctx context.Context) {
+    defer close(r.done)
+    for {
+        if err := r.step(ctx); err == nil {
+            continue
+        } else if ctx.Err() != nil {
+            return
+        } else if err != errNotLeader {
+            r.logger.Error("replicate failed", "error", err)
+        }
+        select {
+        case <-time.After(retryInterval):
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+// 读取并写入一批记录，全部写入后提交offset
+func (r *Replicator) step(ctx context.Context) error {
+    if !r.opts.Source.IsLeader() {
+        return errNotLeader
+    }
+    offset := r.opts.Source.Offset(r.opts.Name)
+    recs, _, err := r.opts.Log.Read(ctx, offset, batchSize, readWait)
+    if ce, ok := err.(*cdc.CompactedError); ok {
+        // 复制太慢或者leader刚从快照恢复，中间的修改无法复制
+        r.logger.Error("replication records lost", "offset", offset, "available", ce.Oldest)
+        return r.opts.Source.CommitOffset(r.opts.Name, ce.Oldest)
+    }
+    if err != nil || len(recs) == 0 {
+        return err
+    }
+    for i := range recs {
+        if err := r.apply(ctx, &recs[i]); err != nil {
+            r.records.With("failed").Inc()
+            return err
+        }
+    }
+    return r.opts.Source.CommitOffset(r.opts.Name, recs[len(recs)-1].Index)
+}
+
+func (r *Replicator) apply(ctx context.Context, rec *cdc.Record) error {
+    cli := r.opts.Client
+    if r.opts.Policy == SourceWins {
+        var err error
+        if rec.Op == cdc.Set {
+            err = cli.Set(ctx, rec.Key, rec.Value)
+        } else {
+            err = cli.Delete(ctx, rec.Key)
+        }
+        if err == nil {
+            r.records.With("applied").Inc()
+        }
+        return err
+    }
+
+    var applied bool
+    var err error
+    if rec.Op == cdc.Set {
+        applied, err = cli.SetAt(ctx, rec.Key, rec.Value, rec.Time)
+    } else {
+        applied, err = cli.DeleteAt(ctx, rec.Key, rec.Time)
+    }
+    if err != nil {
+        return err
+    }
+    if applied {
+        r.records.With("applied").Inc()
+    } else {
+        r.records.With("conflict").Inc()
+    }
+    return nil
+}
+
+// 注册复制进度相关的指标
+func (r *Replicator) registerMetrics(reg *metrics.Registry) {
+    reg.NewGaugeFunc("gache_replication_checkpoint", "Last CDC index replicated to the remote cluster.", func() float64 {
+        return float64(r.opts.Source.Offset(r.opts.Name))
+    })
+    reg.NewGaugeFunc("gache_replication_lag_records", "Number of CDC records not yet replicated.", func() float64 {
+        n, _ := r.opts.Log.Pending(r.opts.Source.Offset(r.opts.Name))
+        return float64(n)
+    })
+    reg.NewGaugeFunc("gache_replication_lag_seconds", "Age of the oldest CDC record not yet replicated.", func() float64 {
+        n, oldest := r.opts.Log.Pending(r.opts.Source.Offset(r.opts.Name))
+        if n == 0 {
+            return 0
+        }
+        return time.Since(oldest).Seconds()
+    })
+}
+
+func (r *Replicator) Close() error {
+    if r.cancel == nil {
+        return nil
+    }
+    r.cancel()
+    <-r.done
+    r.opts.Client.Close()
+    return nil
+}
@@ -0,0 +1,163 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+// Package resp redis协议（RESP2）的编解码。请求为bulk string数组或以空白分隔的inline命令
+package resp
+
+import (
+    "bufio"
+    "errors"
+    "io"
+    "strconv"
+    "strings"
+)
+
+const (
+    // 与redis的proto-max-bulk-len相同
+    maxBulkLen = 512 << 20
+    maxArgs    = 1 << 20
+    // inline命令以及数组、bulk string头部的最大长度
+    maxLineLen = 64 << 10
+)
+
+var ErrProtocol = errors.New("protocol error")
+
+type Reader struct {
+    r *bufio.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+    return &Reader{r: bufio.NewReader(r)}
+}
+
+// ReadCommand 读取一条命令，忽略空行。格式错误时返回ErrProtocol，之后连接应当关闭
+func (r *Reader) ReadCommand() ([]string, error) {
+    for {
+        line, err := r.readLine()
+        if err != nil {
+            return nil, err
+        }
+        if len(line) == 0 {
+            continue
+        }
+        if line[0] != '*' {
+            if args := strings.Fields(line); len(args) > 0 {
+                return args, nil
+            }
+            continue
+        }
+        n, err := parseLen(line[1:], maxArgs)
+        if err != nil {
+            return nil, err
+        }
+        if n <= 0 {
+            continue
+        }
+        args := make([]string, n)
+        for i := range args {
+            if args[i], err = r.readBulk(); err != nil {
+                return nil, err
+            }
+        }
+        return args, nil
+    }
+}
+
+func (r *Reader) readBulk() (string, error) {
+    line, err := r.readLine()
+    if err != nil {
+        return "", err
+    }
+    if len(line) == 0 || line[0] != '$' {
+        return "", ErrProtocol
+    }
+    n, err := parseLen(line[1:], maxBulkLen)
+    if err != nil || n < 0 {
+        return "", ErrProtocol
+    }
+    b := make([]byte, n+2)
+    if _, err := io.ReadFull(r.r, b); err != nil {
+        return "", err
+    }
+    if b[n] != '\r' || b[n+1] != '\n' {
+        return "", ErrProtocol
+    }
+    return string(b[:n]), nil
+}
+
+// 读取一行并去掉结尾的\r\n（inline命令可以只有\n）
+func (r *Reader) readLine() (string, error) {
+    var line []byte
+    for {
+        b, isPrefix, err := r.r.ReadLine()
+        if err != nil {
+            return "", err
+        }
+        line = append(line, b...)
+        if len(line) > maxLineLen {
+            return "", ErrProtocol
+        }
+        if !isPrefix {
+            return string(line), nil
+        }
+    }
+}
+
+func parseLen(s string, max int) (int, error) {
+    n, err := strconv.Atoi(s)
+    if err != nil || n > max {
+        return 0, ErrProtocol
+    }
+    return n, nil
+}
+
+// Writer 写入回复，调用Flush后发送
+type Writer struct {
+    w *bufio.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+    return &Writer{w: bufio.NewWriter(w)}
+}
+
+// WriteSimple 简单字符串，如OK、PONG，不能包含\r\n
+func (w *Writer) WriteSimple(s string) error {
+    return w.line('+', s)
+}
+
+// WriteError 错误，s以错误类型开头，如"ERR unknown command"
+func (w *Writer) WriteError(s string) error {
+    return w.line('-', strings.NewReplacer("\r", " ", "\n", " ").Replace(s))
+}
+
+func (w *Writer) WriteInt(n int64) error {
+    return w.line(':', strconv.FormatInt(n, 10))
+}
+
+func (w *Writer) WriteBulk(s string) error {
+    if err := w.line('$', strconv.Itoa(len(s))); err != nil {
+        return err
+    }
+    w.w.WriteString(s)
+    _, err := w.w.WriteString("\r\n")
+    return err
+}
+
+// WriteArray 数组的头部，之后写入n个元素
+func (w *Writer) WriteArray(n int) error {
+    return w.line('*', strconv.Itoa(n))
+}
+
+func (w *Writer) Flush() error {
+    return w.w.Flush()
+}
+
+func (w *Writer) line(prefix byte, s string) error {
+    w.w.WriteByte(prefix)
+    w.w.WriteString(s)
+    _, err := w.w.WriteString("\r\n")
+    return err
+}
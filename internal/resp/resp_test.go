@@ -0,0 +1,73 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package resp
+
+import (
+    "bytes"
+    "io"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestReadCommand(t *testing.T) {
+    cases := []struct {
+        in   string
+        cmds [][]string
+        err  error
+    }{
+        {"*2\r\n$9\r\nSUBSCRIBE\r\n$2\r\nch\r\n", [][]string{{"SUBSCRIBE", "ch"}}, io.EOF},
+        {"*3\r\n$7\r\nPUBLISH\r\n$2\r\nch\r\n$4\r\na\r\nb\r\n", [][]string{{"PUBLISH", "ch", "a\r\nb"}}, io.EOF},
+        {"*2\r\n$4\r\nECHO\r\n$0\r\n\r\n", [][]string{{"ECHO", ""}}, io.EOF},
+        {"PING\r\nsubscribe  a\tb\n", [][]string{{"PING"}, {"subscribe", "a", "b"}}, io.EOF},
+        {"\r\n*0\r\n*-1\r\nPING\r\n", [][]string{{"PING"}}, io.EOF},
+        {"*1\r\n+PING\r\n", nil, ErrProtocol},
+        {"*x\r\n", nil, ErrProtocol},
+        {"*1\r\n$-1\r\n", nil, ErrProtocol},
+        {"*1\r\n$2\r\nabc\r\n", nil, ErrProtocol},
+        {"*1\r\n$600000000\r\n", nil, ErrProtocol},
+        {"*2\r\n$4\r\nPING\r\n", [][]string{}, io.EOF},
+        {"*1\r\n$4\r\nPI", [][]string{}, io.ErrUnexpectedEOF},
+        {strings.Repeat("a", maxLineLen+1) + "\r\n", nil, ErrProtocol},
+    }
+    for _, c := range cases {
+        r := NewReader(strings.NewReader(c.in))
+        var cmds [][]string
+        var err error
+        for {
+            var args []string
+            if args, err = r.ReadCommand(); err != nil {
+                break
+            }
+            cmds = append(cmds, args)
+        }
+        if err != c.err || len(cmds) != len(c.cmds) || (len(cmds) > 0 && !reflect.DeepEqual(cmds, c.cmds)) {
+            t.Errorf("%q: %q %v, want %q %v", c.in, cmds, err, c.cmds, c.err)
+        }
+    }
+}
+
+func TestWriter(t *testing.T) {
+    buf := &bytes.Buffer{}
+    w := NewWriter(buf)
+    w.WriteSimple("OK")
+    w.WriteError("ERR bad\r\nline")
+    w.WriteInt(-3)
+    w.WriteArray(2)
+    w.WriteBulk("a\r\nb")
+    w.WriteBulk("")
+    if buf.Len() != 0 {
+        t.Fatal("written before Flush")
+    }
+    if err := w.Flush(); err != nil {
+        t.Fatal(err)
+    }
+    expect := "+OK\r\n-ERR bad  line\r\n:-3\r\n*2\r\n$4\r\na\r\nb\r\n$0\r\n\r\n"
+    if buf.String() != expect {
+        t.Fatalf("%q, want %q", buf.String(), expect)
+    }
+}
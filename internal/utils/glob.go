@@ -0,0 +1,32 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package utils
+
+// MatchGlob 简单的通配符匹配：* 匹配任意长度（包括"/"）的字符串，? 匹配单个字符
+func MatchGlob(pattern, s string) bool {
+    p, i := 0, 0
+    starP, starI := -1, 0
+    for i < len(s) {
+        if p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]) {
+            p++
+            i++
+        } else if p < len(pattern) && pattern[p] == '*' {
+            starP, starI = p, i
+            p++
+        } else if starP >= 0 {
+            p = starP + 1
+            starI++
+            i = starI
+        } else {
+            return false
+        }
+    }
+    for p < len(pattern) && pattern[p] == '*' {
+        p++
+    }
+    return p == len(pattern)
+}
@@ -0,0 +1,19 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package utils
+
+import "hash/crc32"
+
+const SlotCount = 16384
+
+var CRC32Q = crc32.MakeTable(0xD5828281)
+
+// CalcSlot 计算key所在的slot，服务端与客户端使用相同的算法
+func CalcSlot(key string) uint32 {
+    sum := crc32.Checksum([]byte(key), CRC32Q)
+    return sum % SlotCount
+}
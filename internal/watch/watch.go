@@ -0,0 +1,263 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+// Package watch 将key的修改通知给订阅者。每个节点应用raft日志时产生事件，
+// 最近的事件保存在环形缓冲区中，重新连接的订阅者可以从指定的版本号继续接收
+package watch
+
+import (
+    "errors"
+    "fmt"
+    "github.com/xfali/gache/command"
+    "github.com/xfali/gache/db"
+    "github.com/xfali/gache/internal/utils"
+    "strings"
+    "sync"
+)
+
+const (
+    Set    = "set"
+    Delete = "delete"
+    // 临时key因会话过期或关闭被删除（EPHEMERAL_DEL），或者超过max-memory被淘汰（EVICT）
+    Expire = "expire"
+)
+
+var (
+    // 订阅者处理太慢，缓冲区已满
+    ErrOverflow = errors.New("watcher overflow")
+    // 从快照恢复，之前的事件不再连续
+    ErrReset = errors.New("watch reset by snapshot restore")
+)
+
+// 订阅者最少可以缓存的事件数
+const minWatcherBuffer = 256
+
+type Event struct {
+    // 修改后db的版本号
+    Version uint64 `json:"version"`
+    Type    string `json:"type"`
+    Key     string `json:"key"`
+    Value   string `json:"value,omitempty"`
+}
+
+// CompactedError 请求的版本号之后的事件已经不在缓冲区中
+type CompactedError struct {
+    Oldest uint64
+}
+
+func (e *CompactedError) Error() string {
+    return fmt.Sprintf("version compacted, oldest available %d", e.Oldest)
+}
+
+// Pattern 匹配key的方式，Key、Prefix、Glob只能设置一个
+type Pattern struct {
+    Key    string
+    Prefix string
+    Glob   string
+}
+
+func (p *Pattern) Validate() error {
+    n := 0
+    for _, v := range []string{p.Key, p.Prefix, p.Glob} {
+        if v != "" {
+            n++
+        }
+    }
+    if n != 1 {
+        return errors.New("exactly one of key, prefix and glob is required")
+    }
+    return nil
+}
+
+func (p *Pattern) Match(key string) bool {
+    switch {
+    case p.Key != "":
+        return key == p.Key
+    case p.Prefix != "":
+        return strings.HasPrefix(key, p.Prefix)
+    default:
+        return utils.MatchGlob(p.Glob, key)
+    }
+}
+
+type Watcher struct {
+    // 订阅时最后一个事件的版本号，之后的事件都会发送给订阅者
+    Start uint64
+
+    hub     *Hub
+    pattern Pattern
+    ch      chan Event
+    done    chan struct{}
+    err     error
+}
+
+// Events 按版本号顺序的事件，Done关闭后停止
+func (w *Watcher) Events() <-chan Event {
+    return w.ch
+}
+
+func (w *Watcher) Done() <-chan struct{} {
+    return w.done
+}
+
+// Err Done关闭的原因，调用Close时为nil
+func (w *Watcher) Err() error {
+    w.hub.mu.Lock()
+    defer w.hub.mu.Unlock()
+    return w.err
+}
+
+func (w *Watcher) Close() {
+    w.hub.mu.Lock()
+    defer w.hub.mu.Unlock()
+    w.hub.remove(w, nil)
+}
+
+type Hub struct {
+    mu       sync.Mutex
+    last     uint64
+    buf      []Event
+    start    int
+    size     int
+    watchers map[*Watcher]bool
+
+    // 单机模式下串行执行写命令，保证事件与版本号一致
+    process sync.Mutex
+}
+
+// NewHub 最多保留size个最近的事件，version为db当前的版本号
+func NewHub(size int, version uint64) *Hub {
+    return &Hub{
+        last:     version,
+        buf:      make([]Event, size),
+        watchers: map[*Watcher]bool{},
+    }
+}
+
+// Process 执行命令，修改了key时通知订阅者。h为nil时只执行命令
+func (h *Hub) Process(d *db.GacheDb, req *command.Request) (interface{}, error) {
+    if h == nil || !command.IsWrite(req.Cmd) {
+        return req.Process(d)
+    }
+    h.process.Lock()
+    defer h.process.Unlock()
+
+    version := d.Version()
+    resp, err := req.Process(d)
+    if v := d.Version(); v != version {
+        ev := Event{Version: v, Type: Delete, Key: req.K}
+        if value, ok := d.Lookup(req.K); ok {
+            ev.Type, ev.Value = Set, value
+        } else if req.Cmd == command.EPHEMERAL_DEL || req.Cmd == command.EVICT {
+            ev.Type = Expire
+        }
+        h.Publish(ev)
+    }
+    return resp, err
+}
+
+func (h *Hub) Publish(ev Event) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    h.last = ev.Version
+    if len(h.buf) > 0 {
+        if h.size < len(h.buf) {
+            h.buf[(h.start+h.size)%len(h.buf)] = ev
+            h.size++
+        } else {
+            h.buf[h.start] = ev
+            h.start = (h.start + 1) % len(h.buf)
+        }
+    }
+    for w := range h.watchers {
+        if !w.pattern.Match(ev.Key) {
+            continue
+        }
+        select {
+        case w.ch <- ev:
+        default:
+            h.remove(w, ErrOverflow)
+        }
+    }
+}
+
+// Reset 从快照恢复后调用，清空缓冲区并停止所有订阅者
+func (h *Hub) Reset(version uint64) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    h.last = version
+    h.start, h.size = 0, 0
+    for w := range h.watchers {
+        h.remove(w, ErrReset)
+    }
+}
+
+// Watch 订阅匹配pattern的事件。from为0时只接收之后的事件，
+// 否则先发送缓冲区中版本号大于from的事件，这些事件已经不在缓冲区中时返回CompactedError
+func (h *Hub) Watch(pattern Pattern, from uint64) (*Watcher, error) {
+    if err := pattern.Validate(); err != nil {
+        return nil, err
+    }
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    var replay []Event
+    if from > 0 && from < h.last {
+        // 每次修改版本号加1，缓冲区中的事件是连续的
+        if h.size == 0 || h.buf[h.start].Version > from+1 {
+            oldest := h.last + 1
+            if h.size > 0 {
+                oldest = h.buf[h.start].Version
+            }
+            return nil, &CompactedError{Oldest: oldest}
+        }
+        for i := 0; i < h.size; i++ {
+            ev := h.buf[(h.start+i)%len(h.buf)]
+            if ev.Version > from && pattern.Match(ev.Key) {
+                replay = append(replay, ev)
+            }
+        }
+    }
+
+    w := &Watcher{
+        Start:   h.last,
+        hub:     h,
+        pattern: pattern,
+        ch:      make(chan Event, len(replay)+minWatcherBuffer),
+        done:    make(chan struct{}),
+    }
+    for _, ev := range replay {
+        w.ch <- ev
+    }
+    h.watchers[w] = true
+    return w, nil
+}
+
+// 需要持有h.mu
+func (h *Hub) remove(w *Watcher, err error) {
+    if !h.watchers[w] {
+        return
+    }
+    delete(h.watchers, w)
+    w.err = err
+    close(w.done)
+}
+
+// Version 最后一个事件的版本号
+func (h *Hub) Version() uint64 {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    return h.last
+}
+
+// Watchers 当前的订阅者数
+func (h *Hub) Watchers() int {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    return len(h.watchers)
+}
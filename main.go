@@ -7,118 +7,112 @@
 package main
 
 import (
+    "context"
     "flag"
     "fmt"
-    "gache/cluster"
-    "gache/cluster/gossip"
-    "gache/config"
-    "gache/db"
-    "gache/handler"
-    "log"
-    "net/http"
+    "github.com/hashicorp/go-hclog"
+    "github.com/xfali/gache/config"
+    gachelog "github.com/xfali/gache/internal/logger"
+    "github.com/xfali/gache/server"
     "os"
     "os/signal"
     "syscall"
     "time"
 )
 
+// 等待正在处理的请求完成的最长时间
+const shutdownTimeout = 30 * time.Second
+
 func main() {
-    port := flag.Int("p", 8000, "server port")
-    addr := flag.String("raft-addr", "", "raft tcp address, format: :7000")
-    dir := flag.String("raft-dir", "/tmp", "raft dir")
-    joinAddr := flag.String("raft-join", "", "raft join addr")
-    gossipPort := flag.Int("cluster-port", 9000, "cluster port")
-    gossipMember := flag.String("cluster-members", "", "member list: HOST1:PORT1,HOST2:PORT2,HOST3:PORT3")
-    gossipSlots := flag.String("cluster-slot", "", "Slot: 0-16383")
+    def := config.Default()
+    configFile := flag.String("config", "", "config file (yaml)")
+    printConfig := flag.Bool("print-config", false, "print effective configuration and exit")
+    flag.String("log-level", def.LogLevel, "log level: trace, debug, info, warn, error")
+    flag.String("log-format", def.LogFormat, "log format: text, json")
+    flag.Int("p", def.ApiPort, "server port")
+    flag.Int("resp-port", def.RespPort, "RESP (redis protocol) port for publish/subscribe, 0 to disable")
+    flag.String("raft-addr", def.RaftTcpAddr, "raft tcp address, format: HOST:7000")
+    flag.String("raft-id", def.RaftNodeId, "raft node id, default raft-addr")
+    flag.String("raft-dir", def.RaftDir, "raft dir")
+    flag.String("raft-join", def.RaftJoinAddr, "api address of existing nodes to join: HOST1:PORT1,HOST2:PORT2")
+    flag.String("raft-join-secret", def.RaftJoinSecret, "shared secret to sign join requests")
+    flag.Bool("raft-join-replace", def.RaftJoinReplace, "replace the member that already uses this raft-id or raft-addr when joining")
+    flag.Int("raft-batch", def.RaftMaxBatch, "max commands per raft log entry")
+    flag.Int("raft-inflight", def.RaftMaxInflight, "max raft batches in flight")
+    flag.Int("cluster-port", def.ClusterPort, "cluster port")
+    flag.String("cluster-members", def.ClusterMemebers, "member list: HOST1:PORT1,HOST2:PORT2,HOST3:PORT3")
+    flag.String("cluster-slot", def.ClusterSlot, "Slot: 0-16383")
 
     flag.Parse()
 
-    conf := &config.Config{
-        RaftTcpAddr:  *addr,
-        RaftDir:      *dir,
-        RaftJoinAddr: *joinAddr,
-
-        ClusterPort:     *gossipPort,
-        ClusterMemebers: *gossipMember,
-        ClusterSlot:     *gossipSlots,
-
-        ApiPort: *port,
+    conf, err := loadConfig(*configFile)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(1)
     }
-
-    gacheDb := db.New()
-    notifyCh := make(chan bool, 1)
-    var servers []shutdown
-    var raft cluster.Replication = nil
-    if conf.RaftTcpAddr != "" {
-        r, err := cluster.New(conf, gacheDb, notifyCh)
-        if err != nil {
-            log.Fatal(err)
-        }
-        raft = r
-        servers = append(servers, raft.Shutdown)
+    if *printConfig {
+        conf.Dump(os.Stdout)
+        return
     }
-
-    ctx := handler.NewContext(raft, gacheDb)
-    handler := handler.New(ctx)
-
-    if conf.RaftJoinAddr != "" {
-        cluster.Join(conf)
+    logger := gachelog.New(conf)
+
+    s, err := server.New(conf,
+        server.WithLogger(logger),
+        server.WithConfigLoader(func() (*config.Config, error) {
+            return loadConfig(*configFile)
+        }))
+    if err != nil {
+        logger.Error("create server failed", "error", err)
+        os.Exit(1)
     }
-
-    if conf.ClusterSlot != "" {
-        c, err := gossip.Startup(conf, &gossip.NodeDelegate{
-            Enabled:    true,
-            JoinFunc:   ctx.NodeJoin,
-            LeaveFunc:  ctx.NodeLeave,
-            UpdateFunc: ctx.NodeUpdate,
-        })
-        if err != nil {
-            closeAll(servers)
-            os.Exit(-1)
-        }
-        ctx.SetCluster(conf, c)
-        servers = append(servers, c.Close)
+    if err := s.Start(context.Background()); err != nil {
+        logger.Error("start server failed", "error", err)
+        os.Exit(1)
     }
 
-    http.HandleFunc("/key/", handler.Handle)
-    http.HandleFunc("/join", handler.Join)
-    http.HandleFunc("/cluster", handler.Cluster)
-    //设置访问的ip和端口
-    s := &http.Server{
-        Addr:           fmt.Sprintf(":%d", conf.ApiPort),
-        Handler:        nil,
-        ReadTimeout:    15 * time.Second,
-        WriteTimeout:   15 * time.Second,
-        IdleTimeout:    15 * time.Second,
-        MaxHeaderBytes: 1 << 20,
-    }
-
-    go s.ListenAndServe()
-    servers = append(servers, s.Close)
-
-    handleSignal(servers)
+    handleSignal(s, logger)
 }
 
-type shutdown func() error
+// 配置优先级：默认值 < 配置文件 < 环境变量 < 命令行参数
+func loadConfig(path string) (*config.Config, error) {
+    flags := map[string]string{}
+    flag.Visit(func(f *flag.Flag) {
+        switch f.Name {
+        case "config", "print-config":
+        case "p":
+            flags["port"] = f.Value.String()
+        default:
+            flags[f.Name] = f.Value.String()
+        }
+    })
+    return config.Load(path, flags)
+}
 
-func handleSignal(c []shutdown) {
-    quitChan := make(chan os.Signal)
+func handleSignal(s *server.Server, logger hclog.Logger) {
+    quitChan := make(chan os.Signal, 1)
     signal.Notify(quitChan,
         syscall.SIGINT,
         syscall.SIGTERM,
         syscall.SIGHUP,
     )
-    <-quitChan
-
-    closeAll(c)
-    log.Println("server gracefully shutdown")
-    close(quitChan)
-}
-
-func closeAll(c []shutdown) {
-    for _, v := range c {
-        if err := v(); nil != err {
-            log.Fatalf("server shutdown failed, err: %v\n", err)
+    for sig := range quitChan {
+        if sig != syscall.SIGHUP {
+            break
+        }
+        ret, err := s.Reload()
+        if err != nil {
+            logger.Error("reload config failed", "error", err)
+            continue
         }
+        logger.Info("reload config", "applied", ret.Applied, "restart_required", ret.RestartRequired)
+    }
+    signal.Stop(quitChan)
+
+    ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+    defer cancel()
+    if err := s.Stop(ctx); err != nil {
+        logger.Error("server shutdown failed", "error", err)
+        os.Exit(1)
     }
+    logger.Info("server gracefully shutdown")
 }
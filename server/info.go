@@ -0,0 +1,130 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package server
+
+import (
+    "errors"
+    "github.com/xfali/gache/internal/handler"
+)
+
+var ErrRaftDisabled = errors.New("raft is not enabled")
+
+// RaftInfo 本节点的raft状态以及raft集群的成员
+type RaftInfo struct {
+    ID    string `json:"id"`
+    State string `json:"state"`
+    Term  uint64 `json:"term"`
+    // leader的raft地址，没有leader时为空
+    Leader       string     `json:"leader"`
+    CommitIndex  uint64     `json:"commitIndex"`
+    AppliedIndex uint64     `json:"appliedIndex"`
+    LastIndex    uint64     `json:"lastIndex"`
+    Peers        []RaftPeer `json:"peers"`
+}
+
+type RaftPeer struct {
+    ID   string `json:"id"`
+    Addr string `json:"addr"`
+    // 节点成为过leader后才会登记api地址
+    ApiAddr string `json:"apiAddr,omitempty"`
+    Voter   bool   `json:"voter"`
+    Leader  bool   `json:"leader"`
+}
+
+// ClusterInfo gossip分片集群的状态，未配置cluster-slot时Enabled为false
+type ClusterInfo struct {
+    Enabled bool `json:"enabled"`
+    // OK、ERROR、NOT_READY或者MOVE
+    State string        `json:"state,omitempty"`
+    Self  ClusterNode   `json:"self"`
+    Nodes []ClusterNode `json:"nodes"`
+}
+
+// ClusterNode 集群中的一个节点以及负责的slot范围[SlotBegin, SlotEnd]
+type ClusterNode struct {
+    Addr      string `json:"addr,omitempty"`
+    ApiAddr   string `json:"apiAddr,omitempty"`
+    RespAddr  string `json:"respAddr,omitempty"`
+    SlotBegin uint32 `json:"slotBegin"`
+    SlotEnd   uint32 `json:"slotEnd"`
+    // 是否为所在分片的raft leader
+    Leader bool `json:"leader"`
+}
+
+// Raft 本节点的raft状态，未配置raft-addr时返回ErrRaftDisabled
+func (s *Server) Raft() (RaftInfo, error) {
+    s.mu.Lock()
+    r, started := s.raft, s.ctx != nil
+    s.mu.Unlock()
+
+    if !started {
+        return RaftInfo{}, ErrNotStarted
+    }
+    if r == nil {
+        return RaftInfo{}, ErrRaftDisabled
+    }
+    peers, err := r.Peers()
+    if err != nil {
+        return RaftInfo{}, err
+    }
+    status := r.Status()
+    ret := RaftInfo{
+        ID:           status.ID,
+        State:        status.State,
+        Term:         status.Term,
+        Leader:       status.Leader,
+        CommitIndex:  status.CommitIndex,
+        AppliedIndex: status.AppliedIndex,
+        LastIndex:    status.LastIndex,
+        Peers:        make([]RaftPeer, len(peers)),
+    }
+    for i, p := range peers {
+        ret.Peers[i] = RaftPeer{
+            ID:     p.ID,
+            Addr:   p.Addr,
+            Voter:  p.Suffrage == "Voter",
+            Leader: p.Leader,
+        }
+        if peer, ok := s.db.GetPeer(p.ID); ok {
+            ret.Peers[i].ApiAddr = peer.ApiAddr
+        }
+    }
+    return ret, nil
+}
+
+// Cluster 本节点看到的gossip集群成员以及各自负责的slot
+func (s *Server) Cluster() (ClusterInfo, error) {
+    s.mu.Lock()
+    ctx := s.ctx
+    s.mu.Unlock()
+
+    if ctx == nil {
+        return ClusterInfo{}, ErrNotStarted
+    }
+    status := ctx.Status()
+    ret := ClusterInfo{
+        Enabled: status.ClusterEnabled,
+        State:   status.ClusterState,
+        Self:    clusterNode(status.Self),
+        Nodes:   make([]ClusterNode, len(status.Nodes)),
+    }
+    for i, n := range status.Nodes {
+        ret.Nodes[i] = clusterNode(n)
+    }
+    return ret, nil
+}
+
+func clusterNode(n handler.NodeInfo) ClusterNode {
+    return ClusterNode{
+        Addr:      n.Addr,
+        ApiAddr:   n.ApiAddr,
+        RespAddr:  n.RespAddr,
+        SlotBegin: n.SlotBegin,
+        SlotEnd:   n.SlotEnd,
+        Leader:    n.Master,
+    }
+}
@@ -0,0 +1,90 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package server
+
+import (
+    "github.com/hashicorp/go-hclog"
+    "github.com/hashicorp/memberlist"
+    "github.com/hashicorp/raft"
+    "github.com/xfali/gache/config"
+    "github.com/xfali/gache/db"
+    "net"
+)
+
+type options struct {
+    logger   hclog.Logger
+    db       *db.GacheDb
+    listener net.Listener
+    resp     net.Listener
+    loader   func() (*config.Config, error)
+
+    raftTransport   raft.Transport
+    logStore        raft.LogStore
+    stableStore     raft.StableStore
+    snapshotStore   raft.SnapshotStore
+    gossipTransport memberlist.Transport
+}
+
+type Option func(o *options)
+
+// 使用指定的logger，默认按log-level、log-format输出到标准错误
+func WithLogger(logger hclog.Logger) Option {
+    return func(o *options) {
+        o.logger = logger
+    }
+}
+
+// 使用已有的数据库，默认创建空的数据库
+func WithDB(db *db.GacheDb) Option {
+    return func(o *options) {
+        o.db = db
+    }
+}
+
+// 在指定的listener上提供HTTP接口，默认监听port
+func WithListener(l net.Listener) Option {
+    return func(o *options) {
+        o.listener = l
+    }
+}
+
+// 在指定的listener上提供RESP接口，默认在resp-port不为0时监听resp-port
+func WithRespListener(l net.Listener) Option {
+    return func(o *options) {
+        o.resp = l
+    }
+}
+
+// 重新加载配置时调用load获取新的配置，未设置时不支持重新加载
+func WithConfigLoader(load func() (*config.Config, error)) Option {
+    return func(o *options) {
+        o.loader = load
+    }
+}
+
+// raft节点之间使用的网络，默认使用raft-addr上的TCP（raft-tls时为TLS）
+func WithRaftTransport(t raft.Transport) Option {
+    return func(o *options) {
+        o.raftTransport = t
+    }
+}
+
+// raft日志、元数据与快照的存储，默认保存在raft-dir下
+func WithRaftStorage(logs raft.LogStore, stable raft.StableStore, snapshots raft.SnapshotStore) Option {
+    return func(o *options) {
+        o.logStore = logs
+        o.stableStore = stable
+        o.snapshotStore = snapshots
+    }
+}
+
+// gossip使用的网络，默认使用cluster-port上的UDP/TCP
+func WithGossipTransport(t memberlist.Transport) Option {
+    return func(o *options) {
+        o.gossipTransport = t
+    }
+}
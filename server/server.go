@@ -0,0 +1,464 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package server
+
+import (
+    "context"
+    "errors"
+    "github.com/hashicorp/go-hclog"
+    "github.com/xfali/gache/client"
+    "github.com/xfali/gache/config"
+    "github.com/xfali/gache/db"
+    "github.com/xfali/gache/internal/auth"
+    "github.com/xfali/gache/internal/cdc"
+    "github.com/xfali/gache/internal/cluster"
+    "github.com/xfali/gache/internal/cluster/gossip"
+    "github.com/xfali/gache/internal/faultnet"
+    "github.com/xfali/gache/internal/handler"
+    gachelog "github.com/xfali/gache/internal/logger"
+    "github.com/xfali/gache/internal/metrics"
+    "github.com/xfali/gache/internal/pubsub"
+    "github.com/xfali/gache/internal/replicator"
+    "github.com/xfali/gache/internal/watch"
+    "net"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+)
+
+// 检查内存占用是否超过max-memory的间隔
+const evictInterval = 100 * time.Millisecond
+
+var (
+    ErrStarted    = errors.New("server already started")
+    ErrNotStarted = errors.New("server not started")
+)
+
+// Server 一个gache节点：raft复制、gossip分片集群以及HTTP接口
+type Server struct {
+    conf   *config.Config
+    opts   *options
+    logger hclog.Logger
+
+    mu       sync.Mutex
+    started  bool
+    stopped  bool
+    db       *db.GacheDb
+    raft     cluster.Replication
+    gossip   gossip.Cluster
+    faults   *faultnet.Network
+    watch    *watch.Hub
+    pubsub   *pubsub.Broker
+    cdc      *cdc.Log
+    sink     *cdc.FileSink
+    ctx      *handler.Context
+    http     *handler.Server
+    reloader *config.Reloader
+    cancel   context.CancelFunc
+    // 跨集群复制，未配置replicate-to时为nil
+    replicator *replicator.Replicator
+    reaper     *handler.SessionReaper
+    evictor    *handler.Evictor
+    // RESP接口，未配置resp-port时为nil
+    resp *handler.RespServer
+
+    joinDone chan struct{}
+    joinErr  error
+}
+
+func New(conf *config.Config, opts ...Option) (*Server, error) {
+    if err := conf.Validate(); err != nil {
+        return nil, err
+    }
+    o := &options{}
+    for _, opt := range opts {
+        opt(o)
+    }
+    logger := o.logger
+    if logger == nil {
+        logger = gachelog.New(conf)
+    }
+    gacheDb := o.db
+    if gacheDb == nil {
+        gacheDb = db.New()
+    }
+    // 只在配置了debug-faults时注入故障，规则通过/admin/debug/faults设置
+    var faults *faultnet.Network
+    if conf.DebugFaults {
+        faults = faultnet.New()
+    }
+
+    joinDone := make(chan struct{})
+    if conf.RaftJoinAddr == "" {
+        close(joinDone)
+    }
+    return &Server{
+        conf:     conf,
+        opts:     o,
+        logger:   logger,
+        db:       gacheDb,
+        faults:   faults,
+        joinDone: joinDone,
+    }, nil
+}
+
+// Start 启动raft、gossip和HTTP接口后返回，配置了raft-join时在后台加入集群（见Joined）。
+// ctx只用于启动过程，取消时停止已经启动的部分
+func (s *Server) Start(ctx context.Context) (err error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if s.started {
+        return ErrStarted
+    }
+    s.started = true
+
+    var closers []func() error
+    defer func() {
+        if err != nil {
+            for i := len(closers) - 1; i >= 0; i-- {
+                closers[i]()
+            }
+            s.started = false
+        }
+    }()
+    conf := s.conf
+    // 每个节点的指标单独注册，同一进程中的多个Server互不影响
+    reg := metrics.NewRegistry()
+    s.watch = watch.NewHub(conf.WatchBuffer, s.db.Version())
+    s.pubsub = pubsub.NewBroker()
+    if conf.CdcBuffer > 0 {
+        s.cdc = cdc.NewLog(conf.CdcBuffer)
+    }
+    if conf.CdcDir != "" {
+        sink, err := cdc.NewFileSink(s.cdc, conf.CdcDir, conf.CdcSegmentBytes, s.logger)
+        if err != nil {
+            return err
+        }
+        sink.Start()
+        s.sink = sink
+        closers = append(closers, sink.Close)
+    }
+
+    if conf.RaftTcpAddr != "" {
+        r, err := cluster.NewWithOptions(conf, s.db, make(chan bool, 1), s.logger, cluster.Options{
+            Transport:     s.opts.raftTransport,
+            LogStore:      s.opts.logStore,
+            StableStore:   s.opts.stableStore,
+            SnapshotStore: s.opts.snapshotStore,
+            Faults:        s.faults,
+            Metrics:       reg,
+            Watch:         s.watch,
+            PubSub:        s.pubsub,
+            Cdc:           s.cdc,
+        })
+        if err != nil {
+            return err
+        }
+        s.raft = r
+        closers = append(closers, r.Shutdown)
+    }
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+
+    s.ctx = handler.NewContext(conf, s.raft, s.db, reg, s.logger)
+    s.ctx.SetFaults(s.faults)
+    s.ctx.SetWatch(s.watch)
+    s.ctx.SetPubSub(s.pubsub)
+    s.ctx.SetCdc(s.cdc)
+    if conf.ReplicateTo != "" {
+        cli, err := client.New(strings.Split(conf.ReplicateTo, ","), client.WithToken(conf.ReplicateToken))
+        if err != nil {
+            return err
+        }
+        r, err := replicator.New(replicator.Options{
+            Name:    conf.ReplicateName,
+            Policy:  conf.ReplicatePolicy,
+            Log:     s.cdc,
+            Source:  s.ctx,
+            Client:  cli,
+            Logger:  s.logger,
+            Metrics: reg,
+        })
+        if err != nil {
+            cli.Close()
+            return err
+        }
+        r.Start()
+        s.replicator = r
+        closers = append(closers, r.Close)
+    }
+    h := handler.New(s.ctx)
+    s.reaper = handler.NewSessionReaper(s.ctx, conf.SessionCheckInterval)
+    s.reaper.Start()
+    closers = append(closers, s.reaper.Close)
+    s.ctx.SetMemoryLimit(int64(conf.MaxMemory), conf.EvictionPolicy)
+    s.evictor = handler.NewEvictor(s.ctx, evictInterval)
+    s.evictor.Start()
+    closers = append(closers, s.evictor.Close)
+
+    var dummyCluster gossip.DummyCluster = 1
+    s.gossip = &dummyCluster
+    if conf.ClusterSlot != "" {
+        c, err := gossip.StartupWithOptions(conf, &gossip.NodeDelegate{
+            Enabled:    true,
+            JoinFunc:   s.ctx.NodeJoin,
+            LeaveFunc:  s.ctx.NodeLeave,
+            UpdateFunc: s.ctx.NodeUpdate,
+        }, s.logger, gossip.Options{
+            Transport: s.opts.gossipTransport,
+            Faults:    s.faults,
+        })
+        if err != nil {
+            return err
+        }
+        s.ctx.SetCluster(conf, c)
+        s.gossip = c
+        closers = append(closers, c.Close)
+    }
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+
+    authenticator, err := auth.New(conf)
+    if err != nil {
+        return err
+    }
+    s.ctx.RegisterMetrics(reg)
+    s.http = handler.NewServer(s.routes(h, authenticator, reg), s.logger)
+    if s.opts.listener != nil {
+        err = s.http.Serve(s.opts.listener, conf)
+    } else {
+        err = s.http.Start(conf)
+    }
+    if err != nil {
+        return err
+    }
+    closers = append(closers, s.http.Close)
+
+    if s.opts.resp != nil || conf.RespPort != 0 {
+        s.resp = handler.NewRespServer(s.ctx, authenticator, s.logger)
+        if s.opts.resp != nil {
+            err = s.resp.Serve(s.opts.resp, conf)
+        } else {
+            err = s.resp.Start(conf)
+        }
+        if err != nil {
+            return err
+        }
+        closers = append(closers, s.resp.Close)
+    }
+
+    s.setupReload(authenticator)
+
+    joinCtx, cancel := context.WithCancel(context.Background())
+    s.cancel = cancel
+    if conf.RaftJoinAddr != "" {
+        go s.join(joinCtx)
+    }
+    return nil
+}
+
+func (s *Server) routes(h *handler.Handler, authenticator *auth.Auth, reg *metrics.Registry) http.Handler {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/key/", authenticator.Wrap(h.Handle))
+    mux.HandleFunc("/join", authenticator.Wrap(h.Join))
+    mux.HandleFunc("/cluster", authenticator.Wrap(h.Cluster))
+    mux.HandleFunc("/watch", authenticator.Wrap(h.Watch))
+    mux.HandleFunc("/pubsub", authenticator.Wrap(h.PubSub))
+    mux.HandleFunc("/pubsub/", authenticator.Wrap(h.PubSub))
+    mux.HandleFunc("/cdc", authenticator.Wrap(h.Cdc))
+    mux.HandleFunc("/cdc/offsets/", authenticator.Wrap(h.CdcOffsets))
+    mux.HandleFunc("/lock/", authenticator.Wrap(h.Lock))
+    mux.HandleFunc("/session", authenticator.Wrap(h.Session))
+    mux.HandleFunc("/session/", authenticator.Wrap(h.Session))
+    mux.HandleFunc("/queue/", authenticator.Wrap(h.Queue))
+    mux.HandleFunc("/ratelimit/", authenticator.Wrap(h.RateLimit))
+    mux.HandleFunc("/admin/reload", authenticator.Wrap(h.Reload))
+    mux.HandleFunc("/admin/acl/users", authenticator.Wrap(h.AclUsers))
+    mux.HandleFunc("/admin/acl/users/", authenticator.Wrap(h.AclUsers))
+    mux.HandleFunc("/admin/raft/peers", authenticator.Wrap(h.RaftPeers))
+    mux.HandleFunc("/admin/raft/peers/", authenticator.Wrap(h.RaftPeers))
+    if s.conf.DebugFaults {
+        mux.HandleFunc("/admin/debug/faults", authenticator.Wrap(h.Faults))
+    }
+    // 探针不需要认证，节点状态与指标包含集群拓扑等信息，需要认证
+    mux.HandleFunc("/healthz", h.Healthz)
+    mux.HandleFunc("/readyz", h.Readyz)
+    mux.HandleFunc("/status", authenticator.Wrap(h.Status))
+    mux.HandleFunc("/metrics", authenticator.Wrap(metrics.Handler(reg).ServeHTTP))
+    return mux
+}
+
+func (s *Server) setupReload(authenticator *auth.Auth) {
+    if s.opts.loader == nil {
+        return
+    }
+    s.reloader = config.NewReloader(s.conf, s.opts.loader)
+    s.reloader.OnReload(s.http.Reload)
+    s.reloader.OnReload(func(conf *config.Config) {
+        s.logger.SetLevel(hclog.LevelFromString(conf.LogLevel))
+        s.ctx.SetMemoryLimit(int64(conf.MaxMemory), conf.EvictionPolicy)
+        if err := authenticator.Update(conf); err != nil {
+            s.logger.Error("reload auth failed", "error", err)
+        }
+    })
+    if s.conf.ClusterSlot != "" {
+        s.reloader.OnReload(func(conf *config.Config) {
+            keys, _ := conf.ClusterKeyList()
+            if err := s.gossip.UpdateKeys(keys); err != nil {
+                s.logger.Error("reload cluster keys failed", "error", err)
+            }
+        })
+    }
+    s.ctx.SetReloader(s.reloader)
+}
+
+func (s *Server) join(ctx context.Context) {
+    err := cluster.Join(ctx, s.conf, s.logger)
+    if err != nil && ctx.Err() == nil {
+        s.logger.Error("join raft cluster failed", "error", err)
+    }
+    s.joinErr = err
+    close(s.joinDone)
+}
+
+// Joined 等待加入raft集群完成，未配置raft-join时直接返回
+func (s *Server) Joined(ctx context.Context) error {
+    select {
+    case <-s.joinDone:
+        return s.joinErr
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+// Reload 重新加载配置，需要使用WithConfigLoader
+func (s *Server) Reload() (*config.ReloadResult, error) {
+    s.mu.Lock()
+    ctx := s.ctx
+    s.mu.Unlock()
+
+    if ctx == nil {
+        return nil, ErrNotStarted
+    }
+    return ctx.Reload()
+}
+
+// Stop 依次停止HTTP、RESP接口、gossip和raft，ctx控制等待正在处理的请求的时间
+func (s *Server) Stop(ctx context.Context) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if !s.started {
+        return ErrNotStarted
+    }
+    if s.stopped {
+        return nil
+    }
+    s.stopped = true
+
+    s.cancel()
+    var errs []error
+    if err := s.http.Shutdown(ctx); err != nil {
+        errs = append(errs, err)
+        s.http.Close()
+    }
+    if s.resp != nil {
+        s.resp.Close()
+    }
+    if err := s.gossip.Close(); err != nil {
+        errs = append(errs, err)
+    }
+    if s.replicator != nil {
+        s.replicator.Close()
+    }
+    s.reaper.Close()
+    s.evictor.Close()
+    if s.raft != nil {
+        if err := s.raft.Shutdown(); err != nil {
+            errs = append(errs, err)
+        }
+    }
+    if s.sink != nil {
+        if err := s.sink.Close(); err != nil {
+            errs = append(errs, err)
+        }
+    }
+    if len(errs) > 0 {
+        return errs[0]
+    }
+    return nil
+}
+
+func (s *Server) Config() *config.Config {
+    return s.conf
+}
+
+func (s *Server) Logger() hclog.Logger {
+    return s.logger
+}
+
+func (s *Server) DB() *db.GacheDb {
+    return s.db
+}
+
+// Ready 可以对外提供服务时返回nil，否则返回原因（与/readyz相同）
+func (s *Server) Ready() error {
+    s.mu.Lock()
+    ctx := s.ctx
+    s.mu.Unlock()
+
+    if ctx == nil {
+        return ErrNotStarted
+    }
+    return ctx.Ready()
+}
+
+// RaftIndex 已提交以及本节点已应用的raft日志索引，未配置raft-addr时都为0
+func (s *Server) RaftIndex() (commit, applied uint64) {
+    s.mu.Lock()
+    r := s.raft
+    s.mu.Unlock()
+
+    if r == nil {
+        return 0, 0
+    }
+    status := r.Status()
+    return status.CommitIndex, status.AppliedIndex
+}
+
+// Addr HTTP接口监听的地址
+func (s *Server) Addr() net.Addr {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if s.http == nil {
+        return nil
+    }
+    return s.http.Addr()
+}
+
+// RespAddr RESP接口监听的地址，未启用时为nil
+func (s *Server) RespAddr() net.Addr {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if s.resp == nil {
+        return nil
+    }
+    return s.resp.Addr()
+}
+
+func (s *Server) IsLeader() bool {
+    s.mu.Lock()
+    ctx := s.ctx
+    s.mu.Unlock()
+    return ctx != nil && ctx.IsLeader()
+}
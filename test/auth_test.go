@@ -0,0 +1,54 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package test
+
+import (
+    "github.com/xfali/gache/config"
+    "github.com/xfali/gache/test/harness"
+    "net/http"
+    "testing"
+)
+
+// 探针不需要认证，/status与/metrics需要认证
+func TestAuthEndpoints(t *testing.T) {
+    c := newCluster(t, harness.Options{
+        Replicas: 1,
+        Configure: func(conf *config.Config) {
+            conf.AuthTokens = "alice=t1"
+        },
+    })
+    defer c.Close()
+
+    base := "http://" + c.Nodes()[0].ApiAddr()
+    cases := []struct {
+        path  string
+        token string
+        code  int
+    }{
+        {"/healthz", "", http.StatusOK},
+        {"/readyz", "", http.StatusOK},
+        {"/status", "", http.StatusUnauthorized},
+        {"/status", "t2", http.StatusUnauthorized},
+        {"/status", "t1", http.StatusOK},
+        {"/metrics", "", http.StatusUnauthorized},
+        {"/metrics", "t1", http.StatusOK},
+    }
+    for _, v := range cases {
+        req, _ := http.NewRequest(http.MethodGet, base+v.path, nil)
+        if v.token != "" {
+            req.Header.Set("Authorization", "Bearer "+v.token)
+        }
+        resp, err := http.DefaultClient.Do(req)
+        if err != nil {
+            t.Fatal(err)
+        }
+        resp.Body.Close()
+        if resp.StatusCode != v.code {
+            t.Fatalf("GET %s (%q): %d, want %d", v.path, v.token, resp.StatusCode, v.code)
+        }
+    }
+}
@@ -0,0 +1,253 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package test
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "github.com/xfali/gache/config"
+    "github.com/xfali/gache/internal/cdc"
+    "github.com/xfali/gache/test/harness"
+    "io/ioutil"
+    "net/http"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+// 读取index大于from的记录，返回记录以及下一次读取的from
+func readCdc(t *testing.T, addr, query string) ([]cdc.Record, uint64) {
+    resp, err := http.Get("http://" + addr + "/cdc?" + query)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        t.Fatalf("GET /cdc?%s: %d", query, resp.StatusCode)
+    }
+    next, _ := strconv.ParseUint(resp.Header.Get("X-Gache-Cdc-Next"), 10, 64)
+    var ret []cdc.Record
+    dec := json.NewDecoder(resp.Body)
+    for dec.More() {
+        rec := cdc.Record{}
+        if err := dec.Decode(&rec); err != nil {
+            t.Fatal(err)
+        }
+        ret = append(ret, rec)
+    }
+    return ret, next
+}
+
+func TestCdcStream(t *testing.T) {
+    c := newCluster(t, harness.Options{
+        Replicas: 3,
+        Configure: func(conf *config.Config) {
+            conf.CdcBuffer = 100
+        },
+    })
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    if err := cli.Set(ctx, "a", "1"); err != nil {
+        t.Fatal(err)
+    }
+    if err := cli.Set(ctx, "b", "2"); err != nil {
+        t.Fatal(err)
+    }
+    if err := cli.Delete(ctx, "a"); err != nil {
+        t.Fatal(err)
+    }
+    // 没有修改数据的命令不产生记录
+    if err := cli.Delete(ctx, "missing"); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := cli.CompareAndSwap(ctx, "b", "x", "3"); err != nil {
+        t.Fatal(err)
+    }
+    if err := c.WaitReplicated(ctx, 0); err != nil {
+        t.Fatal(err)
+    }
+
+    // 每个副本上的记录以及index相同
+    var records []cdc.Record
+    for i, n := range c.Nodes() {
+        recs, next := readCdc(t, n.ApiAddr(), "from=0&wait=5s")
+        if len(recs) != 3 || next != recs[2].Index {
+            t.Fatalf("%s: records %+v next %d", n.Name(), recs, next)
+        }
+        if i > 0 {
+            for j := range recs {
+                if recs[j] != records[j] {
+                    t.Fatalf("%s: %+v != %+v", n.Name(), recs[j], records[j])
+                }
+            }
+        }
+        records = recs
+    }
+    want := [][3]string{{cdc.Set, "a", "1"}, {cdc.Set, "b", "2"}, {cdc.Delete, "a", ""}}
+    for i, r := range records {
+        if r.Op != want[i][0] || r.Key != want[i][1] || r.Value != want[i][2] || r.Time.IsZero() {
+            t.Fatalf("record %d: %+v", i, r)
+        }
+        if i > 0 && r.Index <= records[i-1].Index {
+            t.Fatalf("index not increasing: %+v", records)
+        }
+    }
+
+    // 提交offset后从其他节点继续读取
+    follower := c.Nodes()[1]
+    req, _ := http.NewRequest(http.MethodPut, "http://"+follower.ApiAddr()+"/cdc/offsets/etl",
+        strings.NewReader(strconv.FormatUint(records[1].Index, 10)))
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        t.Fatalf("commit offset: %d", resp.StatusCode)
+    }
+    if err := c.WaitReplicated(ctx, 0); err != nil {
+        t.Fatal(err)
+    }
+    recs, _ := readCdc(t, c.Nodes()[2].ApiAddr(), "consumer=etl")
+    if len(recs) != 1 || recs[0] != records[2] {
+        t.Fatalf("records after offset: %+v", recs)
+    }
+}
+
+func TestCdcCompacted(t *testing.T) {
+    c := newCluster(t, harness.Options{
+        Replicas: 1,
+        Configure: func(conf *config.Config) {
+            conf.CdcBuffer = 2
+        },
+    })
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    for i := 0; i < 5; i++ {
+        if err := cli.Set(ctx, fmt.Sprintf("k%d", i), "v"); err != nil {
+            t.Fatal(err)
+        }
+    }
+    resp, err := http.Get("http://" + c.Nodes()[0].ApiAddr() + "/cdc?from=0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusGone {
+        t.Fatalf("compacted: %d", resp.StatusCode)
+    }
+}
+
+// 读取dir下全部NDJSON文件中的记录
+func readSegments(t *testing.T, dir string) ([]cdc.Record, int) {
+    files, err := filepath.Glob(filepath.Join(dir, "*.ndjson"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    sort.Strings(files)
+    var ret []cdc.Record
+    for _, f := range files {
+        b, err := ioutil.ReadFile(f)
+        if err != nil {
+            t.Fatal(err)
+        }
+        s := bufio.NewScanner(bytes.NewReader(b))
+        for s.Scan() {
+            rec := cdc.Record{}
+            if err := json.Unmarshal(s.Bytes(), &rec); err != nil {
+                t.Fatalf("%s: %v", f, err)
+            }
+            ret = append(ret, rec)
+        }
+    }
+    return ret, len(files)
+}
+
+func TestCdcFileSink(t *testing.T) {
+    dir, err := ioutil.TempDir("", "gache-cdc")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+
+    c := newCluster(t, harness.Options{
+        Replicas: 1,
+        Configure: func(conf *config.Config) {
+            conf.CdcBuffer = 100
+            conf.CdcDir = dir
+            conf.CdcSegmentBytes = 256
+        },
+    })
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    write := func(from, to int) {
+        for i := from; i < to; i++ {
+            if err := cli.Set(ctx, fmt.Sprintf("k%d", i), fmt.Sprintf("v%d", i)); err != nil {
+                t.Fatal(err)
+            }
+        }
+    }
+    wait := func(n int) []cdc.Record {
+        var records []cdc.Record
+        err := waitFor(ctx, func() bool {
+            records, _ = readSegments(t, dir)
+            return len(records) >= n
+        })
+        if err != nil {
+            t.Fatalf("records: %d, want %d", len(records), n)
+        }
+        return records
+    }
+
+    write(0, 10)
+    wait(10)
+
+    // 重启后raft重新应用日志，已经导出的记录不会重复写入
+    node := c.Nodes()[0]
+    if err := node.Restart(); err != nil {
+        t.Fatal(err)
+    }
+    write(10, 12)
+    records := wait(12)
+    if len(records) != 12 {
+        t.Fatalf("records: %d", len(records))
+    }
+    for i, r := range records {
+        if r.Op != cdc.Set || r.Key != fmt.Sprintf("k%d", i) || r.Value != fmt.Sprintf("v%d", i) {
+            t.Fatalf("record %d: %+v", i, r)
+        }
+    }
+    if _, files := readSegments(t, dir); files < 2 {
+        t.Fatalf("segments: %d", files)
+    }
+    // 写入记录后保存offset
+    want := strconv.FormatUint(records[11].Index, 10)
+    err = waitFor(ctx, func() bool {
+        b, _ := ioutil.ReadFile(filepath.Join(dir, "offset"))
+        return string(b) == want
+    })
+    if err != nil {
+        t.Fatalf("offset: want %s", want)
+    }
+}
@@ -0,0 +1,231 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package test
+
+import (
+    "context"
+    "fmt"
+    "github.com/xfali/gache/client"
+    "github.com/xfali/gache/internal/utils"
+    "github.com/xfali/gache/test/harness"
+    "testing"
+    "time"
+)
+
+func newCluster(t *testing.T, opts harness.Options) *harness.Cluster {
+    if testing.Short() {
+        t.Skip("skip cluster test in short mode")
+    }
+    c, err := harness.New(opts)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return c
+}
+
+func newClient(t *testing.T, c *harness.Cluster) *client.Client {
+    cli, err := c.Client(client.WithTimeout(2*time.Second), client.WithRetry(20, 50*time.Millisecond))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return cli
+}
+
+func waitTimeout() (context.Context, context.CancelFunc) {
+    return context.WithTimeout(context.Background(), 20*time.Second)
+}
+
+func TestClusterReplication(t *testing.T) {
+    c := newCluster(t, harness.Options{Replicas: 3})
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    for i := 0; i < 50; i++ {
+        if err := cli.Set(ctx, fmt.Sprintf("k%d", i), fmt.Sprintf("v%d", i)); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := c.WaitReplicated(ctx, 0); err != nil {
+        t.Fatal(err)
+    }
+    for _, n := range c.Nodes() {
+        for i := 0; i < 50; i++ {
+            if v := n.DB().Get(fmt.Sprintf("k%d", i)); v != fmt.Sprintf("v%d", i) {
+                t.Fatalf("%s: k%d = %q", n.Name(), i, v)
+            }
+        }
+    }
+}
+
+func TestClusterLeaderFailover(t *testing.T) {
+    c := newCluster(t, harness.Options{Replicas: 3})
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    if err := cli.Set(ctx, "before", "1"); err != nil {
+        t.Fatal(err)
+    }
+    old, err := c.WaitLeader(ctx, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := old.Kill(); err != nil {
+        t.Fatal(err)
+    }
+
+    leader, err := c.WaitLeader(ctx, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if leader == old {
+        t.Fatal("killed node is still leader")
+    }
+    if err := cli.Set(ctx, "after", "2"); err != nil {
+        t.Fatal(err)
+    }
+
+    // 重启后从日志恢复并追上新的写入
+    if err := old.Restart(); err != nil {
+        t.Fatal(err)
+    }
+    if err := c.WaitReplicated(ctx, 0); err != nil {
+        t.Fatal(err)
+    }
+    if v := old.DB().Get("before"); v != "1" {
+        t.Fatalf("before = %q", v)
+    }
+    if v := old.DB().Get("after"); v != "2" {
+        t.Fatalf("after = %q", v)
+    }
+}
+
+func TestClusterPartition(t *testing.T) {
+    c := newCluster(t, harness.Options{Replicas: 3})
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    old, err := c.WaitLeader(ctx, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    c.Isolate(old)
+
+    // 多数派选出新的leader后可以继续写入
+    var leader *harness.Node
+    err = waitFor(ctx, func() bool {
+        leader = c.Leader(0)
+        return leader != nil && leader != old
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := cli.Set(ctx, "k", "majority"); err != nil {
+        t.Fatal(err)
+    }
+    if v := old.DB().Get("k"); v != "" {
+        t.Fatalf("isolated node applied %q", v)
+    }
+
+    c.Heal()
+    if err := c.WaitReplicated(ctx, 0); err != nil {
+        t.Fatal(err)
+    }
+    if v := old.DB().Get("k"); v != "majority" {
+        t.Fatalf("k = %q after heal", v)
+    }
+}
+
+func TestClusterSharded(t *testing.T) {
+    c := newCluster(t, harness.Options{Replicas: 2, Shards: 3})
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    if err := cli.Refresh(ctx); err != nil {
+        t.Fatal(err)
+    }
+    if nodes := cli.Nodes(); len(nodes) != 3 {
+        t.Fatalf("cluster nodes: %v", nodes)
+    }
+
+    kv := map[string]string{}
+    for i := 0; i < 200; i++ {
+        kv[fmt.Sprintf("key-%d", i)] = fmt.Sprintf("value-%d", i)
+    }
+    // 需要转义的key按解码后的key计算slot
+    for _, k := range []string{"a b", "x?y", "p%q", "svc/api/node1", "a#b", "键"} {
+        kv[k] = "value-" + k
+    }
+    if err := cli.MSet(ctx, kv); err != nil {
+        t.Fatal(err)
+    }
+    for s := 0; s < 3; s++ {
+        if err := c.WaitReplicated(ctx, s); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    // 每个key只保存在负责对应slot的分片中
+    for k, v := range kv {
+        slot := utils.CalcSlot(k)
+        for _, n := range c.Nodes() {
+            begin, end := shardSlots(n.Config().ClusterSlot)
+            got := n.DB().Get(k)
+            if owner := begin <= slot && slot <= end; owner && got != v {
+                t.Fatalf("%s: %s = %q, want %q", n.Name(), k, got, v)
+            } else if !owner && got != "" {
+                t.Fatalf("%s: %s stored outside its shard", n.Name(), k)
+            }
+        }
+    }
+
+    ret, err := cli.MGet(ctx, keys(kv))
+    if err != nil {
+        t.Fatal(err)
+    }
+    for k, v := range kv {
+        if ret[k] != v {
+            t.Fatalf("MGet %s = %q, want %q", k, ret[k], v)
+        }
+    }
+}
+
+func shardSlots(s string) (uint32, uint32) {
+    var begin, end uint32
+    fmt.Sscanf(s, "%d-%d", &begin, &end)
+    return begin, end
+}
+
+func keys(kv map[string]string) []string {
+    ret := make([]string, 0, len(kv))
+    for k := range kv {
+        ret = append(ret, k)
+    }
+    return ret
+}
+
+func waitFor(ctx context.Context, cond func() bool) error {
+    for !cond() {
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-time.After(20 * time.Millisecond):
+        }
+    }
+    return nil
+}
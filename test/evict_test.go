@@ -0,0 +1,117 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package test
+
+import (
+    "fmt"
+    "github.com/xfali/gache/client"
+    "github.com/xfali/gache/config"
+    "github.com/xfali/gache/test/harness"
+    "net/http"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+const maxMemory = 4096
+
+func TestEvictNoEviction(t *testing.T) {
+    c := newCluster(t, harness.Options{
+        Replicas: 1,
+        Configure: func(conf *config.Config) {
+            conf.MaxMemory = maxMemory
+        },
+    })
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    value := strings.Repeat("v", 100)
+    var err error
+    n := 0
+    for ; n < 100; n++ {
+        if err = cli.Set(ctx, fmt.Sprintf("k%d", n), value); err != nil {
+            break
+        }
+    }
+    if se, ok := err.(*client.StatusError); !ok || se.Code != http.StatusInsufficientStorage {
+        t.Fatalf("set %d keys: %v", n, err)
+    }
+    // 删除不受限制
+    if err := cli.Delete(ctx, "k0"); err != nil {
+        t.Fatal(err)
+    }
+
+    // 运行时切换为随机淘汰
+    node := c.Nodes()[0]
+    ret, err := node.Reload(func(conf *config.Config) {
+        conf.EvictionPolicy = "allkeys-random"
+        conf.MaxMemory = maxMemory / 2
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(ret.Applied, []string{"max-memory", "eviction-policy"}) || len(ret.RestartRequired) != 0 {
+        t.Fatalf("reload: %+v", ret)
+    }
+    err = waitFor(ctx, func() bool {
+        return node.DB().MemSize() <= maxMemory/2
+    })
+    if err != nil {
+        t.Fatalf("memory %d: %v", node.DB().MemSize(), err)
+    }
+    if err := cli.Set(ctx, "after", value); err != nil {
+        t.Fatal(err)
+    }
+}
+
+// leader通过raft删除key，各个副本的数据相同
+func TestEvictRandom(t *testing.T) {
+    c := newCluster(t, harness.Options{
+        Replicas: 3,
+        Configure: func(conf *config.Config) {
+            conf.MaxMemory = maxMemory
+            conf.EvictionPolicy = "allkeys-random"
+        },
+    })
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    value := strings.Repeat("v", 100)
+    for i := 0; i < 200; i++ {
+        if err := cli.Set(ctx, fmt.Sprintf("k%d", i), value); err != nil {
+            t.Fatal(err)
+        }
+    }
+    leader, err := c.WaitLeader(ctx, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    err = waitFor(ctx, func() bool {
+        return leader.DB().MemSize() <= maxMemory
+    })
+    if err != nil {
+        t.Fatalf("memory %d: %v", leader.DB().MemSize(), err)
+    }
+    if err := c.WaitReplicated(ctx, 0); err != nil {
+        t.Fatal(err)
+    }
+    keys := leader.DB().Copy().Table
+    if len(keys) == 0 || len(keys) >= 200 {
+        t.Fatalf("%d keys left", len(keys))
+    }
+    for _, n := range c.Shard(0) {
+        if got := n.DB().Copy().Table; !reflect.DeepEqual(got, keys) {
+            t.Fatalf("%s: %d keys, leader %d", n.Name(), len(got), len(keys))
+        }
+    }
+}
@@ -0,0 +1,208 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package test
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "github.com/hashicorp/raft"
+    "github.com/xfali/gache/config"
+    "github.com/xfali/gache/internal/faultnet"
+    "github.com/xfali/gache/test/harness"
+    "net/http"
+    "testing"
+    "time"
+)
+
+func TestFaultsDropDuplicate(t *testing.T) {
+    c := newCluster(t, harness.Options{Replicas: 3})
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    if _, err := c.WaitLeader(ctx, 0); err != nil {
+        t.Fatal(err)
+    }
+    c.Faults().Set(faultnet.Any, faultnet.Any, faultnet.Rule{Drop: 0.2, Duplicate: 0.3})
+    for i := 0; i < 30; i++ {
+        if err := cli.Set(ctx, fmt.Sprintf("k%d", i), fmt.Sprintf("v%d", i)); err != nil {
+            t.Fatal(err)
+        }
+    }
+    stats := c.Faults().Stats()
+    if stats.Dropped == 0 || stats.Duplicated == 0 {
+        t.Fatalf("stats: %+v", stats)
+    }
+
+    c.Heal()
+    if err := c.WaitReplicated(ctx, 0); err != nil {
+        t.Fatal(err)
+    }
+    for _, n := range c.Nodes() {
+        for i := 0; i < 30; i++ {
+            if v := n.DB().Get(fmt.Sprintf("k%d", i)); v != fmt.Sprintf("v%d", i) {
+                t.Fatalf("%s: k%d = %q", n.Name(), i, v)
+            }
+        }
+    }
+}
+
+func TestFaultsDelay(t *testing.T) {
+    c := newCluster(t, harness.Options{Replicas: 3})
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    if _, err := c.WaitLeader(ctx, 0); err != nil {
+        t.Fatal(err)
+    }
+    // 小于心跳超时，不会触发选举，但每次提交至少需要一次往返
+    delay := 30 * time.Millisecond
+    c.Faults().Set(faultnet.Any, faultnet.Any, faultnet.Rule{Delay: delay})
+    start := time.Now()
+    if err := cli.Set(ctx, "k", "v"); err != nil {
+        t.Fatal(err)
+    }
+    if d := time.Since(start); d < delay {
+        t.Fatalf("write took %v with %v delay", d, delay)
+    }
+}
+
+// 只断开leader到follower的方向：follower收不到心跳后选出新的leader
+func TestFaultsOneWayPartition(t *testing.T) {
+    c := newCluster(t, harness.Options{Replicas: 3})
+    defer c.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    old, err := c.WaitLeader(ctx, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    c.Faults().Set(old.Name(), faultnet.Any, faultnet.Rule{Partition: true})
+    err = waitFor(ctx, func() bool {
+        leader := c.Leader(0)
+        return leader != nil && leader != old
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestFaultsEndpoint(t *testing.T) {
+    c := newCluster(t, harness.Options{
+        Replicas: 3,
+        Configure: func(conf *config.Config) {
+            conf.DebugFaults = true
+        },
+    })
+    defer c.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    old, err := c.WaitLeader(ctx, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    url := "http://" + old.ApiAddr() + "/admin/debug/faults"
+    do := func(method, body string) *http.Response {
+        req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+        resp, err := http.DefaultClient.Do(req)
+        if err != nil {
+            t.Fatal(err)
+        }
+        return resp
+    }
+
+    // 隔离leader：from默认为本节点，to默认为*
+    for _, body := range []string{`{"partition":true}`, `{"from":"*","to":"` + old.Name() + `","partition":true}`} {
+        resp := do(http.MethodPut, body)
+        resp.Body.Close()
+        if resp.StatusCode != http.StatusOK {
+            t.Fatalf("PUT %s: %d", body, resp.StatusCode)
+        }
+    }
+    resp := do(http.MethodPut, `{"drop":2}`)
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusBadRequest {
+        t.Fatalf("invalid rule: %d", resp.StatusCode)
+    }
+
+    resp = do(http.MethodGet, "")
+    var status struct {
+        Node  string
+        Rules []struct {
+            From      string
+            To        string
+            Partition bool
+        }
+    }
+    err = json.NewDecoder(resp.Body).Decode(&status)
+    resp.Body.Close()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if status.Node != old.Name() || len(status.Rules) != 2 {
+        t.Fatalf("status: %+v", status)
+    }
+
+    err = waitFor(ctx, func() bool {
+        leader := c.Leader(0)
+        return leader != nil && leader != old
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    resp = do(http.MethodDelete, "")
+    resp.Body.Close()
+    // 节点使用自己的规则，与c.Faults()无关
+    getJson(t, url, &status)
+    if len(status.Rules) != 0 {
+        t.Fatalf("rules after delete: %+v", status.Rules)
+    }
+    if err := c.WaitReplicated(ctx, 0); err != nil {
+        t.Fatal(err)
+    }
+}
+
+// 每个节点使用自己的规则时（管理接口），在接收方丢弃来自被隔离节点的请求
+func TestFaultsIncoming(t *testing.T) {
+    _, ta := raft.NewInmemTransport("127.0.0.1:17100")
+    _, tb := raft.NewInmemTransport("127.0.0.1:17101")
+    ta.Connect(tb.LocalAddr(), tb)
+    tb.Connect(ta.LocalAddr(), ta)
+
+    fa, fb := faultnet.New(), faultnet.New()
+    a := fa.RaftTransport("a", ta)
+    b := fb.RaftTransport("b", tb)
+    defer a.(raft.WithClose).Close()
+    defer b.(raft.WithClose).Close()
+    fb.Register("a", string(ta.LocalAddr()))
+    fb.Set("a", "b", faultnet.Rule{Partition: true})
+
+    go func() {
+        for rpc := range b.Consumer() {
+            rpc.Respond(&raft.AppendEntriesResponse{Success: true}, nil)
+        }
+    }()
+    args := &raft.AppendEntriesRequest{Leader: a.EncodePeer("a", a.LocalAddr())}
+    if err := a.AppendEntries("b", b.LocalAddr(), args, &raft.AppendEntriesResponse{}); err == nil {
+        t.Fatal("request from partitioned node accepted")
+    }
+
+    fb.Heal()
+    resp := &raft.AppendEntriesResponse{}
+    if err := a.AppendEntries("b", b.LocalAddr(), args, resp); err != nil || !resp.Success {
+        t.Fatalf("after heal: %v %v", err, resp.Success)
+    }
+}
@@ -0,0 +1,538 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+// Package harness 在一个进程中启动多个gache节点用于测试：raft使用InmemTransport和内存存储，
+// gossip使用内存网络，可以停止、重启节点以及隔离网络
+package harness
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "github.com/hashicorp/go-hclog"
+    "github.com/hashicorp/raft"
+    "github.com/xfali/gache/client"
+    "github.com/xfali/gache/config"
+    "github.com/xfali/gache/db"
+    "github.com/xfali/gache/internal/faultnet"
+    "github.com/xfali/gache/internal/utils"
+    "github.com/xfali/gache/server"
+    "io/ioutil"
+    "net"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+const (
+    raftBasePort   = 17000
+    gossipBasePort = 19000
+    startTimeout   = 30 * time.Second
+    pollInterval   = 20 * time.Millisecond
+)
+
+var ErrNotRunning = errors.New("node is not running")
+
+type Options struct {
+    // 每个分片（raft集群）的节点数，默认3
+    Replicas int
+    // 分片数，为0时不启用gossip分片，只有一个raft集群
+    Shards int
+    // 默认丢弃所有日志
+    Logger hclog.Logger
+    // 启动每个节点前修改配置
+    Configure func(conf *config.Config)
+}
+
+type Cluster struct {
+    opts   Options
+    logger hclog.Logger
+    faults *faultnet.Network
+    raft   *raftNetwork
+    gossip *gossipNetwork
+    nodes  []*Node
+}
+
+type Node struct {
+    c          *Cluster
+    name       string
+    shard      int
+    index      int
+    conf       *config.Config
+    raftAddr   string
+    gossipAddr string
+    apiAddr    string
+    listener   net.Listener
+    respAddr   string
+    respL      net.Listener
+
+    // 重启后保留的raft日志和快照
+    logs  *raft.InmemStore
+    snaps *raft.InmemSnapshotStore
+
+    mu     sync.Mutex
+    server *server.Server
+}
+
+// New 启动集群并等待所有节点就绪
+func New(opts Options) (*Cluster, error) {
+    if opts.Replicas <= 0 {
+        opts.Replicas = 3
+    }
+    logger := opts.Logger
+    if logger == nil {
+        logger = hclog.New(&hclog.LoggerOptions{Output: ioutil.Discard})
+    }
+    c := &Cluster{
+        opts:   opts,
+        logger: logger,
+        faults: faultnet.New(),
+        raft:   newRaftNetwork(),
+        gossip: newGossipNetwork(),
+    }
+
+    shards := opts.Shards
+    if shards == 0 {
+        shards = 1
+    }
+    for s := 0; s < shards; s++ {
+        for i := 0; i < opts.Replicas; i++ {
+            // 先占用端口，便于配置raft-join
+            l, err := net.Listen("tcp", "127.0.0.1:0")
+            if err != nil {
+                c.Close()
+                return nil, err
+            }
+            rl, err := net.Listen("tcp", "127.0.0.1:0")
+            if err != nil {
+                l.Close()
+                c.Close()
+                return nil, err
+            }
+            id := len(c.nodes)
+            c.nodes = append(c.nodes, &Node{
+                c:          c,
+                name:       fmt.Sprintf("s%d-n%d", s, i),
+                shard:      s,
+                index:      i,
+                raftAddr:   "127.0.0.1:" + strconv.Itoa(raftBasePort+id),
+                gossipAddr: "127.0.0.1:" + strconv.Itoa(gossipBasePort+id),
+                apiAddr:    l.Addr().String(),
+                listener:   l,
+                respAddr:   rl.Addr().String(),
+                respL:      rl,
+                logs:       raft.NewInmemStore(),
+                snaps:      raft.NewInmemSnapshotStore(),
+            })
+        }
+    }
+    for _, n := range c.nodes {
+        n.conf = c.config(n)
+        c.faults.Register(n.name, n.raftAddr, n.gossipAddr)
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), startTimeout)
+    defer cancel()
+    for s := 0; s < shards; s++ {
+        // 第一个节点创建raft集群，其余节点加入
+        nodes := c.Shard(s)
+        if err := nodes[0].start(); err != nil {
+            c.Close()
+            return nil, err
+        }
+        if _, err := c.WaitLeader(ctx, s); err != nil {
+            c.Close()
+            return nil, err
+        }
+        for _, n := range nodes[1:] {
+            if err := n.start(); err != nil {
+                c.Close()
+                return nil, err
+            }
+        }
+    }
+    for _, n := range c.nodes {
+        if err := n.server.Joined(ctx); err != nil {
+            c.Close()
+            return nil, fmt.Errorf("%s join: %v", n.name, err)
+        }
+    }
+    if err := c.WaitReady(ctx); err != nil {
+        c.Close()
+        return nil, err
+    }
+    return c, nil
+}
+
+func (c *Cluster) config(n *Node) *config.Config {
+    conf := config.Default()
+    _, port, _ := net.SplitHostPort(n.apiAddr)
+    conf.ApiPort, _ = strconv.Atoi(port)
+    conf.ApiAdvertise = n.apiAddr
+    _, port, _ = net.SplitHostPort(n.respAddr)
+    conf.RespPort, _ = strconv.Atoi(port)
+    conf.RaftTcpAddr = n.raftAddr
+    conf.RaftNodeId = n.name
+    // 使用内存存储，不会创建目录
+    conf.RaftDir = "inmem"
+    conf.RaftHeartbeatTimeout = 100 * time.Millisecond
+    conf.RaftElectionTimeout = 100 * time.Millisecond
+    conf.RaftLeaderLeaseTimeout = 100 * time.Millisecond
+    conf.RaftCommitTimeout = 5 * time.Millisecond
+    conf.RaftApplyTimeout = 2 * time.Second
+    conf.RaftTransportTimeout = time.Second
+
+    var join, members []string
+    for _, other := range c.nodes {
+        if other == n {
+            continue
+        }
+        if other.shard == n.shard && n.index > 0 {
+            join = append(join, other.apiAddr)
+        }
+        members = append(members, other.gossipAddr)
+    }
+    conf.RaftJoinAddr = strings.Join(join, ",")
+
+    if c.opts.Shards > 0 {
+        _, port, _ := net.SplitHostPort(n.gossipAddr)
+        conf.ClusterPort, _ = strconv.Atoi(port)
+        begin, end := slotRange(n.shard, c.opts.Shards)
+        conf.ClusterSlot = fmt.Sprintf("%d-%d", begin, end)
+        conf.ClusterMemebers = strings.Join(members, ",")
+        conf.ClusterGossipInterval = 20 * time.Millisecond
+        conf.ClusterProbeInterval = 200 * time.Millisecond
+        conf.ClusterProbeTimeout = 100 * time.Millisecond
+        conf.ClusterPushPullInterval = time.Second
+    }
+    if c.opts.Configure != nil {
+        c.opts.Configure(conf)
+    }
+    return conf
+}
+
+// 将slot平均分配给各分片
+func slotRange(shard, shards int) (uint32, uint32) {
+    size := utils.SlotCount / uint32(shards)
+    begin := uint32(shard) * size
+    end := begin + size - 1
+    if shard == shards-1 {
+        end = utils.SlotCount - 1
+    }
+    return begin, end
+}
+
+func (c *Cluster) Nodes() []*Node {
+    return c.nodes
+}
+
+// Shard 分片s中的节点
+func (c *Cluster) Shard(s int) []*Node {
+    var ret []*Node
+    for _, n := range c.nodes {
+        if n.shard == s {
+            ret = append(ret, n)
+        }
+    }
+    return ret
+}
+
+func (c *Cluster) ApiAddrs() []string {
+    ret := make([]string, len(c.nodes))
+    for i, n := range c.nodes {
+        ret[i] = n.apiAddr
+    }
+    return ret
+}
+
+// Client 以所有节点为seeds的客户端
+func (c *Cluster) Client(opts ...client.Option) (*client.Client, error) {
+    return client.New(c.ApiAddrs(), opts...)
+}
+
+// Leader 分片s当前唯一的leader，没有或者有多个节点认为自己是leader时返回nil
+func (c *Cluster) Leader(s int) *Node {
+    var leader *Node
+    for _, n := range c.Shard(s) {
+        srv := n.Server()
+        if srv == nil || !srv.IsLeader() {
+            continue
+        }
+        if leader != nil {
+            return nil
+        }
+        leader = n
+    }
+    return leader
+}
+
+// WaitLeader 等待分片s选出唯一的leader
+func (c *Cluster) WaitLeader(ctx context.Context, s int) (*Node, error) {
+    var leader *Node
+    err := poll(ctx, func() error {
+        if leader = c.Leader(s); leader == nil {
+            return fmt.Errorf("shard %d has no leader", s)
+        }
+        return nil
+    })
+    return leader, err
+}
+
+// WaitReady 等待所有运行中的节点可以对外提供服务（见/readyz）
+func (c *Cluster) WaitReady(ctx context.Context) error {
+    return poll(ctx, func() error {
+        for _, n := range c.nodes {
+            srv := n.Server()
+            if srv == nil {
+                continue
+            }
+            if err := srv.Ready(); err != nil {
+                return fmt.Errorf("%s: %v", n.name, err)
+            }
+        }
+        return nil
+    })
+}
+
+// WaitReplicated 等待分片s中与leader连通的节点都应用了leader已提交的日志
+func (c *Cluster) WaitReplicated(ctx context.Context, s int) error {
+    leader, err := c.WaitLeader(ctx, s)
+    if err != nil {
+        return err
+    }
+    srv := leader.Server()
+    if srv == nil {
+        return ErrNotRunning
+    }
+    commit, _ := srv.RaftIndex()
+    return poll(ctx, func() error {
+        for _, n := range c.Shard(s) {
+            srv := n.Server()
+            if srv == nil || c.faults.Partitioned(leader.name, n.name) {
+                continue
+            }
+            if _, applied := srv.RaftIndex(); applied < commit {
+                return fmt.Errorf("%s applied %d, leader commit %d", n.name, applied, commit)
+            }
+        }
+        return nil
+    })
+}
+
+// Partition 将节点分成互相不能通信的几组，未列出的节点属于另外一组。
+// 只影响raft和gossip，HTTP接口仍然可以访问
+func (c *Cluster) Partition(groups ...[]*Node) {
+    listed := map[*Node]bool{}
+    names := make([][]string, len(groups)+1)
+    for i, g := range groups {
+        for _, n := range g {
+            listed[n] = true
+            names[i] = append(names[i], n.name)
+        }
+    }
+    for _, n := range c.nodes {
+        if !listed[n] {
+            names[len(groups)] = append(names[len(groups)], n.name)
+        }
+    }
+    c.faults.Partition(names...)
+}
+
+// Isolate 隔离节点
+func (c *Cluster) Isolate(nodes ...*Node) {
+    c.Partition(nodes)
+}
+
+// Heal 恢复所有节点之间的通信，同时清除通过Faults设置的规则
+func (c *Cluster) Heal() {
+    c.faults.Heal()
+}
+
+// Faults 所有节点共用的故障注入规则，节点名称为Node.Name()
+func (c *Cluster) Faults() *faultnet.Network {
+    return c.faults
+}
+
+// Close 停止所有节点
+func (c *Cluster) Close() error {
+    var err error
+    for _, n := range c.nodes {
+        if e := n.Kill(); e != nil && e != ErrNotRunning && err == nil {
+            err = e
+        }
+        if n.listener != nil {
+            n.listener.Close()
+            n.listener = nil
+        }
+        if n.respL != nil {
+            n.respL.Close()
+            n.respL = nil
+        }
+    }
+    return err
+}
+
+func (n *Node) Name() string {
+    return n.name
+}
+
+func (n *Node) Shard() int {
+    return n.shard
+}
+
+func (n *Node) ApiAddr() string {
+    return n.apiAddr
+}
+
+// RespAddr RESP接口的地址
+func (n *Node) RespAddr() string {
+    return n.respAddr
+}
+
+func (n *Node) RaftAddr() string {
+    return n.raftAddr
+}
+
+func (n *Node) Config() *config.Config {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    return n.conf
+}
+
+// Reload 使用f修改节点的配置，并在运行中的节点上重新加载（同SIGHUP）
+func (n *Node) Reload(f func(conf *config.Config)) (*config.ReloadResult, error) {
+    n.mu.Lock()
+    next := *n.conf
+    f(&next)
+    n.conf = &next
+    srv := n.server
+    n.mu.Unlock()
+
+    if srv == nil {
+        return nil, ErrNotRunning
+    }
+    return srv.Reload()
+}
+
+func (n *Node) loadConfig() (*config.Config, error) {
+    conf := *n.Config()
+    return &conf, conf.Validate()
+}
+
+// Server 停止后为nil
+func (n *Node) Server() *server.Server {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    return n.server
+}
+
+func (n *Node) Alive() bool {
+    return n.Server() != nil
+}
+
+// DB 节点本地的数据库，停止后为nil
+func (n *Node) DB() *db.GacheDb {
+    if srv := n.Server(); srv != nil {
+        return srv.DB()
+    }
+    return nil
+}
+
+// Kill 立即停止节点（不等待正在处理的请求），保留raft日志和快照
+func (n *Node) Kill() error {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+
+    if n.server == nil {
+        return ErrNotRunning
+    }
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    err := n.server.Stop(ctx)
+    if err == context.Canceled {
+        err = nil
+    }
+    n.server = nil
+    n.c.raft.remove(n.raftAddr)
+    return err
+}
+
+// Restart 使用原来的地址和raft存储重新启动节点，数据从快照和日志恢复
+func (n *Node) Restart() error {
+    if n.Alive() {
+        if err := n.Kill(); err != nil {
+            return err
+        }
+    }
+    return n.start()
+}
+
+func (n *Node) start() error {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+
+    if n.server != nil {
+        return nil
+    }
+    l := n.listener
+    n.listener = nil
+    if l == nil {
+        var err error
+        if l, err = net.Listen("tcp", n.apiAddr); err != nil {
+            return err
+        }
+    }
+    rl := n.respL
+    n.respL = nil
+    if rl == nil {
+        var err error
+        if rl, err = net.Listen("tcp", n.respAddr); err != nil {
+            l.Close()
+            return err
+        }
+    }
+    opts := []server.Option{
+        server.WithLogger(n.c.logger.Named(n.name)),
+        server.WithListener(l),
+        server.WithRespListener(rl),
+        // 所有节点共用c.faults注入故障
+        server.WithRaftTransport(n.c.faults.RaftTransport(n.name, n.c.raft.add(n.raftAddr))),
+        server.WithRaftStorage(n.logs, n.logs, n.snaps),
+        server.WithConfigLoader(n.loadConfig),
+    }
+    if n.c.opts.Shards > 0 {
+        opts = append(opts, server.WithGossipTransport(n.c.faults.GossipTransport(n.name, n.c.gossip.add(n.gossipAddr))))
+    }
+    s, err := server.New(n.conf, opts...)
+    if err == nil {
+        err = s.Start(context.Background())
+    }
+    if err != nil {
+        l.Close()
+        rl.Close()
+        n.c.raft.remove(n.raftAddr)
+        return fmt.Errorf("start %s: %v", n.name, err)
+    }
+    n.server = s
+    return nil
+}
+
+func poll(ctx context.Context, f func() error) error {
+    t := time.NewTicker(pollInterval)
+    defer t.Stop()
+    for {
+        err := f()
+        if err == nil {
+            return nil
+        }
+        select {
+        case <-ctx.Done():
+            return fmt.Errorf("%v: %v", ctx.Err(), err)
+        case <-t.C:
+        }
+    }
+}
@@ -0,0 +1,179 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package harness
+
+import (
+    "fmt"
+    "github.com/hashicorp/memberlist"
+    "github.com/hashicorp/raft"
+    "net"
+    "strconv"
+    "sync"
+    "time"
+)
+
+// raftNetwork 连接各节点的raft.InmemTransport，故障由faultnet注入
+type raftNetwork struct {
+    mu         sync.Mutex
+    transports map[string]*raft.InmemTransport
+}
+
+func newRaftNetwork() *raftNetwork {
+    return &raftNetwork{
+        transports: map[string]*raft.InmemTransport{},
+    }
+}
+
+// 为节点创建新的transport，重启后地址不变
+func (n *raftNetwork) add(addr string) *raft.InmemTransport {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+
+    _, t := raft.NewInmemTransportWithTimeout(raft.ServerAddress(addr), 500*time.Millisecond)
+    for a, other := range n.transports {
+        t.Connect(raft.ServerAddress(a), other)
+        other.Connect(raft.ServerAddress(addr), t)
+    }
+    n.transports[addr] = t
+    return t
+}
+
+func (n *raftNetwork) remove(addr string) {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+
+    if t, ok := n.transports[addr]; ok {
+        delete(n.transports, addr)
+        t.DisconnectAll()
+        for _, other := range n.transports {
+            other.Disconnect(raft.ServerAddress(addr))
+        }
+    }
+}
+
+// gossipNetwork 内存中的memberlist网络，与memberlist.MockNetwork类似，
+// 但节点重启后可以使用原来的地址
+type gossipNetwork struct {
+    mu         sync.RWMutex
+    transports map[string]*gossipTransport
+}
+
+func newGossipNetwork() *gossipNetwork {
+    return &gossipNetwork{
+        transports: map[string]*gossipTransport{},
+    }
+}
+
+func (n *gossipNetwork) add(addr string) *gossipTransport {
+    t := &gossipTransport{
+        net:      n,
+        addr:     addr,
+        packetCh: make(chan *memberlist.Packet, 1024),
+        streamCh: make(chan net.Conn, 16),
+        shutdown: make(chan struct{}),
+    }
+    n.mu.Lock()
+    n.transports[addr] = t
+    n.mu.Unlock()
+    return t
+}
+
+func (n *gossipNetwork) route(to string) (*gossipTransport, error) {
+    n.mu.RLock()
+    defer n.mu.RUnlock()
+
+    dest, ok := n.transports[to]
+    if !ok {
+        return nil, fmt.Errorf("no route to %q", to)
+    }
+    return dest, nil
+}
+
+type gossipTransport struct {
+    net      *gossipNetwork
+    addr     string
+    packetCh chan *memberlist.Packet
+    streamCh chan net.Conn
+
+    once     sync.Once
+    shutdown chan struct{}
+}
+
+func (t *gossipTransport) FinalAdvertiseAddr(string, int) (net.IP, int, error) {
+    host, portStr, err := net.SplitHostPort(t.addr)
+    if err != nil {
+        return nil, 0, err
+    }
+    port, err := strconv.Atoi(portStr)
+    if err != nil {
+        return nil, 0, err
+    }
+    return net.ParseIP(host), port, nil
+}
+
+// 与UDP一样，目标不可达或者来不及处理时丢弃
+func (t *gossipTransport) WriteTo(b []byte, addr string) (time.Time, error) {
+    now := time.Now()
+    dest, err := t.net.route(addr)
+    if err != nil {
+        return now, nil
+    }
+    buf := make([]byte, len(b))
+    copy(buf, b)
+    select {
+    case dest.packetCh <- &memberlist.Packet{Buf: buf, From: gossipAddr(t.addr), Timestamp: now}:
+    default:
+    }
+    return now, nil
+}
+
+func (t *gossipTransport) PacketCh() <-chan *memberlist.Packet {
+    return t.packetCh
+}
+
+func (t *gossipTransport) DialTimeout(addr string, timeout time.Duration) (net.Conn, error) {
+    dest, err := t.net.route(addr)
+    if err != nil {
+        return nil, err
+    }
+    p1, p2 := net.Pipe()
+    select {
+    case dest.streamCh <- p1:
+        return p2, nil
+    case <-dest.shutdown:
+    case <-time.After(timeout):
+    }
+    p1.Close()
+    p2.Close()
+    return nil, fmt.Errorf("dial %q timeout", addr)
+}
+
+func (t *gossipTransport) StreamCh() <-chan net.Conn {
+    return t.streamCh
+}
+
+func (t *gossipTransport) Shutdown() error {
+    t.once.Do(func() {
+        close(t.shutdown)
+        t.net.mu.Lock()
+        if t.net.transports[t.addr] == t {
+            delete(t.net.transports, t.addr)
+        }
+        t.net.mu.Unlock()
+    })
+    return nil
+}
+
+type gossipAddr string
+
+func (a gossipAddr) Network() string {
+    return "harness"
+}
+
+func (a gossipAddr) String() string {
+    return string(a)
+}
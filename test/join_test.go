@@ -0,0 +1,77 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package test
+
+import (
+    "bytes"
+    "encoding/json"
+    "github.com/xfali/gache/config"
+    "github.com/xfali/gache/internal/cluster"
+    "github.com/xfali/gache/test/harness"
+    "net/http"
+    "testing"
+    "time"
+)
+
+// 设置raft-join-secret时节点使用签名加入，签名错误以及与已有成员冲突的请求被拒绝
+func TestJoinSigned(t *testing.T) {
+    c := newCluster(t, harness.Options{
+        Replicas: 3,
+        Configure: func(conf *config.Config) {
+            conf.RaftJoinSecret = "secret"
+        },
+    })
+    defer c.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    leader, err := c.WaitLeader(ctx, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var follower *harness.Node
+    for _, n := range c.Shard(0) {
+        if n != leader {
+            follower = n
+        }
+    }
+
+    join := func(jr cluster.JoinRequest, secret string) int {
+        jr.Ts = time.Now().Unix()
+        if secret != "" {
+            jr.Sign(secret)
+        }
+        b, _ := json.Marshal(jr)
+        resp, err := http.Post("http://"+leader.ApiAddr()+"/join", "application/json", bytes.NewReader(b))
+        if err != nil {
+            t.Fatal(err)
+        }
+        resp.Body.Close()
+        return resp.StatusCode
+    }
+    cases := []struct {
+        name   string
+        jr     cluster.JoinRequest
+        secret string
+        code   int
+    }{
+        {"rejoin", cluster.JoinRequest{ID: follower.Name(), Addr: follower.RaftAddr(), ApiAddr: follower.ApiAddr()}, "secret", http.StatusOK},
+        {"unsigned", cluster.JoinRequest{ID: "x", Addr: "127.0.0.1:1"}, "", http.StatusForbidden},
+        {"wrong secret", cluster.JoinRequest{ID: "x", Addr: "127.0.0.1:1"}, "other", http.StatusForbidden},
+        {"id in use", cluster.JoinRequest{ID: follower.Name(), Addr: "127.0.0.1:1"}, "secret", http.StatusConflict},
+        {"addr in use", cluster.JoinRequest{ID: "x", Addr: follower.RaftAddr()}, "secret", http.StatusConflict},
+        {"replace leader", cluster.JoinRequest{ID: leader.Name(), Addr: "127.0.0.1:1", Replace: true}, "secret", http.StatusConflict},
+    }
+    for _, v := range cases {
+        if code := join(v.jr, v.secret); code != v.code {
+            t.Fatalf("%s: %d, want %d", v.name, code, v.code)
+        }
+    }
+    if err := c.WaitReplicated(ctx, 0); err != nil {
+        t.Fatal(err)
+    }
+}
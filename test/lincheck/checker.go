@@ -0,0 +1,395 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package lincheck
+
+import (
+    "hash/fnv"
+    "math"
+    "sort"
+    "time"
+)
+
+// 每个key是一个独立的寄存器，初始值为空（不存在）
+type register string
+
+func step(state register, op *Operation) (bool, register) {
+    switch op.Kind {
+    case Get:
+        return register(op.Value) == state, state
+    case Set:
+        return true, register(op.Value)
+    case Del:
+        return true, ""
+    case Cas:
+        if op.Result == Unknown {
+            if state == register(op.Old) {
+                return true, register(op.Value)
+            }
+            return true, state
+        }
+        if op.Swapped {
+            return state == register(op.Old), register(op.Value)
+        }
+        return state != register(op.Old), state
+    }
+    return false, state
+}
+
+type KeyResult struct {
+    Key string
+    Ok  bool
+    // 超时未完成检查
+    Timeout bool
+    // 参与检查的操作，按调用时间排序
+    Ops []Operation
+    // 检查失败时找到的最长线性化序列（Ops的下标）以及之后的值
+    Linearized []int
+    State      string
+    // 最长线性化序列之后可以作为下一个操作、但与State矛盾的操作
+    Stuck []int
+}
+
+type CheckResult struct {
+    Ok      bool
+    Timeout bool
+    Ops     int
+    Keys    []*KeyResult
+    Events  []Event
+}
+
+// Failures 检查失败或超时的key
+func (r *CheckResult) Failures() []*KeyResult {
+    var ret []*KeyResult
+    for _, k := range r.Keys {
+        if !k.Ok {
+            ret = append(ret, k)
+        }
+    }
+    return ret
+}
+
+// Check 检查历史是否线性一致，timeout为每个key的检查时间上限（0为不限制）
+func Check(h *History, timeout time.Duration) *CheckResult {
+    ret := CheckOperations(h.Operations(), timeout)
+    ret.Events = h.Events()
+    return ret
+}
+
+func CheckOperations(ops []Operation, timeout time.Duration) *CheckResult {
+    byKey := map[string][]Operation{}
+    for _, op := range ops {
+        // 失败的操作没有执行，结果未知的读没有提供任何信息
+        if op.Result == Fail || (op.Kind == Get && op.Result != Ok) {
+            continue
+        }
+        byKey[op.Key] = append(byKey[op.Key], op)
+    }
+    keys := make([]string, 0, len(byKey))
+    for k := range byKey {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+
+    ret := &CheckResult{Ok: true}
+    for _, k := range keys {
+        kops := byKey[k]
+        sort.Slice(kops, func(i, j int) bool {
+            return kops[i].Call < kops[j].Call
+        })
+        // 去掉没有被观察到的结果未知的写后可以线性化时，原来的历史也可以（把它们放在最后）；
+        // 否则再检查完整的历史
+        kr := checkKey(k, pruneUnknown(kops), timeout)
+        if !kr.Ok && !kr.Timeout && len(kr.Ops) < len(kops) {
+            kr = checkKey(k, kops, timeout)
+        }
+        ret.Ops += len(kops)
+        ret.Keys = append(ret.Keys, kr)
+        if !kr.Ok {
+            ret.Ok = false
+        }
+        if kr.Timeout {
+            ret.Timeout = true
+        }
+    }
+    return ret
+}
+
+// 结果未知的写越多，搜索的分支越多，去掉写入的值没有被GET读到、也不是CAS期望值的操作
+func pruneUnknown(ops []Operation) []Operation {
+    observed := map[string]bool{}
+    for i := range ops {
+        switch ops[i].Kind {
+        case Get:
+            observed[ops[i].Value] = true
+        case Cas:
+            observed[ops[i].Old] = true
+        }
+    }
+    ret := make([]Operation, 0, len(ops))
+    for _, op := range ops {
+        value := op.Value
+        if op.Kind == Del {
+            value = ""
+        }
+        if op.Result == Unknown && !observed[value] {
+            continue
+        }
+        ret = append(ret, op)
+    }
+    return ret
+}
+
+type entry struct {
+    id    int
+    call  bool
+    time  int64
+    match *entry
+    prev  *entry
+    next  *entry
+}
+
+func buildEntries(ops []Operation) *entry {
+    entries := make([]*entry, 0, 2*len(ops))
+    for i := range ops {
+        ret := ops[i].Return
+        // 结果未知的写可能在之后任意时间生效
+        if ops[i].Result == Unknown {
+            ret = math.MaxInt64
+        }
+        r := &entry{id: i, time: ret}
+        c := &entry{id: i, call: true, time: ops[i].Call, match: r}
+        entries = append(entries, c, r)
+    }
+    sort.SliceStable(entries, func(i, j int) bool {
+        if entries[i].time != entries[j].time {
+            return entries[i].time < entries[j].time
+        }
+        return entries[i].call && !entries[j].call
+    })
+
+    head := &entry{id: -1}
+    prev := head
+    for _, e := range entries {
+        prev.next = e
+        e.prev = prev
+        prev = e
+    }
+    return head
+}
+
+// 从链表中移除调用及其返回
+func lift(e *entry) {
+    e.prev.next = e.next
+    e.next.prev = e.prev
+    m := e.match
+    m.prev.next = m.next
+    if m.next != nil {
+        m.next.prev = m.prev
+    }
+}
+
+func unlift(e *entry) {
+    m := e.match
+    m.prev.next = m
+    if m.next != nil {
+        m.next.prev = m
+    }
+    e.prev.next = e
+    e.next.prev = e
+}
+
+type bitset []uint64
+
+func newBitset(n int) bitset {
+    return make(bitset, (n+63)/64)
+}
+
+func (b bitset) set(i int) bitset {
+    b[i/64] |= 1 << uint(i%64)
+    return b
+}
+
+func (b bitset) clear(i int) bitset {
+    b[i/64] &^= 1 << uint(i%64)
+    return b
+}
+
+func (b bitset) clone() bitset {
+    ret := make(bitset, len(b))
+    copy(ret, b)
+    return ret
+}
+
+func (b bitset) equals(o bitset) bool {
+    for i := range b {
+        if b[i] != o[i] {
+            return false
+        }
+    }
+    return true
+}
+
+func (b bitset) hash() uint64 {
+    h := fnv.New64a()
+    var buf [8]byte
+    for _, v := range b {
+        for i := range buf {
+            buf[i] = byte(v >> (8 * uint(i)))
+        }
+        h.Write(buf[:])
+    }
+    return h.Sum64()
+}
+
+type cacheEntry struct {
+    linearized bitset
+    state      register
+}
+
+type frame struct {
+    e     *entry
+    state register
+    pass  int
+}
+
+// 结果未知的操作没有返回，类型和参数相同时可以互换，只需要尝试最早调用的一个
+func signature(op *Operation) string {
+    return string(op.Kind) + "\x00" + op.Old + "\x00" + op.Value
+}
+
+// Wing & Gong的回溯搜索，使用(已线性化的操作, 状态)缓存剪枝。
+// 每一步先尝试结果确定的操作，都不行时再尝试结果未知的操作（第二遍），
+// 结果确定的操作全部线性化后，剩余结果未知的操作可以放在最后
+func checkKey(key string, ops []Operation, timeout time.Duration) *KeyResult {
+    ret := &KeyResult{Key: key, Ops: ops}
+    head := buildEntries(ops)
+
+    var deadline time.Time
+    if timeout > 0 {
+        deadline = time.Now().Add(timeout)
+    }
+    cache := map[uint64][]cacheEntry{}
+    cached := func(b bitset, s register) bool {
+        h := b.hash()
+        for _, c := range cache[h] {
+            if c.state == s && c.linearized.equals(b) {
+                return true
+            }
+        }
+        cache[h] = append(cache[h], cacheEntry{linearized: b, state: s})
+        return false
+    }
+
+    remain := 0
+    for i := range ops {
+        if ops[i].Result != Unknown {
+            remain++
+        }
+    }
+    var calls []frame
+    var best []frame
+    var bestState register
+    linearized := newBitset(len(ops))
+    state := register("")
+    pass := 1
+    // 第二遍中已经尝试过的结果未知的操作
+    var tried map[string]bool
+    e := head.next
+    for n := 0; remain > 0; n++ {
+        if !deadline.IsZero() && n%1024 == 0 && time.Now().After(deadline) {
+            ret.Timeout = true
+            return ret
+        }
+        if e.call {
+            unknown := ops[e.id].Result == Unknown
+            if pass == 2 && unknown {
+                sig := signature(&ops[e.id])
+                if tried[sig] {
+                    e = e.next
+                    continue
+                }
+                tried[sig] = true
+            }
+            if unknown == (pass == 2) {
+                ok, next := step(state, &ops[e.id])
+                if ok && !cached(linearized.clone().set(e.id), next) {
+                    calls = append(calls, frame{e: e, state: state, pass: pass})
+                    state = next
+                    linearized.set(e.id)
+                    lift(e)
+                    if !unknown {
+                        remain--
+                    }
+                    pass = 1
+                    e = head.next
+                    continue
+                }
+            }
+            e = e.next
+            continue
+        }
+
+        // 遇到返回说明之前的调用都无法作为下一个操作
+        if pass == 1 {
+            pass = 2
+            tried = map[string]bool{}
+            e = head.next
+            continue
+        }
+        if len(calls) > len(best) {
+            best = append(best[:0], calls...)
+            bestState = state
+        }
+        if len(calls) == 0 {
+            ret.fail(ops, best, bestState)
+            return ret
+        }
+        // 回溯
+        top := calls[len(calls)-1]
+        calls = calls[:len(calls)-1]
+        e, state, pass = top.e, top.state, top.pass
+        linearized.clear(e.id)
+        unlift(e)
+        if ops[e.id].Result != Unknown {
+            remain++
+        } else {
+            tried = map[string]bool{}
+            for p := head.next; p != e.next; p = p.next {
+                if p.call && ops[p.id].Result == Unknown {
+                    tried[signature(&ops[p.id])] = true
+                }
+            }
+        }
+        e = e.next
+    }
+    ret.Ok = true
+    return ret
+}
+
+func (r *KeyResult) fail(ops []Operation, best []frame, state register) {
+    done := map[int]bool{}
+    for _, f := range best {
+        r.Linearized = append(r.Linearized, f.e.id)
+        done[f.e.id] = true
+    }
+    r.State = string(state)
+
+    // 剩余操作中最早的返回之前开始的操作都可以作为下一个操作
+    minReturn := int64(math.MaxInt64)
+    for i := range ops {
+        if !done[i] && ops[i].Result != Unknown && ops[i].Return < minReturn {
+            minReturn = ops[i].Return
+        }
+    }
+    for i := range ops {
+        if !done[i] && ops[i].Call < minReturn {
+            if ok, _ := step(state, &ops[i]); !ok {
+                r.Stuck = append(r.Stuck, i)
+            }
+        }
+    }
+}
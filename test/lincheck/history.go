@@ -0,0 +1,157 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+// Package lincheck 记录并发访问gache的操作历史，并检查历史是否线性一致（Wing & Gong算法，
+// 按key拆分后分别检查，与Knossos、Porcupine相同）
+package lincheck
+
+import (
+    "fmt"
+    "sort"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+type Kind string
+
+const (
+    Get Kind = "GET"
+    Set Kind = "SET"
+    Del Kind = "DEL"
+    Cas Kind = "CAS"
+)
+
+type Result int
+
+const (
+    // 成功，结果确定
+    Ok Result = iota
+    // 确定没有执行（如503），检查时忽略
+    Fail
+    // 结果未知（超时、失去leader），写操作可能在调用之后的任意时间生效，也可能没有生效
+    Unknown
+)
+
+func (r Result) String() string {
+    switch r {
+    case Ok:
+        return "ok"
+    case Fail:
+        return "fail"
+    default:
+        return "unknown"
+    }
+}
+
+type Operation struct {
+    Client int
+    Kind   Kind
+    Key    string
+    // SET、CAS写入的值，GET读到的值，空字符串表示不存在
+    Value string
+    // CAS期望的当前值
+    Old     string
+    Swapped bool
+    Result  Result
+    Err     string
+
+    // 逻辑时间，用于判断操作之间的先后：A.Return < B.Call 表示A在B开始前已经完成
+    Call   int64
+    Return int64
+    // 相对于开始记录的时间，用于报告
+    CallTime   time.Duration
+    ReturnTime time.Duration
+}
+
+func (op *Operation) String() string {
+    var s string
+    switch op.Kind {
+    case Get:
+        s = fmt.Sprintf("GET %s", op.Key)
+        if op.Result == Ok {
+            s += fmt.Sprintf(" -> %q", op.Value)
+        }
+    case Set:
+        s = fmt.Sprintf("SET %s %q", op.Key, op.Value)
+    case Del:
+        s = fmt.Sprintf("DEL %s", op.Key)
+    case Cas:
+        s = fmt.Sprintf("CAS %s %q -> %q", op.Key, op.Old, op.Value)
+        if op.Result == Ok {
+            s += fmt.Sprintf(" swapped=%v", op.Swapped)
+        }
+    }
+    s += " " + op.Result.String()
+    if op.Err != "" {
+        s += " (" + op.Err + ")"
+    }
+    return s
+}
+
+// 故障注入等事件，只用于报告
+type Event struct {
+    Time time.Duration
+    Desc string
+}
+
+// History 并发安全的操作记录
+type History struct {
+    start time.Time
+    clock int64
+
+    mu     sync.Mutex
+    ops    []Operation
+    events []Event
+}
+
+func NewHistory() *History {
+    return &History{start: time.Now()}
+}
+
+// Invoke 在发出请求前调用，记录调用时间
+func (h *History) Invoke(op *Operation) {
+    op.Call = atomic.AddInt64(&h.clock, 1)
+    op.CallTime = time.Since(h.start)
+}
+
+// Complete 得到结果后调用，记录返回时间并保存操作
+func (h *History) Complete(op *Operation) {
+    op.Return = atomic.AddInt64(&h.clock, 1)
+    op.ReturnTime = time.Since(h.start)
+
+    h.mu.Lock()
+    h.ops = append(h.ops, *op)
+    h.mu.Unlock()
+}
+
+func (h *History) Note(format string, args ...interface{}) {
+    h.mu.Lock()
+    h.events = append(h.events, Event{Time: time.Since(h.start), Desc: fmt.Sprintf(format, args...)})
+    h.mu.Unlock()
+}
+
+// Operations 按调用时间排序的全部操作
+func (h *History) Operations() []Operation {
+    h.mu.Lock()
+    ret := make([]Operation, len(h.ops))
+    copy(ret, h.ops)
+    h.mu.Unlock()
+
+    sort.Slice(ret, func(i, j int) bool {
+        return ret[i].Call < ret[j].Call
+    })
+    return ret
+}
+
+func (h *History) Events() []Event {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    ret := make([]Event, len(h.events))
+    copy(ret, h.events)
+    return ret
+}
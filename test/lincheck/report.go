@@ -0,0 +1,102 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package lincheck
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "time"
+)
+
+// 报告中显示的失败点之前已线性化的操作数
+const reportContext = 10
+
+// Report 输出检查结果，失败时列出每个key最长的线性化序列的末尾、无法继续线性化的操作以及同一时段的故障
+func (r *CheckResult) Report(w io.Writer) {
+    status := "OK"
+    switch {
+    case r.Timeout:
+        status = "UNKNOWN (timeout)"
+    case !r.Ok:
+        status = "FAILED"
+    }
+    fmt.Fprintf(w, "linearizability: %s, %d keys, %d operations\n", status, len(r.Keys), r.Ops)
+
+    for _, k := range r.Failures() {
+        fmt.Fprintln(w)
+        if k.Timeout {
+            fmt.Fprintf(w, "key %q: check timeout, %d operations\n", k.Key, len(k.Ops))
+            continue
+        }
+        fmt.Fprintf(w, "key %q: not linearizable, %d of %d operations linearized, value after them: %q\n",
+            k.Key, len(k.Linearized), len(k.Ops), k.State)
+
+        from := 0
+        if len(k.Linearized) > reportContext {
+            from = len(k.Linearized) - reportContext
+            fmt.Fprintf(w, "  ... %d earlier operations\n", from)
+        }
+        fmt.Fprintln(w, "  linearized:")
+        for _, i := range k.Linearized[from:] {
+            fmt.Fprintf(w, "    %s\n", formatOp(&k.Ops[i]))
+        }
+        fmt.Fprintln(w, "  cannot be linearized next:")
+        for _, i := range k.Stuck {
+            fmt.Fprintf(w, "    %s\n", formatOp(&k.Ops[i]))
+        }
+
+        begin, end := window(k)
+        var events []Event
+        for _, e := range r.Events {
+            if e.Time >= begin && e.Time <= end {
+                events = append(events, e)
+            }
+        }
+        if len(events) > 0 {
+            fmt.Fprintln(w, "  faults around the failure:")
+            for _, e := range events {
+                fmt.Fprintf(w, "    %10s  %s\n", round(e.Time), e.Desc)
+            }
+        }
+    }
+}
+
+func (r *CheckResult) String() string {
+    buf := &bytes.Buffer{}
+    r.Report(buf)
+    return buf.String()
+}
+
+// 失败点前后的时间段
+func window(k *KeyResult) (time.Duration, time.Duration) {
+    var begin, end time.Duration
+    ops := k.Linearized
+    if len(ops) > reportContext {
+        ops = ops[len(ops)-reportContext:]
+    }
+    first := true
+    for _, i := range append(ops, k.Stuck...) {
+        op := &k.Ops[i]
+        if first || op.CallTime < begin {
+            begin = op.CallTime
+        }
+        if first || op.ReturnTime > end {
+            end = op.ReturnTime
+        }
+        first = false
+    }
+    return begin - time.Second, end
+}
+
+func formatOp(op *Operation) string {
+    return fmt.Sprintf("[%10s - %10s] client %-2d %s", round(op.CallTime), round(op.ReturnTime), op.Client, op.String())
+}
+
+func round(d time.Duration) time.Duration {
+    return d.Round(100 * time.Microsecond)
+}
@@ -0,0 +1,236 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package lincheck
+
+import (
+    "context"
+    "fmt"
+    "github.com/xfali/gache/client"
+    "github.com/xfali/gache/test/harness"
+    "math/rand"
+    "net"
+    "net/http"
+    "net/url"
+    "sync"
+    "time"
+)
+
+type Workload struct {
+    // 并发的客户端数，默认5
+    Clients int
+    // 访问的key数，默认3
+    Keys int
+    Duration time.Duration
+    // 每个客户端两次操作之间的间隔
+    Interval time.Duration
+    // 单个请求的超时时间，默认1s
+    Timeout time.Duration
+    // 为true时不断停止、重启leader以及隔离节点
+    Nemesis         bool
+    NemesisInterval time.Duration
+    // 为true时从任意节点读取（可能读到旧数据，用于验证检查器能发现问题）
+    StaleReads bool
+    Seed       int64
+}
+
+func (w *Workload) defaults() {
+    if w.Clients <= 0 {
+        w.Clients = 5
+    }
+    if w.Keys <= 0 {
+        w.Keys = 3
+    }
+    if w.Timeout <= 0 {
+        w.Timeout = time.Second
+    }
+    if w.NemesisInterval <= 0 {
+        w.NemesisInterval = 500 * time.Millisecond
+    }
+    if w.Seed == 0 {
+        w.Seed = time.Now().UnixNano()
+    }
+}
+
+// Run 对集群执行随机的GET/SET/DEL/CAS并记录历史，结束时恢复网络并重启停止的节点
+func Run(ctx context.Context, c *harness.Cluster, w Workload) (*History, error) {
+    w.defaults()
+    h := NewHistory()
+    h.Note("seed %d", w.Seed)
+
+    ctx, cancel := context.WithTimeout(ctx, w.Duration)
+    defer cancel()
+
+    var wg sync.WaitGroup
+    for i := 0; i < w.Clients; i++ {
+        opts := []client.Option{
+            client.WithTimeout(w.Timeout),
+            // 重试会让一次操作生效多次，由检查器处理结果未知的操作
+            client.WithRetry(0, 0),
+        }
+        if !w.StaleReads {
+            opts = append(opts, client.WithLinearizableReads())
+        }
+        cli, err := c.Client(opts...)
+        if err != nil {
+            cancel()
+            wg.Wait()
+            return nil, err
+        }
+        wg.Add(1)
+        go func(id int, cli *client.Client) {
+            defer wg.Done()
+            defer cli.Close()
+            runClient(ctx, h, cli, id, w)
+        }(i, cli)
+    }
+    if w.Nemesis {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            nemesis(ctx, h, c, w)
+        }()
+    }
+    wg.Wait()
+    return h, nil
+}
+
+func runClient(ctx context.Context, h *History, cli *client.Client, id int, w Workload) {
+    r := rand.New(rand.NewSource(w.Seed + int64(id)))
+    // 最近读到或写入的值，作为CAS期望的值
+    last := map[string]string{}
+    for seq := 0; ctx.Err() == nil; seq++ {
+        key := fmt.Sprintf("k%d", r.Intn(w.Keys))
+        op := &Operation{Client: id, Key: key}
+        value := fmt.Sprintf("c%d-%d", id, seq)
+
+        // 操作本身不受ctx影响，避免结束时产生大量结果未知的操作
+        opCtx, cancel := context.WithTimeout(context.Background(), w.Timeout)
+        switch p := r.Intn(10); {
+        case p < 4:
+            op.Kind = Get
+            h.Invoke(op)
+            v, err := cli.Get(opCtx, key)
+            op.Value = v
+            classify(op, err)
+            if err == nil {
+                last[key] = v
+            }
+        case p < 7:
+            op.Kind, op.Value = Set, value
+            h.Invoke(op)
+            classify(op, cli.Set(opCtx, key, value))
+            last[key] = value
+        case p < 9:
+            op.Kind, op.Old, op.Value = Cas, last[key], value
+            h.Invoke(op)
+            swapped, err := cli.CompareAndSwap(opCtx, key, op.Old, value)
+            op.Swapped = swapped
+            classify(op, err)
+            if swapped {
+                last[key] = value
+            }
+        default:
+            op.Kind = Del
+            h.Invoke(op)
+            classify(op, cli.Delete(opCtx, key))
+            last[key] = ""
+        }
+        cancel()
+        h.Complete(op)
+
+        if w.Interval > 0 {
+            time.Sleep(w.Interval)
+        }
+    }
+}
+
+// 503、4xx以及连接失败表示请求没有执行，其他错误（超时、504、连接断开）结果未知
+func classify(op *Operation, err error) {
+    if err == nil {
+        op.Result = Ok
+        return
+    }
+    op.Err = err.Error()
+    op.Result = Unknown
+    if se, ok := err.(*client.StatusError); ok {
+        if se.Code == http.StatusServiceUnavailable || (se.Code >= 400 && se.Code < 500) {
+            op.Result = Fail
+        }
+        return
+    }
+    if ue, ok := err.(*url.Error); ok {
+        err = ue.Err
+    }
+    if oe, ok := err.(*net.OpError); ok && oe.Op == "dial" {
+        op.Result = Fail
+    }
+}
+
+func nemesis(ctx context.Context, h *History, c *harness.Cluster, w Workload) {
+    r := rand.New(rand.NewSource(w.Seed - 1))
+    wait := func() bool {
+        select {
+        case <-ctx.Done():
+            return false
+        case <-time.After(w.NemesisInterval):
+            return true
+        }
+    }
+    defer recoverCluster(h, c)
+
+    for wait() {
+        nodes := c.Nodes()
+        leader := c.Leader(0)
+        switch r.Intn(3) {
+        case 0:
+            if leader == nil {
+                continue
+            }
+            h.Note("kill leader %s", leader.Name())
+            leader.Kill()
+            if !wait() {
+                return
+            }
+            h.Note("restart %s", leader.Name())
+            if err := leader.Restart(); err != nil {
+                h.Note("restart %s failed: %v", leader.Name(), err)
+            }
+        case 1:
+            if leader == nil {
+                continue
+            }
+            h.Note("isolate leader %s", leader.Name())
+            c.Isolate(leader)
+            if !wait() {
+                return
+            }
+            h.Note("heal")
+            c.Heal()
+        default:
+            n := nodes[r.Intn(len(nodes))]
+            h.Note("isolate %s", n.Name())
+            c.Isolate(n)
+            if !wait() {
+                return
+            }
+            h.Note("heal")
+            c.Heal()
+        }
+    }
+}
+
+func recoverCluster(h *History, c *harness.Cluster) {
+    c.Heal()
+    for _, n := range c.Nodes() {
+        if !n.Alive() {
+            h.Note("restart %s", n.Name())
+            if err := n.Restart(); err != nil {
+                h.Note("restart %s failed: %v", n.Name(), err)
+            }
+        }
+    }
+}
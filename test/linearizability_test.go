@@ -0,0 +1,132 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package test
+
+import (
+    "context"
+    "flag"
+    "github.com/xfali/gache/test/harness"
+    "github.com/xfali/gache/test/lincheck"
+    "io/ioutil"
+    "strings"
+    "testing"
+    "time"
+)
+
+var (
+    linDuration = flag.Duration("lin-duration", 5*time.Second, "duration of the linearizability workload")
+    linSeed     = flag.Int64("lin-seed", 0, "random seed of the linearizability workload, 0 for random")
+)
+
+// 按顺序给出的操作依次不重叠，[call, return]
+func seqOps(ops ...lincheck.Operation) []lincheck.Operation {
+    for i := range ops {
+        ops[i].Call = int64(2*i + 1)
+        ops[i].Return = int64(2*i + 2)
+    }
+    return ops
+}
+
+func TestLincheckStaleRead(t *testing.T) {
+    ops := seqOps(
+        lincheck.Operation{Kind: lincheck.Set, Key: "x", Value: "1"},
+        lincheck.Operation{Kind: lincheck.Set, Key: "x", Value: "2"},
+        lincheck.Operation{Kind: lincheck.Get, Key: "x", Value: "1"},
+    )
+    ret := lincheck.CheckOperations(ops, 0)
+    if ret.Ok {
+        t.Fatal("stale read should not be linearizable")
+    }
+    report := ret.String()
+    if !strings.Contains(report, `GET x -> "1"`) {
+        t.Fatalf("report does not show the stale read:\n%s", report)
+    }
+}
+
+func TestLincheckConcurrent(t *testing.T) {
+    // 并发的写可以按任意顺序线性化
+    ops := []lincheck.Operation{
+        {Client: 0, Kind: lincheck.Set, Key: "x", Value: "1", Call: 1, Return: 4},
+        {Client: 1, Kind: lincheck.Set, Key: "x", Value: "2", Call: 2, Return: 3},
+        {Client: 2, Kind: lincheck.Get, Key: "x", Value: "1", Call: 5, Return: 6},
+        {Client: 2, Kind: lincheck.Get, Key: "y", Value: "", Call: 7, Return: 8},
+    }
+    if ret := lincheck.CheckOperations(ops, 0); !ret.Ok {
+        t.Fatalf("should be linearizable:\n%s", ret)
+    }
+}
+
+func TestLincheckCas(t *testing.T) {
+    ok := seqOps(
+        lincheck.Operation{Kind: lincheck.Cas, Key: "x", Old: "", Value: "1", Swapped: true},
+        lincheck.Operation{Kind: lincheck.Cas, Key: "x", Old: "", Value: "2", Swapped: false},
+        lincheck.Operation{Kind: lincheck.Cas, Key: "x", Old: "1", Value: "3", Swapped: true},
+        lincheck.Operation{Kind: lincheck.Get, Key: "x", Value: "3"},
+    )
+    if ret := lincheck.CheckOperations(ok, 0); !ret.Ok {
+        t.Fatalf("should be linearizable:\n%s", ret)
+    }
+
+    bad := seqOps(
+        lincheck.Operation{Kind: lincheck.Set, Key: "x", Value: "1"},
+        lincheck.Operation{Kind: lincheck.Cas, Key: "x", Old: "1", Value: "2", Swapped: false},
+    )
+    if ret := lincheck.CheckOperations(bad, 0); ret.Ok {
+        t.Fatal("failed CAS on matching value should not be linearizable")
+    }
+}
+
+func TestLincheckUnknown(t *testing.T) {
+    // 结果未知的写可能在之后任意时间生效，也可能没有生效
+    ops := seqOps(
+        lincheck.Operation{Kind: lincheck.Set, Key: "x", Value: "1"},
+        lincheck.Operation{Kind: lincheck.Set, Key: "x", Value: "2", Result: lincheck.Unknown},
+        lincheck.Operation{Kind: lincheck.Get, Key: "x", Value: "1"},
+        lincheck.Operation{Kind: lincheck.Get, Key: "x", Value: "2"},
+    )
+    if ret := lincheck.CheckOperations(ops, 0); !ret.Ok {
+        t.Fatalf("should be linearizable:\n%s", ret)
+    }
+
+    // 确定失败的写没有生效
+    ops = seqOps(
+        lincheck.Operation{Kind: lincheck.Set, Key: "x", Value: "1"},
+        lincheck.Operation{Kind: lincheck.Set, Key: "x", Value: "2", Result: lincheck.Fail},
+        lincheck.Operation{Kind: lincheck.Get, Key: "x", Value: "2"},
+    )
+    if ret := lincheck.CheckOperations(ops, 0); ret.Ok {
+        t.Fatal("failed write should not be visible")
+    }
+}
+
+func TestLinearizability(t *testing.T) {
+    c := newCluster(t, harness.Options{Replicas: 3})
+    defer c.Close()
+
+    h, err := lincheck.Run(context.Background(), c, lincheck.Workload{
+        Duration: *linDuration,
+        Nemesis:  true,
+        Seed:     *linSeed,
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    ret := lincheck.Check(h, time.Minute)
+    if ret.Ops == 0 {
+        t.Fatal("no operations recorded")
+    }
+    if !ret.Ok {
+        f, err := ioutil.TempFile("", "gache-lincheck-*.txt")
+        if err == nil {
+            ret.Report(f)
+            f.Close()
+            t.Logf("report: %s", f.Name())
+        }
+        t.Fatalf("\n%s", ret)
+    }
+    t.Logf("%d operations linearizable", ret.Ops)
+}
@@ -0,0 +1,146 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package test
+
+import (
+    "encoding/json"
+    "github.com/xfali/gache/client"
+    "github.com/xfali/gache/test/harness"
+    "net/http"
+    "testing"
+    "time"
+)
+
+func TestLock(t *testing.T) {
+    c := newCluster(t, harness.Options{Replicas: 3})
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    a, err := cli.Lock(ctx, "job", "a", 5*time.Second, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := cli.Lock(ctx, "job", "b", 5*time.Second, 0); err != client.ErrLockHeld {
+        t.Fatalf("lock held by a: %v", err)
+    }
+    // 同一个持有者重复加锁时token不变
+    again, err := cli.Lock(ctx, "job", "a", 5*time.Second, 0)
+    if err != nil || again.Token != a.Token {
+        t.Fatalf("relock: %+v %v, want token %d", again, err, a.Token)
+    }
+
+    // 阻塞等待a释放
+    type result struct {
+        l   *client.Lock
+        err error
+    }
+    ch := make(chan result, 1)
+    go func() {
+        l, err := cli.Lock(ctx, "job", "b", 5*time.Second, 10*time.Second)
+        ch <- result{l, err}
+    }()
+    time.Sleep(200 * time.Millisecond)
+    if err := cli.Unlock(ctx, a); err != nil {
+        t.Fatal(err)
+    }
+    r := <-ch
+    if r.err != nil {
+        t.Fatal(r.err)
+    }
+    b := r.l
+    if b.Owner != "b" || b.Token <= a.Token {
+        t.Fatalf("lock b: %+v, a: %+v", b, a)
+    }
+    if err := cli.Unlock(ctx, a); err != client.ErrLockLost {
+        t.Fatalf("unlock stale: %v", err)
+    }
+    if err := cli.RefreshLock(ctx, b, 5*time.Second); err != nil {
+        t.Fatal(err)
+    }
+
+    // 每个节点上的锁相同
+    if err := c.WaitReplicated(ctx, 0); err != nil {
+        t.Fatal(err)
+    }
+    for _, n := range c.Nodes() {
+        resp, err := http.Get("http://" + n.ApiAddr() + "/lock/job")
+        if err != nil {
+            t.Fatal(err)
+        }
+        info := client.Lock{}
+        json.NewDecoder(resp.Body).Decode(&info)
+        resp.Body.Close()
+        if resp.StatusCode != http.StatusOK || info.Owner != "b" || info.Token != b.Token {
+            t.Fatalf("%s: %d %+v", n.Name(), resp.StatusCode, info)
+        }
+    }
+
+    // leader切换后token仍然递增
+    leader, err := c.WaitLeader(ctx, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := leader.Kill(); err != nil {
+        t.Fatal(err)
+    }
+    // POST结果未知时客户端不重试，等待选出新的leader后再发送
+    if _, err := c.WaitLeader(ctx, 0); err != nil {
+        t.Fatal(err)
+    }
+    other, err := cli.Lock(ctx, "other", "a", 5*time.Second, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if other.Token <= b.Token {
+        t.Fatalf("token after failover: %d <= %d", other.Token, b.Token)
+    }
+    if err := cli.Unlock(ctx, b); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestLockExpire(t *testing.T) {
+    c := newCluster(t, harness.Options{Replicas: 1})
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    x, err := cli.Lock(ctx, "lease", "x", 300*time.Millisecond, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // x不释放，过期后y获得锁
+    y, err := cli.Lock(ctx, "lease", "y", 5*time.Second, 5*time.Second)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if y.Token <= x.Token {
+        t.Fatalf("token: %d <= %d", y.Token, x.Token)
+    }
+    if err := cli.RefreshLock(ctx, x, time.Second); err != client.ErrLockLost {
+        t.Fatalf("refresh expired: %v", err)
+    }
+    if err := cli.Unlock(ctx, x); err != client.ErrLockLost {
+        t.Fatalf("unlock expired: %v", err)
+    }
+    if err := cli.Unlock(ctx, y); err != nil {
+        t.Fatal(err)
+    }
+    resp, err := http.Get("http://" + c.Nodes()[0].ApiAddr() + "/lock/lease")
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusNotFound {
+        t.Fatalf("released lock: %d", resp.StatusCode)
+    }
+}
@@ -0,0 +1,55 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package test
+
+import (
+    "fmt"
+    "github.com/xfali/gache/test/harness"
+    "io/ioutil"
+    "net/http"
+    "strings"
+    "testing"
+)
+
+func getMetrics(t *testing.T, node *harness.Node) string {
+    resp, err := http.Get("http://" + node.ApiAddr() + "/metrics")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer resp.Body.Close()
+    body, err := ioutil.ReadAll(resp.Body)
+    if err != nil || resp.StatusCode != http.StatusOK {
+        t.Fatalf("metrics: %d %v", resp.StatusCode, err)
+    }
+    return string(body)
+}
+
+// 同一进程中的多个节点使用各自的指标，互不影响
+func TestMetricsPerNode(t *testing.T) {
+    c1 := newCluster(t, harness.Options{Replicas: 1})
+    defer c1.Close()
+    c2 := newCluster(t, harness.Options{Replicas: 1})
+    defer c2.Close()
+    cli := newClient(t, c1)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    for i := 0; i < 3; i++ {
+        if err := cli.Set(ctx, fmt.Sprintf("k%d", i), "v"); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    set := `gache_command_total{cmd="SET",result="ok"} `
+    if m := getMetrics(t, c1.Nodes()[0]); !strings.Contains(m, set+"3\n") {
+        t.Fatalf("node of cluster 1:\n%s", m)
+    }
+    if m := getMetrics(t, c2.Nodes()[0]); strings.Contains(m, set) {
+        t.Fatalf("node of cluster 2 counted commands of cluster 1:\n%s", m)
+    }
+}
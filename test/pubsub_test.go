@@ -0,0 +1,101 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package test
+
+import (
+    "fmt"
+    "github.com/xfali/gache/internal/pubsub"
+    "github.com/xfali/gache/internal/utils"
+    "github.com/xfali/gache/test/harness"
+    "net/http"
+    "testing"
+)
+
+func TestPubSub(t *testing.T) {
+    c := newCluster(t, harness.Options{Replicas: 3})
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    leader, err := c.WaitLeader(ctx, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var follower *harness.Node
+    for _, n := range c.Nodes() {
+        if n != leader {
+            follower = n
+            break
+        }
+    }
+
+    // 在follower上订阅，消息通过raft复制到每个节点
+    s := openSSE(t, ctx, "http://"+follower.ApiAddr()+"/pubsub?channel=news&pattern=alerts.*", nil)
+    defer s.Close()
+    for _, m := range [][2]string{{"news", "hello"}, {"other", "x"}, {"alerts.cpu", "high"}} {
+        if err := cli.Publish(ctx, m[0], m[1]); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    msg := pubsub.Message{}
+    if typ := s.next(t, &msg); typ != "message" || msg.Channel != "news" || msg.Data != "hello" {
+        t.Fatalf("message: %s %+v", typ, msg)
+    }
+    msg = pubsub.Message{}
+    if typ := s.next(t, &msg); typ != "pmessage" || msg.Channel != "alerts.cpu" || msg.Pattern != "alerts.*" || msg.Data != "high" {
+        t.Fatalf("message: %s %+v", typ, msg)
+    }
+}
+
+func TestPubSubSharded(t *testing.T) {
+    c := newCluster(t, harness.Options{Replicas: 1, Shards: 2})
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    if err := cli.Refresh(ctx); err != nil {
+        t.Fatal(err)
+    }
+
+    // 分别找到属于两个分片的频道
+    node := c.Nodes()[0]
+    begin, end := shardSlots(node.Config().ClusterSlot)
+    var local, remote string
+    for i := 0; local == "" || remote == ""; i++ {
+        ch := fmt.Sprintf("ch-%d", i)
+        if slot := utils.CalcSlot(ch); begin <= slot && slot <= end {
+            local = ch
+        } else {
+            remote = ch
+        }
+    }
+
+    // 订阅其他分片的频道时跳转到所在的节点
+    s := openSSE(t, ctx, "http://"+node.ApiAddr()+"/pubsub?channel="+remote, nil)
+    defer s.Close()
+    if err := cli.Publish(ctx, remote, "v"); err != nil {
+        t.Fatal(err)
+    }
+    msg := pubsub.Message{}
+    if typ := s.next(t, &msg); typ != "message" || msg.Channel != remote || msg.Data != "v" {
+        t.Fatalf("message: %s %+v", typ, msg)
+    }
+
+    resp, err := http.Get("http://" + node.ApiAddr() + "/pubsub?channel=" + local + "&channel=" + remote)
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusBadRequest {
+        t.Fatalf("cross shard subscribe: %d", resp.StatusCode)
+    }
+}
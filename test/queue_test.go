@@ -0,0 +1,174 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package test
+
+import (
+    "encoding/json"
+    "github.com/xfali/gache/client"
+    "github.com/xfali/gache/config"
+    "github.com/xfali/gache/test/harness"
+    "net/http"
+    "testing"
+    "time"
+)
+
+func TestQueue(t *testing.T) {
+    c := newCluster(t, harness.Options{Replicas: 3})
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    for _, body := range []string{"a", "b"} {
+        if _, err := cli.Enqueue(ctx, "jobs", body); err != nil {
+            t.Fatal(err)
+        }
+    }
+    // 按入队顺序投递，投递中的消息对其他消费者不可见
+    a, err := cli.Dequeue(ctx, "jobs", 5*time.Second, 0)
+    if err != nil || a == nil || a.Body != "a" {
+        t.Fatalf("dequeue: %+v %v", a, err)
+    }
+    b, err := cli.Dequeue(ctx, "jobs", 5*time.Second, 0)
+    if err != nil || b == nil || b.Body != "b" {
+        t.Fatalf("dequeue: %+v %v", b, err)
+    }
+    if m, err := cli.Dequeue(ctx, "jobs", 5*time.Second, 0); err != nil || m != nil {
+        t.Fatalf("empty queue: %+v %v", m, err)
+    }
+    if err := cli.Ack(ctx, a); err != nil {
+        t.Fatal(err)
+    }
+    if err := cli.Ack(ctx, a); err != client.ErrReceiptExpired {
+        t.Fatalf("ack twice: %v", err)
+    }
+
+    // nack后立即重新投递，回执不同
+    if err := cli.Nack(ctx, b, 0); err != nil {
+        t.Fatal(err)
+    }
+    again, err := cli.Dequeue(ctx, "jobs", 5*time.Second, 0)
+    if err != nil || again == nil || again.ID != b.ID || again.Deliveries != 2 || again.Receipt == b.Receipt {
+        t.Fatalf("redelivery: %+v %v, first %+v", again, err, b)
+    }
+    if err := cli.Ack(ctx, b); err != client.ErrReceiptExpired {
+        t.Fatalf("ack old receipt: %v", err)
+    }
+    if err := cli.Ack(ctx, again); err != nil {
+        t.Fatal(err)
+    }
+
+    // 长轮询等待之后入队的消息
+    ch := make(chan *client.QueueMessage, 1)
+    go func() {
+        m, _ := cli.Dequeue(ctx, "jobs", 5*time.Second, 10*time.Second)
+        ch <- m
+    }()
+    time.Sleep(200 * time.Millisecond)
+    if _, err := cli.Enqueue(ctx, "jobs", "c"); err != nil {
+        t.Fatal(err)
+    }
+    if m := <-ch; m == nil || m.Body != "c" {
+        t.Fatalf("long poll: %+v", m)
+    }
+
+    // leader切换后投递中的消息仍然不可见
+    leader, err := c.WaitLeader(ctx, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := leader.Kill(); err != nil {
+        t.Fatal(err)
+    }
+    if m, err := cli.Dequeue(ctx, "jobs", 5*time.Second, 0); err != nil || m != nil {
+        t.Fatalf("after failover: %+v %v", m, err)
+    }
+}
+
+func TestQueueDeadLetter(t *testing.T) {
+    c := newCluster(t, harness.Options{
+        Replicas: 1,
+        Configure: func(conf *config.Config) {
+            conf.QueueMaxDeliveries = 2
+        },
+    })
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    if _, err := cli.Enqueue(ctx, "mail", "x"); err != nil {
+        t.Fatal(err)
+    }
+    // 第一次可见性超时，第二次nack，之后移到死信
+    first, err := cli.Dequeue(ctx, "mail", 200*time.Millisecond, 0)
+    if err != nil || first == nil {
+        t.Fatalf("dequeue: %+v %v", first, err)
+    }
+    second, err := cli.Dequeue(ctx, "mail", 5*time.Second, 5*time.Second)
+    if err != nil || second == nil || second.ID != first.ID || second.Deliveries != 2 {
+        t.Fatalf("redelivery: %+v %v", second, err)
+    }
+    if err := cli.Ack(ctx, first); err != client.ErrReceiptExpired {
+        t.Fatalf("ack after timeout: %v", err)
+    }
+    if err := cli.Nack(ctx, second, 0); err != nil {
+        t.Fatal(err)
+    }
+    if m, err := cli.Dequeue(ctx, "mail", 5*time.Second, 0); err != nil || m != nil {
+        t.Fatalf("dead letter delivered: %+v %v", m, err)
+    }
+
+    addr := "http://" + c.Nodes()[0].ApiAddr() + "/queue/mail/"
+    stats := struct {
+        Ready    int `json:"ready"`
+        InFlight int `json:"inFlight"`
+        Dead     int `json:"dead"`
+    }{}
+    getJson(t, addr+"stats", &stats)
+    if stats.Ready != 0 || stats.InFlight != 0 || stats.Dead != 1 {
+        t.Fatalf("stats: %+v", stats)
+    }
+    var dead []client.QueueMessage
+    getJson(t, addr+"dead", &dead)
+    if len(dead) != 1 || dead[0].ID != first.ID || dead[0].Body != "x" {
+        t.Fatalf("dead: %+v", dead)
+    }
+
+    req, _ := http.NewRequest(http.MethodDelete, addr+"dead", nil)
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    purged := map[string]int{}
+    json.NewDecoder(resp.Body).Decode(&purged)
+    resp.Body.Close()
+    if purged["purged"] != 1 {
+        t.Fatalf("purge: %d %v", resp.StatusCode, purged)
+    }
+    dead = nil
+    getJson(t, addr+"dead", &dead)
+    if len(dead) != 0 {
+        t.Fatalf("dead after purge: %+v", dead)
+    }
+}
+
+func getJson(t *testing.T, url string, v interface{}) {
+    resp, err := http.Get(url)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        t.Fatalf("GET %s: %d", url, resp.StatusCode)
+    }
+    if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+        t.Fatal(err)
+    }
+}
@@ -0,0 +1,112 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package test
+
+import (
+    "github.com/xfali/gache/client"
+    "github.com/xfali/gache/test/harness"
+    "net/http"
+    "testing"
+    "time"
+)
+
+func TestRateLimitTokenBucket(t *testing.T) {
+    c := newCluster(t, harness.Options{Replicas: 3})
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    for i := int64(2); i >= 0; i-- {
+        r, err := cli.RateLimit(ctx, "api/alice", client.TokenBucket, 3, time.Minute, 1)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !r.Allowed || r.Remaining != i || r.Limit != 3 {
+            t.Fatalf("request %d: %+v", 3-i, r)
+        }
+    }
+    r, err := cli.RateLimit(ctx, "api/alice", client.TokenBucket, 3, time.Minute, 1)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // 每20s恢复一个令牌
+    if r.Allowed || r.Remaining != 0 || r.RetryAfter <= 0 || r.RetryAfter > 20*time.Second {
+        t.Fatalf("over limit: %+v", r)
+    }
+    // 其他限流器不受影响
+    if r, err := cli.RateLimit(ctx, "api/bob", client.TokenBucket, 3, time.Minute, 3); err != nil || !r.Allowed || r.Remaining != 0 {
+        t.Fatalf("bob: %+v %v", r, err)
+    }
+
+    // leader切换后仍然限流
+    leader, err := c.WaitLeader(ctx, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := leader.Kill(); err != nil {
+        t.Fatal(err)
+    }
+    // POST结果未知时客户端不重试，等待选出新的leader后再发送
+    if _, err := c.WaitLeader(ctx, 0); err != nil {
+        t.Fatal(err)
+    }
+    r, err = cli.RateLimit(ctx, "api/alice", client.TokenBucket, 3, time.Minute, 1)
+    if err != nil || r.Allowed {
+        t.Fatalf("after failover: %+v %v", r, err)
+    }
+
+    if err := cli.ResetRateLimit(ctx, "api/alice"); err != nil {
+        t.Fatal(err)
+    }
+    r, err = cli.RateLimit(ctx, "api/alice", client.TokenBucket, 3, time.Minute, 1)
+    if err != nil || !r.Allowed || r.Remaining != 2 {
+        t.Fatalf("after reset: %+v %v", r, err)
+    }
+}
+
+func TestRateLimitSlidingWindow(t *testing.T) {
+    c := newCluster(t, harness.Options{Replicas: 1})
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    r, err := cli.RateLimit(ctx, "login", client.SlidingWindow, 2, 500*time.Millisecond, 2)
+    if err != nil || !r.Allowed || r.Remaining != 0 {
+        t.Fatalf("first: %+v %v", r, err)
+    }
+    r, err = cli.RateLimit(ctx, "login", client.SlidingWindow, 2, 500*time.Millisecond, 1)
+    if err != nil || r.Allowed || r.RetryAfter <= 0 || r.RetryAfter > 500*time.Millisecond {
+        t.Fatalf("over limit: %+v %v", r, err)
+    }
+    time.Sleep(r.RetryAfter)
+    r, err = cli.RateLimit(ctx, "login", client.SlidingWindow, 2, 500*time.Millisecond, 1)
+    if err != nil || !r.Allowed || r.Remaining != 1 {
+        t.Fatalf("after window: %+v %v", r, err)
+    }
+
+    // 通过时也设置X-RateLimit-*
+    resp, err := http.Post("http://"+c.Nodes()[0].ApiAddr()+"/ratelimit/login?algorithm=sliding-window&limit=2&period=500ms", "", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusOK || resp.Header.Get("X-RateLimit-Remaining") != "0" || resp.Header.Get("X-RateLimit-Limit") != "2" {
+        t.Fatalf("headers: %d %v", resp.StatusCode, resp.Header)
+    }
+    resp, err = http.Post("http://"+c.Nodes()[0].ApiAddr()+"/ratelimit/login?limit=2&period=500ms&cost=3", "", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusBadRequest {
+        t.Fatalf("cost over limit: %d", resp.StatusCode)
+    }
+}
@@ -0,0 +1,127 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package test
+
+import (
+    "context"
+    "github.com/xfali/gache/client"
+    "github.com/xfali/gache/config"
+    "github.com/xfali/gache/internal/replicator"
+    "github.com/xfali/gache/test/harness"
+    "strings"
+    "testing"
+    "time"
+)
+
+// 启动目标集群以及复制到目标集群的源集群
+func newReplicatedClusters(t *testing.T, policy string) (*harness.Cluster, *harness.Cluster) {
+    target := newCluster(t, harness.Options{Replicas: 1})
+    source, err := harness.New(harness.Options{
+        Replicas: 3,
+        Configure: func(conf *config.Config) {
+            conf.CdcBuffer = 100
+            conf.ReplicateTo = strings.Join(target.ApiAddrs(), ",")
+            conf.ReplicatePolicy = policy
+        },
+    })
+    if err != nil {
+        target.Close()
+        t.Fatal(err)
+    }
+    return source, target
+}
+
+// 等待目标集群中key的值为want，key不存在时为空
+func waitValue(t *testing.T, ctx context.Context, cli *client.Client, key, want string) {
+    var v string
+    var err error
+    cond := func() bool {
+        v, err = cli.Get(ctx, key)
+        return err == nil && v == want
+    }
+    if waitFor(ctx, cond) != nil {
+        t.Fatalf("%s: got %q %v, want %q", key, v, err, want)
+    }
+}
+
+func TestReplicationLww(t *testing.T) {
+    source, target := newReplicatedClusters(t, replicator.LastWriterWins)
+    defer target.Close()
+    defer source.Close()
+    src := newClient(t, source)
+    defer src.Close()
+    dst := newClient(t, target)
+    defer dst.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    for _, kv := range [][2]string{{"a", "1"}, {"b", "2"}} {
+        if err := src.Set(ctx, kv[0], kv[1]); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := src.Delete(ctx, "a"); err != nil {
+        t.Fatal(err)
+    }
+    waitValue(t, ctx, dst, "b", "2")
+    waitValue(t, ctx, dst, "a", "")
+
+    // 目标集群中更晚的修改不会被覆盖
+    if err := dst.Set(ctx, "c", "remote"); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := src.SetAt(ctx, "c", "stale", time.Now().Add(-time.Hour)); err != nil {
+        t.Fatal(err)
+    }
+    if ok, err := dst.SetAt(ctx, "c", "stale", time.Now().Add(-time.Hour)); err != nil || ok {
+        t.Fatalf("SetAt older: %v %v", ok, err)
+    }
+    if err := src.Set(ctx, "d", "4"); err != nil {
+        t.Fatal(err)
+    }
+    waitValue(t, ctx, dst, "d", "4")
+    waitValue(t, ctx, dst, "c", "remote")
+
+    // leader切换后从提交的offset继续复制
+    leader, err := source.WaitLeader(ctx, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var checkpoint uint64
+    getJson(t, "http://"+leader.ApiAddr()+"/cdc/offsets/replicator", &checkpoint)
+    if checkpoint == 0 {
+        t.Fatal("checkpoint not committed")
+    }
+    if err := leader.Kill(); err != nil {
+        t.Fatal(err)
+    }
+    if err := src.Set(ctx, "e", "5"); err != nil {
+        t.Fatal(err)
+    }
+    waitValue(t, ctx, dst, "e", "5")
+    waitValue(t, ctx, dst, "c", "remote")
+}
+
+func TestReplicationSourceWins(t *testing.T) {
+    source, target := newReplicatedClusters(t, replicator.SourceWins)
+    defer target.Close()
+    defer source.Close()
+    src := newClient(t, source)
+    defer src.Close()
+    dst := newClient(t, target)
+    defer dst.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    if err := dst.Set(ctx, "c", "remote"); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := src.SetAt(ctx, "c", "source", time.Now().Add(-time.Hour)); err != nil {
+        t.Fatal(err)
+    }
+    waitValue(t, ctx, dst, "c", "source")
+}
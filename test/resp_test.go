@@ -0,0 +1,209 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package test
+
+import (
+    "bufio"
+    "fmt"
+    "github.com/xfali/gache/config"
+    "github.com/xfali/gache/internal/resp"
+    "github.com/xfali/gache/internal/utils"
+    "github.com/xfali/gache/test/harness"
+    "io"
+    "net"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+)
+
+type respClient struct {
+    t *testing.T
+    c net.Conn
+    r *bufio.Reader
+    w *resp.Writer
+}
+
+func dialResp(t *testing.T, addr string) *respClient {
+    c, err := net.Dial("tcp", addr)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return &respClient{t: t, c: c, r: bufio.NewReader(c), w: resp.NewWriter(c)}
+}
+
+func (c *respClient) send(args ...string) {
+    c.w.WriteArray(len(args))
+    for _, v := range args {
+        c.w.WriteBulk(v)
+    }
+    if err := c.w.Flush(); err != nil {
+        c.t.Fatal(err)
+    }
+}
+
+// 读取一个回复：简单字符串、错误、整数保留类型前缀，bulk string为内容，数组为[a b c]
+func (c *respClient) read() string {
+    c.c.SetReadDeadline(time.Now().Add(5 * time.Second))
+    line, err := c.r.ReadString('\n')
+    if err != nil {
+        c.t.Fatal(err)
+    }
+    line = strings.TrimSuffix(line, "\r\n")
+    switch line[0] {
+    case '$':
+        n, _ := strconv.Atoi(line[1:])
+        b := make([]byte, n+2)
+        if _, err := io.ReadFull(c.r, b); err != nil {
+            c.t.Fatal(err)
+        }
+        return string(b[:n])
+    case '*':
+        n, _ := strconv.Atoi(line[1:])
+        items := make([]string, n)
+        for i := range items {
+            items[i] = c.read()
+        }
+        return "[" + strings.Join(items, " ") + "]"
+    }
+    return line
+}
+
+func (c *respClient) do(args ...string) string {
+    c.send(args...)
+    return c.read()
+}
+
+func (c *respClient) expect(want string, args ...string) {
+    if got := c.do(args...); got != want {
+        c.t.Fatalf("%q: %q, want %q", args, got, want)
+    }
+}
+
+func (c *respClient) Close() {
+    c.c.Close()
+}
+
+func TestRespPubSub(t *testing.T) {
+    c := newCluster(t, harness.Options{Replicas: 3})
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    leader, err := c.WaitLeader(ctx, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var follower *harness.Node
+    for _, n := range c.Nodes() {
+        if n != leader {
+            follower = n
+            break
+        }
+    }
+
+    // 在follower上订阅
+    sub := dialResp(t, follower.RespAddr())
+    defer sub.Close()
+    sub.expect("+PONG", "PING")
+    sub.expect("[subscribe news :1]", "SUBSCRIBE", "news")
+    sub.expect("[psubscribe alerts.* :2]", "PSUBSCRIBE", "alerts.*")
+    sub.expect("[pong ]", "PING")
+    sub.expect("-ERR Can't execute 'publish': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", "PUBLISH", "news", "x")
+
+    // follower上发布跳转到leader
+    pub := dialResp(t, follower.RespAddr())
+    defer pub.Close()
+    pub.expect(fmt.Sprintf("-MOVED %d %s", utils.CalcSlot("news"), leader.RespAddr()), "PUBLISH", "news", "x")
+    pub.expect("-ERR unknown command 'get'", "GET", "k")
+    pub.expect("-ERR wrong number of arguments for 'publish' command", "PUBLISH", "news")
+
+    // 返回leader上的订阅者数
+    local := dialResp(t, leader.RespAddr())
+    defer local.Close()
+    local.expect("[subscribe news :1]", "subscribe", "news")
+    pub = dialResp(t, leader.RespAddr())
+    defer pub.Close()
+    pub.expect(":1", "PUBLISH", "news", "hello")
+    pub.expect(":0", "PUBLISH", "other", "x")
+    // HTTP发布的消息同样发送给RESP的订阅者
+    if err := cli.Publish(ctx, "alerts.cpu", "high"); err != nil {
+        t.Fatal(err)
+    }
+
+    if msg := sub.read(); msg != "[message news hello]" {
+        t.Fatalf("message: %q", msg)
+    }
+    if msg := sub.read(); msg != "[pmessage alerts.* alerts.cpu high]" {
+        t.Fatalf("message: %q", msg)
+    }
+    if msg := local.read(); msg != "[message news hello]" {
+        t.Fatalf("message: %q", msg)
+    }
+
+    sub.expect("[unsubscribe news :1]", "UNSUBSCRIBE")
+    sub.expect("[punsubscribe alerts.* :0]", "PUNSUBSCRIBE", "alerts.*")
+    sub.expect("[unsubscribe  :0]", "UNSUBSCRIBE")
+    // 退出订阅模式后可以执行其他命令
+    sub.expect("hi", "PING", "hi")
+    sub.expect("+OK", "QUIT")
+}
+
+func TestRespSharded(t *testing.T) {
+    c := newCluster(t, harness.Options{Replicas: 1, Shards: 2})
+    defer c.Close()
+
+    node, other := c.Nodes()[0], c.Nodes()[1]
+    begin, end := shardSlots(node.Config().ClusterSlot)
+    var local, remote string
+    for i := 0; local == "" || remote == ""; i++ {
+        ch := fmt.Sprintf("ch-%d", i)
+        if slot := utils.CalcSlot(ch); begin <= slot && slot <= end {
+            local = ch
+        } else {
+            remote = ch
+        }
+    }
+
+    conn := dialResp(t, node.RespAddr())
+    defer conn.Close()
+    moved := fmt.Sprintf("-MOVED %d %s", utils.CalcSlot(remote), other.RespAddr())
+    conn.expect(moved, "PUBLISH", remote, "v")
+    conn.expect(moved, "SUBSCRIBE", local, remote)
+    conn.expect(":0", "PUBLISH", local, "v")
+
+    sub := dialResp(t, other.RespAddr())
+    defer sub.Close()
+    sub.expect("[subscribe "+remote+" :1]", "SUBSCRIBE", remote)
+    remoteConn := dialResp(t, other.RespAddr())
+    defer remoteConn.Close()
+    remoteConn.expect(":1", "PUBLISH", remote, "v")
+    if msg := sub.read(); msg != "[message "+remote+" v]" {
+        t.Fatalf("message: %q", msg)
+    }
+}
+
+func TestRespAuth(t *testing.T) {
+    c := newCluster(t, harness.Options{
+        Replicas: 1,
+        Configure: func(conf *config.Config) {
+            conf.AuthTokens = "alice=t1,bob=t2"
+        },
+    })
+    defer c.Close()
+
+    conn := dialResp(t, c.Nodes()[0].RespAddr())
+    defer conn.Close()
+    conn.expect("-NOAUTH Authentication required.", "PING")
+    conn.expect("-NOAUTH Authentication required.", "SUBSCRIBE", "ch")
+    conn.expect("-WRONGPASS invalid username-password pair", "AUTH", "t3")
+    conn.expect("-WRONGPASS invalid username-password pair", "AUTH", "bob", "t1")
+    conn.expect("+OK", "AUTH", "alice", "t1")
+    conn.expect("+PONG", "PING")
+}
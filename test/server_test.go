@@ -0,0 +1,181 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package test
+
+import (
+    "context"
+    "fmt"
+    "github.com/xfali/gache/config"
+    "github.com/xfali/gache/server"
+    "github.com/xfali/gache/test/harness"
+    "net"
+    "testing"
+    "time"
+)
+
+func TestServerRaftInfo(t *testing.T) {
+    c := newCluster(t, harness.Options{Replicas: 3})
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    if err := cli.Set(ctx, "k", "v"); err != nil {
+        t.Fatal(err)
+    }
+    if err := c.WaitReplicated(ctx, 0); err != nil {
+        t.Fatal(err)
+    }
+    leader := c.Leader(0)
+    if leader == nil {
+        t.Fatal("no leader")
+    }
+    leaderInfo, err := leader.Server().Raft()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    for _, n := range c.Nodes() {
+        info, err := n.Server().Raft()
+        if err != nil {
+            t.Fatal(err)
+        }
+        state := "Follower"
+        if n == leader {
+            state = "Leader"
+        }
+        if info.ID != n.Name() || info.State != state || info.Leader != leader.RaftAddr() || info.Term != leaderInfo.Term {
+            t.Fatalf("%s: %+v, leader %+v", n.Name(), info, leaderInfo)
+        }
+        if info.AppliedIndex == 0 || info.AppliedIndex > info.CommitIndex || info.CommitIndex > info.LastIndex {
+            t.Fatalf("%s: index %+v", n.Name(), info)
+        }
+        if len(info.Peers) != len(c.Nodes()) {
+            t.Fatalf("%s: peers %+v", n.Name(), info.Peers)
+        }
+        for _, p := range info.Peers {
+            var node *harness.Node
+            for _, other := range c.Nodes() {
+                if other.Name() == p.ID {
+                    node = other
+                }
+            }
+            if node == nil || p.Addr != node.RaftAddr() || !p.Voter || p.Leader != (node == leader) {
+                t.Fatalf("%s: peer %+v", n.Name(), p)
+            }
+            if node == leader && p.ApiAddr != leader.ApiAddr() {
+                t.Fatalf("%s: leader api addr %q, want %q", n.Name(), p.ApiAddr, leader.ApiAddr())
+            }
+        }
+    }
+}
+
+func TestServerClusterInfo(t *testing.T) {
+    c := newCluster(t, harness.Options{Replicas: 2, Shards: 2})
+    defer c.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    leaders := map[int]*harness.Node{}
+    for s := 0; s < 2; s++ {
+        leader, err := c.WaitLeader(ctx, s)
+        if err != nil {
+            t.Fatal(err)
+        }
+        leaders[s] = leader
+    }
+
+    // gossip传播成员以及leader变化需要时间
+    var last error
+    deadline := time.Now().Add(10 * time.Second)
+    for _, n := range c.Nodes() {
+        for {
+            if last = checkClusterInfo(c, n, leaders); last == nil {
+                break
+            }
+            if time.Now().After(deadline) {
+                t.Fatal(last)
+            }
+            time.Sleep(50 * time.Millisecond)
+        }
+    }
+}
+
+func checkClusterInfo(c *harness.Cluster, n *harness.Node, leaders map[int]*harness.Node) error {
+    info, err := n.Server().Cluster()
+    if err != nil {
+        return err
+    }
+    if !info.Enabled || info.State != "OK" {
+        return fmt.Errorf("%s: cluster %+v", n.Name(), info)
+    }
+    if err := checkClusterNode(n, info.Self, leaders); err != nil {
+        return err
+    }
+    if len(info.Nodes) != len(c.Nodes()) {
+        return fmt.Errorf("%s: nodes %+v", n.Name(), info.Nodes)
+    }
+    for _, other := range c.Nodes() {
+        found := false
+        for _, node := range info.Nodes {
+            if node.RespAddr == other.RespAddr() {
+                if err := checkClusterNode(other, node, leaders); err != nil {
+                    return fmt.Errorf("%s: %v", n.Name(), err)
+                }
+                found = true
+            }
+        }
+        if !found {
+            return fmt.Errorf("%s: %s not found in %+v", n.Name(), other.Name(), info.Nodes)
+        }
+    }
+    return nil
+}
+
+func checkClusterNode(n *harness.Node, node server.ClusterNode, leaders map[int]*harness.Node) error {
+    begin, end := shardSlots(n.Config().ClusterSlot)
+    if node.RespAddr != n.RespAddr() || node.SlotBegin != begin || node.SlotEnd != end || node.Leader != (leaders[n.Shard()] == n) {
+        return fmt.Errorf("%s: node %+v", n.Name(), node)
+    }
+    _, port, _ := net.SplitHostPort(n.ApiAddr())
+    if _, p, _ := net.SplitHostPort(node.ApiAddr); p != port {
+        return fmt.Errorf("%s: api addr %q, want port %s", n.Name(), node.ApiAddr, port)
+    }
+    return nil
+}
+
+func TestServerInfoDisabled(t *testing.T) {
+    l, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    conf := config.Default()
+    conf.ApiPort = l.Addr().(*net.TCPAddr).Port
+    srv, err := server.New(conf, server.WithListener(l))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := srv.Raft(); err != server.ErrNotStarted {
+        t.Fatalf("raft before start: %v", err)
+    }
+    if _, err := srv.Cluster(); err != server.ErrNotStarted {
+        t.Fatalf("cluster before start: %v", err)
+    }
+
+    if err := srv.Start(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    defer srv.Stop(context.Background())
+    if _, err := srv.Raft(); err != server.ErrRaftDisabled {
+        t.Fatalf("raft: %v", err)
+    }
+    info, err := srv.Cluster()
+    if err != nil || info.Enabled || len(info.Nodes) != 0 {
+        t.Fatalf("cluster: %+v %v", info, err)
+    }
+}
@@ -0,0 +1,153 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package test
+
+import (
+    "context"
+    "encoding/json"
+    "github.com/xfali/gache/config"
+    "github.com/xfali/gache/internal/handler"
+    "github.com/xfali/gache/test/harness"
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+)
+
+func sessionCluster(t *testing.T, replicas int) *harness.Cluster {
+    return newCluster(t, harness.Options{
+        Replicas: replicas,
+        Configure: func(conf *config.Config) {
+            conf.SessionCheckInterval = 50 * time.Millisecond
+        },
+    })
+}
+
+// 每个节点上key的值都为want时返回
+func waitAllNodes(t *testing.T, ctx context.Context, c *harness.Cluster, key, want string) {
+    for _, n := range c.Nodes() {
+        if !n.Alive() {
+            continue
+        }
+        err := waitFor(ctx, func() bool {
+            return n.DB().Get(key) == want
+        })
+        if err != nil {
+            t.Fatalf("%s: %s = %q, want %q", n.Name(), key, n.DB().Get(key), want)
+        }
+    }
+}
+
+func TestSession(t *testing.T) {
+    c := sessionCluster(t, 3)
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    s, err := cli.NewSession(ctx, time.Second)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := cli.SetEphemeral(ctx, s, "svc/a", "10.0.0.1"); err != nil {
+        t.Fatal(err)
+    }
+    if err := cli.SetEphemeral(ctx, s, "svc/b", "10.0.0.2"); err != nil {
+        t.Fatal(err)
+    }
+    // 普通写入后不再是临时key
+    if err := cli.Set(ctx, "svc/b", "10.0.0.3"); err != nil {
+        t.Fatal(err)
+    }
+
+    resp, err := http.Get("http://" + c.Nodes()[0].ApiAddr() + "/session/" + s.ID)
+    if err != nil {
+        t.Fatal(err)
+    }
+    info := handler.SessionInfo{}
+    json.NewDecoder(resp.Body).Decode(&info)
+    resp.Body.Close()
+    if len(info.Keys) != 1 || info.Keys[0] != "svc/a" {
+        t.Fatalf("session: %+v", info)
+    }
+
+    // 心跳期间不会过期，leader切换后仍然有效
+    leader, err := c.WaitLeader(ctx, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := leader.Kill(); err != nil {
+        t.Fatal(err)
+    }
+    time.Sleep(2 * time.Second)
+    select {
+    case <-s.Done():
+        t.Fatalf("session lost: %v", s.Err())
+    default:
+    }
+    waitAllNodes(t, ctx, c, "svc/a", "10.0.0.1")
+
+    if err := s.Close(ctx); err != nil {
+        t.Fatal(err)
+    }
+    waitAllNodes(t, ctx, c, "svc/a", "")
+    waitAllNodes(t, ctx, c, "svc/b", "10.0.0.3")
+    if err := cli.SetEphemeral(ctx, s, "svc/c", "x"); err == nil {
+        t.Fatal("set ephemeral key on closed session")
+    }
+}
+
+func TestSessionExpire(t *testing.T) {
+    c := sessionCluster(t, 3)
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    leader, err := c.WaitLeader(ctx, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // 不发送心跳
+    resp, err := http.Post("http://"+leader.ApiAddr()+"/session?ttl=300ms", "", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    info := handler.SessionInfo{}
+    json.NewDecoder(resp.Body).Decode(&info)
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusOK || info.ID == "" {
+        t.Fatalf("create session: %d %+v", resp.StatusCode, info)
+    }
+    req, _ := http.NewRequest(http.MethodPut, "http://"+leader.ApiAddr()+"/key/eph", strings.NewReader("v"))
+    req.Header.Set(handler.HeaderSession, info.ID)
+    resp, err = http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        t.Fatalf("set ephemeral: %d", resp.StatusCode)
+    }
+    if err := cli.Set(ctx, "persistent", "v"); err != nil {
+        t.Fatal(err)
+    }
+
+    waitAllNodes(t, ctx, c, "eph", "")
+    waitAllNodes(t, ctx, c, "persistent", "v")
+    req, _ = http.NewRequest(http.MethodPut, "http://"+leader.ApiAddr()+"/session/"+info.ID, nil)
+    resp, err = http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusNotFound {
+        t.Fatalf("keepalive expired session: %d", resp.StatusCode)
+    }
+}
@@ -0,0 +1,248 @@
+// Copyright (C) 2019, Xiongfa Li.
+// All right reserved.
+// @author xiongfa.li
+// @version V1.0
+// Description: 
+
+package test
+
+import (
+    "bufio"
+    "context"
+    "encoding/json"
+    "fmt"
+    "github.com/xfali/gache/config"
+    "github.com/xfali/gache/internal/handler"
+    "github.com/xfali/gache/internal/watch"
+    "github.com/xfali/gache/test/harness"
+    "golang.org/x/net/websocket"
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+)
+
+type sseStream struct {
+    resp    *http.Response
+    scanner *bufio.Scanner
+}
+
+func openSSE(t *testing.T, ctx context.Context, url string, header http.Header) *sseStream {
+    req, _ := http.NewRequest(http.MethodGet, url, nil)
+    for k, v := range header {
+        req.Header[k] = v
+    }
+    resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if resp.StatusCode != http.StatusOK {
+        resp.Body.Close()
+        t.Fatalf("GET %s: %d", url, resp.StatusCode)
+    }
+    return &sseStream{resp: resp, scanner: bufio.NewScanner(resp.Body)}
+}
+
+// next 读取下一个事件，跳过注释，data为JSON时解析到v中
+func (s *sseStream) next(t *testing.T, v interface{}) string {
+    var typ, data string
+    for s.scanner.Scan() {
+        line := s.scanner.Text()
+        switch {
+        case line == "":
+            if data == "" {
+                continue
+            }
+            if typ != "error" {
+                if err := json.Unmarshal([]byte(data), v); err != nil {
+                    t.Fatal(err)
+                }
+            }
+            return typ
+        case strings.HasPrefix(line, "event: "):
+            typ = strings.TrimPrefix(line, "event: ")
+        case strings.HasPrefix(line, "data: "):
+            data = strings.TrimPrefix(line, "data: ")
+        }
+    }
+    t.Fatalf("stream closed: %v", s.scanner.Err())
+    return ""
+}
+
+func (s *sseStream) Close() {
+    s.resp.Body.Close()
+}
+
+func TestWatchSSE(t *testing.T) {
+    c := newCluster(t, harness.Options{Replicas: 3})
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    leader, err := c.WaitLeader(ctx, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var follower *harness.Node
+    for _, n := range c.Nodes() {
+        if n != leader {
+            follower = n
+            break
+        }
+    }
+
+    // 在follower上订阅
+    s := openSSE(t, ctx, "http://"+follower.ApiAddr()+"/watch?prefix=user/", nil)
+    defer s.Close()
+    if err := cli.Set(ctx, "other", "x"); err != nil {
+        t.Fatal(err)
+    }
+    if err := cli.Set(ctx, "user/1", "a"); err != nil {
+        t.Fatal(err)
+    }
+    if err := cli.Delete(ctx, "user/1"); err != nil {
+        t.Fatal(err)
+    }
+
+    ev := watch.Event{}
+    typ := s.next(t, &ev)
+    if typ != watch.Set || ev.Key != "user/1" || ev.Value != "a" {
+        t.Fatalf("event: %s %+v", typ, ev)
+    }
+    set := ev.Version
+    typ = s.next(t, &ev)
+    if typ != watch.Delete || ev.Key != "user/1" || ev.Version != set+1 {
+        t.Fatalf("event: %s %+v", typ, ev)
+    }
+
+    // 通过Last-Event-ID从set之后继续接收
+    r := openSSE(t, ctx, "http://"+follower.ApiAddr()+"/watch?prefix=user/", http.Header{"Last-Event-ID": {fmt.Sprint(set)}})
+    defer r.Close()
+    if typ = r.next(t, &ev); typ != watch.Delete || ev.Version != set+1 {
+        t.Fatalf("resumed event: %s %+v", typ, ev)
+    }
+}
+
+func TestWatchCompacted(t *testing.T) {
+    c := newCluster(t, harness.Options{
+        Replicas: 1,
+        Configure: func(conf *config.Config) {
+            conf.WatchBuffer = 4
+        },
+    })
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    for i := 0; i < 10; i++ {
+        if err := cli.Set(ctx, fmt.Sprintf("k%d", i), "v"); err != nil {
+            t.Fatal(err)
+        }
+    }
+    url := "http://" + c.Nodes()[0].ApiAddr() + "/watch?glob=k*&from=1"
+    resp, err := http.Get(url)
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusGone {
+        t.Fatalf("GET %s: %d", url, resp.StatusCode)
+    }
+
+    resp, err = http.Get("http://" + c.Nodes()[0].ApiAddr() + "/watch?key=a&prefix=b")
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusBadRequest {
+        t.Fatalf("invalid pattern: %d", resp.StatusCode)
+    }
+}
+
+func TestWatchWebSocket(t *testing.T) {
+    c := newCluster(t, harness.Options{Replicas: 1})
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    if err := c.WaitReady(ctx); err != nil {
+        t.Fatal(err)
+    }
+    addr := c.Nodes()[0].ApiAddr()
+    ws, err := websocket.Dial("ws://"+addr+"/watch?key=k", "", "http://"+addr)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer ws.Close()
+    ws.SetDeadline(time.Now().Add(10 * time.Second))
+
+    if err := cli.Set(ctx, "k", "v"); err != nil {
+        t.Fatal(err)
+    }
+    ev := watch.Event{}
+    if err := websocket.JSON.Receive(ws, &ev); err != nil {
+        t.Fatal(err)
+    }
+    if ev.Type != watch.Set || ev.Key != "k" || ev.Value != "v" {
+        t.Fatalf("event: %+v", ev)
+    }
+}
+
+func TestWatchExpire(t *testing.T) {
+    c := sessionCluster(t, 1)
+    defer c.Close()
+    cli := newClient(t, c)
+    defer cli.Close()
+
+    ctx, cancel := waitTimeout()
+    defer cancel()
+    if err := c.WaitReady(ctx); err != nil {
+        t.Fatal(err)
+    }
+    addr := c.Nodes()[0].ApiAddr()
+    s := openSSE(t, ctx, "http://"+addr+"/watch?prefix=eph/", nil)
+    defer s.Close()
+
+    // 不发送心跳，会话过期后删除临时key
+    resp, err := http.Post("http://"+addr+"/session?ttl=300ms", "", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    info := handler.SessionInfo{}
+    json.NewDecoder(resp.Body).Decode(&info)
+    resp.Body.Close()
+    req, _ := http.NewRequest(http.MethodPut, "http://"+addr+"/key/eph/1", strings.NewReader("v"))
+    req.Header.Set(handler.HeaderSession, info.ID)
+    resp, err = http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        t.Fatalf("set ephemeral: %d", resp.StatusCode)
+    }
+    if err := cli.Set(ctx, "eph/2", "v"); err != nil {
+        t.Fatal(err)
+    }
+    if err := cli.Delete(ctx, "eph/2"); err != nil {
+        t.Fatal(err)
+    }
+
+    for _, want := range []watch.Event{
+        {Type: watch.Set, Key: "eph/1", Value: "v"},
+        {Type: watch.Set, Key: "eph/2", Value: "v"},
+        {Type: watch.Delete, Key: "eph/2"},
+        {Type: watch.Expire, Key: "eph/1"},
+    } {
+        ev := watch.Event{}
+        if typ := s.next(t, &ev); typ != want.Type || ev.Type != want.Type || ev.Key != want.Key || ev.Value != want.Value {
+            t.Fatalf("event: %s %+v, want %+v", typ, ev, want)
+        }
+    }
+}